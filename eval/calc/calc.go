@@ -0,0 +1,371 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+// Package calc provides spreadsheet-like cells whose formulas are evaluated with an eval.Evaluator and which are
+// recalculated incrementally as their inputs change.
+package calc
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ddkwork/toolbox/collection"
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/eval"
+)
+
+// CycleError is returned when a formula would cause a cell to depend upon itself.
+type CycleError struct {
+	// Names holds the names of the cells that form the cycle, in dependency order. The first name is repeated at the
+	// end.
+	Names []string
+}
+
+// Error implements the error interface.
+func (e *CycleError) Error() string {
+	return "cycle detected: " + strings.Join(e.Names, " -> ")
+}
+
+// Sheet holds a set of named cells, each of which has either a formula or a fixed value. Formulas refer to other cells
+// as variables, e.g. "$a + $b". A Sheet tracks the dependencies between its cells and only recalculates those whose
+// inputs have changed. A Sheet is not safe for concurrent use.
+type Sheet struct {
+	evaluator  *eval.Evaluator
+	cells      map[string]*cell
+	dependents map[string]collection.Set[string]
+	dirty      collection.Set[string]
+}
+
+type cell struct {
+	formula string
+	program *eval.Program
+	deps    collection.Set[string]
+	value   any
+	err     error
+}
+
+// New creates a new, empty Sheet that compiles formulas with the evaluator. Variables that do not name a cell in the
+// Sheet are passed to the evaluator's Resolver, if it has one.
+func New(evaluator *eval.Evaluator) *Sheet {
+	return &Sheet{
+		evaluator:  evaluator,
+		cells:      make(map[string]*cell),
+		dependents: make(map[string]collection.Set[string]),
+		dirty:      collection.NewSet[string](),
+	}
+}
+
+// Set the formula for the named cell. The formula is compiled immediately, so syntax errors are returned here. If the
+// formula would create a cycle, a *CycleError is returned and the cell is left unchanged. The cell and everything that
+// depends on it will be recalculated on the next call to Recalculate() or Value().
+func (s *Sheet) Set(name, formula string) error {
+	program, err := s.evaluator.Compile(formula)
+	if err != nil {
+		return err
+	}
+	deps := collection.NewSet(program.Variables()...)
+	if path := s.pathTo(deps, name); path != nil {
+		return &CycleError{Names: append([]string{name}, path...)}
+	}
+	s.replace(name, &cell{
+		formula: formula,
+		program: program,
+		deps:    deps,
+	})
+	return nil
+}
+
+// SetValue sets a fixed value for the named cell, replacing any formula it had.
+func (s *Sheet) SetValue(name string, value any) {
+	s.replace(name, &cell{
+		deps:  collection.NewSet[string](),
+		value: value,
+	})
+}
+
+// Remove the named cell. Cells that depend on it will be recalculated, resolving the name through the evaluator's
+// Resolver instead.
+func (s *Sheet) Remove(name string) {
+	c, exists := s.cells[name]
+	if !exists {
+		return
+	}
+	s.unlink(name, c)
+	delete(s.cells, name)
+	delete(s.dirty, name)
+	s.dirty.Add(s.Dependents(name)...)
+}
+
+// Names returns the names of the cells in the Sheet, sorted.
+func (s *Sheet) Names() []string {
+	names := make([]string, 0, len(s.cells))
+	for name := range s.cells {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Formula returns the formula of the named cell, or an empty string if it has a fixed value or does not exist.
+func (s *Sheet) Formula(name string) string {
+	if c, exists := s.cells[name]; exists {
+		return c.formula
+	}
+	return ""
+}
+
+// Dependencies returns the names the named cell's formula refers to, sorted.
+func (s *Sheet) Dependencies(name string) []string {
+	c, exists := s.cells[name]
+	if !exists {
+		return nil
+	}
+	deps := c.deps.Values()
+	slices.Sort(deps)
+	return deps
+}
+
+// Dependents returns the names of the cells whose formulas refer directly to the named cell, sorted.
+func (s *Sheet) Dependents(name string) []string {
+	dependents := s.dependents[name].Values()
+	slices.Sort(dependents)
+	return dependents
+}
+
+// Value returns the value of the named cell, recalculating the Sheet first if needed. An error is returned if the cell
+// does not exist or its formula could not be evaluated.
+func (s *Sheet) Value(name string) (any, error) {
+	c, exists := s.cells[name]
+	if !exists {
+		return nil, errs.Newf("no such cell: %s", name)
+	}
+	if !s.dirty.Empty() {
+		s.Recalculate()
+		c = s.cells[name]
+	}
+	return c.value, c.err
+}
+
+// Recalculate brings the Sheet up-to-date, evaluating the cells that have changed since the last recalculation along
+// with any cells whose inputs changed as a result. Cells are evaluated in dependency order, with ties broken by name.
+// Returns the names of the cells that were evaluated, in the order they were evaluated. A cell whose formula fails to
+// evaluate holds the error, which is also reported by the cells that depend on it.
+func (s *Sheet) Recalculate() []string {
+	if s.dirty.Empty() {
+		return nil
+	}
+	// Gather every cell that might be affected by the dirty cells.
+	affected := collection.NewSet[string]()
+	pending := s.dirty.Values()
+	for len(pending) != 0 {
+		name := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if affected.Contains(name) {
+			continue
+		}
+		if _, exists := s.cells[name]; exists {
+			affected.Add(name)
+		}
+		pending = append(pending, s.dependents[name].Values()...)
+	}
+	// Count the unresolved inputs of each affected cell, so that they can be visited in topological order.
+	inputs := make(map[string]int, len(affected))
+	var ready []string
+	for name := range affected {
+		count := 0
+		for dep := range s.cells[name].deps {
+			if affected.Contains(dep) {
+				count++
+			}
+		}
+		inputs[name] = count
+		if count == 0 {
+			ready = append(ready, name)
+		}
+	}
+	changed := collection.NewSet[string]()
+	var evaluated []string
+	for len(ready) != 0 {
+		slices.Sort(ready)
+		name := ready[0]
+		ready = ready[1:]
+		c := s.cells[name]
+		if s.dirty.Contains(name) || s.anyChanged(c.deps, changed) {
+			evaluated = append(evaluated, name)
+			if s.evaluate(name, c) {
+				changed.Add(name)
+			}
+		}
+		for dependent := range s.dependents[name] {
+			if affected.Contains(dependent) {
+				if inputs[dependent]--; inputs[dependent] == 0 {
+					ready = append(ready, dependent)
+				}
+			}
+		}
+	}
+	s.dirty.Clear()
+	return evaluated
+}
+
+// evaluate the cell, returning true if its value or error changed.
+func (s *Sheet) evaluate(name string, c *cell) bool {
+	if c.program == nil {
+		// A fixed value is only marked dirty when it has been changed.
+		return true
+	}
+	oldValue := c.value
+	oldErr := c.err
+	c.value = nil
+	c.err = nil
+	for _, dep := range s.Dependencies(name) {
+		if other, exists := s.cells[dep]; exists && other.err != nil {
+			c.err = errs.Newf("depends on %q, which has an error", dep)
+			break
+		}
+	}
+	if c.err == nil {
+		c.value, c.err = c.program.Eval(&resolver{sheet: s})
+	}
+	if (oldErr == nil) != (c.err == nil) || (oldErr != nil && oldErr.Error() != c.err.Error()) {
+		return true
+	}
+	return !equal(oldValue, c.value)
+}
+
+func (s *Sheet) anyChanged(deps, changed collection.Set[string]) bool {
+	for dep := range deps {
+		if changed.Contains(dep) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Sheet) replace(name string, c *cell) {
+	if old, exists := s.cells[name]; exists {
+		s.unlink(name, old)
+		if c.program != nil {
+			c.value = old.value
+			c.err = old.err
+		} else if old.program == nil && equal(old.value, c.value) {
+			s.cells[name] = c
+			return
+		}
+	} else {
+		// Cells that referred to this name before it existed were resolved elsewhere.
+		s.dirty.Add(s.Dependents(name)...)
+	}
+	s.cells[name] = c
+	for dep := range c.deps {
+		dependents, exists := s.dependents[dep]
+		if !exists {
+			dependents = collection.NewSet[string]()
+			s.dependents[dep] = dependents
+		}
+		dependents.Add(name)
+	}
+	s.dirty.Add(name)
+}
+
+func (s *Sheet) unlink(name string, c *cell) {
+	for dep := range c.deps {
+		if dependents, exists := s.dependents[dep]; exists {
+			delete(dependents, name)
+			if dependents.Empty() {
+				delete(s.dependents, dep)
+			}
+		}
+	}
+}
+
+// pathTo returns the chain of names leading from one of the starting names to target by following cell
+// dependencies, or nil if target cannot be reached.
+func (s *Sheet) pathTo(start collection.Set[string], target string) []string {
+	visited := collection.NewSet[string]()
+	var walk func(name string) []string
+	walk = func(name string) []string {
+		if name == target {
+			return []string{name}
+		}
+		if visited.Contains(name) {
+			return nil
+		}
+		visited.Add(name)
+		c, exists := s.cells[name]
+		if !exists {
+			return nil
+		}
+		for _, dep := range s.sorted(c.deps) {
+			if path := walk(dep); path != nil {
+				return append([]string{name}, path...)
+			}
+		}
+		return nil
+	}
+	for _, name := range s.sorted(start) {
+		if path := walk(name); path != nil {
+			return path
+		}
+	}
+	return nil
+}
+
+func (s *Sheet) sorted(set collection.Set[string]) []string {
+	values := set.Values()
+	slices.Sort(values)
+	return values
+}
+
+type resolver struct {
+	sheet *Sheet
+}
+
+// ResolveValue implements eval.ValueResolver.
+func (r *resolver) ResolveValue(variableName string) (any, bool) {
+	if c, exists := r.sheet.cells[variableName]; exists {
+		return c.value, true
+	}
+	if other, ok := r.sheet.evaluator.Resolver.(eval.ValueResolver); ok {
+		return other.ResolveValue(variableName)
+	}
+	return nil, false
+}
+
+// ResolveVariable implements eval.VariableResolver.
+func (r *resolver) ResolveVariable(variableName string) string {
+	if c, exists := r.sheet.cells[variableName]; exists {
+		switch v := c.value.(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		case time.Time:
+			return v.Format(time.RFC3339Nano)
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	if r.sheet.evaluator.Resolver != nil {
+		return r.sheet.evaluator.Resolver.ResolveVariable(variableName)
+	}
+	return ""
+}
+
+func equal(left, right any) (same bool) {
+	defer func() {
+		if recover() != nil {
+			// Values that are not comparable, such as lists, are compared by their text.
+			same = fmt.Sprint(left) == fmt.Sprint(right)
+		}
+	}()
+	return left == right
+}
@@ -0,0 +1,141 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package calc_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/eval"
+	"github.com/ddkwork/toolbox/eval/calc"
+	"github.com/ddkwork/toolbox/xmath/fixed"
+	"github.com/ddkwork/toolbox/xmath/fixed/f64"
+)
+
+type mapResolver map[string]string
+
+func (m mapResolver) ResolveVariable(variableName string) string {
+	return m[variableName]
+}
+
+func TestIncremental(t *testing.T) {
+	s := calc.New(eval.NewFloatEvaluator[float64](mapResolver{"rate": "2"}, true))
+	s.SetValue("a", 1.0)
+	s.SetValue("b", 2.0)
+	check.NoError(t, s.Set("sum", "$a + $b"))
+	check.NoError(t, s.Set("total", "$sum * $rate"))
+	check.NoError(t, s.Set("other", "$b * 10"))
+	check.Equal(t, []string{"a", "b", "other", "sum", "total"}, s.Recalculate())
+	checkValue(t, s, "total", 6.0)
+	check.Equal(t, []string{"a", "b"}, s.Dependencies("sum"))
+	check.Equal(t, []string{"other", "sum"}, s.Dependents("b"))
+
+	// Only cells downstream of the change are evaluated, in dependency order.
+	s.SetValue("a", 5.0)
+	check.Equal(t, []string{"a", "sum", "total"}, s.Recalculate())
+	checkValue(t, s, "total", 14.0)
+	check.Equal(t, 0, len(s.Recalculate()))
+
+	// Changes that do not alter a cell's value stop there.
+	check.NoError(t, s.Set("sum", "$b + $a"))
+	check.Equal(t, []string{"sum"}, s.Recalculate())
+
+	// Value() recalculates on demand.
+	s.SetValue("b", 0.0)
+	checkValue(t, s, "other", 0.0)
+	checkValue(t, s, "total", 10.0)
+}
+
+func TestFixedValues(t *testing.T) {
+	s := calc.New(eval.NewFixedEvaluator[fixed.D4](nil, true))
+	s.SetValue("price", f64.From[fixed.D4](1.25))
+	check.NoError(t, s.Set("qty", "3"))
+	check.NoError(t, s.Set("cost", "$price * $qty"))
+	check.NoError(t, s.Set("label", `"cost: " + $cost`))
+	checkValue(t, s, "cost", f64.From[fixed.D4](3.75))
+	checkValue(t, s, "label", "cost: 3.75")
+}
+
+func TestParameterNamedLikeCell(t *testing.T) {
+	// A function parameter with the same name as a cell does not hide references to that cell.
+	s := calc.New(eval.NewFloatEvaluator[float64](nil, true))
+	check.NoError(t, s.Set("a", "1"))
+	check.NoError(t, s.Set("b", "let f(a) = a * 2; f($a)"))
+	checkValue(t, s, "b", 2.0)
+	check.Equal(t, []string{"a"}, s.Dependencies("b"))
+	check.NoError(t, s.Set("a", "5"))
+	checkValue(t, s, "b", 10.0)
+
+	err := s.Set("c", "let f(c) = c; f($c)")
+	var cycle *calc.CycleError
+	check.True(t, errors.As(err, &cycle))
+	check.Equal(t, []string{"c", "c"}, cycle.Names)
+}
+
+func TestCycles(t *testing.T) {
+	s := calc.New(eval.NewFloatEvaluator[float64](nil, true))
+	check.NoError(t, s.Set("a", "$b + 1"))
+	check.NoError(t, s.Set("b", "$c + 1"))
+	check.NoError(t, s.Set("c", "1"))
+	err := s.Set("c", "$a + 1")
+	var cycle *calc.CycleError
+	check.True(t, errors.As(err, &cycle))
+	check.Equal(t, []string{"c", "a", "b", "c"}, cycle.Names)
+	check.Equal(t, "cycle detected: c -> a -> b -> c", err.Error())
+	check.Equal(t, "1", s.Formula("c"))
+	checkValue(t, s, "a", 3.0)
+
+	check.Error(t, s.Set("d", "$d * 2"))
+	_, err = s.Value("d")
+	check.Error(t, err)
+}
+
+func TestErrors(t *testing.T) {
+	s := calc.New(eval.NewFloatEvaluator[float64](nil, false))
+	s.SetValue("x", 0.0)
+	check.NoError(t, s.Set("y", "1 / $x"))
+	check.NoError(t, s.Set("z", "$y + 1"))
+	_, err := s.Value("y")
+	check.Error(t, err)
+	_, err = s.Value("z")
+	check.Error(t, err)
+	check.Contains(t, err.Error(), `"y"`)
+
+	s.SetValue("x", 4.0)
+	checkValue(t, s, "z", 1.25)
+
+	check.Error(t, s.Set("bad", "(1 + "))
+	check.Equal(t, []string{"x", "y", "z"}, s.Names())
+}
+
+func TestRemove(t *testing.T) {
+	s := calc.New(eval.NewFloatEvaluator[float64](mapResolver{"a": "100"}, true))
+	check.NoError(t, s.Set("b", "$a + 1"))
+	s.SetValue("a", 1.0)
+	checkValue(t, s, "b", 2.0)
+	s.Remove("a")
+	checkValue(t, s, "b", 101.0)
+	s.SetValue("a", 7.0)
+	checkValue(t, s, "b", 8.0)
+	check.Equal(t, []string{"b"}, s.Dependents("a"))
+	s.Remove("b")
+	check.Equal(t, 0, len(s.Dependents("a")))
+	_, err := s.Value("b")
+	check.Error(t, err)
+}
+
+func checkValue(t *testing.T, s *calc.Sheet, name string, expected any) {
+	t.Helper()
+	value, err := s.Value(name)
+	check.NoError(t, err, name)
+	check.Equal(t, fmt.Sprint(expected), fmt.Sprint(value), name)
+}
@@ -0,0 +1,169 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	_ error = &SyntaxError{}
+	_ error = &EvalError{}
+)
+
+// SyntaxError is returned when an expression cannot be parsed. Offset is the byte offset of the problem within the
+// Expression, while Line and Column provide the same location in a 1-based, human-friendly form, with Column counted in
+// runes. Token holds the offending text, if any, and Expected describes what the parser was looking for, if known.
+type SyntaxError struct {
+	Expression string
+	Message    string
+	Token      string
+	Expected   string
+	Offset     int
+	Line       int
+	Column     int
+}
+
+func newSyntaxError(expression string, offset int, token, expected, msg string) *SyntaxError {
+	line, column := lineColumn(expression, offset)
+	return &SyntaxError{
+		Expression: expression,
+		Message:    msg,
+		Token:      token,
+		Expected:   expected,
+		Offset:     offset,
+		Line:       line,
+		Column:     column,
+	}
+}
+
+// Error implements the error interface.
+func (s *SyntaxError) Error() string {
+	var buffer strings.Builder
+	fmt.Fprintf(&buffer, "%s at line %d, column %d", s.Message, s.Line, s.Column)
+	if s.Token != "" {
+		fmt.Fprintf(&buffer, " near %q", s.Token)
+	}
+	if s.Expected != "" {
+		fmt.Fprintf(&buffer, "; expected %s", s.Expected)
+	}
+	return buffer.String()
+}
+
+// rebase returns a copy of this error relocated to a larger expression which contains this error's expression at the
+// given offset.
+func (s *SyntaxError) rebase(expression string, offset int) *SyntaxError {
+	return newSyntaxError(expression, s.Offset+offset, s.Token, s.Expected, s.Message)
+}
+
+// EvalError is returned when an error occurs while evaluating an expression. Start and End are the byte offsets of the
+// sub-expression within the Expression that produced the error, while Line and Column provide the location of Start in
+// a 1-based, human-friendly form, with Column counted in runes.
+type EvalError struct {
+	Err        error
+	Expression string
+	Start      int
+	End        int
+	Line       int
+	Column     int
+}
+
+func newEvalError(expression string, start, end int, err error) *EvalError {
+	line, column := lineColumn(expression, start)
+	return &EvalError{
+		Err:        err,
+		Expression: expression,
+		Start:      start,
+		End:        end,
+		Line:       line,
+		Column:     column,
+	}
+}
+
+// Error implements the error interface.
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("%s in %q at line %d, column %d", e.message(), e.Text(), e.Line, e.Column)
+}
+
+// Unwrap returns the underlying error.
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// Text returns the sub-expression that produced the error.
+func (e *EvalError) Text() string {
+	if e.Start < 0 || e.End > len(e.Expression) || e.Start > e.End {
+		return ""
+	}
+	return e.Expression[e.Start:e.End]
+}
+
+func (e *EvalError) message() string {
+	var msgErr interface{ Message() string }
+	if errors.As(e.Err, &msgErr) {
+		return msgErr.Message()
+	}
+	return e.Err.Error()
+}
+
+// spanError tags an error produced by the sub-expression that lies between start and end. Errors that have already
+// been tagged by a deeper sub-expression of this evaluator's expression are returned as-is.
+func (e *Evaluator) spanError(err error, start, end int) error {
+	if err == nil {
+		return nil
+	}
+	var evalErr *EvalError
+	if errors.As(err, &evalErr) && evalErr.Expression == e.expression {
+		return err
+	}
+	var syntaxErr *SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Expression == e.expression {
+		return err
+	}
+	return newEvalError(e.expression, start, end, err)
+}
+
+// nestedError relocates an error produced while evaluating text, which was found at offset within this evaluator's
+// expression. If the offset is negative or the error cannot be relocated, it is tagged with the span between start and
+// end instead.
+func (e *Evaluator) nestedError(err error, text string, offset, start, end int) error {
+	var evalErr *EvalError
+	var syntaxErr *SyntaxError
+	switch {
+	case errors.As(err, &evalErr):
+		if evalErr.Expression == e.expression {
+			return err
+		}
+		if offset >= 0 && evalErr.Expression == text {
+			return newEvalError(e.expression, evalErr.Start+offset, evalErr.End+offset, evalErr.Err)
+		}
+		return newEvalError(e.expression, start, end, evalErr.Err)
+	case errors.As(err, &syntaxErr):
+		if syntaxErr.Expression == e.expression {
+			return err
+		}
+		if offset >= 0 && syntaxErr.Expression == text {
+			return syntaxErr.rebase(e.expression, offset)
+		}
+		return newSyntaxError(e.expression, start, syntaxErr.Token, syntaxErr.Expected, syntaxErr.Message)
+	default:
+		return e.spanError(err, start, end)
+	}
+}
+
+func lineColumn(expression string, offset int) (line, column int) {
+	offset = max(min(offset, len(expression)), 0)
+	line = 1 + strings.Count(expression[:offset], "\n")
+	lineStart := strings.LastIndexByte(expression[:offset], '\n') + 1
+	return line, 1 + utf8.RuneCountInString(expression[lineStart:offset])
+}
@@ -0,0 +1,134 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/eval"
+)
+
+func TestSyntaxErrors(t *testing.T) {
+	e := eval.NewFloatEvaluator[float64](nil, false)
+	for _, one := range []struct {
+		expr     string
+		token    string
+		expected string
+		offset   int
+		line     int
+		column   int
+	}{
+		{expr: "1 + (2 * 3", token: "(", expected: ")", offset: 4, line: 1, column: 5},
+		{expr: "1 + 2)", token: ")", offset: 5, line: 1, column: 6},
+		{expr: "1 +\n  foo(2)", token: "foo", expected: "function name", offset: 6, line: 2, column: 3},
+		{expr: `"é" + "abc`, token: `"abc`, expected: `"`, offset: 7, line: 1, column: 7},
+		{expr: "[1, 2", token: "[", expected: "]", offset: 0, line: 1, column: 1},
+		{expr: "max(1, [2)", token: "[", expected: "]", offset: 7, line: 1, column: 8},
+	} {
+		_, err := e.Compile(one.expr)
+		checkSyntaxError(t, err, one.expr, one.token, one.expected, one.offset, one.line, one.column)
+		if one.expr != "max(1, [2)" { // Function arguments aren't parsed until they are evaluated by Evaluate()
+			_, err = e.Evaluate(one.expr)
+			checkSyntaxError(t, err, one.expr, one.token, one.expected, one.offset, one.line, one.column)
+		}
+	}
+}
+
+func checkSyntaxError(t *testing.T, err error, expr, token, expected string, offset, line, column int) {
+	t.Helper()
+	var syntaxErr *eval.SyntaxError
+	check.True(t, errors.As(err, &syntaxErr), "%s: %v", expr, err)
+	if syntaxErr != nil {
+		check.Equal(t, expr, syntaxErr.Expression, expr)
+		check.Equal(t, token, syntaxErr.Token, expr)
+		check.Equal(t, expected, syntaxErr.Expected, expr)
+		check.Equal(t, offset, syntaxErr.Offset, expr)
+		check.Equal(t, line, syntaxErr.Line, expr)
+		check.Equal(t, column, syntaxErr.Column, expr)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	e := eval.NewFloatEvaluator[float64](mapResolver{"a": "1"}, false)
+	for _, one := range []struct {
+		expr string
+		text string
+		line int
+	}{
+		{expr: "1 + 10 / ($a - 1)", text: "10 / ($a - 1)", line: 1},
+		{expr: "max(1, 2 / 0)", text: "2 / 0", line: 1},
+		{expr: "1 +\n $missing", text: "$missing", line: 2},
+		{expr: `[1, 2][5] + 1`, text: "[1, 2][5]", line: 1},
+		{expr: `[1, 2 % 0]`, text: "2 % 0", line: 1},
+		{expr: `sqrt("abc")`, text: `sqrt("abc")`, line: 1},
+	} {
+		_, err := e.Evaluate(one.expr)
+		checkEvalError(t, err, one.expr, one.text, one.line)
+		var p *eval.Program
+		p, err = e.Compile(one.expr)
+		check.NoError(t, err, one.expr)
+		_, err = p.Eval(mapResolver{"a": "1"})
+		checkEvalError(t, err, one.expr, one.text, one.line)
+	}
+}
+
+func TestEvalErrorInFunctionArgument(t *testing.T) {
+	e := eval.NewFloatEvaluator[float64](mapResolver{"a": "2"}, false)
+	for _, one := range []struct {
+		expr        string
+		text        string
+		start       int
+		substituted bool
+	}{
+		// The text of the failing argument also appears earlier in the call, so it can only be located by its index.
+		{expr: `contains("2 / 0",2 / 0)`, text: "2 / 0", start: 17},
+		{expr: `max($a / 1,$a / 1,2 / 0)`, text: "2 / 0", start: 18},
+		{expr: `max(1 / 0,1 / 0)`, text: "1 / 0", start: 4},
+		{expr: `len(1 / 0)`, text: "1 / 0", start: 4},
+		// The arguments of if() are not evaluated in order.
+		{expr: `if(0,1 / 0,1 / 0)`, text: "1 / 0", start: 11},
+		{expr: `if(1,1 / 0,1 / 0)`, text: "1 / 0", start: 5},
+		// Arguments whose variables have been substituted can't be located within the call by Evaluate().
+		{expr: `max(1,$a / 0)`, text: "max(1,$a / 0)", start: 0, substituted: true},
+	} {
+		_, err := e.Evaluate(one.expr)
+		checkEvalErrorStart(t, err, one.expr, one.text, one.start)
+		if !one.substituted {
+			var p *eval.Program
+			p, err = e.Compile(one.expr)
+			check.NoError(t, err, one.expr)
+			_, err = p.Eval(mapResolver{"a": "2"})
+			checkEvalErrorStart(t, err, one.expr, one.text, one.start)
+		}
+	}
+}
+
+func checkEvalErrorStart(t *testing.T, err error, expr, text string, start int) {
+	t.Helper()
+	checkEvalError(t, err, expr, text, 1)
+	var evalErr *eval.EvalError
+	if errors.As(err, &evalErr) {
+		check.Equal(t, start, evalErr.Start, expr)
+	}
+}
+
+func checkEvalError(t *testing.T, err error, expr, text string, line int) {
+	t.Helper()
+	var evalErr *eval.EvalError
+	check.True(t, errors.As(err, &evalErr), "%s: %v", expr, err)
+	if evalErr != nil {
+		check.Equal(t, expr, evalErr.Expression, expr)
+		check.Equal(t, text, evalErr.Text(), expr)
+		check.Equal(t, line, evalErr.Line, expr)
+		check.Contains(t, evalErr.Error(), "at line", expr)
+	}
+}
@@ -10,6 +10,7 @@
 package eval
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/ddkwork/toolbox/errs"
@@ -20,17 +21,59 @@ type VariableResolver interface {
 	ResolveVariable(variableName string) string
 }
 
+// ValueResolver may optionally be implemented by a VariableResolver to supply the values of variables directly, rather
+// than as text to be substituted into the expression. It is only consulted for operands that consist solely of a
+// variable reference, such as "$name"; the variable's text from ResolveVariable() is used everywhere else. The second
+// return value should be false if the variable is not known.
+type ValueResolver interface {
+	ResolveValue(variableName string) (any, bool)
+}
+
+// span holds the byte offsets of a portion of an expression.
+type span struct {
+	start int
+	end   int
+}
+
+func (s span) location() span {
+	return s
+}
+
+func (s *span) widen(start, end int) {
+	s.start = min(s.start, start)
+	s.end = max(s.end, end)
+}
+
 type expressionOperand struct {
+	span
 	value   string
 	unaryOp *Operator
+	quoted  bool
+}
+
+type expressionList struct {
+	span
+	elements []string
+	offsets  []int
+	unaryOp  *Operator
+}
+
+type expressionIndex struct {
+	span
+	target  any
+	index   string
+	offset  int
+	unaryOp *Operator
 }
 
 type expressionOperator struct {
 	op      *Operator
 	unaryOp *Operator
+	index   int
 }
 
 type expressionTree struct {
+	span
 	evaluator *Evaluator
 	left      any
 	right     any
@@ -42,24 +85,98 @@ type expressionTree struct {
 type Function func(evaluator *Evaluator, arguments string) (any, error)
 
 type parsedFunction struct {
-	function Function
-	args     string
-	unaryOp  *Operator
+	span
+	name      string
+	function  Function
+	args      string
+	argsStart int
+	unaryOp   *Operator
+}
+
+// functionCall holds the arguments of the function being called, so that each may be evaluated by its index. The
+// offsets record where the arguments lie within the expression, so that errors found while evaluating them can be
+// located. Arguments whose text was changed by the substitution of variables have an offset of -1. When the call is
+// part of a Program, nodes holds the compiled form of each argument.
+type functionCall struct {
+	arguments string
+	args      []string
+	offsets   []int
+	nodes     []Node
+	start     int
+}
+
+func newFunctionCall(arguments, original string, start int) *functionCall {
+	c := &functionCall{
+		arguments: arguments,
+		start:     start,
+	}
+	if arguments != original {
+		c.start = -1
+	}
+	offset := start
+	for remaining := arguments; remaining != ""; {
+		var arg, originalArg string
+		arg, remaining = NextArg(remaining)
+		before := len(original)
+		originalArg, original = NextArg(original)
+		c.args = append(c.args, arg)
+		if arg == originalArg {
+			c.offsets = append(c.offsets, offset)
+		} else {
+			c.offsets = append(c.offsets, -1)
+		}
+		offset += before - len(original)
+	}
+	return c
 }
 
 // Evaluator is used to evaluate an expression. If you do not have any variables that will be resolved, you can leave
 // Resolver unset. StdOperators() and StdFunctions() can be used to populate the Operators and Functions fields.
+// MaxDepth limits the nesting of calls to user-defined functions; if it is zero, DefaultMaxDepth is used.
 type Evaluator struct {
 	Resolver      VariableResolver
 	Operators     []*Operator
 	Functions     map[string]Function
+	MaxDepth      int
+	compiled      map[string]Node
+	defined       map[string]Function
+	scope         *scope
+	call          *functionCall
+	depth         int
+	source        string
+	expression    string
 	operandStack  []any
 	operatorStack []*expressionOperator
 }
 
-// Evaluate an expression.
+// Evaluate an expression. Problems found while parsing the expression are returned as a *SyntaxError, while problems
+// found while evaluating it are returned as an *EvalError.
+//
+// An expression may consist of several statements separated by semicolons, in which case its value is that of the last
+// statement. A statement of the form "let name = expression" binds the value of the expression to name for use by the
+// statements that follow it, while one of the form "let name(param1, param2) = expression" defines a function. Bound
+// names may be referred to either by their bare name or as a variable, i.e. "name" or "$name". Parameters may only be
+// referred to by their bare name, so "$name" always refers to a variable, even within the body of a function with a
+// parameter of the same name. Functions defined this way remain available to later calls on this Evaluator and may call
+// themselves or each other, but their bodies can only see their own parameters, not the bindings of the statements
+// around them.
 func (e *Evaluator) Evaluate(expression string) (any, error) {
-	if err := e.parse(expression); err != nil {
+	v, err := e.evaluate(expression)
+	if err != nil {
+		return nil, err
+	}
+	return exportValue(v), nil
+}
+
+func (e *Evaluator) evaluate(expression string) (any, error) {
+	statements, err := parseStatements(expression)
+	if err != nil {
+		return nil, err
+	}
+	if statements != nil {
+		return e.evaluateStatements(expression, statements)
+	}
+	if err = e.parse(expression); err != nil {
 		return nil, err
 	}
 	for len(e.operatorStack) != 0 {
@@ -72,19 +189,78 @@ func (e *Evaluator) Evaluate(expression string) (any, error) {
 }
 
 // EvaluateNew reuses the Resolver, Operators, and Functions from this Evaluator to create a new Evaluator and then
-// resolves an expression with it.
+// resolves an expression with it. When called while running a Program, expressions that were compiled along with the
+// Program are not parsed again.
 func (e *Evaluator) EvaluateNew(expression string) (any, error) {
-	other := Evaluator{
+	v, err := e.evaluateNew(expression)
+	if err != nil {
+		return nil, err
+	}
+	return exportValue(v), nil
+}
+
+// evaluateNew is the same as EvaluateNew, but leaves the text of operands as is, so that the result may be used as an
+// operand itself.
+func (e *Evaluator) evaluateNew(expression string) (any, error) {
+	other := e.derive()
+	if node, ok := e.compiled[expression]; ok {
+		// Compiled nodes carry locations within the Program's expression.
+		other.expression = e.source
+		return other.evaluateProgram(node)
+	}
+	return other.evaluate(expression)
+}
+
+// evaluateArg evaluates arg, the argument found at index within the arguments of the function being called. An index
+// of -1 refers to the entire argument string. Errors are located at the argument within this evaluator's expression
+// when its position is known.
+func (e *Evaluator) evaluateArg(arg string, index int) (any, error) {
+	c := e.call
+	if c == nil {
+		return e.evaluateNew(arg)
+	}
+	offset := c.start
+	if index == -1 {
+		if arg != c.arguments {
+			return e.evaluateNew(arg)
+		}
+	} else {
+		if index < 0 || index >= len(c.args) || arg != c.args[index] {
+			return e.evaluateNew(arg)
+		}
+		if c.nodes != nil {
+			other := e.derive()
+			other.expression = e.source
+			return other.evaluateProgram(c.nodes[index])
+		}
+		offset = c.offsets[index]
+	}
+	v, err := e.evaluateNew(arg)
+	if err != nil && offset != -1 {
+		err = e.nestedError(err, arg, offset, offset, offset+len(arg))
+	}
+	return v, err
+}
+
+// derive returns a new Evaluator that shares this Evaluator's configuration, definitions, and local bindings.
+func (e *Evaluator) derive() *Evaluator {
+	return &Evaluator{
 		Resolver:  e.Resolver,
 		Operators: e.Operators,
 		Functions: e.Functions,
+		MaxDepth:  e.MaxDepth,
+		compiled:  e.compiled,
+		defined:   e.defined,
+		scope:     e.scope,
+		depth:     e.depth,
+		source:    e.source,
 	}
-	return other.Evaluate(expression)
 }
 
 func (e *Evaluator) parse(expression string) error {
 	var unaryOp *Operator
 	haveOperand := false
+	e.expression = expression
 	e.operandStack = nil
 	e.operatorStack = nil
 	i := 0
@@ -94,6 +270,15 @@ func (e *Evaluator) parse(expression string) error {
 			i++
 			continue
 		}
+		if ch == '"' || ch == '[' {
+			var err error
+			if i, err = e.processLiteral(expression, i, haveOperand, unaryOp); err != nil {
+				return err
+			}
+			haveOperand = true
+			unaryOp = nil
+			continue
+		}
 		opIndex, op := e.nextOperator(expression, i, nil)
 		if opIndex > i || opIndex == -1 {
 			var err error
@@ -104,79 +289,223 @@ func (e *Evaluator) parse(expression string) error {
 			unaryOp = nil
 		}
 		if opIndex == i {
-			if op != nil && op.EvaluateUnary != nil && i == 0 {
+			if op != nil && op.EvaluateUnary != nil && !haveOperand {
 				i = opIndex + len(op.Symbol)
 				if unaryOp != nil {
-					return errs.Newf("consecutive unary operators are not allowed at index %d", i)
+					return newSyntaxError(expression, opIndex, op.Symbol, "operand",
+						"consecutive unary operators are not allowed")
 				}
 				unaryOp = op
+				haveOperand = false
 			} else {
 				var err error
-				if i, err = e.processOperator(expression, opIndex, op, haveOperand, unaryOp); err != nil {
+				if i, op, err = e.processOperator(expression, opIndex, op, haveOperand, unaryOp); err != nil {
 					return err
 				}
 				unaryOp = nil
-			}
-			if op == nil || op.Symbol != ")" {
-				haveOperand = false
+				// A function call that ends the expression leaves no operator behind.
+				haveOperand = op == nil || op.Symbol == ")"
 			}
 		}
 	}
+	for _, one := range e.operatorStack {
+		if one.op.Symbol == "(" {
+			return newSyntaxError(expression, one.index, "(", ")", "parenthesis not closed")
+		}
+	}
 	return nil
 }
 
 func (e *Evaluator) nextOperator(expression string, start int, match *Operator) (int, *Operator) {
 	for i := start; i < len(expression); i++ {
+		switch expression[i] {
+		case '"':
+			i = quotedEnd(expression, i)
+			continue
+		case '[':
+			if end := bracketEnd(expression, i); end != -1 {
+				i = end
+				continue
+			}
+		default:
+		}
 		if match != nil {
 			if match.match(expression, i, len(expression)) {
 				return i, match
 			}
 		} else {
+			// Prefer the longest matching symbol, so that ">=" is not mistaken for ">" followed by "=".
+			var found *Operator
 			for _, op := range e.Operators {
-				if op.match(expression, i, len(expression)) {
-					return i, op
+				if op.match(expression, i, len(expression)) && (found == nil || len(op.Symbol) > len(found.Symbol)) {
+					found = op
 				}
 			}
+			if found != nil {
+				return i, found
+			}
 		}
 	}
 	return -1, nil
 }
 
 func (e *Evaluator) processOperand(expression string, start, opIndex int, unaryOp *Operator) (int, error) {
+	end := opIndex
 	if opIndex == -1 {
-		text := strings.TrimSpace(expression[start:])
-		if text == "" {
-			return -1, errs.Newf("expression is invalid at index %d", start)
-		}
-		e.operandStack = append(e.operandStack, &expressionOperand{
-			value:   text,
-			unaryOp: unaryOp,
-		})
-		return len(expression), nil
+		end = len(expression)
 	}
-	text := strings.TrimSpace(expression[start:opIndex])
+	text := strings.TrimSpace(expression[start:end])
 	if text == "" {
-		return -1, errs.Newf("expression is invalid at index %d", start)
+		return -1, newSyntaxError(expression, start, "", "operand", "missing operand")
+	}
+	e.pushOperand(text, start+strings.Index(expression[start:end], text), unaryOp)
+	return end, nil
+}
+
+func (e *Evaluator) pushOperand(text string, start int, unaryOp *Operator) {
+	// Any trailing [index] suffixes are split off and applied to the operand in order.
+	type suffix struct {
+		index  string
+		offset int
+		end    int
+	}
+	var indexes []suffix
+	if i := strings.IndexByte(text, '['); i > 0 {
+		for i < len(text) && text[i] == '[' {
+			end := bracketEnd(text, i)
+			if end == -1 {
+				break
+			}
+			indexes = append(indexes, suffix{
+				index:  text[i+1 : end],
+				offset: start + i + 1,
+				end:    start + end + 1,
+			})
+			for i = end + 1; i < len(text) && isSpace(text[i]); i++ {
+			}
+		}
+		text = strings.TrimSpace(text[:strings.IndexByte(text, '[')])
 	}
 	e.operandStack = append(e.operandStack, &expressionOperand{
+		span:    span{start: start, end: start + len(text)},
 		value:   text,
 		unaryOp: unaryOp,
 	})
-	return opIndex, nil
+	for _, one := range indexes {
+		e.indexTop(one.index, one.offset, one.end)
+	}
+}
+
+// processIndexes applies any [index] suffixes that immediately follow a function call.
+func (e *Evaluator) processIndexes(expression string, index int) (int, error) {
+	for {
+		next := index
+		for next < len(expression) && isSpace(expression[next]) {
+			next++
+		}
+		if next == len(expression) || expression[next] != '[' {
+			return index, nil
+		}
+		end := bracketEnd(expression, next)
+		if end == -1 {
+			return -1, newSyntaxError(expression, next, "[", "]", "index not closed")
+		}
+		e.indexTop(expression[next+1:end], next+1, end+1)
+		index = end + 1
+	}
+}
+
+// indexTop replaces the operand on the top of the stack with an index into it. Any unary operator on the operand is
+// moved so that it applies to the result of the index instead.
+func (e *Evaluator) indexTop(index string, offset, end int) {
+	target := e.operandStack[len(e.operandStack)-1]
+	one := &expressionIndex{
+		span:   span{start: spanOf(target).start, end: end},
+		target: target,
+		index:  index,
+		offset: offset,
+	}
+	switch t := target.(type) {
+	case *expressionOperand:
+		one.unaryOp, t.unaryOp = t.unaryOp, nil
+	case *expressionList:
+		one.unaryOp, t.unaryOp = t.unaryOp, nil
+	case *parsedFunction:
+		one.unaryOp, t.unaryOp = t.unaryOp, nil
+	default:
+	}
+	e.operandStack[len(e.operandStack)-1] = one
+}
+
+func (e *Evaluator) processLiteral(expression string, start int, haveOperand bool, unaryOp *Operator) (int, error) {
+	if expression[start] == '"' {
+		end := quotedEnd(expression, start)
+		s, err := strconv.Unquote(expression[start : end+1])
+		if err != nil {
+			if end == len(expression)-1 && (end == start || expression[end] != '"') {
+				return -1, newSyntaxError(expression, start, expression[start:], `"`, "string not closed")
+			}
+			return -1, newSyntaxError(expression, start, expression[start:end+1], "", "invalid string")
+		}
+		e.operandStack = append(e.operandStack, &expressionOperand{
+			span:    span{start: start, end: end + 1},
+			value:   s,
+			unaryOp: unaryOp,
+			quoted:  true,
+		})
+		return end + 1, nil
+	}
+	end := bracketEnd(expression, start)
+	if end == -1 {
+		return -1, newSyntaxError(expression, start, "[", "]", "bracket not closed")
+	}
+	inner := expression[start+1 : end]
+	if haveOperand {
+		// A bracket following an operand indexes into it.
+		if len(e.operandStack) == 0 {
+			return -1, newSyntaxError(expression, start, "[", "operand", "nothing to index")
+		}
+		e.indexTop(inner, start+1, end+1)
+		return end + 1, nil
+	}
+	list := &expressionList{
+		span:    span{start: start, end: end + 1},
+		unaryOp: unaryOp,
+	}
+	if strings.TrimSpace(inner) != "" {
+		offset := start + 1
+		for {
+			var arg string
+			remaining := inner
+			arg, inner = NextArg(inner)
+			list.elements = append(list.elements, arg)
+			list.offsets = append(list.offsets, offset)
+			if inner == "" {
+				break
+			}
+			offset += len(remaining) - len(inner)
+		}
+	}
+	e.operandStack = append(e.operandStack, list)
+	return end + 1, nil
 }
 
-func (e *Evaluator) processOperator(expression string, index int, op *Operator, haveOperand bool, unaryOp *Operator) (int, error) {
+// processOperator processes the operator found at index and returns the index just past it, along with the operator
+// that was processed last, which will differ from op when op opens the arguments of a function call.
+func (e *Evaluator) processOperator(expression string, index int, op *Operator, haveOperand bool, unaryOp *Operator) (int, *Operator, error) {
 	if haveOperand && op != nil && op.Symbol == "(" {
 		var err error
 		index, op, err = e.processFunction(expression, index)
 		if err != nil {
-			return -1, err
+			return -1, nil, err
+		}
+		if index, err = e.processIndexes(expression, index+len(op.Symbol)); err != nil {
+			return -1, nil, err
 		}
-		index += len(op.Symbol)
 		var tmp int
 		tmp, op = e.nextOperator(expression, index, nil)
 		if op == nil {
-			return index, nil
+			return index, nil, nil
 		}
 		index = tmp
 	}
@@ -185,6 +514,7 @@ func (e *Evaluator) processOperator(expression string, index int, op *Operator,
 		e.operatorStack = append(e.operatorStack, &expressionOperator{
 			op:      op,
 			unaryOp: unaryOp,
+			index:   index,
 		})
 	case ")":
 		var stackOp *expressionOperator
@@ -200,17 +530,26 @@ func (e *Evaluator) processOperator(expression string, index int, op *Operator,
 			}
 		}
 		if len(e.operatorStack) == 0 {
-			return -1, errs.Newf("invalid expression at index %d", index)
+			return -1, nil, newSyntaxError(expression, index, ")", "", "unexpected closing parenthesis")
 		}
 		stackOp = e.operatorStack[len(e.operatorStack)-1]
 		if stackOp.op.Symbol != "(" {
-			return -1, errs.Newf("invalid expression at index %d", index)
+			return -1, nil, newSyntaxError(expression, index, ")", "", "unexpected closing parenthesis")
 		}
 		e.operatorStack = e.operatorStack[:len(e.operatorStack)-1]
+		if len(e.operandStack) != 0 {
+			if one, ok := e.operandStack[len(e.operandStack)-1].(interface{ widen(start, end int) }); ok {
+				one.widen(stackOp.index, index+len(op.Symbol))
+			}
+		}
 		if stackOp.unaryOp != nil {
+			if len(e.operandStack) == 0 {
+				return -1, nil, newSyntaxError(expression, index, ")", "operand", "missing operand")
+			}
 			left := e.operandStack[len(e.operandStack)-1]
 			e.operandStack = e.operandStack[:len(e.operandStack)-1]
 			e.operandStack = append(e.operandStack, &expressionTree{
+				span:      span{start: stackOp.index, end: index + len(op.Symbol)},
 				evaluator: e,
 				left:      left,
 				unaryOp:   stackOp.unaryOp,
@@ -231,9 +570,10 @@ func (e *Evaluator) processOperator(expression string, index int, op *Operator,
 		e.operatorStack = append(e.operatorStack, &expressionOperator{
 			op:      op,
 			unaryOp: unaryOp,
+			index:   index,
 		})
 	}
-	return index + len(op.Symbol), nil
+	return index + len(op.Symbol), op, nil
 }
 
 func (e *Evaluator) processFunction(expression string, opIndex int) (int, *Operator, error) {
@@ -242,7 +582,7 @@ func (e *Evaluator) processFunction(expression string, opIndex int) (int, *Opera
 	next := opIndex
 	for parens > 0 {
 		if next, op = e.nextOperator(expression, next+1, nil); op == nil {
-			return -1, nil, errs.Newf("function not closed at index %d", opIndex)
+			return -1, nil, newSyntaxError(expression, opIndex, "(", ")", "function not closed")
 		}
 		switch op.Symbol {
 		case "(":
@@ -253,21 +593,28 @@ func (e *Evaluator) processFunction(expression string, opIndex int) (int, *Opera
 		}
 	}
 	if len(e.operandStack) == 0 {
-		return -1, nil, errs.Newf("invalid stack at index %d", next)
+		return -1, nil, newSyntaxError(expression, opIndex, "(", "function name", "missing function name")
 	}
 	operand, ok := e.operandStack[len(e.operandStack)-1].(*expressionOperand)
-	if !ok {
-		return -1, nil, errs.Newf("unexpected operand stack value at index %d", next)
+	if !ok || operand.quoted {
+		return -1, nil, newSyntaxError(expression, opIndex, "(", "operator", "unexpected opening parenthesis")
 	}
 	e.operandStack = e.operandStack[:len(e.operandStack)-1]
 	f, exists := e.Functions[operand.value]
 	if !exists {
-		return -1, nil, errs.Newf("function not defined: %s", operand.value)
+		f, exists = e.defined[operand.value]
+	}
+	if !exists {
+		return -1, nil, newSyntaxError(expression, operand.start, operand.value, "function name",
+			"function not defined")
 	}
 	e.operandStack = append(e.operandStack, &parsedFunction{
-		function: f,
-		args:     expression[opIndex+1 : next],
-		unaryOp:  operand.unaryOp,
+		span:      span{start: operand.start, end: next + 1},
+		name:      operand.value,
+		function:  f,
+		args:      expression[opIndex+1 : next],
+		argsStart: opIndex + 1,
+		unaryOp:   operand.unaryOp,
 	})
 	return next, op, nil
 }
@@ -285,7 +632,15 @@ func (e *Evaluator) processTree() {
 	}
 	op := e.operatorStack[len(e.operatorStack)-1]
 	e.operatorStack = e.operatorStack[:len(e.operatorStack)-1]
+	where := span{start: op.index, end: op.index + len(op.op.Symbol)}
+	if left != nil {
+		where.start = min(where.start, spanOf(left).start)
+	}
+	if right != nil {
+		where.end = max(where.end, spanOf(right).end)
+	}
 	e.operandStack = append(e.operandStack, &expressionTree{
+		span:      where,
 		evaluator: e,
 		left:      left,
 		right:     right,
@@ -307,15 +662,17 @@ func (e *Evaluator) evaluateOperand(operand any) (any, error) {
 		}
 		if op.left != nil && op.right != nil {
 			if op.op.Evaluate == nil {
-				return nil, errs.New("operator does not have Evaluate function defined")
+				return nil, e.spanError(errs.New("operator does not have Evaluate function defined"), op.start, op.end)
 			}
 			var v any
 			v, err = op.op.Evaluate(left, right)
 			if err != nil {
-				return nil, err
+				return nil, e.spanError(err, op.start, op.end)
 			}
 			if op.unaryOp != nil && op.unaryOp.EvaluateUnary != nil {
-				return op.unaryOp.EvaluateUnary(v)
+				if v, err = op.unaryOp.EvaluateUnary(v); err != nil {
+					return nil, e.spanError(err, op.start, op.end)
+				}
 			}
 			return v, nil
 		}
@@ -332,34 +689,74 @@ func (e *Evaluator) evaluateOperand(operand any) (any, error) {
 				v, err = op.op.EvaluateUnary(v)
 			}
 			if err != nil {
-				return nil, err
+				return nil, e.spanError(err, op.start, op.end)
 			}
 		}
 		if v == nil {
-			return nil, errs.New("expression is invalid")
+			return nil, e.spanError(errs.New("expression is invalid"), op.start, op.end)
 		}
 		return v, nil
 	case *expressionOperand:
-		v, err := e.replaceVariables(op.value)
+		if op.quoted {
+			v, err := applyUnary(op.unaryOp, op.value)
+			return v, e.spanError(err, op.start, op.end)
+		}
+		if local, ok := e.value(op.value); ok {
+			v, err := applyUnary(op.unaryOp, local)
+			return v, e.spanError(err, op.start, op.end)
+		}
+		text, err := e.replaceVariables(op.value, false)
 		if err != nil {
-			return nil, err
+			return nil, e.spanError(err, op.start, op.end)
 		}
+		var v any = operandText(text)
 		if op.unaryOp != nil && op.unaryOp.EvaluateUnary != nil {
-			return op.unaryOp.EvaluateUnary(v)
+			if v, err = op.unaryOp.EvaluateUnary(v); err != nil {
+				return nil, e.spanError(err, op.start, op.end)
+			}
 		}
 		return v, nil
-	case *parsedFunction:
-		s, err := e.replaceVariables(op.args)
+	case *expressionList:
+		list := make([]any, 0, len(op.elements))
+		for i, element := range op.elements {
+			v, err := e.evaluateNew(element)
+			if err != nil {
+				return nil, e.nestedError(err, element, op.offsets[i], op.start, op.end)
+			}
+			list = append(list, v)
+		}
+		v, err := applyUnary(op.unaryOp, list)
+		return v, e.spanError(err, op.start, op.end)
+	case *expressionIndex:
+		target, err := e.evaluateOperand(op.target)
 		if err != nil {
 			return nil, err
 		}
+		var index, v any
+		if index, err = e.evaluateNew(op.index); err != nil {
+			return nil, e.nestedError(err, op.index, op.offset, op.start, op.end)
+		}
+		if v, err = indexValue(target, index); err == nil {
+			v, err = applyUnary(op.unaryOp, v)
+		}
+		return v, e.spanError(err, op.start, op.end)
+	case *parsedFunction:
+		s, err := e.replaceVariables(op.args, true)
+		if err != nil {
+			return nil, e.spanError(err, op.start, op.end)
+		}
 		var v any
+		call := e.call
+		e.call = newFunctionCall(s, op.args, op.argsStart)
 		v, err = op.function(e, s)
+		e.call = call
 		if err != nil {
-			return nil, err
+			return nil, e.nestedError(err, "", -1, op.start, op.end)
 		}
 		if op.unaryOp != nil && op.unaryOp.EvaluateUnary != nil {
-			return op.unaryOp.EvaluateUnary(v)
+			if v, err = op.unaryOp.EvaluateUnary(v); err != nil {
+				return nil, e.spanError(err, op.start, op.end)
+			}
 		}
 		return v, nil
 	default:
@@ -370,18 +767,15 @@ func (e *Evaluator) evaluateOperand(operand any) (any, error) {
 	}
 }
 
-func (e *Evaluator) replaceVariables(expression string) (string, error) {
-	dollar := strings.IndexRune(expression, '$')
-	if dollar == -1 {
-		return expression, nil
-	}
-	if e.Resolver == nil {
-		return "", errs.Newf("no variable resolver, yet variables present at index %d", dollar)
-	}
+// replaceVariables substitutes the values of the variables found in the expression. Local bindings take precedence
+// over the Resolver. When keepLocals is true, references to local bindings are left in place, so that a nested
+// evaluation can resolve them to their values rather than to their text.
+func (e *Evaluator) replaceVariables(expression string, keepLocals bool) (string, error) {
+	dollar := nextDollar(expression, 0)
 	for dollar >= 0 {
 		last := dollar
 		for i, ch := range expression[dollar+1:] {
-			if ch == '_' || ch == '.' || ch == '#' || (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (i != 0 && ch >= '0' && ch <= '9') {
+			if isVariableRune(ch, i == 0) {
 				last = dollar + 1 + i
 			} else {
 				break
@@ -391,9 +785,21 @@ func (e *Evaluator) replaceVariables(expression string) (string, error) {
 			return "", errs.Newf("invalid variable at index %d", dollar)
 		}
 		name := expression[dollar+1 : last+1]
-		v := e.Resolver.ResolveVariable(name)
-		if strings.TrimSpace(v) == "" {
-			return "", errs.Newf("unable to resolve variable $%s", name)
+		var v string
+		if local, ok := e.local(name, true); ok {
+			if keepLocals {
+				dollar = nextDollar(expression, last+1)
+				continue
+			}
+			v = stringFrom(local)
+		} else {
+			if e.Resolver == nil {
+				return "", errs.Newf("no variable resolver, yet variables present at index %d", dollar)
+			}
+			v = e.Resolver.ResolveVariable(name)
+			if strings.TrimSpace(v) == "" {
+				return "", errs.Newf("unable to resolve variable $%s", name)
+			}
 		}
 		var buffer strings.Builder
 		if dollar > 0 {
@@ -404,20 +810,109 @@ func (e *Evaluator) replaceVariables(expression string) (string, error) {
 			buffer.WriteString(expression[last+1:])
 		}
 		expression = buffer.String()
-		dollar = strings.IndexRune(expression, '$')
+		dollar = nextDollar(expression, dollar)
 	}
 	return expression, nil
 }
 
+// local returns the value bound to name. The variable flag should be true when name was referred to as a variable.
+func (e *Evaluator) local(name string, variable bool) (any, bool) {
+	if e.scope == nil {
+		return nil, false
+	}
+	return e.scope.lookup(name, variable)
+}
+
+// value returns the value of an operand which consists solely of a local binding or a variable whose value can be
+// resolved directly.
+func (e *Evaluator) value(text string) (any, bool) {
+	if name, variable := strings.CutPrefix(text, "$"); name != "" {
+		if v, ok := e.local(name, variable); ok {
+			return v, true
+		}
+	}
+	if resolver, ok := e.Resolver.(ValueResolver); ok && len(text) > 1 && text[0] == '$' && isName(text[1:]) {
+		return resolver.ResolveValue(text[1:])
+	}
+	return nil, false
+}
+
+// nextDollar returns the index of the first '$' at or after start that is not within a quoted string, or -1.
+func nextDollar(expression string, start int) int {
+	for i := start; i < len(expression); i++ {
+		switch expression[i] {
+		case '"':
+			i = quotedEnd(expression, i)
+		case '$':
+			return i
+		default:
+		}
+	}
+	return -1
+}
+
+// quotedEnd returns the index of the quote that closes the string starting at start, or the index of the last byte if
+// the string is not terminated.
+func quotedEnd(expression string, start int) int {
+	for i := start + 1; i < len(expression); i++ {
+		switch expression[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		default:
+		}
+	}
+	return len(expression) - 1
+}
+
+// bracketEnd returns the index of the bracket that closes the one at start, or -1 if it is not closed.
+func bracketEnd(expression string, start int) int {
+	depth := 0
+	for i := start; i < len(expression); i++ {
+		switch expression[i] {
+		case '"':
+			i = quotedEnd(expression, i)
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		default:
+		}
+	}
+	return -1
+}
+
+func spanOf(operand any) span {
+	if one, ok := operand.(interface{ location() span }); ok {
+		return one.location()
+	}
+	return span{}
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+func isVariableRune(ch rune, first bool) bool {
+	return ch == '_' || ch == '.' || ch == '#' || (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') ||
+		(!first && ch >= '0' && ch <= '9')
+}
+
 // NextArg provides extraction of the next argument from an arguments string passed to a Function. An empty string will
-// be returned if no argument remains.
+// be returned if no argument remains. Commas within parentheses, brackets, or quoted strings do not separate arguments.
 func NextArg(args string) (arg, remaining string) {
 	parens := 0
-	for i, ch := range args {
-		switch {
-		case ch == '(':
+	for i := 0; i < len(args); i++ {
+		switch ch := args[i]; {
+		case ch == '"':
+			i = quotedEnd(args, i)
+		case ch == '(' || ch == '[':
 			parens++
-		case ch == ')':
+		case ch == ')' || ch == ']':
 			parens--
 		case ch == ',' && parens == 0:
 			return args[:i], args[i+1:]
@@ -10,12 +10,14 @@
 package eval_test
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
 	"github.com/ddkwork/toolbox/check"
 	"github.com/ddkwork/toolbox/eval"
 	"github.com/ddkwork/toolbox/xmath/fixed"
+	"github.com/ddkwork/toolbox/xmath/num"
 )
 
 var (
@@ -50,6 +52,8 @@ var (
 		"(1 + max(0, 0)) - 10", "-9", "-9.0000000000000000",
 		"abs(-12)", "12", "12.0000000000000000",
 		"min(0, 1)", "0", "0.0000000000000000",
+		"2 * -3", "-6", "-6.0000000000000000",
+		"10 - -2 * (-1)", "8", "8.0000000000000000",
 		"(1 + (2 * max(3, min(-4, 5) + 2) - ((14 - (13 - (12 - (11 - (10 - (9 - (8 - (7 + 6))))))))))) - 10", "-1", "-1.0000000000000000",
 	}
 	strExpr = []string{
@@ -59,6 +63,25 @@ var (
 		"if($foo > $bar, yes, no)", "yes",
 		"if($foo < $bar, yes, no)", "no",
 	}
+	intExpr = []string{
+		"1 + 1", "2",
+		"7 / 2", "3",
+		"-7 / 2", "-3",
+		"7 % 3", "1",
+		"2 ^ 10", "1024",
+		"2 ^ 100", "1267650600228229401496703205376",
+		"2 ^ -1", "0",
+		"(-1) ^ -3", "-1",
+		"1.9 + 1", "2",
+		"1 / 0", "0",
+		"sqrt(10 ^ 30)", "1000000000000000",
+		"sqrt(99)", "9",
+		"abs(-12) + max(3, 7, 5) - min(4, -4)", "23",
+		"18446744073709551616 * 1000", "18446744073709551616000",
+		"$foo + $bar", "24",
+		"if($foo > $bar, 1, 2)", "1",
+		"len([1, 2, 3]) * 2", "6",
+	}
 )
 
 func TestFixedEvaluator(t *testing.T) {
@@ -105,6 +128,136 @@ func TestFloatEvaluator(t *testing.T) {
 	check.Error(t, err)
 }
 
+func TestComparisonOperators(t *testing.T) {
+	// Two-character operators must not be mistaken for their one-character prefixes.
+	for _, e := range []*eval.Evaluator{
+		eval.NewFixedEvaluator[fixed.D4](resolver{}, true),
+		eval.NewFloatEvaluator[float64](resolver{}, true),
+	} {
+		for _, one := range []struct {
+			expr     string
+			expected bool
+		}{
+			{"5 >= 1", true},
+			{"1 >= 1", true},
+			{"1 >= 5", false},
+			{"5 <= 1", false},
+			{"1 <= 1", true},
+			{"5 > 1", true},
+			{"5 < 1", false},
+			{"1 == 1", true},
+			{"1 != 1", false},
+			{"1 != 2", true},
+			{"1 + 1 >= 2 && 3 != 4", true},
+		} {
+			result, err := e.Evaluate(one.expr)
+			check.NoError(t, err, one.expr)
+			check.Equal(t, one.expected, result, one.expr)
+		}
+	}
+}
+
+func TestUnaryAfterOperator(t *testing.T) {
+	// A unary operator may appear anywhere an operand is expected, not just at the start of the expression.
+	for _, e := range []*eval.Evaluator{
+		eval.NewFixedEvaluator[fixed.D4](resolver{}, true),
+		eval.NewFloatEvaluator[float64](resolver{}, true),
+	} {
+		for _, one := range []struct {
+			expr     string
+			expected string
+		}{
+			{"-3", "-3"},
+			{"2 * -3", "-6"},
+			{"10 - -2 * (-1)", "8"},
+			{"2 * -(1 + 2)", "-6"},
+			{"max(-1, -2) + -abs(-4)", "-5"},
+			{"abs(-2) * -1", "-2"},
+			{"!(1 > 2) && !(2 > 3)", "true"},
+		} {
+			result, err := e.Evaluate(one.expr)
+			check.NoError(t, err, one.expr)
+			check.Equal(t, one.expected, fmt.Sprintf("%v", result), one.expr)
+		}
+		_, err := e.Evaluate("2 * - -3")
+		check.Error(t, err)
+	}
+}
+
+func TestFixed128Evaluator(t *testing.T) {
+	e := eval.NewFixed128Evaluator[fixed.D4](resolver{}, true)
+	for i := 0; i < len(numExpr); i += 3 {
+		result, err := e.Evaluate(numExpr[i])
+		check.NoError(t, err, "%d: %s == %s", i, numExpr[i], numExpr[i+1])
+		check.Equal(t, numExpr[i+1], fmt.Sprintf("%v", result), "%d: %s == %s", i, numExpr[i], numExpr[i+1])
+	}
+	for i := 0; i < len(strExpr); i += 2 {
+		result, err := e.Evaluate(strExpr[i])
+		check.NoError(t, err, "%d: %s == %s", i, strExpr[i], strExpr[i+1])
+		check.Equal(t, strExpr[i+1], result, "%d: %s == %s", i, strExpr[i], strExpr[i+1])
+	}
+
+	result, err := e.Evaluate("92233720368547758.07 * 1000 + 0.5")
+	check.NoError(t, err)
+	check.Equal(t, "92233720368547758070.5", fmt.Sprintf("%v", result))
+	result, err = e.Evaluate("2 ^ 3 + round(2.5) + ceil(-1.5) + floor(1.5)")
+	check.NoError(t, err)
+	check.Equal(t, "11", fmt.Sprintf("%v", result))
+	result, err = e.Evaluate("10 % 3 + 2 ^ -1")
+	check.NoError(t, err)
+	check.Equal(t, "1.5", fmt.Sprintf("%v", result))
+
+	for _, expr := range []string{
+		"10000000000000000000000000000000000 * 10",
+		"10000000000000000000000000000000000 + 10000000000000000000000000000000000",
+		"-10000000000000000000000000000000000 - 10000000000000000000000000000000000",
+		"10000000000000000000000000000000000 / 0.01",
+		"10 ^ 40",
+		"exp(1000)",
+	} {
+		_, err = e.Evaluate(expr)
+		check.True(t, errors.Is(err, num.ErrOverflow), expr)
+	}
+
+	e = eval.NewFixed128Evaluator[fixed.D4](resolver{}, false)
+	_, err = e.Evaluate("1 / 0")
+	check.Error(t, err)
+}
+
+func TestInt128Evaluator(t *testing.T) {
+	e := eval.NewInt128Evaluator(resolver{}, true)
+	for i := 0; i < len(intExpr); i += 2 {
+		result, err := e.Evaluate(intExpr[i])
+		check.NoError(t, err, "%d: %s == %s", i, intExpr[i], intExpr[i+1])
+		check.Equal(t, intExpr[i+1], fmt.Sprintf("%v", result), "%d: %s == %s", i, intExpr[i], intExpr[i+1])
+	}
+	for i := 0; i < len(strExpr); i += 2 {
+		result, err := e.Evaluate(strExpr[i])
+		check.NoError(t, err, "%d: %s == %s", i, strExpr[i], strExpr[i+1])
+		check.Equal(t, strExpr[i+1], result, "%d: %s == %s", i, strExpr[i], strExpr[i+1])
+	}
+
+	for _, expr := range []string{
+		"170141183460469231731687303715884105727 + 1",
+		"-170141183460469231731687303715884105727 - 2",
+		"-(-170141183460469231731687303715884105727 - 1)",
+		"18446744073709551616 * 18446744073709551616",
+		"2 ^ 127",
+		"170141183460469231731687303715884105728 + 0",
+		"exp(100)",
+	} {
+		_, err := e.Evaluate(expr)
+		check.True(t, errors.Is(err, num.ErrOverflow), expr)
+	}
+	result, err := e.Evaluate("2 ^ 126 - 1 + 2 ^ 126")
+	check.NoError(t, err)
+	check.Equal(t, num.MaxInt128, result)
+
+	e = eval.NewInt128Evaluator(resolver{}, false)
+	_, err = e.Evaluate("1 / 0")
+	check.Error(t, err)
+}
+
 type resolver struct{}
 
 func (r resolver) ResolveVariable(variableName string) string {
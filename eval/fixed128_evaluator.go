@@ -0,0 +1,21 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+import "github.com/ddkwork/toolbox/xmath/fixed"
+
+// NewFixed128Evaluator creates a new evaluator whose number type is one of the 128-bit fixed types.
+func NewFixed128Evaluator[T fixed.Dx](resolver VariableResolver, divideByZeroReturnsZero bool) *Evaluator {
+	return &Evaluator{
+		Resolver:  resolver,
+		Operators: Fixed128Operators[T](divideByZeroReturnsZero),
+		Functions: Fixed128Functions[T](),
+	}
+}
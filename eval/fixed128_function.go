@@ -0,0 +1,190 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+import (
+	"maps"
+	"math"
+	"strings"
+
+	"github.com/ddkwork/toolbox/xmath/fixed"
+	"github.com/ddkwork/toolbox/xmath/fixed/f128"
+)
+
+// Fixed128Functions returns standard functions that work with 128-bit fixed-point values, along with those from
+// ValueFunctions(). Results that cannot be represented produce an error rather than wrapping around.
+func Fixed128Functions[T fixed.Dx]() map[string]Function {
+	functions := map[string]Function{
+		"abs":   fixed128Absolute[T],
+		"cbrt":  fixed128CubeRoot[T],
+		"ceil":  fixed128Ceiling[T],
+		"exp":   fixed128BaseEExponential[T],
+		"exp2":  fixed128Base2Exponential[T],
+		"floor": fixed128Floor[T],
+		"if":    fixed128If[T],
+		"log":   fixed128NaturalLog[T],
+		"log1p": fixed128NaturalLogSum1[T],
+		"log10": fixed128DecimalLog[T],
+		"max":   fixed128Maximum[T],
+		"min":   fixed128Minimum[T],
+		"round": fixed128Round[T],
+		"sqrt":  fixed128SquareRoot[T],
+	}
+	maps.Copy(functions, ValueFunctions(func(value int) any { return f128.From[T](value) }))
+	return functions
+}
+
+func fixed128Absolute[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	value, err := evalToFixed128[T](e, arguments, -1)
+	if err != nil {
+		return nil, err
+	}
+	if value.LessThan(f128.Int[T]{}) {
+		return value.CheckedNeg()
+	}
+	return value, nil
+}
+
+func fixed128Base2Exponential[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	return fixed128SingleNumberFunc[T](e, arguments, math.Exp2)
+}
+
+func fixed128BaseEExponential[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	return fixed128SingleNumberFunc[T](e, arguments, math.Exp)
+}
+
+func fixed128Ceiling[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	value, err := evalToFixed128[T](e, arguments, -1)
+	if err != nil {
+		return nil, err
+	}
+	trunc := value.Trunc()
+	if value.GreaterThan(trunc) {
+		return trunc.CheckedAdd(f128.Multiplier[T]())
+	}
+	return trunc, nil
+}
+
+func fixed128CubeRoot[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	return fixed128SingleNumberFunc[T](e, arguments, math.Cbrt)
+}
+
+func fixed128DecimalLog[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	return fixed128SingleNumberFunc[T](e, arguments, math.Log10)
+}
+
+func fixed128Floor[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	value, err := evalToFixed128[T](e, arguments, -1)
+	if err != nil {
+		return nil, err
+	}
+	return value.Trunc(), nil
+}
+
+func fixed128If[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	var arg string
+	arg, arguments = NextArg(arguments)
+	evaluated, err := e.evaluateArg(arg, 0)
+	if err != nil {
+		return nil, err
+	}
+	var value f128.Int[T]
+	if value, err = Fixed128From[T](evaluated); err != nil {
+		if s, ok := textFrom(evaluated); ok {
+			if s != "" && !strings.EqualFold(s, "false") {
+				value = value.Inc()
+			}
+		} else {
+			return nil, err
+		}
+	}
+	index := 1
+	if value == (f128.Int[T]{}) {
+		_, arguments = NextArg(arguments)
+		index = 2
+	}
+	arg, _ = NextArg(arguments)
+	return e.evaluateArg(arg, index)
+}
+
+func fixed128Maximum[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	maximum := f128.Minimum[T]()
+	for i := 0; arguments != ""; i++ {
+		var arg string
+		arg, arguments = NextArg(arguments)
+		value, err := evalToFixed128[T](e, arg, i)
+		if err != nil {
+			return nil, err
+		}
+		maximum = maximum.Max(value)
+	}
+	return maximum, nil
+}
+
+func fixed128Minimum[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	minimum := f128.Maximum[T]()
+	for i := 0; arguments != ""; i++ {
+		var arg string
+		arg, arguments = NextArg(arguments)
+		value, err := evalToFixed128[T](e, arg, i)
+		if err != nil {
+			return nil, err
+		}
+		minimum = minimum.Min(value)
+	}
+	return minimum, nil
+}
+
+func fixed128NaturalLog[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	return fixed128SingleNumberFunc[T](e, arguments, math.Log)
+}
+
+func fixed128NaturalLogSum1[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	return fixed128SingleNumberFunc[T](e, arguments, math.Log1p)
+}
+
+func fixed128Round[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	value, err := evalToFixed128[T](e, arguments, -1)
+	if err != nil {
+		return nil, err
+	}
+	one := f128.Multiplier[T]()
+	half := one.Div(f128.From[T](2))
+	trunc := value.Trunc()
+	rem := value.Sub(trunc)
+	switch {
+	case rem.GreaterThanOrEqual(half):
+		return trunc.CheckedAdd(one)
+	case rem.LessThan(half.Neg()):
+		return trunc.CheckedSub(one)
+	default:
+		return trunc, nil
+	}
+}
+
+func fixed128SquareRoot[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
+	return fixed128SingleNumberFunc[T](e, arguments, math.Sqrt)
+}
+
+func evalToFixed128[T fixed.Dx](e *Evaluator, arg string, index int) (f128.Int[T], error) {
+	evaluated, err := e.evaluateArg(arg, index)
+	if err != nil {
+		return f128.Int[T]{}, err
+	}
+	return Fixed128From[T](evaluated)
+}
+
+func fixed128SingleNumberFunc[T fixed.Dx](e *Evaluator, arguments string, f func(float64) float64) (any, error) {
+	value, err := evalToFixed128[T](e, arguments, -1)
+	if err != nil {
+		return nil, err
+	}
+	return fixed128FromFloat[T](f(f128.As[T, float64](value)))
+}
@@ -0,0 +1,359 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xmath/fixed"
+	"github.com/ddkwork/toolbox/xmath/fixed/f128"
+	"github.com/ddkwork/toolbox/xmath/num"
+)
+
+// Fixed128Operators returns standard operators that work with 128-bit fixed-point values, as well as with strings, lists,
+// dates, and durations. Arithmetic that overflows results in an error rather than wrapping around.
+func Fixed128Operators[T fixed.Dx](divideByZeroReturnsZero bool) []*Operator {
+	var divide, modulo OpFunc
+	if divideByZeroReturnsZero {
+		divide = fixed128DivideAllowDivideByZero[T]
+		modulo = fixed128ModuloAllowDivideByZero[T]
+	} else {
+		divide = fixed128Divide[T]
+		modulo = fixed128Modulo[T]
+	}
+	return []*Operator{
+		OpenParen(),
+		CloseParen(),
+		LogicalOr(fixed128LogicalOr[T]),
+		LogicalAnd(fixed128LogicalAnd[T]),
+		Not(fixed128Not[T]),
+		Equal(valueCompare(fixed128Equal[T], isEqual)),
+		NotEqual(valueCompare(fixed128NotEqual[T], isNotEqual)),
+		GreaterThan(valueCompare(fixed128GreaterThan[T], isGreater)),
+		GreaterThanOrEqual(valueCompare(fixed128GreaterThanOrEqual[T], isGreaterOrEqual)),
+		LessThan(valueCompare(fixed128LessThan[T], isLess)),
+		LessThanOrEqual(valueCompare(fixed128LessThanOrEqual[T], isLessOrEqual)),
+		Add(valueAdd(fixed128Add[T]), fixed128AddUnary[T]),
+		Subtract(valueSubtract(fixed128Subtract[T]), fixed128SubtractUnary[T]),
+		Multiply(fixed128Multiply[T]),
+		Divide(divide),
+		Modulo(modulo),
+		Power(fixed128Power[T]),
+	}
+}
+
+func fixed128Not[T fixed.Dx](arg any) (any, error) {
+	if b, ok := arg.(bool); ok {
+		return !b, nil
+	}
+	v, err := Fixed128From[T](arg)
+	if err != nil {
+		return nil, err
+	}
+	if v == (f128.Int[T]{}) {
+		return true, nil
+	}
+	return false, nil
+}
+
+func fixed128LogicalOr[T fixed.Dx](left, right any) (any, error) {
+	l, err := Fixed128From[T](left)
+	if err != nil {
+		return nil, err
+	}
+	if l != (f128.Int[T]{}) {
+		return true, nil
+	}
+	var r f128.Int[T]
+	r, err = Fixed128From[T](right)
+	if err != nil {
+		return nil, err
+	}
+	return r != (f128.Int[T]{}), nil
+}
+
+func fixed128LogicalAnd[T fixed.Dx](left, right any) (any, error) {
+	l, err := Fixed128From[T](left)
+	if err != nil {
+		return nil, err
+	}
+	if l == (f128.Int[T]{}) {
+		return false, nil
+	}
+	var r f128.Int[T]
+	r, err = Fixed128From[T](right)
+	if err != nil {
+		return nil, err
+	}
+	return r != (f128.Int[T]{}), nil
+}
+
+func fixed128Equal[T fixed.Dx](left, right any) (any, error) {
+	var r f128.Int[T]
+	l, err := Fixed128From[T](left)
+	if err == nil {
+		r, err = Fixed128From[T](right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) == fmt.Sprintf("%v", right), nil
+	}
+	return l == r, nil
+}
+
+func fixed128NotEqual[T fixed.Dx](left, right any) (any, error) {
+	var r f128.Int[T]
+	l, err := Fixed128From[T](left)
+	if err == nil {
+		r, err = Fixed128From[T](right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) != fmt.Sprintf("%v", right), nil
+	}
+	return l != r, nil
+}
+
+func fixed128GreaterThan[T fixed.Dx](left, right any) (any, error) {
+	var r f128.Int[T]
+	l, err := Fixed128From[T](left)
+	if err == nil {
+		r, err = Fixed128From[T](right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) > fmt.Sprintf("%v", right), nil
+	}
+	return l.GreaterThan(r), nil
+}
+
+func fixed128GreaterThanOrEqual[T fixed.Dx](left, right any) (any, error) {
+	var r f128.Int[T]
+	l, err := Fixed128From[T](left)
+	if err == nil {
+		r, err = Fixed128From[T](right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) >= fmt.Sprintf("%v", right), nil
+	}
+	return l.GreaterThanOrEqual(r), nil
+}
+
+func fixed128LessThan[T fixed.Dx](left, right any) (any, error) {
+	var r f128.Int[T]
+	l, err := Fixed128From[T](left)
+	if err == nil {
+		r, err = Fixed128From[T](right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) < fmt.Sprintf("%v", right), nil
+	}
+	return l.LessThan(r), nil
+}
+
+func fixed128LessThanOrEqual[T fixed.Dx](left, right any) (any, error) {
+	var r f128.Int[T]
+	l, err := Fixed128From[T](left)
+	if err == nil {
+		r, err = Fixed128From[T](right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) <= fmt.Sprintf("%v", right), nil
+	}
+	return l.LessThanOrEqual(r), nil
+}
+
+func fixed128Add[T fixed.Dx](left, right any) (any, error) {
+	var r f128.Int[T]
+	l, err := Fixed128From[T](left)
+	if err == nil {
+		r, err = Fixed128From[T](right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v%v", left, right), nil
+	}
+	return l.CheckedAdd(r)
+}
+
+func fixed128AddUnary[T fixed.Dx](arg any) (any, error) {
+	return Fixed128From[T](arg)
+}
+
+func fixed128Subtract[T fixed.Dx](left, right any) (any, error) {
+	l, err := Fixed128From[T](left)
+	if err != nil {
+		return nil, err
+	}
+	var r f128.Int[T]
+	r, err = Fixed128From[T](right)
+	if err != nil {
+		return nil, err
+	}
+	return l.CheckedSub(r)
+}
+
+func fixed128SubtractUnary[T fixed.Dx](arg any) (any, error) {
+	v, err := Fixed128From[T](arg)
+	if err != nil {
+		return nil, err
+	}
+	return v.CheckedNeg()
+}
+
+func fixed128Multiply[T fixed.Dx](left, right any) (any, error) {
+	l, err := Fixed128From[T](left)
+	if err != nil {
+		return nil, err
+	}
+	var r f128.Int[T]
+	r, err = Fixed128From[T](right)
+	if err != nil {
+		return nil, err
+	}
+	return l.CheckedMul(r)
+}
+
+func fixed128Divide[T fixed.Dx](left, right any) (any, error) {
+	l, err := Fixed128From[T](left)
+	if err != nil {
+		return nil, err
+	}
+	var r f128.Int[T]
+	r, err = Fixed128From[T](right)
+	if err != nil {
+		return nil, err
+	}
+	if r == (f128.Int[T]{}) {
+		return nil, errs.New("divide by zero")
+	}
+	return l.CheckedDiv(r)
+}
+
+func fixed128DivideAllowDivideByZero[T fixed.Dx](left, right any) (any, error) {
+	l, err := Fixed128From[T](left)
+	if err != nil {
+		return nil, err
+	}
+	var r f128.Int[T]
+	r, err = Fixed128From[T](right)
+	if err != nil {
+		return nil, err
+	}
+	if r == (f128.Int[T]{}) {
+		return r, nil
+	}
+	return l.CheckedDiv(r)
+}
+
+func fixed128Modulo[T fixed.Dx](left, right any) (any, error) {
+	l, err := Fixed128From[T](left)
+	if err != nil {
+		return nil, err
+	}
+	var r f128.Int[T]
+	r, err = Fixed128From[T](right)
+	if err != nil {
+		return nil, err
+	}
+	if r == (f128.Int[T]{}) {
+		return nil, errs.New("divide by zero")
+	}
+	return fixed128Mod(l, r)
+}
+
+func fixed128ModuloAllowDivideByZero[T fixed.Dx](left, right any) (any, error) {
+	l, err := Fixed128From[T](left)
+	if err != nil {
+		return nil, err
+	}
+	var r f128.Int[T]
+	r, err = Fixed128From[T](right)
+	if err != nil {
+		return nil, err
+	}
+	if r == (f128.Int[T]{}) {
+		return r, nil
+	}
+	return fixed128Mod(l, r)
+}
+
+func fixed128Power[T fixed.Dx](left, right any) (any, error) {
+	l, err := Fixed128From[T](left)
+	if err != nil {
+		return nil, err
+	}
+	var r f128.Int[T]
+	r, err = Fixed128From[T](right)
+	if err != nil {
+		return nil, err
+	}
+	return fixed128Pow(l, r)
+}
+
+func fixed128Mod[T fixed.Dx](left, right f128.Int[T]) (f128.Int[T], error) {
+	quotient, err := left.CheckedDiv(right)
+	if err != nil {
+		return f128.Int[T]{}, err
+	}
+	var multiple f128.Int[T]
+	if multiple, err = right.CheckedMul(quotient.Trunc()); err != nil {
+		return f128.Int[T]{}, err
+	}
+	return left.CheckedSub(multiple)
+}
+
+func fixed128Pow[T fixed.Dx](base, exponent f128.Int[T]) (f128.Int[T], error) {
+	if exponent.Trunc() != exponent {
+		return fixed128FromFloat[T](math.Pow(f128.As[T, float64](base), f128.As[T, float64](exponent)))
+	}
+	// Whole exponents are computed exactly, so that overflow can be detected.
+	one := f128.From[T, int](1)
+	power, err := powBySquaring(f128.As[T, int64](exponent.Abs()), one, base, f128.Int[T].CheckedMul)
+	if err != nil {
+		return f128.Int[T]{}, err
+	}
+	if exponent.LessThan(f128.Int[T]{}) {
+		if power == (f128.Int[T]{}) {
+			return f128.Int[T]{}, errs.New("divide by zero")
+		}
+		return one.CheckedDiv(power)
+	}
+	return power, nil
+}
+
+// fixed128FromFloat converts a floating-point result into an f128.Int, returning an error rather than a clamped or
+// meaningless value if the result cannot be represented.
+func fixed128FromFloat[T fixed.Dx](value float64) (f128.Int[T], error) {
+	if math.IsNaN(value) {
+		return f128.Int[T]{}, errs.New("result is not a number")
+	}
+	if math.IsInf(value, 0) || math.Abs(value) >= f128.As[T, float64](f128.Maximum[T]()) {
+		return f128.Int[T]{}, num.ErrOverflow
+	}
+	return f128.From[T](value), nil
+}
+
+// Fixed128From attempts to convert the arg into one of the f128.Int types.
+func Fixed128From[T fixed.Dx](arg any) (f128.Int[T], error) {
+	switch a := arg.(type) {
+	case bool:
+		if a {
+			return f128.From[T, int](1), nil
+		}
+		return f128.Int[T]{}, nil
+	case f128.Int[T]:
+		return a, nil
+	case operandText:
+		return Fixed128From[T](string(a))
+	case string:
+		return f128.FromString[T](a)
+	default:
+		return f128.Int[T]{}, errs.Newf("not a number: %v", arg)
+	}
+}
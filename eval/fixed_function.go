@@ -10,6 +10,7 @@
 package eval
 
 import (
+	"maps"
 	"math"
 	"strings"
 
@@ -17,9 +18,10 @@ import (
 	"github.com/ddkwork/toolbox/xmath/fixed/f64"
 )
 
-// FixedFunctions returns standard functions that work with 64-bit fixed-point values.
+// FixedFunctions returns standard functions that work with 64-bit fixed-point values, along with those from
+// ValueFunctions().
 func FixedFunctions[T fixed.Dx]() map[string]Function {
-	return map[string]Function{
+	functions := map[string]Function{
 		"abs":   fixedAbsolute[T],
 		"cbrt":  fixedCubeRoot[T],
 		"ceil":  fixedCeiling[T],
@@ -35,10 +37,12 @@ func FixedFunctions[T fixed.Dx]() map[string]Function {
 		"round": fixedRound[T],
 		"sqrt":  fixedSquareRoot[T],
 	}
+	maps.Copy(functions, ValueFunctions(func(value int) any { return f64.From[T](value) }))
+	return functions
 }
 
 func fixedAbsolute[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
-	value, err := evalToFixed[T](e, arguments)
+	value, err := evalToFixed[T](e, arguments, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +58,7 @@ func fixedBaseEExponential[T fixed.Dx](e *Evaluator, arguments string) (any, err
 }
 
 func fixedCeiling[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
-	value, err := evalToFixed[T](e, arguments)
+	value, err := evalToFixed[T](e, arguments, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +74,7 @@ func fixedDecimalLog[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
 }
 
 func fixedFloor[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
-	value, err := evalToFixed[T](e, arguments)
+	value, err := evalToFixed[T](e, arguments, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -80,13 +84,13 @@ func fixedFloor[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
 func fixedIf[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
 	var arg string
 	arg, arguments = NextArg(arguments)
-	evaluated, err := e.EvaluateNew(arg)
+	evaluated, err := e.evaluateArg(arg, 0)
 	if err != nil {
 		return nil, err
 	}
 	var value f64.Int[T]
 	if value, err = FixedFrom[T](evaluated); err != nil {
-		if s, ok := evaluated.(string); ok {
+		if s, ok := textFrom(evaluated); ok {
 			if s != "" && !strings.EqualFold(s, "false") {
 				value = any(&value).(interface{ Inc() f64.Int[T] }).Inc()
 			}
@@ -94,19 +98,21 @@ func fixedIf[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
 			return nil, err
 		}
 	}
+	index := 1
 	if value == 0 {
 		_, arguments = NextArg(arguments)
+		index = 2
 	}
 	arg, _ = NextArg(arguments)
-	return e.EvaluateNew(arg)
+	return e.evaluateArg(arg, index)
 }
 
 func fixedMaximum[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
 	maximum := f64.Int[T](f64.Min)
-	for arguments != "" {
+	for i := 0; arguments != ""; i++ {
 		var arg string
 		arg, arguments = NextArg(arguments)
-		value, err := evalToFixed[T](e, arg)
+		value, err := evalToFixed[T](e, arg, i)
 		if err != nil {
 			return nil, err
 		}
@@ -117,10 +123,10 @@ func fixedMaximum[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
 
 func fixedMinimum[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
 	minimum := f64.Int[T](f64.Max)
-	for arguments != "" {
+	for i := 0; arguments != ""; i++ {
 		var arg string
 		arg, arguments = NextArg(arguments)
-		value, err := evalToFixed[T](e, arg)
+		value, err := evalToFixed[T](e, arg, i)
 		if err != nil {
 			return nil, err
 		}
@@ -134,7 +140,7 @@ func fixedNaturalLog[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
 }
 
 func fixedNaturalLogSum1[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
-	value, err := evalToFixed[T](e, arguments)
+	value, err := evalToFixed[T](e, arguments, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -143,7 +149,7 @@ func fixedNaturalLogSum1[T fixed.Dx](e *Evaluator, arguments string) (any, error
 }
 
 func fixedRound[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
-	value, err := evalToFixed[T](e, arguments)
+	value, err := evalToFixed[T](e, arguments, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -154,8 +160,8 @@ func fixedSquareRoot[T fixed.Dx](e *Evaluator, arguments string) (any, error) {
 	return fixedSingleNumberFunc[T](e, arguments, math.Sqrt)
 }
 
-func evalToFixed[T fixed.Dx](e *Evaluator, arg string) (f64.Int[T], error) {
-	evaluated, err := e.EvaluateNew(arg)
+func evalToFixed[T fixed.Dx](e *Evaluator, arg string, index int) (f64.Int[T], error) {
+	evaluated, err := e.evaluateArg(arg, index)
 	if err != nil {
 		return 0, err
 	}
@@ -163,7 +169,7 @@ func evalToFixed[T fixed.Dx](e *Evaluator, arg string) (f64.Int[T], error) {
 }
 
 func fixedSingleNumberFunc[T fixed.Dx](e *Evaluator, arguments string, f func(float64) float64) (any, error) {
-	value, err := evalToFixed[T](e, arguments)
+	value, err := evalToFixed[T](e, arguments, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -18,7 +18,8 @@ import (
 	"github.com/ddkwork/toolbox/xmath/fixed/f64"
 )
 
-// FixedOperators returns standard operators that work with 64-bit fixed-point values.
+// FixedOperators returns standard operators that work with 64-bit fixed-point values, as well as with strings, lists,
+// dates, and durations.
 func FixedOperators[T fixed.Dx](divideByZeroReturnsZero bool) []*Operator {
 	var divide, modulo OpFunc
 	if divideByZeroReturnsZero {
@@ -34,14 +35,14 @@ func FixedOperators[T fixed.Dx](divideByZeroReturnsZero bool) []*Operator {
 		LogicalOr(fixedLogicalOr[T]),
 		LogicalAnd(fixedLogicalAnd[T]),
 		Not(fixedNot[T]),
-		Equal(fixedEqual[T]),
-		NotEqual(fixedNotEqual[T]),
-		GreaterThan(fixedGreaterThan[T]),
-		GreaterThanOrEqual(fixedGreaterThanOrEqual[T]),
-		LessThan(fixedLessThan[T]),
-		LessThanOrEqual(fixedLessThanOrEqual[T]),
-		Add(fixedAdd[T], fixedAddUnary[T]),
-		Subtract(fixedSubtract[T], fixedSubtractUnary[T]),
+		Equal(valueCompare(fixedEqual[T], isEqual)),
+		NotEqual(valueCompare(fixedNotEqual[T], isNotEqual)),
+		GreaterThan(valueCompare(fixedGreaterThan[T], isGreater)),
+		GreaterThanOrEqual(valueCompare(fixedGreaterThanOrEqual[T], isGreaterOrEqual)),
+		LessThan(valueCompare(fixedLessThan[T], isLess)),
+		LessThanOrEqual(valueCompare(fixedLessThanOrEqual[T], isLessOrEqual)),
+		Add(valueAdd(fixedAdd[T]), fixedAddUnary[T]),
+		Subtract(valueSubtract(fixedSubtract[T]), fixedSubtractUnary[T]),
 		Multiply(fixedMultiply[T]),
 		Divide(divide),
 		Modulo(modulo),
@@ -304,6 +305,8 @@ func FixedFrom[T fixed.Dx](arg any) (f64.Int[T], error) {
 		return 0, nil
 	case f64.Int[T]:
 		return a, nil
+	case operandText:
+		return FixedFrom[T](string(a))
 	case string:
 		return f64.FromString[T](a)
 	default:
@@ -10,15 +10,16 @@
 package eval
 
 import (
+	"maps"
 	"strings"
 
 	"github.com/ddkwork/toolbox/xmath"
 	"golang.org/x/exp/constraints"
 )
 
-// FloatFunctions returns standard functions that work with constraints.Float.
+// FloatFunctions returns standard functions that work with constraints.Float, along with those from ValueFunctions().
 func FloatFunctions[T constraints.Float]() map[string]Function {
-	return map[string]Function{
+	functions := map[string]Function{
 		"abs":   floatAbs[T],
 		"cbrt":  floatCubeRoot[T],
 		"ceil":  floatCeiling[T],
@@ -34,6 +35,8 @@ func FloatFunctions[T constraints.Float]() map[string]Function {
 		"round": floatRound[T],
 		"sqrt":  floatSquareRoot[T],
 	}
+	maps.Copy(functions, ValueFunctions(func(value int) any { return T(value) }))
+	return functions
 }
 
 func floatAbs[T constraints.Float](e *Evaluator, arguments string) (any, error) {
@@ -67,13 +70,13 @@ func floatFloor[T constraints.Float](e *Evaluator, arguments string) (any, error
 func floatIf[T constraints.Float](e *Evaluator, arguments string) (any, error) {
 	var arg string
 	arg, arguments = NextArg(arguments)
-	evaluated, err := e.EvaluateNew(arg)
+	evaluated, err := e.evaluateArg(arg, 0)
 	if err != nil {
 		return nil, err
 	}
 	var value T
 	if value, err = floatFrom[T](evaluated); err != nil {
-		if s, ok := evaluated.(string); ok {
+		if s, ok := textFrom(evaluated); ok {
 			if s != "" && !strings.EqualFold(s, "false") {
 				value = 1
 			}
@@ -81,19 +84,21 @@ func floatIf[T constraints.Float](e *Evaluator, arguments string) (any, error) {
 			return nil, err
 		}
 	}
+	index := 1
 	if value == 0 {
 		_, arguments = NextArg(arguments)
+		index = 2
 	}
 	arg, _ = NextArg(arguments)
-	return e.EvaluateNew(arg)
+	return e.evaluateArg(arg, index)
 }
 
 func floatMaximum[T constraints.Float](e *Evaluator, arguments string) (any, error) {
 	maxValue := xmath.MinValue[T]()
-	for arguments != "" {
+	for i := 0; arguments != ""; i++ {
 		var arg string
 		arg, arguments = NextArg(arguments)
-		value, err := evalToFloat[T](e, arg)
+		value, err := evalToFloat[T](e, arg, i)
 		if err != nil {
 			return nil, err
 		}
@@ -104,10 +109,10 @@ func floatMaximum[T constraints.Float](e *Evaluator, arguments string) (any, err
 
 func floatMinimum[T constraints.Float](e *Evaluator, arguments string) (any, error) {
 	minValue := xmath.MaxValue[T]()
-	for arguments != "" {
+	for i := 0; arguments != ""; i++ {
 		var arg string
 		arg, arguments = NextArg(arguments)
-		value, err := evalToFloat[T](e, arg)
+		value, err := evalToFloat[T](e, arg, i)
 		if err != nil {
 			return nil, err
 		}
@@ -121,7 +126,7 @@ func floatNaturalLog[T constraints.Float](e *Evaluator, arguments string) (any,
 }
 
 func floatNaturalLogSum1[T constraints.Float](e *Evaluator, arguments string) (any, error) {
-	value, err := evalToFloat[T](e, arguments)
+	value, err := evalToFloat[T](e, arguments, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -136,8 +141,8 @@ func floatSquareRoot[T constraints.Float](e *Evaluator, arguments string) (any,
 	return floatSingleNumberFunc(e, arguments, xmath.Sqrt[T])
 }
 
-func evalToFloat[T constraints.Float](e *Evaluator, arg string) (T, error) {
-	evaluated, err := e.EvaluateNew(arg)
+func evalToFloat[T constraints.Float](e *Evaluator, arg string, index int) (T, error) {
+	evaluated, err := e.evaluateArg(arg, index)
 	if err != nil {
 		return 0, err
 	}
@@ -145,7 +150,7 @@ func evalToFloat[T constraints.Float](e *Evaluator, arg string) (T, error) {
 }
 
 func floatSingleNumberFunc[T constraints.Float](e *Evaluator, arguments string, f func(T) T) (any, error) {
-	value, err := evalToFloat[T](e, arguments)
+	value, err := evalToFloat[T](e, arguments, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -19,7 +19,8 @@ import (
 	"golang.org/x/exp/constraints"
 )
 
-// FloatOperators returns standard operators that work with floating point values.
+// FloatOperators returns standard operators that work with floating point values, as well as with strings, lists,
+// dates, and durations.
 func FloatOperators[T constraints.Float](divideByZeroReturnsZero bool) []*Operator {
 	var divide, modulo OpFunc
 	if divideByZeroReturnsZero {
@@ -35,14 +36,14 @@ func FloatOperators[T constraints.Float](divideByZeroReturnsZero bool) []*Operat
 		LogicalOr(floatLogicalOr[T]),
 		LogicalAnd(floatLogicalAnd[T]),
 		Not(floatNot[T]),
-		Equal(floatEqual[T]),
-		NotEqual(floatNotEqual[T]),
-		GreaterThan(floatGreaterThan[T]),
-		GreaterThanOrEqual(floatGreaterThanOrEqual[T]),
-		LessThan(floatLessThan[T]),
-		LessThanOrEqual(floatLessThanOrEqual[T]),
-		Add(floatAdd[T], floatAddUnary[T]),
-		Subtract(floatSubtract[T], floatSubtractUnary[T]),
+		Equal(valueCompare(floatEqual[T], isEqual)),
+		NotEqual(valueCompare(floatNotEqual[T], isNotEqual)),
+		GreaterThan(valueCompare(floatGreaterThan[T], isGreater)),
+		GreaterThanOrEqual(valueCompare(floatGreaterThanOrEqual[T], isGreaterOrEqual)),
+		LessThan(valueCompare(floatLessThan[T], isLess)),
+		LessThanOrEqual(valueCompare(floatLessThanOrEqual[T], isLessOrEqual)),
+		Add(valueAdd(floatAdd[T]), floatAddUnary[T]),
+		Subtract(valueSubtract(floatSubtract[T]), floatSubtractUnary[T]),
 		Multiply(floatMultiply[T]),
 		Divide(divide),
 		Modulo(modulo),
@@ -304,6 +305,8 @@ func floatFrom[T constraints.Float](arg any) (T, error) {
 		return 0, nil
 	case T:
 		return a, nil
+	case operandText:
+		return floatFrom[T](string(a))
 	case string:
 		var t T
 		f, err := strconv.ParseFloat(a, reflect.TypeOf(t).Bits())
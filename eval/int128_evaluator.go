@@ -0,0 +1,20 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+// NewInt128Evaluator creates a new evaluator whose number type is num.Int128. Fractional results, such as those of
+// division, are truncated.
+func NewInt128Evaluator(resolver VariableResolver, divideByZeroReturnsZero bool) *Evaluator {
+	return &Evaluator{
+		Resolver:  resolver,
+		Operators: Int128Operators(divideByZeroReturnsZero),
+		Functions: Int128Functions(),
+	}
+}
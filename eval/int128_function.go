@@ -0,0 +1,182 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+import (
+	"maps"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xmath/num"
+)
+
+var (
+	maxInt128Float = num.MaxInt128.AsFloat64()
+	minInt128Float = num.MinInt128.AsFloat64()
+)
+
+// Int128Functions returns standard functions that work with 128-bit integer values, along with those from
+// ValueFunctions(). Functions whose results are fractional truncate them, while results that cannot be represented
+// produce an error rather than wrapping around.
+func Int128Functions() map[string]Function {
+	functions := map[string]Function{
+		"abs":   int128Absolute,
+		"cbrt":  int128CubeRoot,
+		"ceil":  int128Identity,
+		"exp":   int128BaseEExponential,
+		"exp2":  int128Base2Exponential,
+		"floor": int128Identity,
+		"if":    int128If,
+		"log":   int128NaturalLog,
+		"log1p": int128NaturalLogSum1,
+		"log10": int128DecimalLog,
+		"max":   int128Maximum,
+		"min":   int128Minimum,
+		"round": int128Identity,
+		"sqrt":  int128SquareRoot,
+	}
+	maps.Copy(functions, ValueFunctions(func(value int) any { return num.Int128From64(int64(value)) }))
+	return functions
+}
+
+func int128Absolute(e *Evaluator, arguments string) (any, error) {
+	value, err := evalToInt128(e, arguments, -1)
+	if err != nil {
+		return nil, err
+	}
+	if value.Sign() < 0 {
+		return value.CheckedNeg()
+	}
+	return value, nil
+}
+
+func int128Base2Exponential(e *Evaluator, arguments string) (any, error) {
+	return int128SingleNumberFunc(e, arguments, math.Exp2)
+}
+
+func int128BaseEExponential(e *Evaluator, arguments string) (any, error) {
+	return int128SingleNumberFunc(e, arguments, math.Exp)
+}
+
+func int128CubeRoot(e *Evaluator, arguments string) (any, error) {
+	return int128SingleNumberFunc(e, arguments, math.Cbrt)
+}
+
+func int128DecimalLog(e *Evaluator, arguments string) (any, error) {
+	return int128SingleNumberFunc(e, arguments, math.Log10)
+}
+
+// int128Identity is used for the rounding functions, since integers are already whole.
+func int128Identity(e *Evaluator, arguments string) (any, error) {
+	return evalToInt128(e, arguments, -1)
+}
+
+func int128If(e *Evaluator, arguments string) (any, error) {
+	var arg string
+	arg, arguments = NextArg(arguments)
+	evaluated, err := e.evaluateArg(arg, 0)
+	if err != nil {
+		return nil, err
+	}
+	var value num.Int128
+	if value, err = Int128From(evaluated); err != nil {
+		if s, ok := textFrom(evaluated); ok {
+			if s != "" && !strings.EqualFold(s, "false") {
+				value = value.Inc()
+			}
+		} else {
+			return nil, err
+		}
+	}
+	index := 1
+	if value.IsZero() {
+		_, arguments = NextArg(arguments)
+		index = 2
+	}
+	arg, _ = NextArg(arguments)
+	return e.evaluateArg(arg, index)
+}
+
+func int128Maximum(e *Evaluator, arguments string) (any, error) {
+	maximum := num.MinInt128
+	for i := 0; arguments != ""; i++ {
+		var arg string
+		arg, arguments = NextArg(arguments)
+		value, err := evalToInt128(e, arg, i)
+		if err != nil {
+			return nil, err
+		}
+		if value.GreaterThan(maximum) {
+			maximum = value
+		}
+	}
+	return maximum, nil
+}
+
+func int128Minimum(e *Evaluator, arguments string) (any, error) {
+	minimum := num.MaxInt128
+	for i := 0; arguments != ""; i++ {
+		var arg string
+		arg, arguments = NextArg(arguments)
+		value, err := evalToInt128(e, arg, i)
+		if err != nil {
+			return nil, err
+		}
+		if value.LessThan(minimum) {
+			minimum = value
+		}
+	}
+	return minimum, nil
+}
+
+func int128NaturalLog(e *Evaluator, arguments string) (any, error) {
+	return int128SingleNumberFunc(e, arguments, math.Log)
+}
+
+func int128NaturalLogSum1(e *Evaluator, arguments string) (any, error) {
+	return int128SingleNumberFunc(e, arguments, math.Log1p)
+}
+
+func int128SquareRoot(e *Evaluator, arguments string) (any, error) {
+	value, err := evalToInt128(e, arguments, -1)
+	if err != nil {
+		return nil, err
+	}
+	if value.Sign() < 0 {
+		return nil, errs.New("result is not a number")
+	}
+	// Computed exactly, since a float64 cannot hold every 128-bit integer.
+	return num.Int128FromBigInt(new(big.Int).Sqrt(value.AsBigInt())), nil
+}
+
+func evalToInt128(e *Evaluator, arg string, index int) (num.Int128, error) {
+	evaluated, err := e.evaluateArg(arg, index)
+	if err != nil {
+		return num.Int128{}, err
+	}
+	return Int128From(evaluated)
+}
+
+func int128SingleNumberFunc(e *Evaluator, arguments string, f func(float64) float64) (any, error) {
+	value, err := evalToInt128(e, arguments, -1)
+	if err != nil {
+		return nil, err
+	}
+	result := f(value.AsFloat64())
+	if math.IsNaN(result) {
+		return nil, errs.New("result is not a number")
+	}
+	if result >= maxInt128Float || result < minInt128Float {
+		return nil, num.ErrOverflow
+	}
+	return num.Int128FromFloat64(result), nil
+}
@@ -0,0 +1,376 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xmath/num"
+)
+
+// Int128Operators returns standard operators that work with 128-bit integer values, as well as with strings, lists,
+// dates, and durations. Arithmetic that overflows results in an error rather than wrapping around.
+func Int128Operators(divideByZeroReturnsZero bool) []*Operator {
+	var divide, modulo OpFunc
+	if divideByZeroReturnsZero {
+		divide = int128DivideAllowDivideByZero
+		modulo = int128ModuloAllowDivideByZero
+	} else {
+		divide = int128Divide
+		modulo = int128Modulo
+	}
+	return []*Operator{
+		OpenParen(),
+		CloseParen(),
+		LogicalOr(int128LogicalOr),
+		LogicalAnd(int128LogicalAnd),
+		Not(int128Not),
+		Equal(valueCompare(int128Equal, isEqual)),
+		NotEqual(valueCompare(int128NotEqual, isNotEqual)),
+		GreaterThan(valueCompare(int128GreaterThan, isGreater)),
+		GreaterThanOrEqual(valueCompare(int128GreaterThanOrEqual, isGreaterOrEqual)),
+		LessThan(valueCompare(int128LessThan, isLess)),
+		LessThanOrEqual(valueCompare(int128LessThanOrEqual, isLessOrEqual)),
+		Add(valueAdd(int128Add), int128AddUnary),
+		Subtract(valueSubtract(int128Subtract), int128SubtractUnary),
+		Multiply(int128Multiply),
+		Divide(divide),
+		Modulo(modulo),
+		Power(int128Power),
+	}
+}
+
+func int128Not(arg any) (any, error) {
+	if b, ok := arg.(bool); ok {
+		return !b, nil
+	}
+	v, err := Int128From(arg)
+	if err != nil {
+		return nil, err
+	}
+	if v.IsZero() {
+		return true, nil
+	}
+	return false, nil
+}
+
+func int128LogicalOr(left, right any) (any, error) {
+	l, err := Int128From(left)
+	if err != nil {
+		return nil, err
+	}
+	if !l.IsZero() {
+		return true, nil
+	}
+	var r num.Int128
+	r, err = Int128From(right)
+	if err != nil {
+		return nil, err
+	}
+	return !r.IsZero(), nil
+}
+
+func int128LogicalAnd(left, right any) (any, error) {
+	l, err := Int128From(left)
+	if err != nil {
+		return nil, err
+	}
+	if l.IsZero() {
+		return false, nil
+	}
+	var r num.Int128
+	r, err = Int128From(right)
+	if err != nil {
+		return nil, err
+	}
+	return !r.IsZero(), nil
+}
+
+func int128Equal(left, right any) (any, error) {
+	var r num.Int128
+	l, err := Int128From(left)
+	if err == nil {
+		r, err = Int128From(right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) == fmt.Sprintf("%v", right), nil
+	}
+	return l == r, nil
+}
+
+func int128NotEqual(left, right any) (any, error) {
+	var r num.Int128
+	l, err := Int128From(left)
+	if err == nil {
+		r, err = Int128From(right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) != fmt.Sprintf("%v", right), nil
+	}
+	return l != r, nil
+}
+
+func int128GreaterThan(left, right any) (any, error) {
+	var r num.Int128
+	l, err := Int128From(left)
+	if err == nil {
+		r, err = Int128From(right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) > fmt.Sprintf("%v", right), nil
+	}
+	return l.GreaterThan(r), nil
+}
+
+func int128GreaterThanOrEqual(left, right any) (any, error) {
+	var r num.Int128
+	l, err := Int128From(left)
+	if err == nil {
+		r, err = Int128From(right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) >= fmt.Sprintf("%v", right), nil
+	}
+	return l.GreaterThanOrEqual(r), nil
+}
+
+func int128LessThan(left, right any) (any, error) {
+	var r num.Int128
+	l, err := Int128From(left)
+	if err == nil {
+		r, err = Int128From(right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) < fmt.Sprintf("%v", right), nil
+	}
+	return l.LessThan(r), nil
+}
+
+func int128LessThanOrEqual(left, right any) (any, error) {
+	var r num.Int128
+	l, err := Int128From(left)
+	if err == nil {
+		r, err = Int128From(right)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", left) <= fmt.Sprintf("%v", right), nil
+	}
+	return l.LessThanOrEqual(r), nil
+}
+
+func int128Add(left, right any) (any, error) {
+	var r num.Int128
+	l, err := Int128From(left)
+	if err == nil {
+		r, err = Int128From(right)
+	}
+	if err != nil {
+		if errors.Is(err, num.ErrOverflow) {
+			return nil, err
+		}
+		return fmt.Sprintf("%v%v", left, right), nil
+	}
+	return l.CheckedAdd(r)
+}
+
+func int128AddUnary(arg any) (any, error) {
+	return Int128From(arg)
+}
+
+func int128Subtract(left, right any) (any, error) {
+	l, err := Int128From(left)
+	if err != nil {
+		return nil, err
+	}
+	var r num.Int128
+	r, err = Int128From(right)
+	if err != nil {
+		return nil, err
+	}
+	return l.CheckedSub(r)
+}
+
+func int128SubtractUnary(arg any) (any, error) {
+	v, err := Int128From(arg)
+	if err != nil {
+		return nil, err
+	}
+	return v.CheckedNeg()
+}
+
+func int128Multiply(left, right any) (any, error) {
+	l, err := Int128From(left)
+	if err != nil {
+		return nil, err
+	}
+	var r num.Int128
+	r, err = Int128From(right)
+	if err != nil {
+		return nil, err
+	}
+	return l.CheckedMul(r)
+}
+
+func int128Divide(left, right any) (any, error) {
+	l, err := Int128From(left)
+	if err != nil {
+		return nil, err
+	}
+	var r num.Int128
+	r, err = Int128From(right)
+	if err != nil {
+		return nil, err
+	}
+	if r.IsZero() {
+		return nil, errs.New("divide by zero")
+	}
+	return l.CheckedDiv(r)
+}
+
+func int128DivideAllowDivideByZero(left, right any) (any, error) {
+	l, err := Int128From(left)
+	if err != nil {
+		return nil, err
+	}
+	var r num.Int128
+	r, err = Int128From(right)
+	if err != nil {
+		return nil, err
+	}
+	if r.IsZero() {
+		return r, nil
+	}
+	return l.CheckedDiv(r)
+}
+
+func int128Modulo(left, right any) (any, error) {
+	l, err := Int128From(left)
+	if err != nil {
+		return nil, err
+	}
+	var r num.Int128
+	r, err = Int128From(right)
+	if err != nil {
+		return nil, err
+	}
+	if r.IsZero() {
+		return nil, errs.New("divide by zero")
+	}
+	return l.Mod(r), nil
+}
+
+func int128ModuloAllowDivideByZero(left, right any) (any, error) {
+	l, err := Int128From(left)
+	if err != nil {
+		return nil, err
+	}
+	var r num.Int128
+	r, err = Int128From(right)
+	if err != nil {
+		return nil, err
+	}
+	if r.IsZero() {
+		return r, nil
+	}
+	return l.Mod(r), nil
+}
+
+func int128Power(left, right any) (any, error) {
+	l, err := Int128From(left)
+	if err != nil {
+		return nil, err
+	}
+	var r num.Int128
+	r, err = Int128From(right)
+	if err != nil {
+		return nil, err
+	}
+	return int128Pow(l, r)
+}
+
+func int128Pow(base, exponent num.Int128) (num.Int128, error) {
+	one := num.Int128From64(1)
+	switch {
+	case base == one:
+		return one, nil
+	case base.Equal64(-1):
+		if exponent.Mod64(2).IsZero() {
+			return one, nil
+		}
+		return base, nil
+	case exponent.Sign() < 0:
+		if base.IsZero() {
+			return num.Int128{}, errs.New("divide by zero")
+		}
+		// The result is a fraction, which truncates to zero.
+		return num.Int128{}, nil
+	case !exponent.IsInt64():
+		if base.IsZero() {
+			return base, nil
+		}
+		return num.Int128{}, num.ErrOverflow
+	default:
+		return powBySquaring(exponent.AsInt64(), one, base, num.Int128.CheckedMul)
+	}
+}
+
+// powBySquaring raises base to the non-negative exponent, using mul to perform each multiplication so that overflow
+// can be reported.
+func powBySquaring[V any](exponent int64, one, base V, mul func(left, right V) (V, error)) (V, error) {
+	result := one
+	var err error
+	for exponent > 0 {
+		if exponent&1 != 0 {
+			if result, err = mul(result, base); err != nil {
+				return result, err
+			}
+		}
+		if exponent >>= 1; exponent > 0 {
+			if base, err = mul(base, base); err != nil {
+				return base, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// Int128From attempts to convert the arg into a num.Int128. Strings with a fractional part are truncated.
+func Int128From(arg any) (num.Int128, error) {
+	switch a := arg.(type) {
+	case bool:
+		if a {
+			return num.Int128From64(1), nil
+		}
+		return num.Int128{}, nil
+	case num.Int128:
+		return a, nil
+	case operandText:
+		return Int128From(string(a))
+	case string:
+		return int128FromString(a)
+	default:
+		return num.Int128{}, errs.Newf("not a number: %v", arg)
+	}
+}
+
+func int128FromString(s string) (num.Int128, error) {
+	b, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		var f *big.Float
+		if f, ok = new(big.Float).SetString(s); !ok || f.IsInf() {
+			return num.Int128{}, errs.Newf("invalid value: %s", s)
+		}
+		b, _ = f.Int(nil)
+	}
+	return num.CheckedInt128FromBigInt(b)
+}
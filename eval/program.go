@@ -0,0 +1,651 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+var (
+	_ Node = &OperandNode{}
+	_ Node = &FunctionNode{}
+	_ Node = &OperatorNode{}
+	_ Node = &ListNode{}
+	_ Node = &IndexNode{}
+	_ Node = &BlockNode{}
+	_ Node = &LetNode{}
+	_ Node = &DefineNode{}
+)
+
+// Node is an element of the abstract syntax tree of a compiled Program. It will be one of *OperandNode, *FunctionNode,
+// *OperatorNode, *ListNode, *IndexNode, *BlockNode, *LetNode, or *DefineNode.
+type Node interface {
+	Location() Span
+	evaluate(e *Evaluator) (any, error)
+}
+
+// Span holds the byte offsets of the portion of a Program's expression that a Node was compiled from.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Location returns the Span.
+func (s Span) Location() Span {
+	return s
+}
+
+// OperandNode holds a literal operand. Any variables referenced by the operand are replaced with their values each time
+// the operand is evaluated. Quoted is true for string literals, whose Text has already been unquoted and which never
+// reference variables.
+type OperandNode struct {
+	Span
+	Text      string
+	Variables []string
+	Unary     *Operator
+	Quoted    bool
+	dynamic   bool
+}
+
+// FunctionNode holds a call to a Function. Args contains the compiled form of each argument. The standard functions
+// evaluate their arguments from Args, while other Functions are still handed the text of their arguments, which calls
+// to EvaluateNew() map back to the same compiled form.
+type FunctionNode struct {
+	Span
+	Name      string
+	Args      []Node
+	Unary     *Operator
+	function  Function
+	arguments string
+	args      []string
+}
+
+// OperatorNode holds an operator along with its operands. Either Left or Right may be nil when the operator is being
+// applied to a single operand.
+type OperatorNode struct {
+	Span
+	Op    *Operator
+	Unary *Operator
+	Left  Node
+	Right Node
+}
+
+// ListNode holds a list literal.
+type ListNode struct {
+	Span
+	Elements []Node
+	Unary    *Operator
+}
+
+// IndexNode holds an index into a list or string.
+type IndexNode struct {
+	Span
+	Target Node
+	Index  Node
+	Unary  *Operator
+}
+
+// BlockNode holds a sequence of statements. Its value is that of the last statement.
+type BlockNode struct {
+	Span
+	Statements []Node
+}
+
+// LetNode binds the value of an expression to a Name for use by the statements that follow it.
+type LetNode struct {
+	Span
+	Name  string
+	Value Node
+}
+
+// DefineNode holds the definition of a user-defined function. The function is defined when the Program is compiled, so
+// evaluating a DefineNode does nothing.
+type DefineNode struct {
+	Span
+	Name   string
+	Params []string
+	Body   Node
+}
+
+// Program holds a compiled expression that may be evaluated many times without being parsed again.
+type Program struct {
+	root      Node
+	source    string
+	operators []*Operator
+	functions map[string]Function
+	defined   map[string]Function
+	compiled  map[string]Node
+	variables []string
+	calls     []string
+	maxDepth  int
+}
+
+type compiler struct {
+	evaluator *Evaluator
+	source    string
+	compiled  map[string]Node
+	defined   map[string]Function
+}
+
+// Compile an expression into a Program that uses the Operators and Functions from this Evaluator. Variables are not
+// resolved until the Program is evaluated. Unlike Evaluate, variables found in function arguments are resolved as
+// values rather than being spliced into the argument text. Problems found while compiling the expression are returned
+// as a *SyntaxError. Functions that were defined by earlier calls to Evaluate are available to the Program, while those
+// defined by the expression itself are only available to the Program.
+func (e *Evaluator) Compile(expression string) (*Program, error) {
+	p := &Program{
+		source:    expression,
+		operators: e.Operators,
+		functions: e.Functions,
+		defined:   maps.Clone(e.defined),
+		compiled:  make(map[string]Node),
+		maxDepth:  e.MaxDepth,
+	}
+	if p.defined == nil {
+		p.defined = make(map[string]Function)
+	}
+	c := &compiler{
+		evaluator: e,
+		source:    expression,
+		compiled:  p.compiled,
+		defined:   p.defined,
+	}
+	var err error
+	if p.root, err = c.compile(expression, 0); err != nil {
+		return nil, err
+	}
+	p.collect(p.root, nil)
+	return p, nil
+}
+
+// Root returns the root node of the Program's abstract syntax tree. May be nil if the expression was empty.
+func (p *Program) Root() Node {
+	return p.root
+}
+
+// Expression returns the expression the Program was compiled from.
+func (p *Program) Expression() string {
+	return p.source
+}
+
+// Variables returns the names of the variables referenced by the Program, in the order they first appear.
+func (p *Program) Variables() []string {
+	return append([]string(nil), p.variables...)
+}
+
+// Functions returns the names of the functions called by the Program, in the order they first appear.
+func (p *Program) Functions() []string {
+	return append([]string(nil), p.calls...)
+}
+
+// Eval evaluates the Program, using the resolver to obtain the values of any variables. If the Program does not
+// reference any variables, the resolver may be nil. A Program may be evaluated concurrently. Problems found while
+// evaluating the Program are returned as an *EvalError.
+func (p *Program) Eval(resolver VariableResolver) (any, error) {
+	e := &Evaluator{
+		Resolver:   resolver,
+		Operators:  p.operators,
+		Functions:  p.functions,
+		MaxDepth:   p.maxDepth,
+		compiled:   p.compiled,
+		defined:    p.defined,
+		source:     p.source,
+		expression: p.source,
+	}
+	v, err := e.evaluateProgram(p.root)
+	if err != nil {
+		return nil, err
+	}
+	return exportValue(v), nil
+}
+
+// collect records the variables and functions referenced by node. References to the names in bound find local bindings
+// rather than variables, so are not recorded.
+func (p *Program) collect(node Node, bound []string) {
+	switch n := node.(type) {
+	case *OperandNode:
+		for _, name := range n.Variables {
+			if !slices.Contains(bound, name) {
+				p.variables = appendUnique(p.variables, name)
+			}
+		}
+	case *FunctionNode:
+		p.calls = appendUnique(p.calls, n.Name)
+		for _, arg := range n.Args {
+			p.collect(arg, bound)
+		}
+	case *OperatorNode:
+		p.collect(n.Left, bound)
+		p.collect(n.Right, bound)
+	case *ListNode:
+		for _, element := range n.Elements {
+			p.collect(element, bound)
+		}
+	case *IndexNode:
+		p.collect(n.Target, bound)
+		p.collect(n.Index, bound)
+	case *BlockNode:
+		// A binding is only visible to the statements that follow it.
+		bound = slices.Clip(bound)
+		for _, one := range n.Statements {
+			p.collect(one, bound)
+			if let, ok := one.(*LetNode); ok {
+				bound = append(bound, let.Name)
+			}
+		}
+	case *LetNode:
+		p.collect(n.Value, bound)
+	case *DefineNode:
+		// The body of a function can't see the bindings around it, and its parameters can't be referred to as
+		// variables.
+		p.collect(n.Body, nil)
+	default:
+	}
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, one := range list {
+		if one == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// compile the text, which is found at offset within the source expression.
+func (c *compiler) compile(text string, offset int) (Node, error) {
+	statements, err := parseStatements(text)
+	if err != nil {
+		var syntaxErr *SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, syntaxErr.rebase(c.source, offset)
+		}
+		return nil, err
+	}
+	if statements != nil {
+		for i := range statements {
+			statements[i].offset += offset
+			statements[i].nameOffset += offset
+			statements[i].bodyOffset += offset
+		}
+		return c.compileStatements(statements, Span{Start: offset, End: offset + len(text)})
+	}
+	other := Evaluator{
+		Operators: c.evaluator.Operators,
+		Functions: c.evaluator.Functions,
+		defined:   c.defined,
+	}
+	if err = other.parse(text); err != nil {
+		var syntaxErr *SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, syntaxErr.rebase(c.source, offset)
+		}
+		return nil, err
+	}
+	for len(other.operatorStack) != 0 {
+		other.processTree()
+	}
+	if len(other.operandStack) == 0 {
+		return nil, nil
+	}
+	return c.toNode(other.operandStack[len(other.operandStack)-1], offset)
+}
+
+func (c *compiler) compileStatements(statements []statement, location Span) (Node, error) {
+	block := &BlockNode{Span: location}
+	for i := range statements {
+		if statements[i].function {
+			if err := statements[i].define(c.source, c.evaluator.Functions, c.defined); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i := range statements {
+		s := &statements[i]
+		location := Span{
+			Start: s.offset,
+			End:   s.offset + len(s.text),
+		}
+		switch {
+		case s.function:
+			body, err := c.compileArg(s.body, s.bodyOffset)
+			if err != nil {
+				return nil, err
+			}
+			block.Statements = append(block.Statements, &DefineNode{
+				Span:   location,
+				Name:   s.name,
+				Params: s.params,
+				Body:   body,
+			})
+		case s.binding:
+			value, err := c.compile(s.body, s.bodyOffset)
+			if err != nil {
+				return nil, err
+			}
+			block.Statements = append(block.Statements, &LetNode{
+				Span:  location,
+				Name:  s.name,
+				Value: value,
+			})
+		default:
+			node, err := c.compile(s.text, s.offset)
+			if err != nil {
+				return nil, err
+			}
+			block.Statements = append(block.Statements, node)
+		}
+	}
+	return block, nil
+}
+
+func (c *compiler) toNode(operand any, offset int) (Node, error) {
+	where := spanOf(operand)
+	location := Span{
+		Start: where.start + offset,
+		End:   where.end + offset,
+	}
+	switch op := operand.(type) {
+	case *expressionTree:
+		left, err := c.toNode(op.left, offset)
+		if err != nil {
+			return nil, err
+		}
+		var right Node
+		if right, err = c.toNode(op.right, offset); err != nil {
+			return nil, err
+		}
+		return &OperatorNode{
+			Span:  location,
+			Op:    op.op,
+			Unary: op.unaryOp,
+			Left:  left,
+			Right: right,
+		}, nil
+	case *expressionOperand:
+		if op.quoted {
+			return &OperandNode{
+				Span:   location,
+				Text:   op.value,
+				Unary:  op.unaryOp,
+				Quoted: true,
+			}, nil
+		}
+		return &OperandNode{
+			Span:      location,
+			Text:      op.value,
+			Variables: variableNames(op.value),
+			Unary:     op.unaryOp,
+			dynamic:   nextDollar(op.value, 0) != -1,
+		}, nil
+	case *expressionList:
+		n := &ListNode{
+			Span:  location,
+			Unary: op.unaryOp,
+		}
+		for i, element := range op.elements {
+			node, err := c.compile(element, offset+op.offsets[i])
+			if err != nil {
+				return nil, err
+			}
+			n.Elements = append(n.Elements, node)
+		}
+		return n, nil
+	case *expressionIndex:
+		target, err := c.toNode(op.target, offset)
+		if err != nil {
+			return nil, err
+		}
+		var index Node
+		if index, err = c.compile(op.index, offset+op.offset); err != nil {
+			return nil, err
+		}
+		return &IndexNode{
+			Span:   location,
+			Target: target,
+			Index:  index,
+			Unary:  op.unaryOp,
+		}, nil
+	case *parsedFunction:
+		n := &FunctionNode{
+			Span:      location,
+			Name:      op.name,
+			Unary:     op.unaryOp,
+			function:  op.function,
+			arguments: op.args,
+		}
+		argOffset := offset + op.argsStart
+		remaining := op.args
+		for remaining != "" {
+			var arg string
+			before := len(remaining)
+			arg, remaining = NextArg(remaining)
+			node, err := c.compileArg(arg, argOffset)
+			if err != nil {
+				return nil, err
+			}
+			n.Args = append(n.Args, node)
+			n.args = append(n.args, arg)
+			argOffset += before - len(remaining)
+		}
+		// Some functions evaluate their entire argument string at once, so make that available, too. Failure here
+		// isn't fatal, since the individual arguments have already been compiled successfully.
+		if _, exists := c.compiled[op.args]; !exists {
+			if node, err := c.compile(op.args, offset+op.argsStart); err == nil {
+				c.compiled[op.args] = node
+			}
+		}
+		return n, nil
+	default:
+		if op != nil {
+			return nil, errs.New("invalid expression")
+		}
+		return nil, nil
+	}
+}
+
+// compileArg compiles a function argument or body and records it so that calls to EvaluateNew() with the same text
+// will use it. When identical text is found elsewhere in the expression, only its first occurrence is recorded, but
+// each occurrence is compiled separately so that the locations recorded in its nodes are its own.
+func (c *compiler) compileArg(arg string, offset int) (Node, error) {
+	node, err := c.compile(arg, offset)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := c.compiled[arg]; !exists {
+		c.compiled[arg] = node
+	}
+	return node, nil
+}
+
+func (e *Evaluator) evaluateProgram(node Node) (any, error) {
+	if node == nil {
+		return "", nil
+	}
+	return node.evaluate(e)
+}
+
+func (n *OperandNode) evaluate(e *Evaluator) (any, error) {
+	var v any = n.Text
+	if !n.Quoted {
+		v = operandText(n.Text)
+		if local, ok := e.value(n.Text); ok {
+			v = local
+		} else if n.dynamic {
+			text, err := e.replaceVariables(n.Text, false)
+			if err != nil {
+				return nil, e.spanError(err, n.Start, n.End)
+			}
+			v = operandText(text)
+		}
+	}
+	v, err := applyUnary(n.Unary, v)
+	return v, e.spanError(err, n.Start, n.End)
+}
+
+func (n *BlockNode) evaluate(e *Evaluator) (any, error) {
+	local := e.derive()
+	local.expression = e.expression
+	local.scope = &scope{
+		values: make(map[string]any),
+		parent: e.scope,
+	}
+	var result any = ""
+	for _, one := range n.Statements {
+		v, err := local.evaluateProgram(one)
+		if err != nil {
+			return nil, err
+		}
+		result = v
+	}
+	return result, nil
+}
+
+func (n *LetNode) evaluate(e *Evaluator) (any, error) {
+	v, err := e.evaluateProgram(n.Value)
+	if err != nil {
+		return nil, err
+	}
+	e.scope.values[n.Name] = v
+	return v, nil
+}
+
+func (n *DefineNode) evaluate(_ *Evaluator) (any, error) {
+	return "", nil
+}
+
+func (n *ListNode) evaluate(e *Evaluator) (any, error) {
+	list := make([]any, 0, len(n.Elements))
+	for _, element := range n.Elements {
+		v, err := e.evaluateProgram(element)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	v, err := applyUnary(n.Unary, list)
+	return v, e.spanError(err, n.Start, n.End)
+}
+
+func (n *IndexNode) evaluate(e *Evaluator) (any, error) {
+	target, err := evaluateNode(e, n.Target)
+	if err != nil {
+		return nil, err
+	}
+	var index, v any
+	if index, err = e.evaluateProgram(n.Index); err != nil {
+		return nil, err
+	}
+	if v, err = indexValue(target, index); err == nil {
+		v, err = applyUnary(n.Unary, v)
+	}
+	return v, e.spanError(err, n.Start, n.End)
+}
+
+func (n *FunctionNode) evaluate(e *Evaluator) (any, error) {
+	call := e.call
+	e.call = &functionCall{
+		arguments: n.arguments,
+		args:      n.args,
+		nodes:     n.Args,
+		start:     -1,
+	}
+	v, err := n.function(e, n.arguments)
+	e.call = call
+	if err != nil {
+		return nil, e.nestedError(err, "", -1, n.Start, n.End)
+	}
+	v, err = applyUnary(n.Unary, v)
+	return v, e.spanError(err, n.Start, n.End)
+}
+
+func (n *OperatorNode) evaluate(e *Evaluator) (any, error) {
+	left, err := evaluateNode(e, n.Left)
+	if err != nil {
+		return nil, err
+	}
+	var right any
+	if right, err = evaluateNode(e, n.Right); err != nil {
+		return nil, err
+	}
+	if n.Left != nil && n.Right != nil {
+		if n.Op.Evaluate == nil {
+			return nil, e.spanError(errs.New("operator does not have Evaluate function defined"), n.Start, n.End)
+		}
+		var v any
+		if v, err = n.Op.Evaluate(left, right); err == nil {
+			v, err = applyUnary(n.Unary, v)
+		}
+		return v, e.spanError(err, n.Start, n.End)
+	}
+	var v any
+	if n.Right == nil {
+		v = left
+	} else {
+		v = right
+	}
+	if v != nil {
+		if n.Unary != nil && n.Unary.EvaluateUnary != nil {
+			v, err = n.Unary.EvaluateUnary(v)
+		} else if n.Op != nil && n.Op.EvaluateUnary != nil {
+			v, err = n.Op.EvaluateUnary(v)
+		}
+		if err != nil {
+			return nil, e.spanError(err, n.Start, n.End)
+		}
+	}
+	if v == nil {
+		return nil, e.spanError(errs.New("expression is invalid"), n.Start, n.End)
+	}
+	return v, nil
+}
+
+func evaluateNode(e *Evaluator, node Node) (any, error) {
+	if node == nil {
+		return nil, nil
+	}
+	return node.evaluate(e)
+}
+
+func applyUnary(unaryOp *Operator, v any) (any, error) {
+	if unaryOp != nil && unaryOp.EvaluateUnary != nil {
+		return unaryOp.EvaluateUnary(v)
+	}
+	return v, nil
+}
+
+func variableNames(text string) []string {
+	var names []string
+	for i := 0; i < len(text); i++ {
+		if text[i] == '"' {
+			i = quotedEnd(text, i)
+			continue
+		}
+		if text[i] != '$' {
+			continue
+		}
+		last := i
+		for j, ch := range text[i+1:] {
+			if !isVariableRune(ch, j == 0) {
+				break
+			}
+			last = i + 1 + j
+		}
+		if last != i {
+			names = appendUnique(names, text[i+1:last+1])
+			i = last
+		}
+	}
+	return names
+}
@@ -0,0 +1,101 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/eval"
+	"github.com/ddkwork/toolbox/xmath/fixed"
+)
+
+func TestFixedProgram(t *testing.T) {
+	e := eval.NewFixedEvaluator[fixed.D4](nil, true)
+	for i := 0; i < len(numExpr); i += 3 {
+		p, err := e.Compile(numExpr[i])
+		check.NoError(t, err, "%d: %s", i, numExpr[i])
+		var result any
+		result, err = p.Eval(resolver{})
+		check.NoError(t, err, "%d: %s == %s", i, numExpr[i], numExpr[i+1])
+		check.Equal(t, numExpr[i+1], fmt.Sprintf("%v", result), "%d: %s == %s", i, numExpr[i], numExpr[i+1])
+	}
+	for i := 0; i < len(strExpr); i += 2 {
+		p, err := e.Compile(strExpr[i])
+		check.NoError(t, err, "%d: %s", i, strExpr[i])
+		var result any
+		result, err = p.Eval(resolver{})
+		check.NoError(t, err, "%d: %s == %s", i, strExpr[i], strExpr[i+1])
+		check.Equal(t, strExpr[i+1], result, "%d: %s == %s", i, strExpr[i], strExpr[i+1])
+	}
+
+	e = eval.NewFixedEvaluator[fixed.D4](nil, false)
+	p, err := e.Compile("1 / 0")
+	check.NoError(t, err)
+	_, err = p.Eval(nil)
+	check.Error(t, err)
+}
+
+func TestFloatProgram(t *testing.T) {
+	e := eval.NewFloatEvaluator[float64](nil, true)
+	for i := 0; i < len(numExpr); i += 3 {
+		p, err := e.Compile(numExpr[i])
+		check.NoError(t, err, "%d: %s", i, numExpr[i])
+		var result any
+		result, err = p.Eval(resolver{})
+		check.NoError(t, err, "%d: %s == %s", i, numExpr[i], numExpr[i+2])
+		check.Equal(t, numExpr[i+2], fmt.Sprintf("%0.16f", result), "%d: %s == %s", i, numExpr[i], numExpr[i+2])
+	}
+	for i := 0; i < len(strExpr); i += 2 {
+		p, err := e.Compile(strExpr[i])
+		check.NoError(t, err, "%d: %s", i, strExpr[i])
+		var result any
+		result, err = p.Eval(resolver{})
+		check.NoError(t, err, "%d: %s == %s", i, strExpr[i], strExpr[i+1])
+		check.Equal(t, strExpr[i+1], result, "%d: %s == %s", i, strExpr[i], strExpr[i+1])
+	}
+}
+
+func TestProgramReuse(t *testing.T) {
+	e := eval.NewFloatEvaluator[float64](nil, true)
+	p, err := e.Compile("max($a, $b * 2) + if($a > $b, abs($c), 0)")
+	check.NoError(t, err)
+	check.Equal(t, []string{"a", "b", "c"}, p.Variables())
+	check.Equal(t, []string{"max", "if", "abs"}, p.Functions())
+	_, ok := p.Root().(*eval.OperatorNode)
+	check.True(t, ok)
+
+	var result any
+	result, err = p.Eval(mapResolver{"a": "3", "b": "1", "c": "-4"})
+	check.NoError(t, err)
+	check.Equal(t, 7.0, result)
+	result, err = p.Eval(mapResolver{"a": "1", "b": "5", "c": "-4"})
+	check.NoError(t, err)
+	check.Equal(t, 10.0, result)
+
+	_, err = p.Eval(nil)
+	check.Error(t, err)
+
+	_, err = e.Compile("unknown(1)")
+	check.Error(t, err)
+
+	p, err = e.Compile("")
+	check.NoError(t, err)
+	result, err = p.Eval(nil)
+	check.NoError(t, err)
+	check.Equal(t, "", result)
+}
+
+type mapResolver map[string]string
+
+func (m mapResolver) ResolveVariable(variableName string) string {
+	return m[variableName]
+}
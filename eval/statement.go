@@ -0,0 +1,257 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+import (
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// DefaultMaxDepth is the maximum nesting of calls to user-defined functions that is permitted when an Evaluator's
+// MaxDepth is zero.
+const DefaultMaxDepth = 64
+
+// scope holds local bindings. When bare is true, its values may only be referred to by their bare names, not as
+// variables.
+type scope struct {
+	values map[string]any
+	parent *scope
+	bare   bool
+}
+
+type statement struct {
+	text       string
+	offset     int
+	name       string
+	nameOffset int
+	params     []string
+	body       string
+	bodyOffset int
+	binding    bool
+	function   bool
+}
+
+// lookup returns the value bound to name. The variable flag should be true when name was referred to as a variable.
+func (s *scope) lookup(name string, variable bool) (any, bool) {
+	for one := s; one != nil; one = one.parent {
+		if one.bare && variable {
+			continue
+		}
+		if v, ok := one.values[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// parseStatements splits the expression into its semicolon-separated statements. Semicolons within parentheses,
+// brackets, or quoted strings do not separate statements. Returns nil if the expression is a single, plain expression.
+func parseStatements(expression string) ([]statement, error) {
+	if strings.IndexByte(expression, ';') == -1 && !isLet(expression) {
+		return nil, nil
+	}
+	var statements []statement
+	add := func(start, end int) {
+		if text := expression[start:end]; strings.TrimSpace(text) != "" {
+			statements = append(statements, statement{
+				text:   text,
+				offset: start,
+			})
+		}
+	}
+	depth := 0
+	start := 0
+	for i := 0; i < len(expression); i++ {
+		switch expression[i] {
+		case '"':
+			i = quotedEnd(expression, i)
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ';':
+			if depth == 0 {
+				add(start, i)
+				start = i + 1
+			}
+		default:
+		}
+	}
+	add(start, len(expression))
+	if len(statements) == 1 && statements[0].text == expression && !isLet(expression) {
+		return nil, nil
+	}
+	for i := range statements {
+		if isLet(statements[i].text) {
+			if err := statements[i].parseLet(expression); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return statements, nil
+}
+
+func isLet(text string) bool {
+	text = strings.TrimLeft(text, " \t\n\r")
+	return len(text) > 3 && strings.HasPrefix(text, "let") && isSpace(text[3])
+}
+
+// parseLet fills in the details of a let statement. Errors are reported relative to the full expression.
+func (s *statement) parseLet(expression string) error {
+	end := s.offset + len(s.text)
+	i := s.offset + strings.Index(s.text, "let") + 3
+	i = skipSpace(expression, i, end)
+	s.nameOffset = i
+	for i < end && isVariableRune(rune(expression[i]), i == s.nameOffset) {
+		i++
+	}
+	if i == s.nameOffset {
+		return newSyntaxError(expression, i, "", "name", "missing name")
+	}
+	s.name = expression[s.nameOffset:i]
+	i = skipSpace(expression, i, end)
+	if i < end && expression[i] == '(' {
+		closing := strings.IndexByte(expression[i:end], ')')
+		if closing == -1 {
+			return newSyntaxError(expression, i, "(", ")", "parameters not closed")
+		}
+		closing += i
+		s.function = true
+		s.params = make([]string, 0)
+		if params := expression[i+1 : closing]; strings.TrimSpace(params) != "" {
+			offset := i + 1
+			for _, param := range strings.Split(params, ",") {
+				name := strings.TrimSpace(param)
+				where := offset + strings.Index(param, name)
+				if !isName(name) {
+					return newSyntaxError(expression, where, name, "parameter name", "invalid parameter")
+				}
+				for _, one := range s.params {
+					if one == name {
+						return newSyntaxError(expression, where, name, "", "duplicate parameter")
+					}
+				}
+				s.params = append(s.params, name)
+				offset += len(param) + 1
+			}
+		}
+		i = skipSpace(expression, closing+1, end)
+	} else {
+		s.binding = true
+	}
+	if i >= end || expression[i] != '=' || (i+1 < end && expression[i+1] == '=') {
+		return newSyntaxError(expression, i, "", "=", "missing assignment")
+	}
+	s.bodyOffset = i + 1
+	s.body = expression[s.bodyOffset:end]
+	if strings.TrimSpace(s.body) == "" {
+		return newSyntaxError(expression, end, "", "expression", "missing expression")
+	}
+	return nil
+}
+
+// define registers the user-defined function described by this statement in defined.
+func (s *statement) define(expression string, builtin, defined map[string]Function) error {
+	if _, exists := builtin[s.name]; exists {
+		return newSyntaxError(expression, s.nameOffset, s.name, "", "function already defined")
+	}
+	defined[s.name] = userFunction(s.name, s.params, s.body)
+	return nil
+}
+
+func (e *Evaluator) evaluateStatements(expression string, statements []statement) (any, error) {
+	e.expression = expression
+	if e.defined == nil {
+		e.defined = make(map[string]Function)
+	}
+	// Define all functions up front, so that they may call each other regardless of the order they appear in.
+	for i := range statements {
+		if statements[i].function {
+			if err := statements[i].define(expression, e.Functions, e.defined); err != nil {
+				return nil, err
+			}
+		}
+	}
+	local := e.derive()
+	local.scope = &scope{
+		values: make(map[string]any),
+		parent: e.scope,
+	}
+	var result any = ""
+	for i := range statements {
+		s := &statements[i]
+		switch {
+		case s.function:
+			result = ""
+		case s.binding:
+			v, err := local.evaluateNew(s.body)
+			if err != nil {
+				return nil, e.nestedError(err, s.body, s.bodyOffset, s.offset, s.offset+len(s.text))
+			}
+			local.scope.values[s.name] = v
+			result = v
+		default:
+			v, err := local.evaluateNew(s.text)
+			if err != nil {
+				return nil, e.nestedError(err, s.text, s.offset, s.offset, s.offset+len(s.text))
+			}
+			result = v
+		}
+	}
+	return result, nil
+}
+
+// userFunction returns a Function that evaluates body with each of its parameters bound to the value of the
+// corresponding argument.
+func userFunction(name string, params []string, body string) Function {
+	return func(e *Evaluator, arguments string) (any, error) {
+		args, err := evalArgs(e, arguments, len(params), len(params))
+		if err != nil {
+			return nil, err
+		}
+		limit := e.MaxDepth
+		if limit <= 0 {
+			limit = DefaultMaxDepth
+		}
+		if e.depth >= limit {
+			return nil, errs.Newf("%s() exceeded the maximum call depth of %d", name, limit)
+		}
+		callee := e.derive()
+		callee.depth = e.depth + 1
+		callee.scope = &scope{
+			values: make(map[string]any, len(params)),
+			bare:   true,
+		}
+		for i, param := range params {
+			callee.scope.values[param] = args[i]
+		}
+		return callee.evaluateNew(body)
+	}
+}
+
+func skipSpace(expression string, i, end int) int {
+	for i < end && isSpace(expression[i]) {
+		i++
+	}
+	return i
+}
+
+func isName(text string) bool {
+	if text == "" {
+		return false
+	}
+	for i, ch := range text {
+		if !isVariableRune(ch, i == 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/eval"
+	"github.com/ddkwork/toolbox/xmath/fixed"
+)
+
+var statementExpr = []string{
+	"let f(x) = x * 2; f(3)", "6",
+	"let y = 3; y + 1", "4",
+	"let a = 2; let b = $a * 3; b - a", "4",
+	"let add(a, b) = a + b; add(add(1, 2), 3)", "6",
+	"let hyp(a, b) = sqrt(a * a + b * b); hyp(3, 4)", "5",
+	"let fact(n) = if(n <= 1, 1, n * fact(n - 1)); fact(5)", "120",
+	"let even(n) = if(n == 0, 1, odd(n - 1)); let odd(n) = if(n == 0, 0, even(n - 1)); even(10)", "1",
+	"let answer() = 42; answer() - 2", "40",
+	"let twice(x) = x + x; let v = twice(-$a); -v", "4",
+	"let xs = [1, 2, 3]; len(xs) + xs[-1]", "6",
+	`let greet(name) = "Hello, " + name; greet("Bob")`, "Hello, Bob",
+	`let s = "a;b"; split(s, ";")[1]`, "b",
+	"1; 2; 3", "3",
+	"let f(x) = x", "",
+}
+
+func TestFloatStatements(t *testing.T) {
+	e := eval.NewFloatEvaluator[float64](mapResolver{"a": "2"}, true)
+	checkStatements(t, e)
+}
+
+func TestFixedStatements(t *testing.T) {
+	e := eval.NewFixedEvaluator[fixed.D4](mapResolver{"a": "2"}, true)
+	checkStatements(t, e)
+}
+
+func checkStatements(t *testing.T, e *eval.Evaluator) {
+	t.Helper()
+	for i := 0; i < len(statementExpr); i += 2 {
+		result, err := e.Evaluate(statementExpr[i])
+		check.NoError(t, err, "%d: %s", i, statementExpr[i])
+		check.Equal(t, statementExpr[i+1], fmt.Sprint(result), "%d: %s", i, statementExpr[i])
+		var p *eval.Program
+		p, err = e.Compile(statementExpr[i])
+		check.NoError(t, err, "%d: %s", i, statementExpr[i])
+		result, err = p.Eval(mapResolver{"a": "2"})
+		check.NoError(t, err, "%d: %s", i, statementExpr[i])
+		check.Equal(t, statementExpr[i+1], fmt.Sprint(result), "%d: %s", i, statementExpr[i])
+	}
+}
+
+func TestDefinitionsPersist(t *testing.T) {
+	e := eval.NewFloatEvaluator[float64](nil, true)
+	_, err := e.Evaluate("let double(x) = x * 2; let square(x) = x * x")
+	check.NoError(t, err)
+	var result any
+	result, err = e.Evaluate("double(square(3))")
+	check.NoError(t, err)
+	check.Equal(t, 18.0, result)
+
+	var p *eval.Program
+	p, err = e.Compile("let b = 4; double($a) + b")
+	check.NoError(t, err)
+	check.Equal(t, []string{"a"}, p.Variables())
+	check.Equal(t, []string{"double"}, p.Functions())
+	_, ok := p.Root().(*eval.BlockNode)
+	check.True(t, ok)
+	result, err = p.Eval(mapResolver{"a": "5"})
+	check.NoError(t, err)
+	check.Equal(t, 14.0, result)
+
+	// Local bindings do not outlive the expression they were made in.
+	_, err = e.Evaluate("let k = 3; k")
+	check.NoError(t, err)
+	result, err = e.Evaluate("k")
+	check.NoError(t, err)
+	check.Equal(t, "k", result)
+
+	// Definitions belong to the Evaluator they were made on.
+	_, err = eval.NewFloatEvaluator[float64](nil, true).Evaluate("double(2)")
+	check.Error(t, err)
+}
+
+func TestBoundVariables(t *testing.T) {
+	e := eval.NewFloatEvaluator[float64](mapResolver{"a": "5", "k": "10", "x": "3", "y": "1"}, true)
+	for _, one := range []struct {
+		expr      string
+		variables []string
+		expected  float64
+	}{
+		// Parameters may only be referred to by their bare name.
+		{expr: "let f(x) = x * 2; f($x) + $y", variables: []string{"x", "y"}, expected: 7},
+		{expr: "let f(x) = $x * x; f(2)", variables: []string{"x"}, expected: 6},
+		// Bindings are only visible to the statements that follow them.
+		{expr: "let b = $a + 1; let a = 2; $a * b", variables: []string{"a"}, expected: 12},
+		{expr: "let a = $a + 1; a", variables: []string{"a"}, expected: 6},
+		{expr: "let a = 1; $a * 2", expected: 2},
+		// Function bodies can't see the bindings around them.
+		{expr: "let k = 1; let f(x) = $k + x; f(k)", variables: []string{"k"}, expected: 11},
+	} {
+		result, err := e.Evaluate(one.expr)
+		check.NoError(t, err, one.expr)
+		check.Equal(t, one.expected, result, one.expr)
+		var p *eval.Program
+		p, err = e.Compile(one.expr)
+		check.NoError(t, err, one.expr)
+		check.Equal(t, one.variables, p.Variables(), one.expr)
+		result, err = p.Eval(e.Resolver)
+		check.NoError(t, err, one.expr)
+		check.Equal(t, one.expected, result, one.expr)
+	}
+}
+
+func TestRecursionLimit(t *testing.T) {
+	e := eval.NewFloatEvaluator[float64](nil, true)
+	_, err := e.Evaluate("let loop(n) = loop(n + 1); loop(0)")
+	check.Error(t, err)
+	check.Contains(t, err.Error(), "maximum call depth of 64")
+
+	e.MaxDepth = 5
+	result, err := e.Evaluate("let down(n) = if(n <= 0, 0, down(n - 1)); down(4)")
+	check.NoError(t, err)
+	check.Equal(t, "0", fmt.Sprint(result))
+	_, err = e.Evaluate("down(5)")
+	check.Error(t, err)
+
+	p, err := e.Compile("down(5)")
+	check.NoError(t, err)
+	_, err = p.Eval(nil)
+	check.Error(t, err)
+}
+
+func TestStatementErrors(t *testing.T) {
+	e := eval.NewFloatEvaluator[float64](nil, true)
+	for _, one := range []struct {
+		expr     string
+		token    string
+		expected string
+		offset   int
+	}{
+		{expr: "let = 3", expected: "name", offset: 4},
+		{expr: "let x 3", expected: "=", offset: 6},
+		{expr: "let x == 3", expected: "=", offset: 6},
+		{expr: "let x = ", expected: "expression", offset: 8},
+		{expr: "let f(x = x", token: "(", expected: ")", offset: 5},
+		{expr: "let f(1) = 2", token: "1", expected: "parameter name", offset: 6},
+		{expr: "let f(x, x) = 2", token: "x", offset: 9},
+		{expr: "let sqrt(x) = x; sqrt(2)", token: "sqrt", offset: 4},
+		{expr: "1;\nlet y = (2", token: "(", expected: ")", offset: 11},
+	} {
+		_, err := e.Evaluate(one.expr)
+		checkSyntaxError(t, err, one.expr, one.token, one.expected, one.offset, lineOf(one.expr, one.offset),
+			columnOf(one.expr, one.offset))
+		_, err = e.Compile(one.expr)
+		checkSyntaxError(t, err, one.expr, one.token, one.expected, one.offset, lineOf(one.expr, one.offset),
+			columnOf(one.expr, one.offset))
+	}
+
+	// Function bodies cannot see the bindings around them.
+	expr := "let k = 2; let f(x) = x * k; f(3)"
+	_, err := e.Evaluate(expr)
+	check.Error(t, err)
+	// Calls must supply one argument per parameter.
+	expr = "let f(x) = x; 1 + f(1, 2)"
+	_, err = e.Evaluate(expr)
+	checkEvalError(t, err, expr, "f(1, 2)", 1)
+	var p *eval.Program
+	p, err = e.Compile(expr)
+	check.NoError(t, err)
+	_, err = p.Eval(nil)
+	checkEvalError(t, err, expr, "f(1, 2)", 1)
+}
+
+func lineOf(expr string, offset int) int {
+	line := 1
+	for _, ch := range expr[:offset] {
+		if ch == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+func columnOf(expr string, offset int) int {
+	column := 1
+	for _, ch := range expr[:offset] {
+		column++
+		if ch == '\n' {
+			column = 1
+		}
+	}
+	return column
+}
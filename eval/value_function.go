@@ -0,0 +1,297 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ValueFunctions returns standard functions that work with strings, lists, dates, and durations. The fromInt function
+// is used to convert integer results, such as lengths, into the number type of the evaluator.
+func ValueFunctions(fromInt func(value int) any) map[string]Function {
+	return map[string]Function{
+		"contains":    valueContains,
+		"date":        valueDate,
+		"date_add":    valueDateAdd,
+		"date_format": valueDateFormat,
+		"day": func(e *Evaluator, arguments string) (any, error) {
+			return valueDatePart(e, arguments, fromInt, time.Time.Day)
+		},
+		"duration": valueDuration,
+		"join":     valueJoin,
+		"len": func(e *Evaluator, arguments string) (any, error) {
+			v, err := e.evaluateArg(arguments, -1)
+			if err != nil {
+				return nil, err
+			}
+			return fromInt(valueLength(v)), nil
+		},
+		"lower": valueLower,
+		"month": func(e *Evaluator, arguments string) (any, error) {
+			return valueDatePart(e, arguments, fromInt, func(t time.Time) int { return int(t.Month()) })
+		},
+		"now":     valueNow,
+		"replace": valueReplace,
+		"split":   valueSplit,
+		"substr":  valueSubstring,
+		"trim":    valueTrim,
+		"upper":   valueUpper,
+		"year": func(e *Evaluator, arguments string) (any, error) {
+			return valueDatePart(e, arguments, fromInt, time.Time.Year)
+		},
+	}
+}
+
+func valueContains(e *Evaluator, arguments string) (any, error) {
+	args, err := evalArgs(e, arguments, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if list, ok := args[0].([]any); ok {
+		target := stringFrom(args[1])
+		for _, one := range list {
+			if stringFrom(one) == target {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return strings.Contains(stringFrom(args[0]), stringFrom(args[1])), nil
+}
+
+func valueDate(e *Evaluator, arguments string) (any, error) {
+	args, err := evalArgs(e, arguments, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return dateFrom(args[0])
+}
+
+func valueDateAdd(e *Evaluator, arguments string) (any, error) {
+	args, err := evalArgs(e, arguments, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+	var t time.Time
+	if t, err = dateFrom(args[0]); err != nil {
+		return nil, err
+	}
+	if len(args) == 2 {
+		var d time.Duration
+		if d, err = durationFrom(args[1]); err != nil {
+			return nil, err
+		}
+		return t.Add(d), nil
+	}
+	var amount int
+	if amount, err = intFrom(args[1]); err != nil {
+		return nil, err
+	}
+	switch unit := strings.TrimSuffix(strings.ToLower(stringFrom(args[2])), "s"); unit {
+	case "year":
+		return t.AddDate(amount, 0, 0), nil
+	case "month":
+		return t.AddDate(0, amount, 0), nil
+	case "week":
+		return t.AddDate(0, 0, amount*7), nil
+	case "day":
+		return t.AddDate(0, 0, amount), nil
+	case "hour":
+		return t.Add(time.Duration(amount) * time.Hour), nil
+	case "minute":
+		return t.Add(time.Duration(amount) * time.Minute), nil
+	case "second":
+		return t.Add(time.Duration(amount) * time.Second), nil
+	default:
+		return nil, errs.Newf("invalid date unit: %s", unit)
+	}
+}
+
+func valueDateFormat(e *Evaluator, arguments string) (any, error) {
+	args, err := evalArgs(e, arguments, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	var t time.Time
+	if t, err = dateFrom(args[0]); err != nil {
+		return nil, err
+	}
+	layout := time.DateOnly
+	if len(args) == 2 {
+		layout = stringFrom(args[1])
+	}
+	return t.Format(layout), nil
+}
+
+func valueDatePart(e *Evaluator, arguments string, fromInt func(int) any, part func(time.Time) int) (any, error) {
+	args, err := evalArgs(e, arguments, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	var t time.Time
+	if t, err = dateFrom(args[0]); err != nil {
+		return nil, err
+	}
+	return fromInt(part(t)), nil
+}
+
+func valueDuration(e *Evaluator, arguments string) (any, error) {
+	args, err := evalArgs(e, arguments, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return durationFrom(args[0])
+}
+
+func valueJoin(e *Evaluator, arguments string) (any, error) {
+	args, err := evalArgs(e, arguments, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := args[0].([]any)
+	if !ok {
+		return nil, errs.Newf("not a list: %v", args[0])
+	}
+	var sep string
+	if len(args) == 2 {
+		sep = stringFrom(args[1])
+	}
+	parts := make([]string, len(list))
+	for i, one := range list {
+		parts[i] = stringFrom(one)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+func valueLower(e *Evaluator, arguments string) (any, error) {
+	return valueSingleStringFunc(e, arguments, strings.ToLower)
+}
+
+func valueNow(_ *Evaluator, _ string) (any, error) {
+	return time.Now(), nil
+}
+
+func valueReplace(e *Evaluator, arguments string) (any, error) {
+	args, err := evalArgs(e, arguments, 3, 3)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ReplaceAll(stringFrom(args[0]), stringFrom(args[1]), stringFrom(args[2])), nil
+}
+
+func valueSplit(e *Evaluator, arguments string) (any, error) {
+	args, err := evalArgs(e, arguments, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(stringFrom(args[0]), stringFrom(args[1]))
+	list := make([]any, len(parts))
+	for i, one := range parts {
+		list[i] = one
+	}
+	return list, nil
+}
+
+func valueSubstring(e *Evaluator, arguments string) (any, error) {
+	args, err := evalArgs(e, arguments, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(stringFrom(args[0]))
+	var start int
+	if start, err = intFrom(args[1]); err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		start += len(runes)
+	}
+	start = max(min(start, len(runes)), 0)
+	end := len(runes)
+	if len(args) == 3 {
+		var length int
+		if length, err = intFrom(args[2]); err != nil {
+			return nil, err
+		}
+		end = max(min(start+length, len(runes)), start)
+	}
+	return string(runes[start:end]), nil
+}
+
+func valueTrim(e *Evaluator, arguments string) (any, error) {
+	return valueSingleStringFunc(e, arguments, strings.TrimSpace)
+}
+
+func valueUpper(e *Evaluator, arguments string) (any, error) {
+	return valueSingleStringFunc(e, arguments, strings.ToUpper)
+}
+
+func valueSingleStringFunc(e *Evaluator, arguments string, f func(string) string) (any, error) {
+	args, err := evalArgs(e, arguments, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return f(stringFrom(args[0])), nil
+}
+
+func evalArgs(e *Evaluator, arguments string, minCount, maxCount int) ([]any, error) {
+	var args []any
+	for i := 0; arguments != ""; i++ {
+		var arg string
+		arg, arguments = NextArg(arguments)
+		v, err := e.evaluateArg(arg, i)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	if len(args) < minCount || len(args) > maxCount {
+		if minCount == maxCount {
+			return nil, errs.Newf("expected %d arguments, got %d", minCount, len(args))
+		}
+		return nil, errs.Newf("expected %d to %d arguments, got %d", minCount, maxCount, len(args))
+	}
+	return args, nil
+}
+
+func dateFrom(arg any) (time.Time, error) {
+	if t, ok := arg.(time.Time); ok {
+		return t, nil
+	}
+	s := strings.TrimSpace(stringFrom(arg))
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errs.Newf("not a date: %v", arg)
+}
+
+func durationFrom(arg any) (time.Duration, error) {
+	if d, ok := arg.(time.Duration); ok {
+		return d, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(fmt.Sprint(arg)))
+	if err != nil {
+		return 0, errs.Newf("not a duration: %v", arg)
+	}
+	return d, nil
+}
@@ -0,0 +1,224 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// operandText holds the text of an unquoted operand, such as a number or the substituted value of a variable. It is kept
+// distinct from string so that operators can tell string literals apart from text that may still be interpreted as a
+// number. The public entry points convert it back into a string before returning it.
+type operandText string
+
+// valueAdd wraps a numeric add operation so that strings and lists may be concatenated and durations may be added to
+// dates and other durations. Anything else is passed through to f.
+func valueAdd(f OpFunc) OpFunc {
+	return func(left, right any) (any, error) {
+		switch l := left.(type) {
+		case string:
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		case []any:
+			if r, ok := right.([]any); ok {
+				list := make([]any, 0, len(l)+len(r))
+				list = append(list, l...)
+				return append(list, r...), nil
+			}
+		case time.Time:
+			if r, ok := right.(time.Duration); ok {
+				return l.Add(r), nil
+			}
+		case time.Duration:
+			switch r := right.(type) {
+			case time.Duration:
+				return l + r, nil
+			case time.Time:
+				return r.Add(l), nil
+			default:
+			}
+		default:
+		}
+		return f(left, right)
+	}
+}
+
+// valueSubtract wraps a numeric subtract operation so that dates and durations may be subtracted from dates and
+// durations. Anything else is passed through to f.
+func valueSubtract(f OpFunc) OpFunc {
+	return func(left, right any) (any, error) {
+		switch l := left.(type) {
+		case time.Time:
+			switch r := right.(type) {
+			case time.Time:
+				return l.Sub(r), nil
+			case time.Duration:
+				return l.Add(-r), nil
+			default:
+			}
+		case time.Duration:
+			if r, ok := right.(time.Duration); ok {
+				return l - r, nil
+			}
+		default:
+		}
+		return f(left, right)
+	}
+}
+
+// valueCompare wraps a numeric comparison operation so that strings are compared lexically and dates and durations are
+// compared chronologically. The test function is given the result of the comparison, which will be -1, 0, or 1.
+// Anything else is passed through to f.
+func valueCompare(f OpFunc, test func(result int) bool) OpFunc {
+	return func(left, right any) (any, error) {
+		if result, ok := compareValues(left, right); ok {
+			return test(result), nil
+		}
+		return f(left, right)
+	}
+}
+
+func compareValues(left, right any) (int, bool) {
+	switch l := left.(type) {
+	case string:
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), true
+		}
+	case time.Time:
+		if r, ok := right.(time.Time); ok {
+			return l.Compare(r), true
+		}
+	case time.Duration:
+		if r, ok := right.(time.Duration); ok {
+			switch {
+			case l < r:
+				return -1, true
+			case l > r:
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	default:
+	}
+	return 0, false
+}
+
+func isEqual(result int) bool { return result == 0 }
+
+func isNotEqual(result int) bool { return result != 0 }
+
+func isGreater(result int) bool { return result > 0 }
+
+func isGreaterOrEqual(result int) bool { return result >= 0 }
+
+func isLess(result int) bool { return result < 0 }
+
+func isLessOrEqual(result int) bool { return result <= 0 }
+
+// indexValue returns the element at the index within a list, or the character at the index within a string. Negative
+// indexes count backwards from the end.
+func indexValue(target, index any) (any, error) {
+	i, err := intFrom(index)
+	if err != nil {
+		return nil, err
+	}
+	switch t := target.(type) {
+	case []any:
+		if i < 0 {
+			i += len(t)
+		}
+		if i < 0 || i >= len(t) {
+			return nil, errs.Newf("index %d out of range for list of length %d", i, len(t))
+		}
+		return t[i], nil
+	case string:
+		runes := []rune(t)
+		if i < 0 {
+			i += len(runes)
+		}
+		if i < 0 || i >= len(runes) {
+			return nil, errs.Newf("index %d out of range for string of length %d", i, len(runes))
+		}
+		return string(runes[i]), nil
+	case operandText:
+		return indexValue(string(t), index)
+	default:
+		return nil, errs.Newf("unable to index into %v", target)
+	}
+}
+
+// intFrom attempts to convert the arg into an int. Since every number type used by the evaluators formats itself as a
+// decimal value, this works regardless of which evaluator produced the arg.
+func intFrom(arg any) (int, error) {
+	switch a := arg.(type) {
+	case int:
+		return a, nil
+	case bool, []any, time.Time, time.Duration:
+		return 0, errs.Newf("not an integer: %v", arg)
+	default:
+		f, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprint(arg)), 64)
+		if err != nil || f != math.Trunc(f) || f < math.MinInt || f >= -math.MinInt {
+			return 0, errs.Newf("not an integer: %v", arg)
+		}
+		return int(f), nil
+	}
+}
+
+func stringFrom(arg any) string {
+	if s, ok := textFrom(arg); ok {
+		return s
+	}
+	return fmt.Sprint(arg)
+}
+
+// textFrom returns the arg as a string if it is either a string or the text of an operand.
+func textFrom(arg any) (string, bool) {
+	switch a := arg.(type) {
+	case string:
+		return a, true
+	case operandText:
+		return string(a), true
+	default:
+		return "", false
+	}
+}
+
+// exportValue converts the text of any operands within v back into plain strings, so that it may be handed to callers
+// outside of this package.
+func exportValue(v any) any {
+	switch t := v.(type) {
+	case operandText:
+		return string(t)
+	case []any:
+		list := make([]any, len(t))
+		for i, one := range t {
+			list[i] = exportValue(one)
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+func valueLength(arg any) int {
+	if list, ok := arg.([]any); ok {
+		return len(list)
+	}
+	return utf8.RuneCountInString(stringFrom(arg))
+}
@@ -0,0 +1,120 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package eval_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/eval"
+	"github.com/ddkwork/toolbox/xmath/fixed"
+)
+
+var valueExpr = []string{
+	`"hello" + " " + "world"`, "hello world",
+	`"a, b" + "(c)"`, "a, b(c)",
+	`"abc" == "abc"`, "true",
+	`"abc" < "abd"`, "true",
+	`"1" + "2"`, "12",
+	`"007" == "7"`, "false",
+	`"007" != "7"`, "true",
+	`"10" < "9"`, "true",
+	`"5" * 2`, "10",
+	`let s = "1"; s + s`, "11",
+	`["1", "2"][0] + "3"`, "13",
+	`[1, 2][0] + 1`, "2",
+	`"cost: $5"`, "cost: $5",
+	`len("héllo")`, "5",
+	`len([1, 2, 3]) + 1`, "4",
+	`substr("abcdef", 2, 3)`, "cde",
+	`substr("abcdef", -2)`, "ef",
+	`contains("abcdef", "cd")`, "true",
+	`contains(["x", "y"], "z")`, "false",
+	`join(["a", "b", "c"], ", ")`, "a, b, c",
+	`join(split("a-b-c", "-"), "+")`, "a+b+c",
+	`upper(trim("  abc  "))`, "ABC",
+	`replace("aaa", "a", "b")`, "bbb",
+	`[1, "two", [3]][1]`, "two",
+	`[1, "two", [3, 4]][2][1]`, "4",
+	`[1, 2, 3][-1]`, "3",
+	`"abc"[1]`, "b",
+	`split("a,b", ",")[1]`, "b",
+	`split("x,y,z", ",")[1]`, "y",
+	`-split("1,2", ",")[1] + 1`, "-1",
+	`-[1, 2][1] + 1`, "-1",
+	`len([])`, "0",
+	`[1, 2] + [3]`, "[1 2 3]",
+	`date_format(date("2024-01-31"))`, "2024-01-31",
+	`date_format(date_add(date("2024-01-31"), 1, "month"))`, "2024-03-02",
+	`date_format(date_add(date("2024-01-31"), 2, "days"), "Jan 2, 2006")`, "Feb 2, 2024",
+	`date_format(date("2024-01-31") + duration("36h"), "2006-01-02 15:04")`, "2024-02-01 12:00",
+	`date("2024-03-01") - date("2024-02-28")`, "48h0m0s",
+	`date("2024-03-01") > date("2024-02-28")`, "true",
+	`duration("90m") == duration("1h30m")`, "true",
+	`year(date("2024-03-01")) + month(date("2024-03-01")) + day(date_add(date("2024-01-01"), $days, "days"))`, "2034",
+}
+
+func TestValues(t *testing.T) {
+	for _, e := range []*eval.Evaluator{
+		eval.NewFixedEvaluator[fixed.D4](valueResolver{}, true),
+		eval.NewFloatEvaluator[float64](valueResolver{}, true),
+	} {
+		for i := 0; i < len(valueExpr); i += 2 {
+			result, err := e.Evaluate(valueExpr[i])
+			check.NoError(t, err, "%d: %s == %s", i, valueExpr[i], valueExpr[i+1])
+			check.Equal(t, valueExpr[i+1], fmt.Sprintf("%v", result), "%d: %s == %s", i, valueExpr[i], valueExpr[i+1])
+
+			var p *eval.Program
+			p, err = e.Compile(valueExpr[i])
+			check.NoError(t, err, "%d: %s", i, valueExpr[i])
+			result, err = p.Eval(valueResolver{})
+			check.NoError(t, err, "%d: %s == %s", i, valueExpr[i], valueExpr[i+1])
+			check.Equal(t, valueExpr[i+1], fmt.Sprintf("%v", result), "%d: %s == %s", i, valueExpr[i], valueExpr[i+1])
+		}
+
+		_, err := e.Evaluate(`[1, 2][5]`)
+		check.Error(t, err)
+		_, err = e.Evaluate(`"unterminated`)
+		check.Error(t, err)
+		_, err = e.Evaluate(`[1, 2`)
+		check.Error(t, err)
+		_, err = e.Evaluate(`date("not a date")`)
+		check.Error(t, err)
+		_, err = e.Evaluate(`substr("abc")`)
+		check.Error(t, err)
+		for _, expr := range []string{`substr("abc", 1.7)`, `[1, 2][0.9]`, `[1, 2]["1e300"]`, `substr("abc", "NaN")`} {
+			_, err = e.Evaluate(expr)
+			check.Error(t, err, expr)
+			check.Contains(t, err.Error(), "not an integer", expr)
+		}
+
+		result, err := e.Evaluate(`[1, "2"]`)
+		check.NoError(t, err)
+		check.Equal(t, []any{"1", "2"}, result)
+
+		result, err = e.Evaluate(`now()`)
+		check.NoError(t, err)
+		_, ok := result.(time.Time)
+		check.True(t, ok)
+	}
+}
+
+type valueResolver struct{}
+
+func (r valueResolver) ResolveVariable(variableName string) string {
+	switch variableName {
+	case "days":
+		return "6"
+	default:
+		return ""
+	}
+}
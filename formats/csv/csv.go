@@ -0,0 +1,366 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+// Package csv provides the ability to read and write delimited text files, such as CSV and TSV, using the same sheet
+// model as the xlsx package.
+package csv
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/formats/xlsx"
+	"github.com/ddkwork/toolbox/xio"
+	"github.com/ddkwork/toolbox/xio/fs/safe"
+)
+
+// Quoting determines when fields are quoted while writing.
+type Quoting int
+
+// Possible Quoting values.
+const (
+	// QuoteMinimal quotes only those fields that need it: fields containing the delimiter, the quote character or a
+	// line break, as well as String cells that would otherwise be read back as a different type.
+	QuoteMinimal Quoting = iota
+	// QuoteAll quotes every non-empty field.
+	QuoteAll
+	// QuoteNone never quotes fields. Fields containing the delimiter or a line break cause an error.
+	QuoteNone
+)
+
+// Formats used for dates. Dates are read in any of these forms.
+const (
+	DateFormat     = "2006-01-02"
+	DateTimeFormat = "2006-01-02T15:04:05.999999999"
+)
+
+// Number formats given to the Date cells that are read.
+const (
+	dateNumberFormat     = "yyyy-mm-dd"
+	dateTimeNumberFormat = "yyyy-mm-dd hh:mm:ss"
+)
+
+var dateLayouts = []string{DateFormat, DateTimeFormat, "2006-01-02 15:04:05.999999999", time.RFC3339Nano}
+
+// Options controls how delimited text is read and written. The zero value describes a standard CSV file.
+type Options struct {
+	// Delimiter separates fields. Defaults to ',' or, when loading or saving a file with a ".tsv" or ".tab" extension,
+	// to '\t'.
+	Delimiter rune
+	// Quote is the character used to quote fields. Defaults to '"'. Within a quoted field, the quote character is
+	// escaped by doubling it.
+	Quote rune
+	// Quoting determines when fields are quoted while writing.
+	Quoting Quoting
+	// CRLF causes lines to be terminated with "\r\n" rather than "\n" while writing. Either is accepted while reading.
+	CRLF bool
+	// NoTypeInference causes every field to be read as a String cell. Otherwise, unquoted fields that look like
+	// numbers, booleans or ISO 8601 dates are read as Number, Boolean and Date cells, respectively.
+	NoTypeInference bool
+}
+
+// Load a sheet from a delimited text file. The sheet is named after the file, without its extension.
+func Load(path string, options *Options) (*xlsx.Sheet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errs.NewWithCause(path, err)
+	}
+	defer xio.CloseIgnoringErrors(f)
+	var sheet *xlsx.Sheet
+	if sheet, err = Read(f, optionsForPath(path, options)); err != nil {
+		return nil, errs.NewWithCause(path, err)
+	}
+	sheet.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return sheet, nil
+}
+
+// Read a sheet from a delimited text stream. A leading byte order mark is ignored. Each line becomes a row, starting
+// at A1, and empty fields produce no cell.
+func Read(r io.Reader, options *Options) (*xlsx.Sheet, error) {
+	delimiter, quote := options.runes()
+	in, err := xio.NewBOMStripper(r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return newSheet(), nil
+		}
+		return nil, err
+	}
+	sheet := newSheet()
+	var field strings.Builder
+	ref := xlsx.Ref{}
+	line := 1
+	quoted := false
+	inQuotes := false
+	afterQuotes := false
+	pending := false
+	finishField := func() {
+		if quoted || field.Len() != 0 {
+			value := field.String()
+			var cell xlsx.Cell
+			if quoted || (options != nil && options.NoTypeInference) {
+				cell = xlsx.StringCell(value)
+			} else {
+				cell = inferCell(value)
+			}
+			sheet.Cells[ref] = cell
+			sheet.Min.Row = min(sheet.Min.Row, ref.Row)
+			sheet.Min.Col = min(sheet.Min.Col, ref.Col)
+			sheet.Max.Row = max(sheet.Max.Row, ref.Row)
+			sheet.Max.Col = max(sheet.Max.Col, ref.Col)
+		}
+		field.Reset()
+		quoted = false
+		afterQuotes = false
+		ref.Col++
+	}
+	finishRow := func() {
+		finishField()
+		ref.Row++
+		ref.Col = 0
+		pending = false
+	}
+	for {
+		var ch rune
+		if ch, _, err = in.ReadRune(); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return nil, errs.Wrap(err)
+			}
+			break
+		}
+		switch {
+		case inQuotes:
+			if ch == quote {
+				var next rune
+				if next, _, err = in.ReadRune(); err == nil && next == quote {
+					field.WriteRune(quote)
+					continue
+				}
+				if err == nil {
+					if err = in.UnreadRune(); err != nil {
+						return nil, errs.Wrap(err)
+					}
+				}
+				inQuotes = false
+				afterQuotes = true
+				continue
+			}
+			if ch == '\n' {
+				line++
+			}
+			field.WriteRune(ch)
+		case ch == delimiter:
+			finishField()
+			pending = true
+		case ch == '\r' || ch == '\n':
+			if ch == '\r' {
+				var next rune
+				if next, _, err = in.ReadRune(); err == nil && next != '\n' {
+					if err = in.UnreadRune(); err != nil {
+						return nil, errs.Wrap(err)
+					}
+				}
+			}
+			finishRow()
+			line++
+		case afterQuotes:
+			return nil, errs.Newf("line %d: unexpected %q after quoted field", line, ch)
+		case ch == quote && field.Len() == 0 && !quoted:
+			quoted = true
+			inQuotes = true
+			pending = true
+		default:
+			field.WriteRune(ch)
+			pending = true
+		}
+	}
+	if inQuotes {
+		return nil, errs.Newf("line %d: quoted field is not terminated", line)
+	}
+	if pending || field.Len() != 0 {
+		finishRow()
+	}
+	if len(sheet.Cells) == 0 {
+		sheet.Min = xlsx.Ref{}
+	}
+	return sheet, nil
+}
+
+// Save a sheet to a delimited text file.
+func Save(path string, sheet *xlsx.Sheet, options *Options) error {
+	options = optionsForPath(path, options)
+	if err := safe.WriteFile(path, func(w io.Writer) error { return Write(w, sheet, options) }); err != nil {
+		return errs.NewWithCause(path, err)
+	}
+	return nil
+}
+
+// Write a sheet to a delimited text stream. Rows and columns are written starting at A1, so that a sheet that is
+// written and then read back has its cells at the same positions. Numbers are written as they are stored, booleans
+// as TRUE or FALSE, and dates in ISO 8601 form. Formulas and number formats are not written.
+func Write(w io.Writer, sheet *xlsx.Sheet, options *Options) error {
+	delimiter, quote := options.runes()
+	quoting := QuoteMinimal
+	eol := "\n"
+	if options != nil {
+		quoting = options.Quoting
+		if options.CRLF {
+			eol = "\r\n"
+		}
+	}
+	maxRef := xlsx.Ref{Row: -1, Col: -1}
+	for ref := range sheet.Cells {
+		if ref.Row < 0 || ref.Col < 0 {
+			return errs.Newf("invalid cell reference: row %d, column %d", ref.Row, ref.Col)
+		}
+		maxRef.Row = max(maxRef.Row, ref.Row)
+		maxRef.Col = max(maxRef.Col, ref.Col)
+	}
+	special := string([]rune{delimiter, quote, '\r', '\n'})
+	bw := bufio.NewWriter(w)
+	for row := 0; row <= maxRef.Row; row++ {
+		for col := 0; col <= maxRef.Col; col++ {
+			if col != 0 {
+				bw.WriteRune(delimiter)
+			}
+			cell, exists := sheet.Cells[xlsx.Ref{Row: row, Col: col}]
+			if !exists {
+				continue
+			}
+			text := fieldText(&cell)
+			needsQuotes := false
+			switch quoting {
+			case QuoteAll:
+				needsQuotes = true
+			case QuoteNone:
+				if strings.ContainsAny(text, string([]rune{delimiter, '\r', '\n'})) {
+					return errs.Newf("cell %s cannot be written without quotes", xlsx.Ref{Row: row, Col: col})
+				}
+			default:
+				needsQuotes = strings.ContainsAny(text, special) ||
+					(cell.Type == xlsx.String && (text == "" || inferCell(text).Type != xlsx.String))
+			}
+			if needsQuotes {
+				bw.WriteRune(quote)
+				q := string(quote)
+				bw.WriteString(strings.ReplaceAll(text, q, q+q))
+				bw.WriteRune(quote)
+			} else {
+				bw.WriteString(text)
+			}
+		}
+		bw.WriteString(eol)
+	}
+	return errs.Wrap(bw.Flush())
+}
+
+func newSheet() *xlsx.Sheet {
+	return &xlsx.Sheet{
+		Min:   xlsx.Ref{Row: math.MaxInt32, Col: math.MaxInt32},
+		Cells: make(map[xlsx.Ref]xlsx.Cell),
+	}
+}
+
+func optionsForPath(path string, options *Options) *Options {
+	if options != nil && options.Delimiter != 0 {
+		return options
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tsv", ".tab":
+		var adjusted Options
+		if options != nil {
+			adjusted = *options
+		}
+		adjusted.Delimiter = '\t'
+		return &adjusted
+	default:
+		return options
+	}
+}
+
+func (o *Options) runes() (delimiter, quote rune) {
+	delimiter = ','
+	quote = '"'
+	if o != nil {
+		if o.Delimiter != 0 {
+			delimiter = o.Delimiter
+		}
+		if o.Quote != 0 {
+			quote = o.Quote
+		}
+	}
+	return delimiter, quote
+}
+
+// inferCell returns a cell of the type that the text appears to hold.
+func inferCell(text string) xlsx.Cell {
+	switch strings.ToLower(text) {
+	case "true":
+		return xlsx.BooleanCell(true)
+	case "false":
+		return xlsx.BooleanCell(false)
+	}
+	if isNumber(text) {
+		return xlsx.Cell{Type: xlsx.Number, Value: text}
+	}
+	if len(text) >= len(DateFormat) && text[4] == '-' {
+		for i, layout := range dateLayouts {
+			if t, err := time.Parse(layout, text); err == nil {
+				cell := xlsx.DateCell(t)
+				if i == 0 {
+					cell.Format = dateNumberFormat
+				} else {
+					cell.Format = dateTimeNumberFormat
+				}
+				return cell
+			}
+		}
+	}
+	return xlsx.StringCell(text)
+}
+
+// isNumber returns true if the text is a decimal number. Numbers with extra leading zeros, such as "007", are not
+// considered numbers, since they are usually codes whose leading zeros matter.
+func isNumber(text string) bool {
+	if text == "" || strings.ContainsAny(text, "xX_ \t") {
+		return false
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return false
+	}
+	digits := strings.TrimLeft(text, "+-")
+	return len(digits) < 2 || digits[0] != '0' || digits[1] == '.' || digits[1] == 'e' || digits[1] == 'E'
+}
+
+// fieldText returns the text to write for the cell.
+func fieldText(cell *xlsx.Cell) string {
+	switch cell.Type {
+	case xlsx.Boolean:
+		if cell.Boolean() {
+			return "TRUE"
+		}
+		return "FALSE"
+	case xlsx.Date:
+		t := cell.Time().Round(time.Millisecond)
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+			return t.Format(DateFormat)
+		}
+		return t.Format(DateTimeFormat)
+	default:
+		return cell.Value
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package csv_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/formats/csv"
+	"github.com/ddkwork/toolbox/formats/xlsx"
+)
+
+func TestRead(t *testing.T) {
+	input := "\ufeffname,qty,price,ok,when\r\n" +
+		"\"Smith, \"\"Bob\"\"\",007,-1.5e3,TRUE,2023-03-14\r\n" +
+		"\"multi\nline\",\"42\",,false,2023-03-14T15:09:26Z\n" +
+		"\n" +
+		",,\"\",0,2023-03-14 15:09:26"
+	sheet, err := csv.Read(strings.NewReader(input), nil)
+	check.NoError(t, err)
+	check.Equal(t, xlsx.Ref{}, sheet.Min)
+	check.Equal(t, xlsx.Ref{Row: 4, Col: 4}, sheet.Max)
+	when := time.Date(2023, time.March, 14, 15, 9, 26, 0, time.UTC)
+	for _, one := range []struct {
+		ref  string
+		cell xlsx.Cell
+	}{
+		{"A1", xlsx.StringCell("name")},
+		{"A2", xlsx.StringCell(`Smith, "Bob"`)},
+		{"B2", xlsx.StringCell("007")},
+		{"C2", xlsx.Cell{Type: xlsx.Number, Value: "-1.5e3"}},
+		{"D2", xlsx.BooleanCell(true)},
+		{"A3", xlsx.StringCell("multi\nline")},
+		{"B3", xlsx.StringCell("42")},
+		{"D3", xlsx.BooleanCell(false)},
+		{"C5", xlsx.StringCell("")},
+		{"D5", xlsx.Cell{Type: xlsx.Number, Value: "0"}},
+	} {
+		cell, exists := sheet.Cells[xlsx.ParseRef(one.ref)]
+		check.True(t, exists, one.ref)
+		check.Equal(t, one.cell, cell, one.ref)
+	}
+	for _, ref := range []string{"C3", "A4", "A5", "B5"} {
+		_, exists := sheet.Cells[xlsx.ParseRef(ref)]
+		check.False(t, exists, ref)
+	}
+	cell := sheet.Cells[xlsx.ParseRef("E2")]
+	check.Equal(t, xlsx.Date, cell.Type)
+	check.Equal(t, "yyyy-mm-dd", cell.Format)
+	check.Equal(t, time.Date(2023, time.March, 14, 0, 0, 0, 0, time.UTC), cell.Time())
+	for _, ref := range []string{"E3", "E5"} {
+		cell = sheet.Cells[xlsx.ParseRef(ref)]
+		check.Equal(t, xlsx.Date, cell.Type, ref)
+		check.Equal(t, when, cell.Time().Round(time.Millisecond), ref)
+	}
+
+	sheet, err = csv.Read(strings.NewReader("1;'a;b'\n2;'it''s'"), &csv.Options{
+		Delimiter:       ';',
+		Quote:           '\'',
+		NoTypeInference: true,
+	})
+	check.NoError(t, err)
+	check.Equal(t, map[xlsx.Ref]xlsx.Cell{
+		{Row: 0, Col: 0}: xlsx.StringCell("1"),
+		{Row: 0, Col: 1}: xlsx.StringCell("a;b"),
+		{Row: 1, Col: 0}: xlsx.StringCell("2"),
+		{Row: 1, Col: 1}: xlsx.StringCell("it's"),
+	}, sheet.Cells)
+
+	sheet, err = csv.Read(strings.NewReader(""), nil)
+	check.NoError(t, err)
+	check.Equal(t, 0, len(sheet.Cells))
+
+	_, err = csv.Read(strings.NewReader("a,\"b\nc"), nil)
+	check.Error(t, err)
+	_, err = csv.Read(strings.NewReader("a,\"b\"c"), nil)
+	check.Error(t, err)
+}
+
+func TestWrite(t *testing.T) {
+	sheet := &xlsx.Sheet{Cells: map[xlsx.Ref]xlsx.Cell{
+		{Row: 0, Col: 0}: xlsx.StringCell("a,b"),
+		{Row: 0, Col: 2}: xlsx.StringCell("12"),
+		{Row: 1, Col: 0}: xlsx.NumberCell(3.25),
+		{Row: 1, Col: 1}: xlsx.BooleanCell(false),
+		{Row: 1, Col: 2}: xlsx.DateCell(time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)),
+		{Row: 3, Col: 1}: xlsx.StringCell("say \"hi\""),
+		{Row: 3, Col: 2}: xlsx.DateCell(time.Date(2020, time.February, 29, 6, 30, 0, 0, time.UTC)),
+	}}
+	var buffer bytes.Buffer
+	check.NoError(t, csv.Write(&buffer, sheet, nil))
+	check.Equal(t, "\"a,b\",,\"12\"\n3.25,FALSE,2020-02-29\n,,\n,\"say \"\"hi\"\"\",2020-02-29T06:30:00\n",
+		buffer.String())
+
+	buffer.Reset()
+	check.NoError(t, csv.Write(&buffer, sheet, &csv.Options{Delimiter: '\t', Quoting: csv.QuoteAll, CRLF: true}))
+	check.Equal(t, "\"a,b\"\t\t\"12\"\r\n\"3.25\"\t\"FALSE\"\t\"2020-02-29\"\r\n\t\t\r\n"+
+		"\t\"say \"\"hi\"\"\"\t\"2020-02-29T06:30:00\"\r\n", buffer.String())
+
+	check.Error(t, csv.Write(&buffer, sheet, &csv.Options{Quoting: csv.QuoteNone}))
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	original := &xlsx.Sheet{Cells: map[xlsx.Ref]xlsx.Cell{
+		{Row: 0, Col: 0}: xlsx.StringCell("tab\there"),
+		{Row: 0, Col: 1}: xlsx.StringCell("TRUE"),
+		{Row: 1, Col: 0}: xlsx.NumberCell(-0.5),
+		{Row: 1, Col: 1}: xlsx.BooleanCell(true),
+		{Row: 2, Col: 3}: xlsx.StringCell(" padded "),
+	}}
+	for _, name := range []string{"data.csv", "data.tsv"} {
+		path := filepath.Join(dir, name)
+		check.NoError(t, csv.Save(path, original, nil))
+		loaded, err := csv.Load(path, nil)
+		check.NoError(t, err)
+		check.Equal(t, "data", loaded.Name)
+		check.Equal(t, original.Cells, loaded.Cells, name)
+	}
+
+	// Converting from xlsx and back preserves values and types.
+	var buffer bytes.Buffer
+	check.NoError(t, xlsx.Write(&buffer, []xlsx.Sheet{*original}))
+	sheets, err := xlsx.Read(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	check.NoError(t, err)
+	buffer.Reset()
+	check.NoError(t, csv.Write(&buffer, &sheets[0], nil))
+	var sheet *xlsx.Sheet
+	sheet, err = csv.Read(&buffer, nil)
+	check.NoError(t, err)
+	check.Equal(t, original.Cells, sheet.Cells)
+}
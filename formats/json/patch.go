@@ -0,0 +1,317 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package json
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// ApplyPatch applies an RFC 6902 JSON Patch to the data. The patch must be an array of operation objects. The patch is
+// applied atomically: if any operation fails, an error describing the failing operation is returned and the data is
+// left unchanged.
+func (j *Data) ApplyPatch(patch *Data) error {
+	var ops []any
+	if patch != nil {
+		var ok bool
+		if ops, ok = patch.obj.([]any); !ok {
+			return errs.New("a JSON patch must be an array of operations")
+		}
+	}
+	doc := deepCopy(j.obj)
+	for i, one := range ops {
+		op, ok := one.(map[string]any)
+		if !ok {
+			return errs.Newf("patch operation %d: must be an object", i)
+		}
+		var err error
+		if doc, err = applyPatchOp(doc, op); err != nil {
+			name, _ := op["op"].(string)   //nolint:errcheck // An empty name is fine for the message
+			path, _ := op["path"].(string) //nolint:errcheck // An empty path is fine for the message
+			return errs.NewWithCausef(err, "patch operation %d (%s %q) failed", i, name, path)
+		}
+	}
+	j.obj = doc
+	return nil
+}
+
+// ApplyMergePatch applies an RFC 7386 JSON Merge Patch to the data. Members of the patch whose value is null are
+// removed from the data, other members are merged recursively, and a patch that is not an object replaces the data
+// entirely.
+func (j *Data) ApplyMergePatch(patch *Data) {
+	var p any
+	if patch != nil {
+		p = patch.obj
+	}
+	j.obj = mergePatch(j.obj, p)
+}
+
+// CreatePatch returns an RFC 6902 JSON Patch that, when applied to this data, transforms it into the target.
+func (j *Data) CreatePatch(target *Data) *Data {
+	var to any
+	if target != nil {
+		to = target.obj
+	}
+	ops := make([]any, 0)
+	diff(j.obj, to, "", &ops)
+	return &Data{obj: ops}
+}
+
+func applyPatchOp(doc any, op map[string]any) (any, error) {
+	name, ok := op["op"].(string)
+	if !ok {
+		return nil, errs.New(`missing "op" member`)
+	}
+	path, ok := op["path"].(string)
+	if !ok {
+		return nil, errs.New(`missing "path" member`)
+	}
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+	value, hasValue := op["value"]
+	switch name {
+	case "add", "replace", "test":
+		if !hasValue {
+			return nil, errs.New(`missing "value" member`)
+		}
+	case "move", "copy":
+		from, isStr := op["from"].(string)
+		if !isStr {
+			return nil, errs.New(`missing "from" member`)
+		}
+		var fromTokens []string
+		if fromTokens, err = parsePointer(from); err != nil {
+			return nil, err
+		}
+		if name == "move" {
+			if from == path {
+				return doc, nil
+			}
+			if strings.HasPrefix(path, from+"/") {
+				return nil, errs.New("cannot move a value into one of its own children")
+			}
+			if doc, value, err = removeValue(doc, fromTokens); err != nil {
+				return nil, err
+			}
+		} else {
+			if value, err = valueAt(doc, fromTokens); err != nil {
+				return nil, err
+			}
+			value = deepCopy(value)
+		}
+		return addValue(doc, tokens, value)
+	case "remove":
+		doc, _, err = removeValue(doc, tokens)
+		return doc, err
+	default:
+		return nil, errs.Newf("unknown operation %q", name)
+	}
+	value = deepCopy(value)
+	switch name {
+	case "add":
+		return addValue(doc, tokens, value)
+	case "replace":
+		if len(tokens) == 0 {
+			return value, nil
+		}
+		return modify(doc, tokens, func(container any, key string) (any, error) {
+			switch c := container.(type) {
+			case map[string]any:
+				if _, exists := c[key]; !exists {
+					return nil, errs.Newf("member %q does not exist", key)
+				}
+				c[key] = value
+			case []any:
+				i, idxErr := arrayIndex(key, len(c), false)
+				if idxErr != nil {
+					return nil, idxErr
+				}
+				c[i] = value
+			}
+			return container, nil
+		})
+	default: // test
+		var actual any
+		if actual, err = valueAt(doc, tokens); err != nil {
+			return nil, err
+		}
+		if !deepEqual(actual, value) {
+			return nil, errs.Newf("test failed at %q: expected %s, found %s", path, jsonText(value), jsonText(actual))
+		}
+		return doc, nil
+	}
+}
+
+// modify locates the container holding the last reference token and calls fn with it and that token. The container
+// returned by fn replaces the original within its parent, which allows arrays to grow and shrink.
+func modify(node any, tokens []string, fn func(container any, key string) (any, error)) (any, error) {
+	switch n := node.(type) {
+	case map[string]any:
+		if len(tokens) == 1 {
+			return fn(n, tokens[0])
+		}
+		child, exists := n[tokens[0]]
+		if !exists {
+			return nil, errs.Newf("member %q does not exist", tokens[0])
+		}
+		updated, err := modify(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = updated
+		return n, nil
+	case []any:
+		if len(tokens) == 1 {
+			return fn(n, tokens[0])
+		}
+		i, err := arrayIndex(tokens[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		var updated any
+		if updated, err = modify(n[i], tokens[1:], fn); err != nil {
+			return nil, err
+		}
+		n[i] = updated
+		return n, nil
+	default:
+		return nil, errs.Newf("cannot look up %q in a value that is not an object or array", tokens[0])
+	}
+}
+
+func addValue(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return modify(doc, tokens, func(container any, key string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[key] = value
+			return c, nil
+		default:
+			a := c.([]any) //nolint:errcheck // modify only passes objects and arrays
+			i, err := arrayIndex(key, len(a), true)
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(a, i, value), nil
+		}
+	})
+}
+
+func removeValue(doc any, tokens []string) (updated, removed any, err error) {
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	updated, err = modify(doc, tokens, func(container any, key string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			var exists bool
+			if removed, exists = c[key]; !exists {
+				return nil, errs.Newf("member %q does not exist", key)
+			}
+			delete(c, key)
+			return c, nil
+		default:
+			a := c.([]any) //nolint:errcheck // modify only passes objects and arrays
+			i, idxErr := arrayIndex(key, len(a), false)
+			if idxErr != nil {
+				return nil, idxErr
+			}
+			removed = a[i]
+			return slices.Delete(a, i, i+1), nil
+		}
+	})
+	return updated, removed, err
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return deepCopy(patch)
+	}
+	t, isMap := target.(map[string]any)
+	if !isMap {
+		t = make(map[string]any)
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergePatch(t[key], value)
+		}
+	}
+	return t
+}
+
+func diff(from, to any, path string, ops *[]any) {
+	if deepEqual(from, to) {
+		return
+	}
+	switch f := from.(type) {
+	case map[string]any:
+		if t, ok := to.(map[string]any); ok {
+			for _, key := range sortedKeys(f) {
+				if value, exists := t[key]; exists {
+					diff(f[key], value, pointerTo(path, key), ops)
+				} else {
+					*ops = append(*ops, patchOp("remove", pointerTo(path, key), nil, false))
+				}
+			}
+			for _, key := range sortedKeys(t) {
+				if _, exists := f[key]; !exists {
+					*ops = append(*ops, patchOp("add", pointerTo(path, key), t[key], true))
+				}
+			}
+			return
+		}
+	case []any:
+		if t, ok := to.([]any); ok {
+			common := min(len(f), len(t))
+			for i := 0; i < common; i++ {
+				diff(f[i], t[i], pointerTo(path, strconv.Itoa(i)), ops)
+			}
+			for i := len(f) - 1; i >= common; i-- {
+				*ops = append(*ops, patchOp("remove", pointerTo(path, strconv.Itoa(i)), nil, false))
+			}
+			for i := common; i < len(t); i++ {
+				*ops = append(*ops, patchOp("add", pointerTo(path, "-"), t[i], true))
+			}
+			return
+		}
+	}
+	*ops = append(*ops, patchOp("replace", path, to, true))
+}
+
+func patchOp(op, path string, value any, hasValue bool) map[string]any {
+	m := map[string]any{
+		"op":   op,
+		"path": path,
+	}
+	if hasValue {
+		m["value"] = deepCopy(value)
+	}
+	return m
+}
+
+// jsonText returns the value in JSON form. Unlike Data.String(), a nil value produces "null".
+func jsonText(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "<invalid>"
+	}
+	return string(data)
+}
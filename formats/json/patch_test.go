@@ -0,0 +1,146 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package json_test
+
+import (
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/formats/json"
+)
+
+func TestApplyPatch(t *testing.T) {
+	for _, one := range []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"a":1}`, `[{"op":"add","path":"/b","value":[1,2]}]`, `{"a":1,"b":[1,2]}`},
+		{`{"a":[1,2]}`, `[{"op":"add","path":"/a/1","value":9}]`, `{"a":[1,9,2]}`},
+		{`{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3}]`, `{"a":[1,2,3]}`},
+		{`{"a":1}`, `[{"op":"add","path":"","value":[true]}]`, `[true]`},
+		{`{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`},
+		{`[1,2,3]`, `[{"op":"remove","path":"/1"}]`, `[1,3]`},
+		{`{"a":{"b":1}}`, `[{"op":"replace","path":"/a/b","value":null}]`, `{"a":{"b":null}}`},
+		{`{"a":{"b":1},"c":[]}`, `[{"op":"move","from":"/a/b","path":"/c/0"}]`, `{"a":{},"c":[1]}`},
+		{`{"a":{"b":[1]}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`,
+			`{"a":{"b":[1]},"c":{"b":[1,2]}}`},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"replace","path":"/m~0n","value":3}]`,
+			`{"m~n":3}`},
+		{`{"a":1.0,"b":{"x":[1,"y"]}}`,
+			`[{"op":"test","path":"/a","value":1},{"op":"test","path":"/b","value":{"x":[1e0,"y"]}}]`,
+			`{"a":1.0,"b":{"x":[1,"y"]}}`},
+	} {
+		data := json.MustParse([]byte(one.doc))
+		check.NoError(t, data.ApplyPatch(json.MustParse([]byte(one.patch))), one.patch)
+		check.Equal(t, one.expected, data.String(), one.patch)
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	const doc = `{"a":[1,2],"b":{"c":"d"}}`
+	for _, patch := range []string{
+		`{"op":"add","path":"/x","value":1}`,
+		`[{"path":"/x","value":1}]`,
+		`[{"op":"add","value":1}]`,
+		`[{"op":"add","path":"/x"}]`,
+		`[{"op":"bogus","path":"/x"}]`,
+		`[{"op":"add","path":"x","value":1}]`,
+		`[{"op":"add","path":"/b/~2","value":1}]`,
+		`[{"op":"add","path":"/a/3","value":1}]`,
+		`[{"op":"add","path":"/a/01","value":1}]`,
+		`[{"op":"add","path":"/x/y","value":1}]`,
+		`[{"op":"remove","path":"/a/-"}]`,
+		`[{"op":"remove","path":"/z"}]`,
+		`[{"op":"replace","path":"/z","value":1}]`,
+		`[{"op":"move","from":"/b","path":"/b/c/d"}]`,
+		`[{"op":"copy","from":"/z","path":"/y"}]`,
+		`[{"op":"add","path":"/a/-","value":3},{"op":"test","path":"/a/2","value":4}]`,
+	} {
+		data := json.MustParse([]byte(doc))
+		check.Error(t, data.ApplyPatch(json.MustParse([]byte(patch))), patch)
+		check.Equal(t, doc, data.String(), patch)
+	}
+
+	data := json.MustParse([]byte(doc))
+	err := data.ApplyPatch(json.MustParse([]byte(`[{"op":"test","path":"/b/c","value":"e"}]`)))
+	check.Error(t, err)
+	check.Contains(t, err.Error(), `patch operation 0 (test "/b/c") failed`)
+	check.Contains(t, err.Error(), `test failed at "/b/c": expected "e", found "d"`)
+
+	err = data.ApplyPatch(json.MustParse([]byte(`[{"op":"test","path":"/a","value":null}]`)))
+	check.Error(t, err)
+	check.Contains(t, err.Error(), `test failed at "/a": expected null, found [1,2]`)
+}
+
+func TestCreatePatch(t *testing.T) {
+	for _, one := range []struct {
+		from string
+		to   string
+	}{
+		{`{"a":1,"b":[1,2,3],"c":{"d":true}}`, `{"a":2,"b":[1,4],"c":{"e":null},"f":"g"}`},
+		{`{"a":[1]}`, `{"a":[1,{"b":2},3]}`},
+		{`[1,2]`, `{"a":1}`},
+		{`{"a":1.0}`, `{"a":1}`},
+		{`"x"`, `null`},
+	} {
+		from := json.MustParse([]byte(one.from))
+		to := json.MustParse([]byte(one.to))
+		patch := from.CreatePatch(to)
+		check.True(t, patch.IsArray())
+		check.NoError(t, from.ApplyPatch(patch), patch.String())
+		check.Equal(t, 0, from.CreatePatch(to).Size(), patch.String())
+	}
+
+	from := json.MustParse([]byte(`{"a":1,"b":2}`))
+	check.Equal(t, `[{"op":"remove","path":"/a"},{"op":"replace","path":"/b","value":3},`+
+		`{"op":"add","path":"/c~1d","value":4}]`,
+		from.CreatePatch(json.MustParse([]byte(`{"b":3,"c/d":4}`))).String())
+	check.Equal(t, `[]`, from.CreatePatch(from).String())
+
+	// Values placed into the data directly need not be comparable.
+	from = json.MustParse([]byte(`{"a":1}`))
+	to := json.MustParse([]byte(`{"a":1}`))
+	from.Raw().(map[string]any)["b"] = []string{"x"}
+	to.Raw().(map[string]any)["b"] = []string{"x"}
+	check.Equal(t, `[]`, from.CreatePatch(to).String())
+	to.Raw().(map[string]any)["b"] = []string{"y"}
+	check.Equal(t, `[{"op":"replace","path":"/b","value":["y"]}]`, from.CreatePatch(to).String())
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	for _, one := range []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		data := json.MustParse([]byte(one.doc))
+		data.ApplyMergePatch(json.MustParse([]byte(one.patch)))
+		check.Equal(t, one.expected, data.String(), one.doc+" + "+one.patch)
+	}
+
+	data := json.MustParse([]byte(`{"a":"foo"}`))
+	data.ApplyMergePatch(json.MustParse([]byte(`null`)))
+	check.Nil(t, data.Raw())
+}
@@ -0,0 +1,172 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package json
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+var pointerTokenReplacer = strings.NewReplacer("~", "~0", "/", "~1")
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, errs.Newf("invalid JSON pointer %q: must be empty or start with '/'", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		for j := 0; j < len(token); j++ {
+			if token[j] == '~' && (j+1 == len(token) || (token[j+1] != '0' && token[j+1] != '1')) {
+				return nil, errs.Newf("invalid JSON pointer %q: bad escape sequence", pointer)
+			}
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// pointerTo appends the escaped token to the JSON Pointer.
+func pointerTo(pointer, token string) string {
+	return pointer + "/" + pointerTokenReplacer.Replace(token)
+}
+
+// arrayIndex converts a reference token into an index into an array of the given length. If forAdd is true, the
+// index may be equal to the length, and "-" refers to the position past the last element.
+func arrayIndex(token string, length int, forAdd bool) (int, error) {
+	if token == "-" {
+		if forAdd {
+			return length, nil
+		}
+		return 0, errs.New("the '-' index refers to a nonexistent element")
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, errs.Newf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, errs.Newf("invalid array index %q", token)
+	}
+	limit := length
+	if forAdd {
+		limit++
+	}
+	if i >= limit {
+		return 0, errs.Newf("array index %d is out of bounds", i)
+	}
+	return i, nil
+}
+
+// valueAt returns the value the reference tokens refer to.
+func valueAt(node any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]any:
+			child, exists := n[token]
+			if !exists {
+				return nil, errs.Newf("member %q does not exist", token)
+			}
+			node = child
+		case []any:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, errs.Newf("cannot look up %q in a value that is not an object or array", token)
+		}
+	}
+	return node, nil
+}
+
+// deepCopy returns a copy of the value that shares no objects or arrays with the original.
+func deepCopy(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(t))
+		for key, value := range t {
+			m[key] = deepCopy(value)
+		}
+		return m
+	case []any:
+		a := make([]any, len(t))
+		for i, value := range t {
+			a[i] = deepCopy(value)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+// deepEqual returns true if the two values are equal by JSON's rules. Numbers are compared by value, so 1 and 1.0 are
+// equal, while the order of an object's members does not matter.
+func deepEqual(left, right any) bool {
+	switch l := left.(type) {
+	case map[string]any:
+		r, ok := right.(map[string]any)
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for key, value := range l {
+			other, exists := r[key]
+			if !exists || !deepEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		r, ok := right.([]any)
+		return ok && slices.EqualFunc(l, r, deepEqual)
+	default:
+		if ln, ok := number(left); ok {
+			rn, isNumber := number(right)
+			return isNumber && ln.Cmp(rn) == 0
+		}
+		if _, ok := number(right); ok {
+			return false
+		}
+		// Values placed into the data through Raw() may be of any type, including those that can't be compared with ==.
+		return reflect.DeepEqual(left, right)
+	}
+}
+
+// number returns the value as a big.Rat if it is a number.
+func number(v any) (*big.Rat, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		r, ok := new(big.Rat).SetString(t.String())
+		return r, ok
+	case float64:
+		r := new(big.Rat)
+		if r.SetFloat64(t) == nil {
+			return nil, false
+		}
+		return r, true
+	case float32:
+		return number(float64(t))
+	case int:
+		return new(big.Rat).SetInt64(int64(t)), true
+	case int64:
+		return new(big.Rat).SetInt64(t), true
+	default:
+		return nil, false
+	}
+}
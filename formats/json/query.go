@@ -0,0 +1,804 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package json
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/eval"
+)
+
+type selectorKind int
+
+const (
+	nameSelector selectorKind = iota
+	wildcardSelector
+	indexSelector
+	sliceSelector
+	filterSelector
+)
+
+type querySegment struct {
+	selectors []*selector
+	recursive bool
+}
+
+type selector struct {
+	kind    selectorKind
+	name    string
+	index   int
+	start   *int
+	end     *int
+	step    int
+	filter  *eval.Program
+	current map[string][]*querySegment
+	root    map[string][]*querySegment
+}
+
+type queryParser struct {
+	query string
+	pos   int
+}
+
+// Query returns the values selected by a JSONPath expression, such as "$.items[?(@.price > 10)].name". Supported are:
+//
+//   - $ for the root value
+//   - .name or ['name'] for the member of an object with the given name
+//   - .* or [*] for every member of an object or element of an array
+//   - [index] for an element of an array, where negative indexes count back from the end
+//   - [start:end:step] for a slice of an array, where each part is optional
+//   - [a,b,...] for the union of several names, indexes or slices
+//   - ..name, ..* or ..[...] for recursive descent through every descendant
+//   - [?(expression)] for the members or elements for which the expression is true
+//
+// Filter expressions are evaluated with the eval package, using its float operators and functions. Within them, @
+// refers to the value being filtered and $ to the root value, each optionally followed by a relative path, e.g.
+// "@.price > 10 && @.tags[0] == 'sale'" or "len(@.tags) > $.minTags". Strings may be quoted with either single or
+// double quotes. Every operand must be a path or a literal, and a filter must be a single expression. Values are only
+// compared with values of the same type, so "@.code == '7'" does not match a code of "007" or 7, and comparing values
+// of different types is simply false. A path that does not exist is missing: it is false when used as a condition, is
+// equal only to another missing value, and makes any arithmetic or function call it takes part in missing, too. Other
+// problems found while evaluating a filter, such as a function called with the wrong number of arguments, are returned
+// as errors.
+//
+// The members of objects are visited in key order, since JSON objects are unordered once parsed.
+func (j *Data) Query(query string) ([]*Data, error) {
+	segments, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	values, err := runQuery(j.obj, j.obj, segments)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Data, len(values))
+	for i, v := range values {
+		result[i] = &Data{obj: v}
+	}
+	return result, nil
+}
+
+func parseQuery(query string) ([]*querySegment, error) {
+	p := &queryParser{query: query}
+	p.skipSpace()
+	if !p.consume('$') {
+		return nil, p.errorf("query must start with '$'")
+	}
+	segments, err := p.parseSegments()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.query) {
+		return nil, p.errorf("unexpected %q", p.query[p.pos])
+	}
+	return segments, nil
+}
+
+// parseSegments parses segments until something that cannot start a segment is encountered.
+func (p *queryParser) parseSegments() ([]*querySegment, error) {
+	var segments []*querySegment
+	for p.pos < len(p.query) {
+		var seg *querySegment
+		var err error
+		switch {
+		case strings.HasPrefix(p.query[p.pos:], ".."):
+			p.pos += 2
+			if p.pos < len(p.query) && p.query[p.pos] == '[' {
+				seg, err = p.parseBracket()
+			} else {
+				seg, err = p.parseDotted()
+			}
+			if seg != nil {
+				seg.recursive = true
+			}
+		case p.query[p.pos] == '.':
+			p.pos++
+			seg, err = p.parseDotted()
+		case p.query[p.pos] == '[':
+			seg, err = p.parseBracket()
+		default:
+			return segments, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+func (p *queryParser) parseDotted() (*querySegment, error) {
+	if p.consume('*') {
+		return &querySegment{selectors: []*selector{{kind: wildcardSelector}}}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.query) && isQueryNameByte(p.query[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, p.errorf("expected a name")
+	}
+	return &querySegment{selectors: []*selector{{kind: nameSelector, name: p.query[start:p.pos]}}}, nil
+}
+
+func (p *queryParser) parseBracket() (*querySegment, error) {
+	p.pos++ // Skip the '['
+	seg := &querySegment{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.query) {
+			return nil, p.errorf("missing ']'")
+		}
+		var sel *selector
+		var err error
+		switch ch := p.query[p.pos]; {
+		case ch == '*':
+			p.pos++
+			sel = &selector{kind: wildcardSelector}
+		case ch == '\'' || ch == '"':
+			var name string
+			if name, err = p.parseString(); err != nil {
+				return nil, err
+			}
+			sel = &selector{kind: nameSelector, name: name}
+		case ch == '?':
+			if sel, err = p.parseFilter(); err != nil {
+				return nil, err
+			}
+		case ch == '-' || ch == ':' || (ch >= '0' && ch <= '9'):
+			if sel, err = p.parseIndexOrSlice(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.errorf("unexpected %q", ch)
+		}
+		seg.selectors = append(seg.selectors, sel)
+		p.skipSpace()
+		if p.consume(']') {
+			return seg, nil
+		}
+		if !p.consume(',') {
+			return nil, p.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+func (p *queryParser) parseIndexOrSlice() (*selector, error) {
+	var parts [3]*int
+	count := 0
+	for {
+		p.skipSpace()
+		start := p.pos
+		if p.pos < len(p.query) && p.query[p.pos] == '-' {
+			p.pos++
+		}
+		for p.pos < len(p.query) && p.query[p.pos] >= '0' && p.query[p.pos] <= '9' {
+			p.pos++
+		}
+		if start != p.pos {
+			v, err := strconv.Atoi(p.query[start:p.pos])
+			if err != nil {
+				p.pos = start
+				return nil, p.errorf("invalid index")
+			}
+			parts[count] = &v
+		}
+		count++
+		p.skipSpace()
+		if count == 3 || !p.consume(':') {
+			break
+		}
+	}
+	if count == 1 {
+		if parts[0] == nil {
+			return nil, p.errorf("expected an index")
+		}
+		return &selector{kind: indexSelector, index: *parts[0]}, nil
+	}
+	sel := &selector{kind: sliceSelector, start: parts[0], end: parts[1], step: 1}
+	if parts[2] != nil {
+		sel.step = *parts[2]
+	}
+	return sel, nil
+}
+
+func (p *queryParser) parseString() (string, error) {
+	quote := p.query[p.pos]
+	start := p.pos
+	p.pos++
+	var buffer strings.Builder
+	for p.pos < len(p.query) {
+		ch := p.query[p.pos]
+		p.pos++
+		switch ch {
+		case quote:
+			return buffer.String(), nil
+		case '\\':
+			if p.pos >= len(p.query) {
+				break
+			}
+			ch = p.query[p.pos]
+			p.pos++
+			switch ch {
+			case 'n':
+				buffer.WriteByte('\n')
+			case 't':
+				buffer.WriteByte('\t')
+			case 'r':
+				buffer.WriteByte('\r')
+			default:
+				buffer.WriteByte(ch)
+			}
+		default:
+			buffer.WriteByte(ch)
+		}
+	}
+	p.pos = start
+	return "", p.errorf("unterminated string")
+}
+
+// parseFilter parses a filter selector, translating the expression into one the eval package understands. Each
+// reference to @ or $ is replaced with a variable whose value is supplied when the filter is evaluated.
+func (p *queryParser) parseFilter() (*selector, error) {
+	p.pos++ // Skip the '?'
+	sel := &selector{
+		kind:    filterSelector,
+		current: make(map[string][]*querySegment),
+		root:    make(map[string][]*querySegment),
+	}
+	var buffer strings.Builder
+	depth := 0
+	for {
+		if p.pos >= len(p.query) {
+			return nil, p.errorf("filter is not terminated")
+		}
+		ch := p.query[p.pos]
+		switch {
+		case ch == '\'' || ch == '"':
+			s, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			buffer.WriteString(strconv.Quote(s))
+			continue
+		case ch == '@' || ch == '$':
+			p.pos++
+			segments, err := p.parseSegments()
+			if err != nil {
+				return nil, err
+			}
+			name := fmt.Sprintf("jp%d", len(sel.current)+len(sel.root))
+			if ch == '@' {
+				sel.current[name] = segments
+			} else {
+				sel.root[name] = segments
+			}
+			buffer.WriteString("$" + name)
+			continue
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == ']' || ch == ',':
+			// The usual form, [?(expression)], needs no special handling, since the parentheses are just a grouping.
+			if depth == 0 {
+				return p.compileFilter(sel, buffer.String())
+			}
+			if ch == ']' {
+				depth--
+			}
+		}
+		buffer.WriteByte(ch)
+		p.pos++
+	}
+}
+
+func (p *queryParser) compileFilter(sel *selector, expression string) (*selector, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, p.errorf("empty filter")
+	}
+	var err error
+	if sel.filter, err = newFilterEvaluator().Compile(expression); err != nil {
+		return nil, errs.NewWithCause("invalid filter expression", err)
+	}
+	if err = sel.checkFilter(sel.filter.Root()); err != nil {
+		return nil, errs.NewWithCause("invalid filter expression", err)
+	}
+	return sel, nil
+}
+
+// checkFilter verifies that node is a single expression whose operands are each a path or a literal. Anything else,
+// such as two operands with no operator between them, would otherwise be taken as text and treated as true.
+func (s *selector) checkFilter(node eval.Node) error {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *eval.OperandNode:
+		if n.Quoted || s.isPath(n.Text) {
+			return nil
+		}
+		if _, ok := filterLiteral(n.Text); ok {
+			return nil
+		}
+		return errs.New("expected a path or literal")
+	case *eval.OperatorNode:
+		if err := s.checkFilter(n.Left); err != nil {
+			return err
+		}
+		return s.checkFilter(n.Right)
+	case *eval.FunctionNode:
+		for _, arg := range n.Args {
+			if err := s.checkFilter(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *eval.ListNode:
+		for _, element := range n.Elements {
+			if err := s.checkFilter(element); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *eval.IndexNode:
+		if err := s.checkFilter(n.Target); err != nil {
+			return err
+		}
+		return s.checkFilter(n.Index)
+	default:
+		return errs.New("a filter must be a single expression")
+	}
+}
+
+// isPath returns true if text is the variable that stands for one of the filter's paths.
+func (s *selector) isPath(text string) bool {
+	name, ok := strings.CutPrefix(text, "$")
+	if !ok {
+		return false
+	}
+	if _, exists := s.current[name]; exists {
+		return true
+	}
+	_, exists := s.root[name]
+	return exists
+}
+
+// newFilterEvaluator returns an evaluator for filter expressions. Its logical operators work with the truthiness of
+// their operands, so that paths which do not exist, or which hold strings, objects or arrays, may be tested directly.
+// Its comparisons follow JSONPath's rules rather than the eval package's, and its arithmetic operators and functions
+// pass missing values through.
+func newFilterEvaluator() *eval.Evaluator {
+	e := eval.NewFloatEvaluator[float64](nil, true)
+	operators := make([]*eval.Operator, len(e.Operators))
+	for i, op := range e.Operators {
+		switch op.Symbol {
+		case "!":
+			op = eval.Not(func(arg any) (any, error) { return !truthy(arg), nil })
+		case "&&":
+			op = eval.LogicalAnd(func(left, right any) (any, error) { return truthy(left) && truthy(right), nil })
+		case "||":
+			op = eval.LogicalOr(func(left, right any) (any, error) { return truthy(left) || truthy(right), nil })
+		case "==":
+			op = eval.Equal(filterCompare(func(result int, _ bool) bool { return result == 0 }))
+		case "!=":
+			op = eval.NotEqual(filterCompare(func(result int, _ bool) bool { return result != 0 }))
+		case ">":
+			op = eval.GreaterThan(filterCompare(func(result int, ordered bool) bool { return ordered && result > 0 }))
+		case ">=":
+			op = eval.GreaterThanOrEqual(filterCompare(func(result int, ordered bool) bool {
+				return result == 0 || (ordered && result > 0)
+			}))
+		case "<":
+			op = eval.LessThan(filterCompare(func(result int, ordered bool) bool { return ordered && result < 0 }))
+		case "<=":
+			op = eval.LessThanOrEqual(filterCompare(func(result int, ordered bool) bool {
+				return result == 0 || (ordered && result < 0)
+			}))
+		case "(", ")":
+		default:
+			op = &eval.Operator{
+				Symbol:        op.Symbol,
+				Precedence:    op.Precedence,
+				Evaluate:      passMissing(op.Evaluate),
+				EvaluateUnary: passMissingUnary(op.EvaluateUnary),
+			}
+		}
+		operators[i] = op
+	}
+	e.Operators = operators
+	functions := make(map[string]eval.Function, len(e.Functions))
+	for name, f := range e.Functions {
+		if name != "if" {
+			// if() only evaluates one of its branches, so a missing value in the other must not matter.
+			f = passMissingFunction(f)
+		}
+		functions[name] = f
+	}
+	e.Functions = functions
+	return e
+}
+
+// filterCompare returns a comparison that is given the result of comparing its operands, which will be -1, 0, or 1,
+// and whether that result orders them or merely says whether they are equal.
+func filterCompare(test func(result int, ordered bool) bool) eval.OpFunc {
+	return func(left, right any) (any, error) {
+		return test(compareFilterValues(filterOperand(left), filterOperand(right))), nil
+	}
+}
+
+// compareFilterValues compares two filter values. Only numbers and strings may be ordered, and then only against values
+// of the same type; any other values, including objects and arrays, are either equal (0) or not (1) by JSON's rules.
+func compareFilterValues(left, right any) (result int, ordered bool) {
+	switch l := left.(type) {
+	case float64:
+		if r, ok := right.(float64); ok {
+			return cmp.Compare(l, r), true
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), true
+		}
+	default:
+		if deepEqual(left, right) {
+			return 0, false
+		}
+	}
+	return 1, false
+}
+
+// filterOperand returns the value of an operand of a comparison. Values from the document, quoted literals and the
+// results of arithmetic arrive already typed, while other literals arrive as their text, which is interpreted here as
+// a number, true, false or null.
+func filterOperand(v any) any {
+	switch v.(type) {
+	case nil, bool, float64, string, []any, map[string]any, missing:
+		return v
+	default:
+		if literal, ok := filterLiteral(fmt.Sprint(v)); ok {
+			return literal
+		}
+		return v
+	}
+}
+
+// filterLiteral returns the value of the text of an unquoted literal, which may be a number, true, false or null.
+func filterLiteral(text string) (any, bool) {
+	switch text {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	case "null":
+		return nil, true
+	default:
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f, true
+		}
+		return nil, false
+	}
+}
+
+func passMissing(f eval.OpFunc) eval.OpFunc {
+	if f == nil {
+		return nil
+	}
+	return func(left, right any) (any, error) {
+		if isMissing(left) || isMissing(right) {
+			return missing{}, nil
+		}
+		return f(left, right)
+	}
+}
+
+func passMissingUnary(f eval.UnaryOpFunc) eval.UnaryOpFunc {
+	if f == nil {
+		return nil
+	}
+	return func(arg any) (any, error) {
+		if isMissing(arg) {
+			return missing{}, nil
+		}
+		return f(arg)
+	}
+}
+
+func passMissingFunction(f eval.Function) eval.Function {
+	return func(e *eval.Evaluator, arguments string) (any, error) {
+		for remaining := arguments; remaining != ""; {
+			var arg string
+			arg, remaining = eval.NextArg(remaining)
+			v, err := e.EvaluateNew(arg)
+			if err != nil {
+				return nil, err
+			}
+			if isMissing(v) {
+				return missing{}, nil
+			}
+		}
+		return f(e, arguments)
+	}
+}
+
+func (p *queryParser) consume(ch byte) bool {
+	if p.pos < len(p.query) && p.query[p.pos] == ch {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.query) && (p.query[p.pos] == ' ' || p.query[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return errs.Newf("invalid query at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func isQueryNameByte(ch byte) bool {
+	return ch == '_' || ch >= 0x80 || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') ||
+		(ch >= '0' && ch <= '9')
+}
+
+func runQuery(root, start any, segments []*querySegment) ([]any, error) {
+	nodes := []any{start}
+	for _, seg := range segments {
+		if seg.recursive {
+			var all []any
+			for _, node := range nodes {
+				all = appendDescendants(all, node)
+			}
+			nodes = all
+		}
+		var next []any
+		for _, node := range nodes {
+			for _, sel := range seg.selectors {
+				var err error
+				if next, err = sel.apply(next, root, node); err != nil {
+					return nil, err
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+// appendDescendants appends the node and all of its descendants, in document order.
+func appendDescendants(list []any, node any) []any {
+	list = append(list, node)
+	switch n := node.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(n) {
+			list = appendDescendants(list, n[key])
+		}
+	case []any:
+		for _, one := range n {
+			list = appendDescendants(list, one)
+		}
+	}
+	return list
+}
+
+func (s *selector) apply(list []any, root, node any) ([]any, error) {
+	switch s.kind {
+	case nameSelector:
+		if m, ok := node.(map[string]any); ok {
+			if v, exists := m[s.name]; exists {
+				list = append(list, v)
+			}
+		}
+	case wildcardSelector:
+		list = appendChildren(list, node)
+	case indexSelector:
+		if a, ok := node.([]any); ok {
+			i := s.index
+			if i < 0 {
+				i += len(a)
+			}
+			if i >= 0 && i < len(a) {
+				list = append(list, a[i])
+			}
+		}
+	case sliceSelector:
+		if a, ok := node.([]any); ok {
+			list = s.appendSlice(list, a)
+		}
+	case filterSelector:
+		for _, child := range appendChildren(nil, node) {
+			match, err := s.matches(root, child)
+			if err != nil {
+				return nil, err
+			}
+			if match {
+				list = append(list, child)
+			}
+		}
+	}
+	return list, nil
+}
+
+func (s *selector) appendSlice(list, a []any) []any {
+	if s.step == 0 {
+		return list
+	}
+	length := len(a)
+	normalize := func(v *int, def int) int {
+		if v == nil {
+			return def
+		}
+		i := *v
+		if i < 0 {
+			i += length
+		}
+		return i
+	}
+	if s.step > 0 {
+		start := min(max(normalize(s.start, 0), 0), length)
+		end := min(max(normalize(s.end, length), 0), length)
+		for i := start; i < end; i += s.step {
+			list = append(list, a[i])
+		}
+	} else {
+		start := min(max(normalize(s.start, length-1), -1), length-1)
+		end := min(max(normalize(s.end, -1-length), -1), length-1)
+		for i := start; i > end; i += s.step {
+			list = append(list, a[i])
+		}
+	}
+	return list
+}
+
+func (s *selector) matches(root, node any) (bool, error) {
+	resolver := &filterResolver{values: make(map[string]any, len(s.current)+len(s.root))}
+	for name, segments := range s.current {
+		if err := resolver.resolve(name, root, node, segments); err != nil {
+			return false, err
+		}
+	}
+	for name, segments := range s.root {
+		if err := resolver.resolve(name, root, root, segments); err != nil {
+			return false, err
+		}
+	}
+	result, err := s.filter.Eval(resolver)
+	if err != nil {
+		return false, errs.NewWithCause("unable to evaluate filter expression", err)
+	}
+	return truthy(result), nil
+}
+
+func appendChildren(list []any, node any) []any {
+	switch n := node.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(n) {
+			list = append(list, n[key])
+		}
+	case []any:
+		list = append(list, n...)
+	}
+	return list
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case nil, missing:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	default:
+		return true
+	}
+}
+
+// missing is the value of a path that does not exist.
+type missing struct{}
+
+func isMissing(v any) bool {
+	_, ok := v.(missing)
+	return ok
+}
+
+// filterResolver supplies the values of the paths referenced by a filter expression.
+type filterResolver struct {
+	values map[string]any
+}
+
+func (r *filterResolver) resolve(name string, root, start any, segments []*querySegment) error {
+	values, err := runQuery(root, start, segments)
+	if err != nil {
+		return err
+	}
+	var v any = missing{}
+	if len(values) != 0 {
+		v = filterValue(values[0])
+	}
+	r.values[name] = v
+	return nil
+}
+
+// ResolveValue implements eval.ValueResolver.
+func (r *filterResolver) ResolveValue(variableName string) (any, bool) {
+	v, exists := r.values[variableName]
+	return v, exists
+}
+
+// ResolveVariable implements eval.VariableResolver.
+func (r *filterResolver) ResolveVariable(variableName string) string {
+	switch v := r.values[variableName].(type) {
+	case nil, missing:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// filterValue converts a JSON value into one that the eval package's float operators understand.
+func filterValue(v any) any {
+	switch t := v.(type) {
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return t.String()
+	case int:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case float32:
+		return float64(t)
+	default:
+		return v
+	}
+}
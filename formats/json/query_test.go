@@ -0,0 +1,179 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package json_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/formats/json"
+)
+
+const storeJSON = `{
+	"store": {
+		"book": [
+			{"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+			{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+			{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3",
+				"price": 8.99},
+			{"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings",
+				"isbn": "0-395-19395-8", "price": 22.99, "tags": ["epic", "classic"]}
+		],
+		"bicycle": {"color": "red", "price": 19.95}
+	},
+	"limit": 10,
+	"odd key": [0, 1, 2, 3, 4, 5]
+}`
+
+func TestQuery(t *testing.T) {
+	data, err := json.Parse([]byte(storeJSON))
+	check.NoError(t, err)
+	for _, one := range []struct {
+		query    string
+		expected string
+	}{
+		{"$.store.book[*].author", `"Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"`},
+		{"$..author", `"Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"`},
+		{"$.store.*", `{"color":"red","price":19.95},` + "[" + `]`},
+		{"$.store..price", `19.95,8.95,12.99,8.99,22.99`},
+		{"$..book[2].title", `"Moby Dick"`},
+		{"$..book[-1].title", `"The Lord of the Rings"`},
+		{"$..book[0,1].price", `8.95,12.99`},
+		{"$..book[:2].price", `8.95,12.99`},
+		{"$..book[1:3].price", `12.99,8.99`},
+		{"$..book[-2:].price", `8.99,22.99`},
+		{"$['odd key'][::2]", `0,2,4`},
+		{"$['odd key'][::-2]", `5,3,1`},
+		{"$['odd key'][4:1:-1]", `4,3,2`},
+		{"$['odd key'][9]", ``},
+		{"$..book[?(@.isbn)].title", `"Moby Dick","The Lord of the Rings"`},
+		{"$..book[?(@.price < 10)].title", `"Sayings of the Century","Moby Dick"`},
+		{"$..book[?@.price > $.limit && @.category == 'fiction'].author", `"Evelyn Waugh","J. R. R. Tolkien"`},
+		{`$..book[?(@.tags[0] == "epic")].price`, `22.99`},
+		{"$..book[?(len(@.tags) == 2)].price", `22.99`},
+		{"$..book[?(!@.isbn)].price", `8.95,12.99`},
+		{"$..book[?(@.isbn && @.tags)].price", `22.99`},
+		{"$..book[?(@.price > 20 || @.author == 'Nigel Rees')].price", `8.95,22.99`},
+		{"$..book[?(@.author == 'Nobody')]", ``},
+		{"$.store.bicycle['color','price']", `"red",19.95`},
+		{"$..[?(@.color)].price", `19.95`},
+		{"$.limit", `10`},
+		{"$", ""},
+	} {
+		results, err := data.Query(one.query)
+		check.NoError(t, err, one.query)
+		if one.query == "$" {
+			check.Equal(t, 1, len(results))
+			check.Equal(t, data.String(), results[0].String())
+			continue
+		}
+		parts := make([]string, len(results))
+		for i, r := range results {
+			parts[i] = r.String()
+			if one.query == "$.store.*" && r.IsArray() {
+				parts[i] = "[]"
+				check.Equal(t, 4, r.Size())
+			}
+		}
+		check.Equal(t, one.expected, strings.Join(parts, ","), one.query)
+	}
+}
+
+func TestQueryFilterTypes(t *testing.T) {
+	data := json.MustParse([]byte(`{"items": [
+		{"code": "007", "tags": []},
+		{"code": "7", "tags": ["a"]},
+		{"code": 7},
+		{"code": true}
+	]}`))
+	for _, one := range []struct {
+		query    string
+		expected string
+	}{
+		{"$.items[?(@.code == '7')].code", `"7"`},
+		{"$.items[?(@.code == 7)].code", `7`},
+		{"$.items[?(@.code != 7)].code", `"007","7",true`},
+		{"$.items[?(@.code == true)].code", `true`},
+		{"$.items[?(@.code < '1')].code", `"007"`},
+		{"$.items[?(@.code >= 7)].code", `7`},
+		{"$.items[?(len(@.tags) > 0)].code", `"7"`},
+		{"$.items[?(len(@.tags) >= 0)].code", `"007","7"`},
+		{"$.items[?(len(@.tags) == 0)].code", `"007"`},
+		{"$.items[?(!@.tags)].code", `7,true`},
+		{"$.items[?(@.size * 2 > 1)].code", ``},
+		{"$.items[?(-@.size < 1)].code", ``},
+		{"$.items[?(@.size == @.weight)].code", `"007","7",7,true`},
+	} {
+		results, err := data.Query(one.query)
+		check.NoError(t, err, one.query)
+		parts := make([]string, len(results))
+		for i, r := range results {
+			parts[i] = r.String()
+		}
+		check.Equal(t, one.expected, strings.Join(parts, ","), one.query)
+	}
+}
+
+func TestQueryFilterStructures(t *testing.T) {
+	data := json.MustParse([]byte(`{"items": [
+		{"id": 1, "a": {"x": 1, "y": [1, 2]}, "b": {"y": [1, 2], "x": 1}},
+		{"id": 2, "a": {"x": 1}, "b": {"x": 2}},
+		{"id": 3, "a": {"x": 1}, "b": {"x": 1, "y": 2}},
+		{"id": 4, "a": [1, {"x": "s"}], "b": [1, {"x": "s"}]},
+		{"id": 5, "a": [1, 2], "b": [2, 1]},
+		{"id": 6, "a": {"x": 1}, "b": true}
+	]}`))
+	for _, one := range []struct {
+		query    string
+		expected string
+	}{
+		{"$.items[?(@.a == @.b)].id", `1,4`},
+		{"$.items[?(@.a != @.b)].id", `2,3,5,6`},
+		{"$.items[?(@.a == true)].id", ``},
+		{"$.items[?(@.b == true)].id", `6`},
+		{"$.items[?(@.a >= @.b)].id", `1,4`},
+		{"$.items[?(@.a < @.b)].id", ``},
+		{"$.items[?(@.a.y == $.items[0].b.y)].id", `1`},
+	} {
+		results, err := data.Query(one.query)
+		check.NoError(t, err, one.query)
+		parts := make([]string, len(results))
+		for i, r := range results {
+			parts[i] = r.String()
+		}
+		check.Equal(t, one.expected, strings.Join(parts, ","), one.query)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	data := json.MustParse([]byte(storeJSON))
+	for _, query := range []string{
+		"store.book",
+		"$.",
+		"$[",
+		"$['unterminated]",
+		"$[1",
+		"$[?(@.price > (1)]",
+		"$[?(@.price > 1)",
+		"$.store book",
+		"$[a]",
+		"$[?(unknown(@.price))]",
+		"$..book[?(substr(@.title) == 'x')]",
+		"$..book[?(date(@.title) > 0)]",
+		"$..book[?(@.price $ 1)]",
+		"$..book[?(@.price 1)]",
+		"$..book[?(@.price > cheap)]",
+		"$..book[?(let a = 1; @.price > a)]",
+	} {
+		_, err := data.Query(query)
+		check.Error(t, err, query)
+	}
+}
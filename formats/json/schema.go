@@ -0,0 +1,541 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package json
+
+import (
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+var schemaTypes = []string{"array", "boolean", "integer", "null", "number", "object", "string"}
+
+// Schema is a compiled JSON Schema. A subset of draft 2020-12 is supported, consisting of these keywords:
+//
+//   - type, enum, const
+//   - properties, patternProperties, additionalProperties, required, minProperties, maxProperties
+//   - items, prefixItems, minItems, maxItems, uniqueItems
+//   - minLength, maxLength, pattern
+//   - minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf
+//   - allOf, anyOf, oneOf, not
+//   - $ref, $defs, $anchor
+//
+// References may only refer to locations within the schema document itself, either by JSON Pointer fragment, such as
+// "#/$defs/name", or by anchor, such as "#name". Other keywords are ignored.
+type Schema struct {
+	root     any
+	anchors  map[string]any
+	patterns map[string]*regexp.Regexp
+}
+
+// Violation describes one way in which data fails to conform to a schema.
+type Violation struct {
+	// Pointer is the JSON Pointer to the offending value within the data.
+	Pointer string
+	// Keyword is the schema keyword that was not satisfied.
+	Keyword string
+	// Message describes the problem.
+	Message string
+}
+
+// ValidationError is returned when data does not conform to a schema. It holds every violation that was found.
+type ValidationError struct {
+	Violations []Violation
+}
+
+// NewSchema compiles a JSON Schema. An error is returned if the schema is malformed, uses an invalid regular
+// expression or contains a reference that cannot be resolved.
+func NewSchema(schema *Data) (*Schema, error) {
+	var root any
+	if schema != nil {
+		root = schema.obj
+	}
+	s := &Schema{
+		root:     root,
+		anchors:  make(map[string]any),
+		patterns: make(map[string]*regexp.Regexp),
+	}
+	if err := s.collectAnchors(root, "#"); err != nil {
+		return nil, err
+	}
+	if err := s.compile(root, "#"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate the data against the schema. Returns nil if the data conforms, or a *ValidationError listing every
+// violation if it does not.
+func (j *Data) Validate(schema *Schema) error {
+	v := &validator{schema: schema}
+	v.validate(schema.root, j.obj, "", nil)
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: v.violations}
+}
+
+// ValidateJSON parses the JSON data and validates it against the schema. Its signature matches the validator taken by
+// fs.JSONValidator(), so that it may be used to check files as they are loaded.
+func (s *Schema) ValidateJSON(data []byte) error {
+	doc, err := Parse(data)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	return doc.Validate(s)
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%q: %s", v.Pointer, v.Message)
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Violations) == 1 {
+		return "schema violation at " + e.Violations[0].String()
+	}
+	var buffer strings.Builder
+	fmt.Fprintf(&buffer, "%d schema violations:", len(e.Violations))
+	for _, one := range e.Violations {
+		buffer.WriteString("\n- ")
+		buffer.WriteString(one.String())
+	}
+	return buffer.String()
+}
+
+func (s *Schema) collectAnchors(schema any, location string) error {
+	m, ok := schema.(map[string]any)
+	if !ok {
+		return nil
+	}
+	if anchor, exists := m["$anchor"]; exists {
+		name, isStr := anchor.(string)
+		if !isStr || name == "" {
+			return errs.Newf("schema at %q: $anchor must be a non-empty string", location)
+		}
+		if _, dup := s.anchors[name]; dup {
+			return errs.Newf("schema at %q: duplicate $anchor %q", location, name)
+		}
+		s.anchors[name] = m
+	}
+	return forEachSubschema(m, location, s.collectAnchors)
+}
+
+func (s *Schema) compile(schema any, location string) error {
+	if _, ok := schema.(bool); ok {
+		return nil
+	}
+	m, ok := schema.(map[string]any)
+	if !ok {
+		return errs.Newf("schema at %q must be an object or a boolean", location)
+	}
+	if t, exists := m["type"]; exists {
+		var names []any
+		switch tt := t.(type) {
+		case string:
+			names = []any{tt}
+		case []any:
+			names = tt
+		}
+		if len(names) == 0 {
+			return errs.Newf("schema at %q: type must be a string or a non-empty array of strings", location)
+		}
+		for _, one := range names {
+			if name, isStr := one.(string); !isStr || !slices.Contains(schemaTypes, name) {
+				return errs.Newf("schema at %q: invalid type %s", location, jsonText(one))
+			}
+		}
+	}
+	if e, exists := m["enum"]; exists {
+		if _, isArray := e.([]any); !isArray {
+			return errs.Newf("schema at %q: enum must be an array", location)
+		}
+	}
+	if r, exists := m["required"]; exists {
+		list, isArray := r.([]any)
+		if !isArray {
+			return errs.Newf("schema at %q: required must be an array of strings", location)
+		}
+		for _, one := range list {
+			if _, isStr := one.(string); !isStr {
+				return errs.Newf("schema at %q: required must be an array of strings", location)
+			}
+		}
+	}
+	for _, keyword := range []string{"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf"} {
+		if value, exists := m[keyword]; exists {
+			n, isNumber := number(value)
+			if !isNumber || (keyword == "multipleOf" && n.Sign() <= 0) {
+				return errs.Newf("schema at %q: %s must be a number", location, keyword)
+			}
+		}
+	}
+	for _, keyword := range []string{
+		"minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties",
+	} {
+		if value, exists := m[keyword]; exists {
+			if _, valid := count(value); !valid {
+				return errs.Newf("schema at %q: %s must be a non-negative integer", location, keyword)
+			}
+		}
+	}
+	if p, exists := m["pattern"]; exists {
+		pattern, isStr := p.(string)
+		if !isStr {
+			return errs.Newf("schema at %q: pattern must be a string", location)
+		}
+		if err := s.compilePattern(pattern, location); err != nil {
+			return err
+		}
+	}
+	if pp, exists := m["patternProperties"]; exists {
+		if props, isMap := pp.(map[string]any); isMap {
+			for pattern := range props {
+				if err := s.compilePattern(pattern, location); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if r, exists := m["$ref"]; exists {
+		ref, isStr := r.(string)
+		if !isStr {
+			return errs.Newf("schema at %q: $ref must be a string", location)
+		}
+		if _, err := s.resolve(ref); err != nil {
+			return errs.NewWithCausef(err, "schema at %q: unable to resolve $ref %q", location, ref)
+		}
+	}
+	return forEachSubschema(m, location, s.compile)
+}
+
+func (s *Schema) compilePattern(pattern, location string) error {
+	if _, exists := s.patterns[pattern]; !exists {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return errs.NewWithCausef(err, "schema at %q: invalid pattern %q", location, pattern)
+		}
+		s.patterns[pattern] = re
+	}
+	return nil
+}
+
+func (s *Schema) resolve(ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, errs.New("only references within the same document are supported")
+	}
+	fragment, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if fragment != "" && !strings.HasPrefix(fragment, "/") {
+		if target, exists := s.anchors[fragment]; exists {
+			return target, nil
+		}
+		return nil, errs.Newf("no $anchor named %q", fragment)
+	}
+	var tokens []string
+	if tokens, err = parsePointer(fragment); err != nil {
+		return nil, err
+	}
+	return valueAt(s.root, tokens)
+}
+
+// forEachSubschema calls fn for each of the schema's immediate subschemas.
+func forEachSubschema(m map[string]any, location string, fn func(schema any, location string) error) error {
+	for _, keyword := range sortedKeys(m) {
+		value := m[keyword]
+		switch keyword {
+		case "properties", "patternProperties", "$defs":
+			if props, ok := value.(map[string]any); ok {
+				for _, name := range sortedKeys(props) {
+					if err := fn(props[name], pointerTo(pointerTo(location, keyword), name)); err != nil {
+						return err
+					}
+				}
+			} else {
+				return errs.Newf("schema at %q: %s must be an object", location, keyword)
+			}
+		case "additionalProperties", "items", "not":
+			if err := fn(value, pointerTo(location, keyword)); err != nil {
+				return err
+			}
+		case "prefixItems", "allOf", "anyOf", "oneOf":
+			list, ok := value.([]any)
+			if !ok || len(list) == 0 {
+				return errs.Newf("schema at %q: %s must be a non-empty array", location, keyword)
+			}
+			for i, one := range list {
+				if err := fn(one, pointerTo(pointerTo(location, keyword), strconv.Itoa(i))); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type validator struct {
+	schema     *Schema
+	violations []Violation
+}
+
+func (v *validator) addf(pointer, keyword, format string, args ...any) {
+	v.violations = append(v.violations, Violation{
+		Pointer: pointer,
+		Keyword: keyword,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// matches returns true if the value conforms to the schema, without recording any violations.
+func (v *validator) matches(schema, value any, pointer string, refs []string) bool {
+	other := &validator{schema: v.schema}
+	other.validate(schema, value, pointer, refs)
+	return len(other.violations) == 0
+}
+
+// validate the value against the schema. refs holds the references that have been followed without moving to a
+// different value, which prevents a reference cycle from recursing forever.
+func (v *validator) validate(schema, value any, pointer string, refs []string) {
+	if b, ok := schema.(bool); ok {
+		if !b {
+			v.addf(pointer, "false", "no value is allowed here")
+		}
+		return
+	}
+	m, ok := schema.(map[string]any)
+	if !ok {
+		return
+	}
+	if ref, exists := m["$ref"].(string); exists && !slices.Contains(refs, ref) {
+		if target, err := v.schema.resolve(ref); err == nil {
+			v.validate(target, value, pointer, append(slices.Clip(refs), ref))
+		}
+	}
+	if t, exists := m["type"]; exists {
+		v.validateType(t, value, pointer)
+	}
+	if e, exists := m["enum"].([]any); exists && !slices.ContainsFunc(e, func(one any) bool { return deepEqual(one, value) }) {
+		v.addf(pointer, "enum", "value must be one of %s", jsonText(e))
+	}
+	if c, exists := m["const"]; exists && !deepEqual(c, value) {
+		v.addf(pointer, "const", "value must be %s", jsonText(c))
+	}
+	switch t := value.(type) {
+	case map[string]any:
+		v.validateObject(m, t, pointer)
+	case []any:
+		v.validateArray(m, t, pointer)
+	case string:
+		v.validateString(m, t, pointer)
+	default:
+		if n, isNumber := number(value); isNumber {
+			v.validateNumber(m, n, pointer)
+		}
+	}
+	if list, exists := m["allOf"].([]any); exists {
+		for _, one := range list {
+			v.validate(one, value, pointer, refs)
+		}
+	}
+	if list, exists := m["anyOf"].([]any); exists &&
+		!slices.ContainsFunc(list, func(one any) bool { return v.matches(one, value, pointer, refs) }) {
+		v.addf(pointer, "anyOf", "value does not match any of the schemas in anyOf")
+	}
+	if list, exists := m["oneOf"].([]any); exists {
+		matched := 0
+		for _, one := range list {
+			if v.matches(one, value, pointer, refs) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.addf(pointer, "oneOf", "value matches %d of the schemas in oneOf, but must match exactly one", matched)
+		}
+	}
+	if not, exists := m["not"]; exists && v.matches(not, value, pointer, refs) {
+		v.addf(pointer, "not", "value must not match the schema in not")
+	}
+}
+
+func (v *validator) validateType(t, value any, pointer string) {
+	var names []string
+	switch tt := t.(type) {
+	case string:
+		names = []string{tt}
+	case []any:
+		for _, one := range tt {
+			if name, ok := one.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	actual := typeOf(value)
+	for _, name := range names {
+		if name == actual || (name == "number" && actual == "integer") {
+			return
+		}
+	}
+	v.addf(pointer, "type", "expected %s, found %s", strings.Join(names, " or "), actual)
+}
+
+func (v *validator) validateObject(m, obj map[string]any, pointer string) {
+	if list, ok := m["required"].([]any); ok {
+		for _, one := range list {
+			if name, isStr := one.(string); isStr {
+				if _, exists := obj[name]; !exists {
+					v.addf(pointer, "required", "missing required property %q", name)
+				}
+			}
+		}
+	}
+	if limit, ok := count(m["minProperties"]); ok && len(obj) < limit {
+		v.addf(pointer, "minProperties", "object has %d properties, fewer than the minimum of %d", len(obj), limit)
+	}
+	if limit, ok := count(m["maxProperties"]); ok && len(obj) > limit {
+		v.addf(pointer, "maxProperties", "object has %d properties, more than the maximum of %d", len(obj), limit)
+	}
+	props, _ := m["properties"].(map[string]any)               //nolint:errcheck // nil is fine when absent
+	patternProps, _ := m["patternProperties"].(map[string]any) //nolint:errcheck // nil is fine when absent
+	additional, hasAdditional := m["additionalProperties"]
+	for _, name := range sortedKeys(obj) {
+		value := obj[name]
+		location := pointerTo(pointer, name)
+		matched := false
+		if schema, exists := props[name]; exists {
+			matched = true
+			v.validate(schema, value, location, nil)
+		}
+		for _, pattern := range sortedKeys(patternProps) {
+			if re := v.schema.patterns[pattern]; re != nil && re.MatchString(name) {
+				matched = true
+				v.validate(patternProps[pattern], value, location, nil)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, isBool := additional.(bool); isBool && !allowed {
+				v.addf(location, "additionalProperties", "property %q is not allowed", name)
+			} else {
+				v.validate(additional, value, location, nil)
+			}
+		}
+	}
+}
+
+func (v *validator) validateArray(m map[string]any, array []any, pointer string) {
+	if limit, ok := count(m["minItems"]); ok && len(array) < limit {
+		v.addf(pointer, "minItems", "array has %d items, fewer than the minimum of %d", len(array), limit)
+	}
+	if limit, ok := count(m["maxItems"]); ok && len(array) > limit {
+		v.addf(pointer, "maxItems", "array has %d items, more than the maximum of %d", len(array), limit)
+	}
+	if unique, ok := m["uniqueItems"].(bool); ok && unique {
+	outer:
+		for i := range array {
+			for k := i + 1; k < len(array); k++ {
+				if deepEqual(array[i], array[k]) {
+					v.addf(pointer, "uniqueItems", "items %d and %d are equal, but items must be unique", i, k)
+					break outer
+				}
+			}
+		}
+	}
+	prefix, _ := m["prefixItems"].([]any) //nolint:errcheck // nil is fine when absent
+	items, hasItems := m["items"]
+	for i, value := range array {
+		location := pointerTo(pointer, strconv.Itoa(i))
+		switch {
+		case i < len(prefix):
+			v.validate(prefix[i], value, location, nil)
+		case hasItems:
+			if allowed, isBool := items.(bool); isBool && !allowed {
+				v.addf(location, "items", "array may not have more than %d items", len(prefix))
+			} else {
+				v.validate(items, value, location, nil)
+			}
+		}
+	}
+}
+
+func (v *validator) validateString(m map[string]any, str, pointer string) {
+	length := utf8.RuneCountInString(str)
+	if limit, ok := count(m["minLength"]); ok && length < limit {
+		v.addf(pointer, "minLength", "string has %d characters, fewer than the minimum of %d", length, limit)
+	}
+	if limit, ok := count(m["maxLength"]); ok && length > limit {
+		v.addf(pointer, "maxLength", "string has %d characters, more than the maximum of %d", length, limit)
+	}
+	if pattern, ok := m["pattern"].(string); ok {
+		if re := v.schema.patterns[pattern]; re != nil && !re.MatchString(str) {
+			v.addf(pointer, "pattern", "string does not match the pattern %q", pattern)
+		}
+	}
+}
+
+func (v *validator) validateNumber(m map[string]any, n *big.Rat, pointer string) {
+	for _, one := range []struct {
+		keyword string
+		op      string
+		valid   func(cmp int) bool
+	}{
+		{"minimum", ">=", func(cmp int) bool { return cmp >= 0 }},
+		{"maximum", "<=", func(cmp int) bool { return cmp <= 0 }},
+		{"exclusiveMinimum", ">", func(cmp int) bool { return cmp > 0 }},
+		{"exclusiveMaximum", "<", func(cmp int) bool { return cmp < 0 }},
+	} {
+		if limit, ok := number(m[one.keyword]); ok && !one.valid(n.Cmp(limit)) {
+			v.addf(pointer, one.keyword, "value must be %s %s", one.op, jsonText(m[one.keyword]))
+		}
+	}
+	if divisor, ok := number(m["multipleOf"]); ok && divisor.Sign() > 0 && !new(big.Rat).Quo(n, divisor).IsInt() {
+		v.addf(pointer, "multipleOf", "value must be a multiple of %s", jsonText(m["multipleOf"]))
+	}
+}
+
+// typeOf returns the JSON Schema type name of the value. Numbers that have no fractional part are reported as
+// "integer".
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		if n, ok := number(value); ok {
+			if n.IsInt() {
+				return "integer"
+			}
+			return "number"
+		}
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// count returns the value as a non-negative int, if possible.
+func count(value any) (int, bool) {
+	n, ok := number(value)
+	if !ok || !n.IsInt() || n.Sign() < 0 || !n.Num().IsInt64() {
+		return 0, false
+	}
+	return int(n.Num().Int64()), true
+}
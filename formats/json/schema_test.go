@@ -0,0 +1,188 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package json_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/formats/json"
+)
+
+const personSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["name", "age"],
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 8, "pattern": "^[A-Z]"},
+		"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+		"score": {"type": "number", "multipleOf": 0.5},
+		"kind": {"enum": ["a", "b", 3]},
+		"version": {"const": 2},
+		"tags": {"type": "array", "items": {"type": "string"}, "minItems": 1, "maxItems": 3, "uniqueItems": true},
+		"point": {"type": "array", "prefixItems": [{"type": "number"}, {"type": "number"}], "items": false},
+		"parent": {"$ref": "#"},
+		"address": {"$ref": "#/$defs/address"},
+		"nickname": {"type": ["string", "null"]}
+	},
+	"patternProperties": {"^x-": {"type": "boolean"}},
+	"additionalProperties": false,
+	"$defs": {
+		"address": {
+			"type": "object",
+			"properties": {"zip": {"$ref": "#zip"}},
+			"minProperties": 1,
+			"maxProperties": 2
+		},
+		"zip": {"$anchor": "zip", "type": "string", "pattern": "^[0-9]{5}$"}
+	}
+}`
+
+func TestSchemaValid(t *testing.T) {
+	schema, err := json.NewSchema(json.MustParse([]byte(personSchema)))
+	check.NoError(t, err)
+	for _, doc := range []string{
+		`{"name":"Bob","age":30}`,
+		`{"name":"Bob","age":30.0,"score":1.5,"kind":3,"version":2.0,"tags":["a","b"],"point":[1,2.5],
+			"x-flag":true,"nickname":null}`,
+		`{"name":"Bob","age":0,"parent":{"name":"Ann","age":149,"address":{"zip":"12345"}}}`,
+	} {
+		check.NoError(t, json.MustParse([]byte(doc)).Validate(schema), doc)
+	}
+}
+
+func TestSchemaViolations(t *testing.T) {
+	schema, err := json.NewSchema(json.MustParse([]byte(personSchema)))
+	check.NoError(t, err)
+	err = json.MustParse([]byte(`{
+		"name": "bob the builder",
+		"score": 1.25,
+		"kind": "c",
+		"version": 3,
+		"tags": ["a", 1, "a", "b"],
+		"point": [1, 2, 3],
+		"parent": {"name": "", "age": 150},
+		"address": {"zip": "1234", "a": 1, "b": 2},
+		"x-flag": "yes",
+		"other": 1,
+		"nickname": 7
+	}`)).Validate(schema)
+	var validationErr *json.ValidationError
+	check.True(t, errors.As(err, &validationErr))
+	var found []string
+	for _, v := range validationErr.Violations {
+		found = append(found, v.Pointer+" "+v.Keyword)
+	}
+	check.Equal(t, []string{
+		" required",
+		"/address maxProperties",
+		"/address/zip pattern",
+		"/kind enum",
+		"/name maxLength",
+		"/name pattern",
+		"/nickname type",
+		"/other additionalProperties",
+		"/parent/age exclusiveMaximum",
+		"/parent/name minLength",
+		"/parent/name pattern",
+		"/point/2 items",
+		"/score multipleOf",
+		"/tags maxItems",
+		"/tags uniqueItems",
+		"/tags/1 type",
+		"/version const",
+		"/x-flag type",
+	}, found)
+	check.Equal(t, `missing required property "age"`, validationErr.Violations[0].Message)
+	check.Contains(t, err.Error(), "18 schema violations:")
+	check.Contains(t, err.Error(), `"/nickname": expected string or null, found integer`)
+	check.Contains(t, err.Error(), `"/parent/age": value must be < 150`)
+
+	err = json.MustParse([]byte(`[]`)).Validate(schema)
+	check.Equal(t, `schema violation at "": expected object, found array`, err.Error())
+}
+
+func TestSchemaCombinators(t *testing.T) {
+	schema, err := json.NewSchema(json.MustParse([]byte(`{
+		"allOf": [{"type": "number"}, {"maximum": 10}],
+		"anyOf": [{"minimum": 5}, {"const": 1}],
+		"oneOf": [{"multipleOf": 2}, {"multipleOf": 3}],
+		"not": {"const": 9}
+	}`)))
+	check.NoError(t, err)
+	for _, one := range []struct {
+		doc      string
+		keywords []string
+	}{
+		{`6`, []string{"oneOf"}},
+		{`8`, nil},
+		{`9`, []string{"not"}},
+		{`1`, []string{"oneOf"}},
+		{`2`, []string{"anyOf"}},
+		{`12`, []string{"maximum", "oneOf"}},
+		{`"x"`, []string{"type", "oneOf"}},
+	} {
+		err = json.MustParse([]byte(one.doc)).Validate(schema)
+		var keywords []string
+		var validationErr *json.ValidationError
+		if errors.As(err, &validationErr) {
+			for _, v := range validationErr.Violations {
+				keywords = append(keywords, v.Keyword)
+			}
+		}
+		check.Equal(t, one.keywords, keywords, one.doc)
+	}
+
+	schema, err = json.NewSchema(json.MustParse([]byte(`false`)))
+	check.NoError(t, err)
+	check.Error(t, json.MustParse([]byte(`{}`)).Validate(schema))
+	schema, err = json.NewSchema(json.MustParse([]byte(`{"$ref": "#"}`)))
+	check.NoError(t, err)
+	check.NoError(t, json.MustParse([]byte(`{}`)).Validate(schema))
+}
+
+func TestSchemaValidateJSON(t *testing.T) {
+	schema, err := json.NewSchema(json.MustParse([]byte(personSchema)))
+	check.NoError(t, err)
+	check.NoError(t, schema.ValidateJSON([]byte(`{"name":"Bob","age":30}`)))
+	err = schema.ValidateJSON([]byte(`{"name":"Bob"}`))
+	var validationErr *json.ValidationError
+	check.True(t, errors.As(err, &validationErr))
+	check.Equal(t, 1, len(validationErr.Violations))
+	err = schema.ValidateJSON([]byte(`{"name":`))
+	check.Error(t, err)
+	check.False(t, errors.As(err, &validationErr))
+}
+
+func TestSchemaErrors(t *testing.T) {
+	for _, schema := range []string{
+		`[]`,
+		`{"type": "float"}`,
+		`{"type": []}`,
+		`{"enum": 1}`,
+		`{"required": [1]}`,
+		`{"minimum": "1"}`,
+		`{"multipleOf": 0}`,
+		`{"minLength": -1}`,
+		`{"maxItems": 1.5}`,
+		`{"pattern": "("}`,
+		`{"patternProperties": {"[": {}}}`,
+		`{"properties": {"a": 1}}`,
+		`{"allOf": []}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"$ref": "#nowhere"}`,
+		`{"$ref": "other.json#/a"}`,
+		`{"$defs": {"a": {"$anchor": "x"}, "b": {"$anchor": "x"}}}`,
+	} {
+		_, err := json.NewSchema(json.MustParse([]byte(schema)))
+		check.Error(t, err, schema)
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// TokenKind identifies the kind of a Token.
+type TokenKind uint8
+
+// Possible TokenKind values.
+const (
+	BeginObjectToken TokenKind = iota
+	EndObjectToken
+	BeginArrayToken
+	EndArrayToken
+	StringToken
+	NumberToken
+	BoolToken
+	NullToken
+)
+
+// Token is a single element of a JSON stream.
+type Token struct {
+	// Path is the JSON Pointer to the value the token belongs to. The tokens that begin and end an object or array
+	// share the path of the object or array.
+	Path string
+	// Value holds the value of a scalar token: a string, a json.Number, a bool, or nil. It is nil for the tokens that
+	// begin and end objects and arrays.
+	Value any
+	// Kind identifies the kind of token.
+	Kind TokenKind
+}
+
+type streamFrame struct {
+	token     string
+	index     int
+	object    bool
+	expectKey bool
+}
+
+// Reader reads a JSON stream one token at a time, without holding the entire document in memory. Numbers are returned
+// as json.Number values, just as Parse does, so no precision is lost. Call Next() to advance to each token in turn:
+//
+//	r := json.NewReader(in)
+//	for r.Next() {
+//		token := r.Token()
+//		if token.Path == "/records" && token.Kind == json.BeginArrayToken {
+//			// ... use r.Decode() to extract each element here ...
+//		}
+//	}
+//	if err := r.Err(); err != nil {
+//		return err
+//	}
+//
+// A stream may contain several top-level values, such as newline-delimited JSON, each of which has the path "".
+type Reader struct {
+	decoder   *json.Decoder
+	stack     []streamFrame
+	token     Token
+	err       error
+	decodable bool
+}
+
+// NewReader creates a new Reader for the stream.
+func NewReader(in io.Reader) *Reader {
+	decoder := json.NewDecoder(in)
+	decoder.UseNumber()
+	return &Reader{decoder: decoder}
+}
+
+// Walk reads the stream, calling fn for each token. Reading stops at the first error, including one returned by fn.
+// fn may call Decode() on the Reader to consume the value that the token begins.
+func Walk(in io.Reader, fn func(r *Reader, token Token) error) error {
+	r := NewReader(in)
+	for r.Next() {
+		if err := fn(r, r.Token()); err != nil {
+			return err
+		}
+	}
+	return r.Err()
+}
+
+// Next advances to the next token, returning false when there are no more tokens or an error occurs.
+func (r *Reader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	r.decodable = false
+	for {
+		tok, err := r.decoder.Token()
+		if err != nil {
+			if !errors.Is(err, io.EOF) || len(r.stack) != 0 {
+				if errors.Is(err, io.EOF) {
+					err = io.ErrUnexpectedEOF
+				}
+				r.err = errs.Wrap(err)
+			}
+			return false
+		}
+		var top *streamFrame
+		if len(r.stack) != 0 {
+			top = &r.stack[len(r.stack)-1]
+		}
+		if top != nil && top.expectKey {
+			if d, ok := tok.(json.Delim); !ok || d != '}' {
+				top.token = tok.(string) //nolint:errcheck // The decoder only returns strings for object keys
+				top.expectKey = false
+				continue
+			}
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			r.stack = r.stack[:len(r.stack)-1]
+			kind := EndArrayToken
+			if d == '}' {
+				kind = EndObjectToken
+			}
+			r.token = Token{Kind: kind, Path: r.path()}
+			r.valueDone()
+			return true
+		}
+		if top != nil && !top.object {
+			top.index++
+			top.token = strconv.Itoa(top.index)
+		}
+		r.token = Token{Path: r.path(), Value: tok}
+		r.decodable = true
+		switch t := tok.(type) {
+		case json.Delim:
+			r.token.Value = nil
+			if t == '{' {
+				r.token.Kind = BeginObjectToken
+				r.stack = append(r.stack, streamFrame{object: true, expectKey: true})
+			} else {
+				r.token.Kind = BeginArrayToken
+				r.stack = append(r.stack, streamFrame{index: -1})
+			}
+			return true
+		case string:
+			r.token.Kind = StringToken
+		case json.Number:
+			r.token.Kind = NumberToken
+		case bool:
+			r.token.Kind = BoolToken
+		default:
+			r.token.Kind = NullToken
+		}
+		r.valueDone()
+		return true
+	}
+}
+
+// Token returns the current token.
+func (r *Reader) Token() Token {
+	return r.token
+}
+
+// Err returns the error, if any, that was encountered while reading.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Decode the value that the current token begins into v, which may be a *Data, a pointer to an interface, or anything
+// else that encoding/json can unmarshal into. For the tokens that begin an object or array, the rest of the object or
+// array is consumed, so the following call to Next() moves past it. Decode may only be called once per token, and not
+// at all for the tokens that end an object or array.
+func (r *Reader) Decode(v any) error {
+	if r.err != nil {
+		return r.err
+	}
+	if !r.decodable {
+		return errs.New("the current token does not begin a value")
+	}
+	r.decodable = false
+	value := r.token.Value
+	if r.token.Kind == BeginObjectToken || r.token.Kind == BeginArrayToken {
+		var err error
+		if value, err = r.readContainer(r.token.Kind == BeginObjectToken); err != nil {
+			r.err = err
+			return err
+		}
+		r.stack = r.stack[:len(r.stack)-1]
+		r.valueDone()
+	}
+	return assign(value, v)
+}
+
+// Skip the value that the current token begins. See Decode() for details.
+func (r *Reader) Skip() error {
+	return r.Decode(nil)
+}
+
+// DecodeAt reads forward to the value at the JSON Pointer and decodes it into v. Returns false if the stream ends
+// without reaching the value.
+func (r *Reader) DecodeAt(pointer string, v any) (bool, error) {
+	for r.Next() {
+		token := r.Token()
+		if token.Kind != EndObjectToken && token.Kind != EndArrayToken && token.Path == pointer {
+			return true, r.Decode(v)
+		}
+	}
+	return false, r.err
+}
+
+func (r *Reader) path() string {
+	var buffer strings.Builder
+	for i := range r.stack {
+		buffer.WriteString(pointerTo("", r.stack[i].token))
+	}
+	return buffer.String()
+}
+
+func (r *Reader) valueDone() {
+	if len(r.stack) != 0 {
+		if top := &r.stack[len(r.stack)-1]; top.object {
+			top.expectKey = true
+		}
+	}
+}
+
+// readContainer reads the remainder of an object or array whose opening delimiter has already been consumed.
+func (r *Reader) readContainer(object bool) (any, error) {
+	var m map[string]any
+	var a []any
+	if object {
+		m = make(map[string]any)
+	} else {
+		a = make([]any, 0)
+	}
+	for {
+		tok, err := r.decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, errs.Wrap(err)
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			if object {
+				return m, nil
+			}
+			return a, nil
+		}
+		if object {
+			key := tok.(string) //nolint:errcheck // The decoder only returns strings for object keys
+			if tok, err = r.decoder.Token(); err != nil {
+				return nil, errs.Wrap(err)
+			}
+			if m[key], err = r.readValue(tok); err != nil {
+				return nil, err
+			}
+		} else {
+			var value any
+			if value, err = r.readValue(tok); err != nil {
+				return nil, err
+			}
+			a = append(a, value)
+		}
+	}
+}
+
+func (r *Reader) readValue(tok json.Token) (any, error) {
+	if d, ok := tok.(json.Delim); ok {
+		return r.readContainer(d == '{')
+	}
+	return tok, nil
+}
+
+// assign the decoded value to the target.
+func assign(value, v any) error {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case *Data:
+		t.obj = value
+		return nil
+	case *any:
+		*t = value
+		return nil
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		return errs.Wrap(decoder.Decode(v))
+	}
+}
+
+// ArrayWriter writes a JSON array to a stream one element at a time, so that arbitrarily many records can be written
+// without holding them all in memory. Each element is written to the underlying stream as soon as it is added and
+// placed on its own line. Close() must be called to terminate the array.
+type ArrayWriter struct {
+	w      io.Writer
+	count  int
+	closed bool
+}
+
+// NewArrayWriter creates a new ArrayWriter for the stream.
+func NewArrayWriter(w io.Writer) *ArrayWriter {
+	return &ArrayWriter{w: w}
+}
+
+// Write an element to the array. The element may be a *Data or anything that encoding/json can marshal.
+func (a *ArrayWriter) Write(element any) error {
+	if a.closed {
+		return errs.New("array writer is closed")
+	}
+	if d, ok := element.(*Data); ok {
+		element = d.obj
+	}
+	data, err := json.Marshal(element)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	prefix := ",\n"
+	if a.count == 0 {
+		prefix = "[\n"
+	}
+	if _, err = io.WriteString(a.w, prefix); err != nil {
+		return errs.Wrap(err)
+	}
+	if _, err = a.w.Write(data); err != nil {
+		return errs.Wrap(err)
+	}
+	a.count++
+	return nil
+}
+
+// Count returns the number of elements written so far.
+func (a *ArrayWriter) Count() int {
+	return a.count
+}
+
+// Close terminates the array. It does not close the underlying stream.
+func (a *ArrayWriter) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	suffix := "\n]\n"
+	if a.count == 0 {
+		suffix = "[]\n"
+	}
+	_, err := io.WriteString(a.w, suffix)
+	return errs.Wrap(err)
+}
@@ -0,0 +1,133 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package json_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/formats/json"
+)
+
+func TestReaderTokens(t *testing.T) {
+	var tokens []string
+	input := `{"a":[1,{"b/c":null}],"d":{},"e":[],"f":true,"g":"s"} 12345678901234567890`
+	check.NoError(t, json.Walk(strings.NewReader(input),
+		func(_ *json.Reader, token json.Token) error {
+			tokens = append(tokens, fmt.Sprintf("%d %s %v", token.Kind, token.Path, token.Value))
+			return nil
+		}))
+	check.Equal(t, []string{
+		"0  <nil>",
+		"2 /a <nil>",
+		"5 /a/0 1",
+		"0 /a/1 <nil>",
+		"7 /a/1/b~1c <nil>",
+		"1 /a/1 <nil>",
+		"3 /a <nil>",
+		"0 /d <nil>",
+		"1 /d <nil>",
+		"2 /e <nil>",
+		"3 /e <nil>",
+		"6 /f true",
+		"4 /g s",
+		"1  <nil>",
+		"5  12345678901234567890",
+	}, tokens)
+
+	check.Error(t, json.Walk(strings.NewReader(`{"a":[1,2}`), func(_ *json.Reader, _ json.Token) error { return nil }))
+	check.Error(t, json.Walk(strings.NewReader(`[1,2`), func(_ *json.Reader, _ json.Token) error { return nil }))
+	check.Error(t, json.Walk(strings.NewReader(`[1]`), func(_ *json.Reader, _ json.Token) error {
+		return fmt.Errorf("stop")
+	}))
+}
+
+func TestReaderDecode(t *testing.T) {
+	const input = `{"meta":{"count":2,"big":1.00000000000000000001},
+		"records":[{"name":"a","value":1},{"name":"b","value":2,"extra":[true]}],"after":"x"}`
+	type record struct {
+		Extra any
+		Name  string
+		Value int
+	}
+	r := json.NewReader(strings.NewReader(input))
+	var meta json.Data
+	found, err := r.DecodeAt("/meta", &meta)
+	check.NoError(t, err)
+	check.True(t, found)
+	check.Equal(t, `{"big":1.00000000000000000001,"count":2}`, meta.String())
+
+	var records []record
+	for r.Next() {
+		token := r.Token()
+		if token.Kind == json.BeginObjectToken && strings.HasPrefix(token.Path, "/records/") {
+			var rec record
+			check.NoError(t, r.Decode(&rec))
+			records = append(records, rec)
+			check.Error(t, r.Decode(&rec))
+		}
+		if token.Path == "/after" {
+			check.Equal(t, json.StringToken, token.Kind)
+			var s string
+			check.NoError(t, r.Decode(&s))
+			check.Equal(t, "x", s)
+		}
+	}
+	check.NoError(t, r.Err())
+	check.Equal(t, []record{{Name: "a", Value: 1}, {Name: "b", Value: 2, Extra: []any{true}}}, records)
+
+	r = json.NewReader(strings.NewReader(input))
+	check.True(t, r.Next())
+	check.True(t, r.Next())
+	check.NoError(t, r.Skip())
+	check.True(t, r.Next())
+	check.Equal(t, "/records", r.Token().Path)
+	var v any
+	found, err = r.DecodeAt("/records/1/extra/0", &v)
+	check.NoError(t, err)
+	check.True(t, found)
+	check.Equal(t, true, v)
+	found, err = r.DecodeAt("/missing", &v)
+	check.NoError(t, err)
+	check.False(t, found)
+
+	r = json.NewReader(strings.NewReader(`{"a":[1,`))
+	check.True(t, r.Next())
+	check.True(t, r.Next())
+	check.Error(t, r.Decode(&v))
+	check.Error(t, r.Err())
+}
+
+func TestArrayWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	w := json.NewArrayWriter(&buffer)
+	check.NoError(t, w.Close())
+	check.Equal(t, "[]\n", buffer.String())
+	check.Error(t, w.Write(1))
+
+	buffer.Reset()
+	w = json.NewArrayWriter(&buffer)
+	check.NoError(t, w.Write(map[string]any{"a": 1}))
+	check.Equal(t, "[\n{\"a\":1}", buffer.String())
+	check.NoError(t, w.Write(json.MustParse([]byte(`{"n":12345678901234567890.5}`))))
+	check.NoError(t, w.Write(struct{ B bool }{B: true}))
+	check.Error(t, w.Write(func() {}))
+	check.Equal(t, 3, w.Count())
+	check.NoError(t, w.Close())
+	check.NoError(t, w.Close())
+	check.Equal(t, "[\n{\"a\":1},\n{\"n\":12345678901234567890.5},\n{\"B\":true}\n]\n", buffer.String())
+
+	data, err := json.Parse(buffer.Bytes())
+	check.NoError(t, err)
+	check.Equal(t, 3, data.Size())
+}
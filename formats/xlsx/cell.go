@@ -19,15 +19,46 @@ const (
 	String CellType = iota
 	Number
 	Boolean
+	Date
 )
 
 // CellType holds an enumeration of cell types.
 type CellType int
 
-// Cell holds the contents of a cell.
+// Cell holds the contents of a cell. The Value of a Date cell holds the Excel serial number for the date, just as for
+// a Number cell; the difference is that Date cells are formatted as dates.
 type Cell struct {
 	Type  CellType
 	Value string
+	// Formula holds the formula used to calculate the cell, without the leading '=', if any. When a Formula is
+	// present, Value holds the result of the last calculation.
+	Formula string
+	// Format holds the number format code used to display a Number or Date cell, e.g. "0.00%" or "yyyy-mm-dd". An
+	// empty Format is the same as "General" for numbers, while dates are given a default date format when written.
+	Format string
+}
+
+// StringCell returns a cell holding the string.
+func StringCell(value string) Cell {
+	return Cell{Type: String, Value: value}
+}
+
+// NumberCell returns a cell holding the number.
+func NumberCell(value float64) Cell {
+	return Cell{Type: Number, Value: strconv.FormatFloat(value, 'f', -1, 64)}
+}
+
+// BooleanCell returns a cell holding the boolean.
+func BooleanCell(value bool) Cell {
+	if value {
+		return Cell{Type: Boolean, Value: "1"}
+	}
+	return Cell{Type: Boolean, Value: "0"}
+}
+
+// DateCell returns a cell holding the time. Excel does not store time zones, so the time's wall clock is used as-is.
+func DateCell(value time.Time) Cell {
+	return Cell{Type: Date, Value: strconv.FormatFloat(excelTimeFromTime(value), 'f', -1, 64)}
 }
 
 func (c *Cell) String() string {
@@ -85,3 +85,17 @@ func fractionOfADay(fraction float64) (hours, minutes, seconds, nanoseconds int)
 	hours = int(frac / 60)
 	return
 }
+
+// excelTimeFromTime converts a time.Time to an Excel time representation. This is the inverse of timeFromExcelTime().
+func excelTimeFromTime(t time.Time) float64 {
+	const secondsPerDay = 24 * 60 * 60
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	seconds := t.Unix() - time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).Unix()
+	days := seconds / secondsPerDay
+	seconds -= days * secondsPerDay
+	if seconds < 0 {
+		days--
+		seconds += secondsPerDay
+	}
+	return float64(days) + (float64(seconds)+float64(t.Nanosecond())/1e9)/secondsPerDay
+}
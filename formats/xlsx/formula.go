@@ -0,0 +1,131 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xlsx
+
+import (
+	"strconv"
+	"strings"
+)
+
+// sharedFormula holds the formula that other cells in a shared formula group derive theirs from.
+type sharedFormula struct {
+	formula string
+	origin  Ref
+}
+
+// shiftFormula returns the formula with its relative cell references moved by the given number of rows and columns, as
+// Excel does when a formula is copied from one cell to another. Absolute references, i.e. those marked with a '$', are
+// left alone, as is any text within quotes.
+func shiftFormula(formula string, rows, cols int) string {
+	if rows == 0 && cols == 0 {
+		return formula
+	}
+	var buffer strings.Builder
+	for i := 0; i < len(formula); {
+		ch := formula[i]
+		switch {
+		case ch == '"' || ch == '\'':
+			// String literals use '"' and sheet names use '\''; both escape their quote by doubling it.
+			end := i + 1
+			for end < len(formula) {
+				if formula[end] == ch {
+					if end+1 < len(formula) && formula[end+1] == ch {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			end = min(end+1, len(formula))
+			buffer.WriteString(formula[i:end])
+			i = end
+		case ch == '$' || isFormulaNameByte(ch):
+			end := i
+			for end < len(formula) && (formula[end] == '$' || isFormulaNameByte(formula[end])) {
+				end++
+			}
+			token := formula[i:end]
+			if end < len(formula) && (formula[end] == '(' || formula[end] == '!') {
+				// Function or sheet name
+				buffer.WriteString(token)
+			} else if shifted, ok := shiftRef(token, rows, cols); ok {
+				buffer.WriteString(shifted)
+			} else {
+				buffer.WriteString(token)
+			}
+			i = end
+		default:
+			buffer.WriteByte(ch)
+			i++
+		}
+	}
+	return buffer.String()
+}
+
+func isFormulaNameByte(ch byte) bool {
+	return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '_' || ch == '.'
+}
+
+// shiftRef shifts a single cell reference of the form [$]COL[$]ROW. Returns false if token is not a cell reference.
+// References that would move off of the sheet become "#REF!".
+func shiftRef(token string, rows, cols int) (string, bool) {
+	i := 0
+	absCol := i < len(token) && token[i] == '$'
+	if absCol {
+		i++
+	}
+	start := i
+	for i < len(token) && ((token[i] >= 'A' && token[i] <= 'Z') || (token[i] >= 'a' && token[i] <= 'z')) {
+		i++
+	}
+	letters := token[start:i]
+	if letters == "" || len(letters) > 3 {
+		return "", false
+	}
+	absRow := i < len(token) && token[i] == '$'
+	if absRow {
+		i++
+	}
+	digits := token[i:]
+	if digits == "" || len(digits) > 7 || digits[0] == '0' {
+		return "", false
+	}
+	for j := 0; j < len(digits); j++ {
+		if digits[j] < '0' || digits[j] > '9' {
+			return "", false
+		}
+	}
+	ref := ParseRef(letters + digits)
+	if ref.Col >= maxColumns || ref.Row >= maxRows {
+		return "", false
+	}
+	if !absCol {
+		ref.Col += cols
+	}
+	if !absRow {
+		ref.Row += rows
+	}
+	if ref.Col < 0 || ref.Col >= maxColumns || ref.Row < 0 || ref.Row >= maxRows {
+		return "#REF!", true
+	}
+	s := ref.String()
+	split := strings.IndexAny(s, "0123456789")
+	var buffer strings.Builder
+	if absCol {
+		buffer.WriteByte('$')
+	}
+	buffer.WriteString(s[:split])
+	if absRow {
+		buffer.WriteByte('$')
+	}
+	buffer.WriteString(strconv.Itoa(ref.Row + 1))
+	return buffer.String(), true
+}
@@ -0,0 +1,74 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xlsx_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/formats/xlsx"
+)
+
+const (
+	testStyles = `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="[Magenta]0.0"/><numFmt numFmtId="165" formatCode="dd/mm/yyyy"/></numFmts>
+<cellXfs count="5"><xf numFmtId="0"/><xf numFmtId="164"/><xf numFmtId="165"/><xf numFmtId="10"/><xf numFmtId="21"/></cellXfs>
+</styleSheet>`
+	testSheet = `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1"><v>1</v></c><c r="B1"><f t="shared" ref="B1:B3" si="0">A1*2+$A$1+SUM(A1:A$2)+'Sheet A1'!C1&amp;"A1"</f><v>4</v></c>
+<c r="C1" s="1"><v>2.5</v></c><c r="D1" s="2"><v>45000</v></c><c r="E1" s="3"><v>0.125</v></c><c r="F1" s="4"><v>0.5</v></c></row>
+<row r="2"><c r="A2"><v>2</v></c><c r="B2"><f t="shared" si="0"/><v>7</v></c>
+<c r="C2" t="str"><f>UPPER("x")</f><v>X</v></c><c r="D2" t="inlineStr"><is><t>inline</t></is></c></row>
+<row r="3"><c r="B3"><f t="shared" si="0"/></c><c r="C3"><f>LOG10(A1)+AB12</f><v>0</v></c></row>
+</sheetData><mergeCells count="1"><mergeCell ref="E2:F3"/></mergeCells></worksheet>`
+)
+
+func TestReadFormulasAndFormats(t *testing.T) {
+	var buffer bytes.Buffer
+	z := zip.NewWriter(&buffer)
+	for name, content := range map[string]string{
+		"xl/styles.xml":            testStyles,
+		"xl/worksheets/sheet1.xml": testSheet,
+	} {
+		w, err := z.Create(name)
+		check.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		check.NoError(t, err)
+	}
+	check.NoError(t, z.Close())
+	sheets, err := xlsx.Read(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	check.NoError(t, err)
+	check.Equal(t, 1, len(sheets))
+	cells := sheets[0].Cells
+	for _, one := range []struct {
+		ref  string
+		cell xlsx.Cell
+	}{
+		{"B1", xlsx.Cell{Type: xlsx.Number, Value: "4", Formula: `A1*2+$A$1+SUM(A1:A$2)+'Sheet A1'!C1&"A1"`}},
+		{"B2", xlsx.Cell{Type: xlsx.Number, Value: "7", Formula: `A2*2+$A$1+SUM(A2:A$2)+'Sheet A1'!C2&"A1"`}},
+		{"B3", xlsx.Cell{Type: xlsx.Number, Formula: `A3*2+$A$1+SUM(A3:A$2)+'Sheet A1'!C3&"A1"`}},
+		{"C1", xlsx.Cell{Type: xlsx.Number, Value: "2.5", Format: "[Magenta]0.0"}},
+		{"D1", xlsx.Cell{Type: xlsx.Date, Value: "45000", Format: "dd/mm/yyyy"}},
+		{"E1", xlsx.Cell{Type: xlsx.Number, Value: "0.125", Format: "0.00%"}},
+		{"F1", xlsx.Cell{Type: xlsx.Date, Value: "0.5", Format: "h:mm:ss"}},
+		{"C2", xlsx.Cell{Type: xlsx.String, Value: "X", Formula: `UPPER("x")`}},
+		{"D2", xlsx.Cell{Type: xlsx.String, Value: "inline"}},
+		{"C3", xlsx.Cell{Type: xlsx.Number, Value: "0", Formula: "LOG10(A1)+AB12"}},
+	} {
+		check.Equal(t, one.cell, cells[xlsx.ParseRef(one.ref)], one.ref)
+	}
+	check.Equal(t, []xlsx.Range{{Min: xlsx.Ref{Row: 1, Col: 4}, Max: xlsx.Ref{Row: 2, Col: 5}}}, sheets[0].MergedRanges)
+	check.True(t, sheets[0].MergedRanges[0].Contains(xlsx.ParseRef("F2")))
+	check.False(t, sheets[0].MergedRanges[0].Contains(xlsx.ParseRef("D2")))
+}
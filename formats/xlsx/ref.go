@@ -67,3 +67,40 @@ func (r Ref) String() string {
 	a[i] = letters[col]
 	return string(a[i:]) + strconv.Itoa(r.Row+1)
 }
+
+// Range holds a rectangular range of cells, inclusive of both Min and Max.
+type Range struct {
+	Min Ref
+	Max Ref
+}
+
+// ParseRange parses a string, such as "A1:C4", into a Range. A single cell reference produces a Range covering just
+// that cell. The resulting Range is normalized so that Min is the top-left corner and Max is the bottom-right corner.
+func ParseRange(str string) Range {
+	first, last, found := strings.Cut(str, ":")
+	r := Range{Min: ParseRef(first)}
+	if found {
+		r.Max = ParseRef(last)
+	} else {
+		r.Max = r.Min
+	}
+	if r.Min.Row > r.Max.Row {
+		r.Min.Row, r.Max.Row = r.Max.Row, r.Min.Row
+	}
+	if r.Min.Col > r.Max.Col {
+		r.Min.Col, r.Max.Col = r.Max.Col, r.Min.Col
+	}
+	return r
+}
+
+// Contains returns true if the reference is within the range.
+func (r Range) Contains(ref Ref) bool {
+	return ref.Row >= r.Min.Row && ref.Row <= r.Max.Row && ref.Col >= r.Min.Col && ref.Col <= r.Max.Col
+}
+
+func (r Range) String() string {
+	if r.Min == r.Max {
+		return r.Min.String()
+	}
+	return r.Min.String() + ":" + r.Max.String()
+}
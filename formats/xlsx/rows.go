@@ -0,0 +1,359 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// Row holds the non-empty cells of a single row.
+type Row struct {
+	// Index is the zero-based index of the row.
+	Index int
+	// Cells holds the cells of the row, in column order.
+	Cells []RowCell
+}
+
+// RowCell holds a cell along with the zero-based index of its column.
+type RowCell struct {
+	Col int
+	Cell
+}
+
+// Rows iterates over the rows of a sheet, decoding them as they are needed rather than holding the entire sheet in
+// memory. Call Next() to advance to each row in turn:
+//
+//	rows, err := workbook.Rows(0)
+//	if err != nil {
+//		return err
+//	}
+//	defer rows.Close()
+//	for rows.Next() {
+//		row := rows.Row()
+//		// ... use the row here ...
+//	}
+//	if err = rows.Err(); err != nil {
+//		return err
+//	}
+type Rows struct {
+	closer  io.Closer
+	decoder *xml.Decoder
+	strs    []string
+	styles  *styles
+	bounds  Range
+	shared  map[int]sharedFormula
+	widths  map[int]float64
+	merged  []Range
+	row     Row
+	last    int
+	err     error
+	done    bool
+}
+
+func newRows(f *zip.File, strs []string, styleInfo *styles, bounds Range) (*Rows, error) {
+	fr, err := f.Open()
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	return &Rows{
+		closer:  fr,
+		decoder: xml.NewDecoder(fr),
+		strs:    strs,
+		styles:  styleInfo,
+		bounds:  bounds,
+		shared:  make(map[int]sharedFormula),
+		last:    -1,
+	}, nil
+}
+
+// Next advances to the next row that has at least one cell within the bounds, returning false when there are no more
+// rows or an error occurs.
+func (r *Rows) Next() bool {
+	if r.done {
+		return false
+	}
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				r.err = errs.Wrap(err)
+			}
+			r.finish()
+			return false
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "col":
+			r.decodeColumn(start)
+		case "mergeCell":
+			if ref := attr(start, "ref"); ref != "" {
+				r.merged = append(r.merged, ParseRange(ref))
+			}
+		case "row":
+			if err = r.decodeRow(start); err != nil {
+				r.err = err
+				r.finish()
+				return false
+			}
+			if r.row.Index > r.bounds.Max.Row {
+				// Rows are stored in order, so nothing further can be within the bounds.
+				r.finish()
+				return false
+			}
+			if r.row.Index >= r.bounds.Min.Row && len(r.row.Cells) != 0 {
+				return true
+			}
+		}
+	}
+}
+
+// Row returns the current row. The returned Row is only valid until the next call to Next().
+func (r *Rows) Row() Row {
+	return r.row
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// ColumnWidths returns the widths of columns that do not use the default width, keyed by their zero-based column
+// index. Widths are measured in characters. The column widths are stored ahead of the rows, so are available once
+// Next() has been called.
+func (r *Rows) ColumnWidths() map[int]float64 {
+	return r.widths
+}
+
+// MergedRanges returns the ranges of cells that have been merged together. The merged ranges are stored after the
+// rows, so are only available once Next() has returned false without reaching the end of the bounds early.
+func (r *Rows) MergedRanges() []Range {
+	return r.merged
+}
+
+// Close releases the resources used by the iterator. It is safe to call Close() more than once.
+func (r *Rows) Close() error {
+	r.finish()
+	if r.closer == nil {
+		return nil
+	}
+	err := r.closer.Close()
+	r.closer = nil
+	return errs.Wrap(err)
+}
+
+func (r *Rows) finish() {
+	r.done = true
+	r.row = Row{}
+}
+
+func (r *Rows) decodeColumn(start xml.StartElement) {
+	first, err := strconv.Atoi(attr(start, "min"))
+	if err != nil {
+		return
+	}
+	var last int
+	if last, err = strconv.Atoi(attr(start, "max")); err != nil {
+		return
+	}
+	var width float64
+	if width, err = strconv.ParseFloat(attr(start, "width"), 64); err != nil {
+		return
+	}
+	if width <= 0 || first < 1 || last < first || last > maxColumns {
+		return
+	}
+	if r.widths == nil {
+		r.widths = make(map[int]float64)
+	}
+	for col := first; col <= last; col++ {
+		r.widths[col-1] = width
+	}
+}
+
+func (r *Rows) decodeRow(start xml.StartElement) error {
+	r.row.Index = r.last + 1
+	if label := attr(start, "r"); label != "" {
+		index, err := strconv.Atoi(label)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		r.row.Index = index - 1
+	}
+	r.last = r.row.Index
+	r.row.Cells = r.row.Cells[:0]
+	col := -1
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				if err = r.decoder.Skip(); err != nil {
+					return errs.Wrap(err)
+				}
+				continue
+			}
+			col++
+			ref := Ref{Row: r.row.Index, Col: col}
+			if label := attr(t, "r"); label != "" {
+				ref = ParseRef(label)
+				col = ref.Col
+			}
+			var cell Cell
+			var ok bool
+			if cell, ok, err = r.decodeCell(t, ref); err != nil {
+				return err
+			}
+			if ok && col >= r.bounds.Min.Col && col <= r.bounds.Max.Col {
+				r.row.Cells = append(r.row.Cells, RowCell{Col: col, Cell: cell})
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// decodeCell decodes the cell that start begins. Returns false if the cell is empty.
+func (r *Rows) decodeCell(start xml.StartElement, ref Ref) (cell Cell, ok bool, err error) {
+	var value *string
+	var inline strings.Builder
+	hasInline := false
+	for {
+		var token xml.Token
+		if token, err = r.decoder.Token(); err != nil {
+			return cell, false, errs.Wrap(err)
+		}
+		if end, isEnd := token.(xml.EndElement); isEnd && end.Name.Local == "c" {
+			break
+		}
+		t, isStart := token.(xml.StartElement)
+		if !isStart {
+			continue
+		}
+		switch t.Name.Local {
+		case "f":
+			var text string
+			if text, err = r.text(); err != nil {
+				return cell, false, err
+			}
+			cell.Formula = text
+			if attr(t, "t") == "shared" {
+				var si int
+				if si, err = strconv.Atoi(attr(t, "si")); err == nil {
+					if master, exists := r.shared[si]; exists && text == "" {
+						cell.Formula = shiftFormula(master.formula, ref.Row-master.origin.Row, ref.Col-master.origin.Col)
+					} else if !exists {
+						r.shared[si] = sharedFormula{formula: text, origin: ref}
+					}
+				}
+			}
+		case "v":
+			var text string
+			if text, err = r.text(); err != nil {
+				return cell, false, err
+			}
+			value = &text
+		case "is":
+			hasInline = true
+		case "t":
+			// Text within an inline string, which may be split into several runs.
+			var text string
+			if text, err = r.text(); err != nil {
+				return cell, false, err
+			}
+			inline.WriteString(text)
+		case "rPh":
+			// Phonetic hints are not part of the text.
+			if err = r.decoder.Skip(); err != nil {
+				return cell, false, errs.Wrap(err)
+			}
+		}
+	}
+	switch {
+	case value != nil:
+		cell.Value = *value
+	case hasInline:
+		cell.Value = inline.String()
+	case cell.Formula == "":
+		return cell, false, nil
+	}
+	switch attr(start, "t") {
+	case "s": // String
+		var v int
+		if v, err = strconv.Atoi(cell.Value); err != nil {
+			return cell, false, errs.Wrap(err)
+		}
+		if v < 0 || v >= len(r.strs) {
+			return cell, false, errs.New("String index out of bounds")
+		}
+		cell.Type = String
+		cell.Value = r.strs[v]
+	case "str", "inlineStr", "e": // Formula result, inline or error string
+		cell.Type = String
+	case "b": // Boolean
+		cell.Type = Boolean
+	default: // Number
+		style := 0
+		if s := attr(start, "s"); s != "" {
+			if style, err = strconv.Atoi(s); err != nil {
+				return cell, false, errs.Wrap(err)
+			}
+		}
+		cell.Format = r.styles.format(style)
+		if isDateFormat(cell.Format) {
+			cell.Type = Date
+		} else {
+			cell.Type = Number
+		}
+	}
+	return cell, true, nil
+}
+
+// text returns the character data of the element that was just started, consuming its end.
+func (r *Rows) text() (string, error) {
+	var buffer strings.Builder
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return "", errs.Wrap(err)
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			buffer.Write(t)
+		case xml.StartElement:
+			if err = r.decoder.Skip(); err != nil {
+				return "", errs.Wrap(err)
+			}
+		case xml.EndElement:
+			return buffer.String(), nil
+		}
+	}
+}
+
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
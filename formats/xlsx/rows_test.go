@@ -0,0 +1,83 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xlsx_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/formats/xlsx"
+)
+
+func TestRows(t *testing.T) {
+	cells := make(map[xlsx.Ref]xlsx.Cell)
+	for row := 0; row < 1000; row++ {
+		for col := 0; col < 10; col++ {
+			if (row+col)%7 == 0 {
+				continue
+			}
+			cells[xlsx.Ref{Row: row, Col: col}] = xlsx.StringCell(fmt.Sprintf("%d,%d", row, col))
+		}
+	}
+	path := filepath.Join(t.TempDir(), "rows.xlsx")
+	check.NoError(t, xlsx.Save(path, []xlsx.Sheet{
+		{Name: "First", Cells: map[xlsx.Ref]xlsx.Cell{{}: xlsx.NumberCell(1)}},
+		{
+			Name:         "Big",
+			Cells:        cells,
+			ColumnWidths: map[int]float64{3: 12},
+			MergedRanges: []xlsx.Range{xlsx.ParseRange("K1:L2")},
+		},
+	}))
+
+	w, err := xlsx.Open(path)
+	check.NoError(t, err)
+	defer func() { check.NoError(t, w.Close()) }()
+	check.Equal(t, []string{"First", "Big"}, w.SheetNames())
+	_, err = w.Rows(2)
+	check.Error(t, err)
+
+	// Walk the whole sheet.
+	rows, err := w.Rows(1)
+	check.NoError(t, err)
+	count := 0
+	expected := 0
+	for rows.Next() {
+		row := rows.Row()
+		check.Equal(t, expected, row.Index)
+		expected++
+		for _, one := range row.Cells {
+			check.Equal(t, cells[xlsx.Ref{Row: row.Index, Col: one.Col}], one.Cell)
+			count++
+		}
+	}
+	check.NoError(t, rows.Err())
+	check.Equal(t, len(cells), count)
+	check.Equal(t, map[int]float64{3: 12}, rows.ColumnWidths())
+	check.Equal(t, []xlsx.Range{xlsx.ParseRange("K1:L2")}, rows.MergedRanges())
+	check.NoError(t, rows.Close())
+	check.False(t, rows.Next())
+
+	// Walk just a portion of the sheet.
+	rows, err = w.RowsInRange(1, xlsx.ParseRange("C500:D502"))
+	check.NoError(t, err)
+	var got []string
+	for rows.Next() {
+		row := rows.Row()
+		for _, one := range row.Cells {
+			got = append(got, one.Value)
+		}
+	}
+	check.NoError(t, rows.Err())
+	check.NoError(t, rows.Close())
+	check.Equal(t, []string{"499,2", "499,3", "500,2", "500,3", "501,2"}, got)
+}
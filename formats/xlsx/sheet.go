@@ -7,21 +7,16 @@
 // This Source Code Form is "Incompatible With Secondary Licenses", as
 // defined by the Mozilla Public License, version 2.0.
 
-// Package xlsx provides the ability to extract text from Excel spreadsheets.
+// Package xlsx provides the ability to read and write Excel spreadsheets.
 package xlsx
 
 import (
 	"archive/zip"
 	"encoding/xml"
-	"fmt"
 	"io"
 	"math"
-	"sort"
-	"strconv"
-	"strings"
 
 	"github.com/ddkwork/toolbox/errs"
-	"github.com/ddkwork/toolbox/txt"
 	"github.com/ddkwork/toolbox/xio"
 )
 
@@ -31,60 +26,47 @@ type Sheet struct {
 	Min   Ref
 	Max   Ref
 	Cells map[Ref]Cell
+	// MergedRanges holds the ranges of cells that have been merged together. The content of a merged range is held by
+	// the cell at its Min.
+	MergedRanges []Range
+	// ColumnWidths holds the widths of columns that do not use the default width, keyed by their zero-based column
+	// index. Widths are measured in characters.
+	ColumnWidths map[int]float64
 }
 
 // Load sheets from an .xlsx file.
 func Load(path string) ([]Sheet, error) {
-	r, err := zip.OpenReader(path)
+	w, err := Open(path)
 	if err != nil {
-		return nil, errs.Wrap(err)
+		return nil, err
 	}
-	defer xio.CloseIgnoringErrors(r)
-	return load(&r.Reader)
+	defer xio.CloseIgnoringErrors(w)
+	return w.load()
 }
 
 // Read sheets from an .xlsx stream.
 func Read(in io.ReaderAt, size int64) ([]Sheet, error) {
-	r, err := zip.NewReader(in, size)
+	w, err := NewWorkbook(in, size)
 	if err != nil {
-		return nil, errs.Wrap(err)
+		return nil, err
 	}
-	return load(r)
+	return w.load()
 }
 
-func load(r *zip.Reader) ([]Sheet, error) {
-	var sheetNames []string
-	var strs []string
-	var files []*zip.File
-	var err error
-	for _, f := range r.File {
-		switch {
-		case f.Name == "docProps/app.xml":
-			if sheetNames, err = loadSheetNames(f); err != nil {
-				return nil, err
-			}
-		case f.Name == "xl/sharedStrings.xml":
-			if strs, err = loadStrings(f); err != nil {
-				return nil, err
-			}
-		case strings.HasPrefix(f.Name, "xl/worksheets/sheet"):
-			files = append(files, f)
+func (w *Workbook) load() ([]Sheet, error) {
+	sheets := make([]Sheet, 0, len(w.files))
+	for i, name := range w.names {
+		rows, err := w.Rows(i)
+		if err != nil {
+			return nil, err
 		}
-	}
-	sort.Slice(files, func(i, j int) bool {
-		return txt.NaturalLess(files[i].Name, files[j].Name, true)
-	})
-	sheets := make([]Sheet, 0, len(files))
-	for i, f := range files {
 		var sheet *Sheet
-		if sheet, err = loadSheet(f, strs); err != nil {
+		sheet, err = loadSheet(rows)
+		xio.CloseIgnoringErrors(rows)
+		if err != nil {
 			return nil, err
 		}
-		if i < len(sheetNames) {
-			sheet.Name = sheetNames[i]
-		} else {
-			sheet.Name = fmt.Sprintf("Sheet%d", i+1)
-		}
+		sheet.Name = name
 		sheets = append(sheets, *sheet)
 	}
 	return sheets, nil
@@ -122,64 +104,36 @@ func loadStrings(f *zip.File) ([]string, error) {
 	return data.SST, nil
 }
 
-func loadSheet(f *zip.File, strs []string) (*Sheet, error) {
-	fr, err := f.Open()
-	if err != nil {
-		return nil, errs.Wrap(err)
-	}
-	defer xio.CloseIgnoringErrors(fr)
-	decoder := xml.NewDecoder(fr)
-	var data struct {
-		Cells []struct {
-			Label string  `xml:"r,attr"`
-			Type  string  `xml:"t,attr"`
-			Value *string `xml:"v"`
-		} `xml:"sheetData>row>c"`
-	}
-	if err = decoder.Decode(&data); err != nil {
-		return nil, errs.Wrap(err)
-	}
+func loadSheet(rows *Rows) (*Sheet, error) {
 	sheet := &Sheet{
 		Min:   Ref{Row: math.MaxInt32, Col: math.MaxInt32},
 		Max:   Ref{},
-		Cells: make(map[Ref]Cell, len(data.Cells)),
-	}
-	for _, one := range data.Cells {
-		if one.Value == nil {
-			continue
-		}
-		ref := ParseRef(one.Label)
-		cell := Cell{Value: *one.Value}
-		switch one.Type {
-		case "s": // String
-			var v int
-			if v, err = strconv.Atoi(cell.Value); err != nil {
-				return nil, errs.Wrap(err)
+		Cells: make(map[Ref]Cell),
+	}
+	for rows.Next() {
+		row := rows.Row()
+		for _, one := range row.Cells {
+			ref := Ref{Row: row.Index, Col: one.Col}
+			if sheet.Min.Row > ref.Row {
+				sheet.Min.Row = ref.Row
 			}
-			if v < 0 || v >= len(strs) {
-				return nil, errs.New("String index out of bounds")
+			if sheet.Min.Col > ref.Col {
+				sheet.Min.Col = ref.Col
 			}
-			cell.Type = String
-			cell.Value = strs[v]
-		case "b": // Boolean
-			cell.Type = Boolean
-		default: // Number
-			cell.Type = Number
-		}
-		if sheet.Min.Row > ref.Row {
-			sheet.Min.Row = ref.Row
-		}
-		if sheet.Min.Col > ref.Col {
-			sheet.Min.Col = ref.Col
-		}
-		if sheet.Max.Row < ref.Row {
-			sheet.Max.Row = ref.Row
-		}
-		if sheet.Max.Col < ref.Col {
-			sheet.Max.Col = ref.Col
+			if sheet.Max.Row < ref.Row {
+				sheet.Max.Row = ref.Row
+			}
+			if sheet.Max.Col < ref.Col {
+				sheet.Max.Col = ref.Col
+			}
+			sheet.Cells[ref] = one.Cell
 		}
-		sheet.Cells[ref] = cell
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sheet.ColumnWidths = rows.ColumnWidths()
+	sheet.MergedRanges = rows.MergedRanges()
 	if sheet.Min.Row > sheet.Max.Row {
 		sheet.Min.Row = sheet.Max.Row
 	}
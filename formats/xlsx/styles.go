@@ -0,0 +1,150 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio"
+)
+
+// generalFormat is the code for the number format used when a cell has no specific number format.
+const generalFormat = "General"
+
+// builtInFormats holds the codes for the number formats that Excel defines implicitly.
+var builtInFormats = map[int]string{
+	0:  generalFormat,
+	1:  "0",
+	2:  "0.00",
+	3:  "#,##0",
+	4:  "#,##0.00",
+	9:  "0%",
+	10: "0.00%",
+	11: "0.00E+00",
+	12: "# ?/?",
+	13: "# ??/??",
+	14: "mm-dd-yy",
+	15: "d-mmm-yy",
+	16: "d-mmm",
+	17: "mmm-yy",
+	18: "h:mm AM/PM",
+	19: "h:mm:ss AM/PM",
+	20: "h:mm",
+	21: "h:mm:ss",
+	22: "m/d/yy h:mm",
+	37: "#,##0 ;(#,##0)",
+	38: "#,##0 ;[Red](#,##0)",
+	39: "#,##0.00;(#,##0.00)",
+	40: "#,##0.00;[Red](#,##0.00)",
+	45: "mm:ss",
+	46: "[h]:mm:ss",
+	47: "mmss.0",
+	48: "##0.0E+0",
+	49: "@",
+}
+
+// styles holds the number formats used by the cell styles of a workbook.
+type styles struct {
+	formats []int
+	codes   map[int]string
+}
+
+func loadStyles(f *zip.File) (*styles, error) {
+	fr, err := f.Open()
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer xio.CloseIgnoringErrors(fr)
+	decoder := xml.NewDecoder(fr)
+	var data struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		Xfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err = decoder.Decode(&data); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	s := &styles{
+		formats: make([]int, len(data.Xfs)),
+		codes:   make(map[int]string, len(data.NumFmts)),
+	}
+	for i, one := range data.Xfs {
+		s.formats[i] = one.NumFmtID
+	}
+	for _, one := range data.NumFmts {
+		s.codes[one.ID] = one.Code
+	}
+	return s, nil
+}
+
+// format returns the number format code used by the cell style. An empty string is returned for the General format,
+// as well as for styles that cannot be resolved.
+func (s *styles) format(style int) string {
+	if s == nil || style < 0 || style >= len(s.formats) {
+		return ""
+	}
+	id := s.formats[style]
+	code, ok := s.codes[id]
+	if !ok {
+		code = builtInFormats[id]
+	}
+	if strings.EqualFold(code, generalFormat) {
+		return ""
+	}
+	return code
+}
+
+// isDateFormat returns true if the number format code displays a date or time.
+func isDateFormat(code string) bool {
+	// Only the first section, which is used for positive numbers, is considered.
+	inQuote := false
+	escaped := false
+	bracket := -1
+	for i, ch := range code {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote:
+			inQuote = ch != '"'
+		case bracket != -1:
+			if ch == ']' {
+				// Elapsed time formats, such as [h]:mm, are in brackets, as are colors and conditions.
+				if elapsed := strings.ToLower(code[bracket:i]); elapsed != "" &&
+					strings.Trim(elapsed, "hms") == "" {
+					return true
+				}
+				bracket = -1
+			}
+		default:
+			switch ch {
+			case '\\', '_', '*':
+				escaped = true
+			case '"':
+				inQuote = true
+			case '[':
+				bracket = i + 1
+			case ';':
+				return false
+			default:
+				if strings.ContainsRune("dDmMyYhHsS", ch) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xlsx
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/txt"
+)
+
+// Workbook provides access to the sheets of an .xlsx file without loading their cells into memory. Only the shared
+// strings and styles, which every sheet may refer to, are loaded up front.
+type Workbook struct {
+	closer io.Closer
+	files  []*zip.File
+	names  []string
+	strs   []string
+	styles *styles
+}
+
+// Open an .xlsx file for streaming access. The Workbook must be closed when no longer needed.
+func Open(path string) (*Workbook, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	var w *Workbook
+	if w, err = newWorkbook(&r.Reader); err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	w.closer = r
+	return w, nil
+}
+
+// NewWorkbook provides streaming access to an .xlsx stream.
+func NewWorkbook(in io.ReaderAt, size int64) (*Workbook, error) {
+	r, err := zip.NewReader(in, size)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	return newWorkbook(r)
+}
+
+func newWorkbook(r *zip.Reader) (*Workbook, error) {
+	w := &Workbook{}
+	var sheetNames []string
+	var err error
+	for _, f := range r.File {
+		switch {
+		case f.Name == "docProps/app.xml":
+			if sheetNames, err = loadSheetNames(f); err != nil {
+				return nil, err
+			}
+		case f.Name == "xl/sharedStrings.xml":
+			if w.strs, err = loadStrings(f); err != nil {
+				return nil, err
+			}
+		case f.Name == "xl/styles.xml":
+			if w.styles, err = loadStyles(f); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(f.Name, "xl/worksheets/sheet"):
+			w.files = append(w.files, f)
+		}
+	}
+	slices.SortFunc(w.files, func(a, b *zip.File) int {
+		return txt.NaturalCmp(a.Name, b.Name, true)
+	})
+	w.names = make([]string, len(w.files))
+	for i := range w.files {
+		if i < len(sheetNames) {
+			w.names[i] = sheetNames[i]
+		} else {
+			w.names[i] = fmt.Sprintf("Sheet%d", i+1)
+		}
+	}
+	return w, nil
+}
+
+// SheetNames returns the names of the sheets in the Workbook.
+func (w *Workbook) SheetNames() []string {
+	return slices.Clone(w.names)
+}
+
+// Rows returns an iterator over the rows of the sheet at the given index.
+func (w *Workbook) Rows(sheet int) (*Rows, error) {
+	return w.RowsInRange(sheet, Range{Max: Ref{Row: maxRows - 1, Col: maxColumns - 1}})
+}
+
+// RowsInRange returns an iterator over the rows of the sheet at the given index, limited to the cells within bounds.
+// Iteration stops as soon as a row beyond the bounds is reached.
+func (w *Workbook) RowsInRange(sheet int, bounds Range) (*Rows, error) {
+	if sheet < 0 || sheet >= len(w.files) {
+		return nil, errs.Newf("sheet index out of range: %d", sheet)
+	}
+	return newRows(w.files[sheet], w.strs, w.styles, bounds)
+}
+
+// Close the Workbook. Any open Rows should be closed first.
+func (w *Workbook) Close() error {
+	if w.closer == nil {
+		return nil
+	}
+	err := w.closer.Close()
+	w.closer = nil
+	return errs.Wrap(err)
+}
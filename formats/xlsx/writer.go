@@ -0,0 +1,444 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio/fs/safe"
+)
+
+// Limits imposed by Excel.
+const (
+	maxRows           = 1048576
+	maxColumns        = 16384
+	maxSheetNameBytes = 31
+)
+
+const (
+	xmlHeader         = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	mainNamespace     = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	relsNamespace     = "http://schemas.openxmlformats.org/package/2006/relationships"
+	relTypePrefix     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/"
+	contentTypePrefix = "application/vnd.openxmlformats-officedocument."
+)
+
+// Number formats given to Date cells that do not have one. Dates without a time of day use a short date format.
+const (
+	defaultDateFormat     = 14
+	defaultDateTimeFormat = 22
+	firstCustomFormat     = 164
+)
+
+// Save sheets to an .xlsx file.
+func Save(path string, sheets []Sheet) error {
+	if err := safe.WriteFile(path, func(w io.Writer) error { return Write(w, sheets) }); err != nil {
+		return errs.NewWithCause(path, err)
+	}
+	return nil
+}
+
+// Write sheets to an .xlsx stream. Each sheet must have a unique name that Excel will accept; sheets without a name are
+// given one of the form "SheetN". Cells may be placed anywhere within the sheet; their Min and Max are ignored.
+func Write(w io.Writer, sheets []Sheet) error {
+	if len(sheets) == 0 {
+		return errs.New("at least one sheet is required")
+	}
+	names, err := sheetNames(sheets)
+	if err != nil {
+		return err
+	}
+	z := zip.NewWriter(w)
+	sst := &sharedStrings{index: make(map[string]int)}
+	st := newStyleTable()
+	for i := range sheets {
+		if err = writePart(z, fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), func(bw *bufio.Writer) error {
+			return writeSheet(bw, &sheets[i], names[i], sst, st)
+		}); err != nil {
+			return err
+		}
+	}
+	for _, part := range []struct {
+		name  string
+		write func(bw *bufio.Writer) error
+	}{
+		{"[Content_Types].xml", func(bw *bufio.Writer) error { return writeContentTypes(bw, len(sheets)) }},
+		{"_rels/.rels", writeRootRels},
+		{"docProps/app.xml", func(bw *bufio.Writer) error { return writeAppProps(bw, names) }},
+		{"xl/workbook.xml", func(bw *bufio.Writer) error { return writeWorkbook(bw, names) }},
+		{"xl/_rels/workbook.xml.rels", func(bw *bufio.Writer) error { return writeWorkbookRels(bw, len(sheets)) }},
+		{"xl/styles.xml", st.write},
+		{"xl/sharedStrings.xml", sst.write},
+	} {
+		if err = writePart(z, part.name, part.write); err != nil {
+			return err
+		}
+	}
+	return errs.Wrap(z.Close())
+}
+
+func sheetNames(sheets []Sheet) ([]string, error) {
+	names := make([]string, len(sheets))
+	used := make(map[string]bool, len(sheets))
+	for i := range sheets {
+		name := sheets[i].Name
+		if name == "" {
+			name = fmt.Sprintf("Sheet%d", i+1)
+		}
+		if len(name) > maxSheetNameBytes {
+			return nil, errs.Newf("sheet name is too long: %q", name)
+		}
+		if strings.ContainsAny(name, `[]:*?/\`) || strings.HasPrefix(name, "'") || strings.HasSuffix(name, "'") {
+			return nil, errs.Newf("invalid sheet name: %q", name)
+		}
+		key := strings.ToLower(name)
+		if used[key] {
+			return nil, errs.Newf("duplicate sheet name: %q", name)
+		}
+		used[key] = true
+		names[i] = name
+	}
+	return names, nil
+}
+
+func writePart(z *zip.Writer, name string, write func(bw *bufio.Writer) error) error {
+	w, err := z.Create(name)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	bw := bufio.NewWriter(w)
+	if _, err = bw.WriteString(xmlHeader); err != nil {
+		return errs.Wrap(err)
+	}
+	if err = write(bw); err != nil {
+		return err
+	}
+	return errs.Wrap(bw.Flush())
+}
+
+func writeSheet(bw *bufio.Writer, sheet *Sheet, name string, sst *sharedStrings, st *styleTable) error {
+	refs := make([]Ref, 0, len(sheet.Cells))
+	for ref := range sheet.Cells {
+		if ref.Row < 0 || ref.Row >= maxRows || ref.Col < 0 || ref.Col >= maxColumns {
+			return errs.Newf("cell reference out of range in sheet %q: row %d, column %d", name, ref.Row, ref.Col)
+		}
+		refs = append(refs, ref)
+	}
+	slices.SortFunc(refs, func(a, b Ref) int {
+		if a.Row != b.Row {
+			return a.Row - b.Row
+		}
+		return a.Col - b.Col
+	})
+	dimension := "A1"
+	if len(refs) != 0 {
+		minRef := refs[0]
+		maxRef := refs[len(refs)-1]
+		for _, ref := range refs {
+			minRef.Col = min(minRef.Col, ref.Col)
+			maxRef.Col = max(maxRef.Col, ref.Col)
+		}
+		dimension = minRef.String() + ":" + maxRef.String()
+	}
+	bw.WriteString(`<worksheet xmlns="` + mainNamespace + `"><dimension ref="` + dimension + `"/>`)
+	if len(sheet.ColumnWidths) != 0 {
+		cols := make([]int, 0, len(sheet.ColumnWidths))
+		for col, width := range sheet.ColumnWidths {
+			if col < 0 || col >= maxColumns || width <= 0 || math.IsInf(width, 0) || math.IsNaN(width) {
+				return errs.Newf("invalid width for column %d in sheet %q: %v", col, name, width)
+			}
+			cols = append(cols, col)
+		}
+		slices.Sort(cols)
+		bw.WriteString("<cols>")
+		for _, col := range cols {
+			c := strconv.Itoa(col + 1)
+			bw.WriteString(`<col min="` + c + `" max="` + c + `" width="` +
+				strconv.FormatFloat(sheet.ColumnWidths[col], 'f', -1, 64) + `" customWidth="1"/>`)
+		}
+		bw.WriteString("</cols>")
+	}
+	bw.WriteString("<sheetData>")
+	row := -1
+	for _, ref := range refs {
+		if ref.Row != row {
+			if row != -1 {
+				bw.WriteString("</row>")
+			}
+			row = ref.Row
+			bw.WriteString(`<row r="` + strconv.Itoa(row+1) + `">`)
+		}
+		cell := sheet.Cells[ref]
+		bw.WriteString(`<c r="` + ref.String() + `"`)
+		var value string
+		switch cell.Type {
+		case String:
+			if cell.Formula != "" {
+				// Formula results are stored inline rather than in the shared strings.
+				bw.WriteString(` t="str"`)
+				value = cell.Value
+			} else {
+				bw.WriteString(` t="s"`)
+				value = strconv.Itoa(sst.add(cell.Value))
+			}
+		case Boolean:
+			bw.WriteString(` t="b"`)
+			value = "0"
+			if cell.Boolean() {
+				value = "1"
+			}
+		case Number, Date:
+			value = strings.TrimSpace(cell.Value)
+			if value != "" || cell.Formula == "" {
+				f, err := strconv.ParseFloat(value, 64)
+				if err != nil || math.IsInf(f, 0) || math.IsNaN(f) || strings.ContainsAny(value, "xX") {
+					return errs.Newf("invalid number in cell %s of sheet %q: %q", ref, name, cell.Value)
+				}
+			}
+			format := cell.Format
+			if format == "" && cell.Type == Date {
+				if f, _ := strconv.ParseFloat(value, 64); f == math.Trunc(f) {
+					format = builtInFormats[defaultDateFormat]
+				} else {
+					format = builtInFormats[defaultDateTimeFormat]
+				}
+			}
+			if style := st.style(format); style != 0 {
+				bw.WriteString(` s="` + strconv.Itoa(style) + `"`)
+			}
+		default:
+			return errs.Newf("invalid type for cell %s of sheet %q: %d", ref, name, cell.Type)
+		}
+		bw.WriteString(">")
+		if cell.Formula != "" {
+			bw.WriteString("<f>")
+			writeEscaped(bw, strings.TrimPrefix(cell.Formula, "="))
+			bw.WriteString("</f>")
+		}
+		if value != "" || cell.Formula == "" {
+			bw.WriteString("<v>")
+			writeEscaped(bw, value)
+			bw.WriteString("</v>")
+		}
+		bw.WriteString("</c>")
+	}
+	if row != -1 {
+		bw.WriteString("</row>")
+	}
+	bw.WriteString("</sheetData>")
+	if len(sheet.MergedRanges) != 0 {
+		bw.WriteString(`<mergeCells count="` + strconv.Itoa(len(sheet.MergedRanges)) + `">`)
+		for _, r := range sheet.MergedRanges {
+			if r.Min.Row < 0 || r.Min.Col < 0 || r.Max.Row >= maxRows || r.Max.Col >= maxColumns ||
+				r.Min.Row > r.Max.Row || r.Min.Col > r.Max.Col {
+				return errs.Newf("invalid merged range in sheet %q: %v", name, r)
+			}
+			bw.WriteString(`<mergeCell ref="` + r.Min.String() + ":" + r.Max.String() + `"/>`)
+		}
+		bw.WriteString("</mergeCells>")
+	}
+	_, err := bw.WriteString("</worksheet>")
+	return errs.Wrap(err)
+}
+
+func writeContentTypes(bw *bufio.Writer, count int) error {
+	bw.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	bw.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	bw.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	writeOverride(bw, "/xl/workbook.xml", "spreadsheetml.sheet.main+xml")
+	for i := 1; i <= count; i++ {
+		writeOverride(bw, fmt.Sprintf("/xl/worksheets/sheet%d.xml", i), "spreadsheetml.worksheet+xml")
+	}
+	writeOverride(bw, "/xl/styles.xml", "spreadsheetml.styles+xml")
+	writeOverride(bw, "/xl/sharedStrings.xml", "spreadsheetml.sharedStrings+xml")
+	writeOverride(bw, "/docProps/app.xml", "extended-properties+xml")
+	_, err := bw.WriteString("</Types>")
+	return errs.Wrap(err)
+}
+
+func writeOverride(bw *bufio.Writer, part, contentType string) {
+	bw.WriteString(`<Override PartName="` + part + `" ContentType="` + contentTypePrefix + contentType + `"/>`)
+}
+
+func writeRootRels(bw *bufio.Writer) error {
+	bw.WriteString(`<Relationships xmlns="` + relsNamespace + `">`)
+	writeRelationship(bw, 1, "officeDocument", "xl/workbook.xml")
+	writeRelationship(bw, 2, "extended-properties", "docProps/app.xml")
+	_, err := bw.WriteString("</Relationships>")
+	return errs.Wrap(err)
+}
+
+func writeRelationship(bw *bufio.Writer, id int, relType, target string) {
+	bw.WriteString(`<Relationship Id="rId` + strconv.Itoa(id) + `" Type="` + relTypePrefix + relType + `" Target="` +
+		target + `"/>`)
+}
+
+func writeAppProps(bw *bufio.Writer, names []string) error {
+	count := strconv.Itoa(len(names))
+	bw.WriteString(`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties" `)
+	bw.WriteString(`xmlns:vt="http://schemas.openxmlformats.org/officeDocument/2006/docPropsVTypes">`)
+	bw.WriteString(`<HeadingPairs><vt:vector size="2" baseType="variant"><vt:variant><vt:lpstr>Worksheets</vt:lpstr>`)
+	bw.WriteString(`</vt:variant><vt:variant><vt:i4>` + count + `</vt:i4></vt:variant></vt:vector></HeadingPairs>`)
+	bw.WriteString(`<TitlesOfParts><vt:vector size="` + count + `" baseType="lpstr">`)
+	for _, name := range names {
+		bw.WriteString("<vt:lpstr>")
+		writeEscaped(bw, name)
+		bw.WriteString("</vt:lpstr>")
+	}
+	_, err := bw.WriteString("</vt:vector></TitlesOfParts></Properties>")
+	return errs.Wrap(err)
+}
+
+func writeWorkbook(bw *bufio.Writer, names []string) error {
+	bw.WriteString(`<workbook xmlns="` + mainNamespace + `" `)
+	bw.WriteString(`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, name := range names {
+		id := strconv.Itoa(i + 1)
+		bw.WriteString(`<sheet name="`)
+		writeEscaped(bw, name)
+		bw.WriteString(`" sheetId="` + id + `" r:id="rId` + id + `"/>`)
+	}
+	_, err := bw.WriteString("</sheets></workbook>")
+	return errs.Wrap(err)
+}
+
+func writeWorkbookRels(bw *bufio.Writer, count int) error {
+	bw.WriteString(`<Relationships xmlns="` + relsNamespace + `">`)
+	for i := 1; i <= count; i++ {
+		writeRelationship(bw, i, "worksheet", fmt.Sprintf("worksheets/sheet%d.xml", i))
+	}
+	writeRelationship(bw, count+1, "styles", "styles.xml")
+	writeRelationship(bw, count+2, "sharedStrings", "sharedStrings.xml")
+	_, err := bw.WriteString("</Relationships>")
+	return errs.Wrap(err)
+}
+
+// styleTable collects the number formats used by the cells of a workbook, assigning each a cell style.
+type styleTable struct {
+	index   map[string]int
+	formats []int
+	custom  map[string]int
+	codes   []string
+}
+
+func newStyleTable() *styleTable {
+	return &styleTable{
+		index:   map[string]int{"": 0},
+		formats: []int{0},
+		custom:  make(map[string]int),
+	}
+}
+
+// style returns the cell style to use for the number format code.
+func (s *styleTable) style(code string) int {
+	if strings.EqualFold(code, generalFormat) {
+		code = ""
+	}
+	if i, exists := s.index[code]; exists {
+		return i
+	}
+	id := -1
+	for builtInID, builtInCode := range builtInFormats {
+		if builtInCode == code {
+			id = builtInID
+			break
+		}
+	}
+	if id == -1 {
+		var exists bool
+		if id, exists = s.custom[code]; !exists {
+			id = firstCustomFormat + len(s.codes)
+			s.custom[code] = id
+			s.codes = append(s.codes, code)
+		}
+	}
+	i := len(s.formats)
+	s.index[code] = i
+	s.formats = append(s.formats, id)
+	return i
+}
+
+func (s *styleTable) write(bw *bufio.Writer) error {
+	bw.WriteString(`<styleSheet xmlns="` + mainNamespace + `">`)
+	if len(s.codes) != 0 {
+		bw.WriteString(`<numFmts count="` + strconv.Itoa(len(s.codes)) + `">`)
+		for i, code := range s.codes {
+			bw.WriteString(`<numFmt numFmtId="` + strconv.Itoa(firstCustomFormat+i) + `" formatCode="`)
+			writeEscaped(bw, code)
+			bw.WriteString(`"/>`)
+		}
+		bw.WriteString("</numFmts>")
+	}
+	bw.WriteString(`<fonts count="1"><font><sz val="11"/><name val="Calibri"/><family val="2"/></font></fonts>`)
+	bw.WriteString(`<fills count="2"><fill><patternFill patternType="none"/></fill>`)
+	bw.WriteString(`<fill><patternFill patternType="gray125"/></fill></fills>`)
+	bw.WriteString(`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`)
+	bw.WriteString(`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	bw.WriteString(`<cellXfs count="` + strconv.Itoa(len(s.formats)) + `">`)
+	for i, id := range s.formats {
+		bw.WriteString(`<xf numFmtId="` + strconv.Itoa(id) + `" fontId="0" fillId="0" borderId="0" xfId="0"`)
+		if i != 0 {
+			bw.WriteString(` applyNumberFormat="1"`)
+		}
+		bw.WriteString("/>")
+	}
+	bw.WriteString("</cellXfs>")
+	bw.WriteString(`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>`)
+	_, err := bw.WriteString("</styleSheet>")
+	return errs.Wrap(err)
+}
+
+// sharedStrings collects the unique strings used by the cells of a workbook.
+type sharedStrings struct {
+	index  map[string]int
+	values []string
+	count  int
+}
+
+func (s *sharedStrings) add(value string) int {
+	s.count++
+	i, exists := s.index[value]
+	if !exists {
+		i = len(s.values)
+		s.index[value] = i
+		s.values = append(s.values, value)
+	}
+	return i
+}
+
+func (s *sharedStrings) write(bw *bufio.Writer) error {
+	bw.WriteString(`<sst xmlns="` + mainNamespace + `" count="` + strconv.Itoa(s.count) + `" uniqueCount="` +
+		strconv.Itoa(len(s.values)) + `">`)
+	for _, value := range s.values {
+		if strings.TrimSpace(value) != value {
+			bw.WriteString(`<si><t xml:space="preserve">`)
+		} else {
+			bw.WriteString("<si><t>")
+		}
+		writeEscaped(bw, value)
+		bw.WriteString("</t></si>")
+	}
+	_, err := bw.WriteString("</sst>")
+	return errs.Wrap(err)
+}
+
+func writeEscaped(bw *bufio.Writer, text string) {
+	// Writes to a bufio.Writer only fail if the underlying writer does, which is reported when it is flushed.
+	_ = xml.EscapeText(bw, []byte(text))
+}
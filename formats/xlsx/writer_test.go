@@ -0,0 +1,127 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xlsx_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/formats/xlsx"
+)
+
+func TestRoundTrip(t *testing.T) {
+	when := time.Date(2023, time.March, 14, 15, 9, 26, 0, time.UTC)
+	day := time.Date(1999, time.December, 31, 0, 0, 0, 0, time.UTC)
+	sheets := []xlsx.Sheet{
+		{
+			Name: "Report",
+			Cells: map[xlsx.Ref]xlsx.Cell{
+				{Row: 0, Col: 0}:  xlsx.StringCell("Name"),
+				{Row: 0, Col: 1}:  xlsx.StringCell("Amount"),
+				{Row: 1, Col: 0}:  xlsx.StringCell("  <padded> & \"quoted\"  "),
+				{Row: 1, Col: 1}:  xlsx.NumberCell(-12.5),
+				{Row: 2, Col: 0}:  xlsx.StringCell("Name"),
+				{Row: 2, Col: 1}:  xlsx.BooleanCell(true),
+				{Row: 3, Col: 2}:  xlsx.DateCell(when),
+				{Row: 4, Col: 2}:  xlsx.DateCell(day),
+				{Row: 9, Col: 27}: xlsx.NumberCell(1e20),
+			},
+			ColumnWidths: map[int]float64{0: 30, 2: 18.5},
+		},
+		{
+			Name:  "Empty",
+			Cells: map[xlsx.Ref]xlsx.Cell{},
+		},
+		{
+			Cells: map[xlsx.Ref]xlsx.Cell{{Row: 2, Col: 1}: xlsx.BooleanCell(false)},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "test.xlsx")
+	check.NoError(t, xlsx.Save(path, sheets))
+	loaded, err := xlsx.Load(path)
+	check.NoError(t, err)
+	check.Equal(t, 3, len(loaded))
+	check.Equal(t, "Report", loaded[0].Name)
+	check.Equal(t, "Empty", loaded[1].Name)
+	check.Equal(t, "Sheet3", loaded[2].Name)
+	for i := range sheets {
+		check.Equal(t, len(sheets[i].Cells), len(loaded[i].Cells), "sheet %d", i)
+		for ref, cell := range sheets[i].Cells {
+			if cell.Type == xlsx.Date {
+				// Dates are given a default format when they do not have one.
+				check.True(t, loaded[i].Cells[ref].Format != "")
+				cell.Format = loaded[i].Cells[ref].Format
+			}
+			check.Equal(t, cell, loaded[i].Cells[ref], "sheet %d, cell %s", i, ref)
+		}
+	}
+	check.Equal(t, sheets[0].ColumnWidths, loaded[0].ColumnWidths)
+	check.Equal(t, xlsx.Ref{Row: 0, Col: 0}, loaded[0].Min)
+	check.Equal(t, xlsx.Ref{Row: 9, Col: 27}, loaded[0].Max)
+	c := loaded[0].Cells[xlsx.Ref{Row: 3, Col: 2}]
+	check.Equal(t, xlsx.Date, c.Type)
+	check.Equal(t, when, c.Time().Round(time.Millisecond))
+	c = loaded[0].Cells[xlsx.Ref{Row: 4, Col: 2}]
+	check.Equal(t, day, c.Time())
+	c = loaded[2].Cells[xlsx.Ref{Row: 2, Col: 1}]
+	check.False(t, c.Boolean())
+
+	// Saving what was loaded produces the same result.
+	var buffer bytes.Buffer
+	check.NoError(t, xlsx.Write(&buffer, loaded))
+	var reloaded []xlsx.Sheet
+	reloaded, err = xlsx.Read(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	check.NoError(t, err)
+	check.Equal(t, loaded, reloaded)
+}
+
+func TestFormulasAndFormats(t *testing.T) {
+	sheets := []xlsx.Sheet{{
+		Name: "Data",
+		Cells: map[xlsx.Ref]xlsx.Cell{
+			{Row: 0, Col: 0}: {Type: xlsx.Number, Value: "0.25", Format: "0.00%"},
+			{Row: 0, Col: 1}: {Type: xlsx.Number, Value: "1234.5", Format: "#,##0.00"},
+			{Row: 0, Col: 2}: {Type: xlsx.Number, Value: "2", Format: `"x"0;[Red]-0`},
+			{Row: 1, Col: 0}: {Type: xlsx.Number, Value: "0.5", Formula: "A1*2", Format: "0.00%"},
+			{Row: 1, Col: 1}: {Type: xlsx.String, Value: "a<b", Formula: `"a"&"<b"`},
+			{Row: 1, Col: 2}: {Type: xlsx.Boolean, Value: "1", Formula: "A2>A1"},
+			{Row: 1, Col: 3}: {Type: xlsx.Number, Formula: "NOW()"},
+			{Row: 2, Col: 0}: {Type: xlsx.Date, Value: "45000.5", Format: "yyyy-mm-dd hh:mm"},
+			{Row: 2, Col: 1}: {Type: xlsx.Date, Value: "0.75", Format: "[h]:mm"},
+		},
+		MergedRanges: []xlsx.Range{xlsx.ParseRange("A4:C5"), xlsx.ParseRange("D1:D2")},
+	}}
+	var buffer bytes.Buffer
+	check.NoError(t, xlsx.Write(&buffer, sheets))
+	loaded, err := xlsx.Read(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	check.NoError(t, err)
+	check.Equal(t, sheets[0].Cells, loaded[0].Cells)
+	check.Equal(t, sheets[0].MergedRanges, loaded[0].MergedRanges)
+	check.Equal(t, "A4:C5", loaded[0].MergedRanges[0].String())
+}
+
+func TestWriteErrors(t *testing.T) {
+	for i, sheets := range [][]xlsx.Sheet{
+		nil,
+		{{Name: "a"}, {Name: "A"}},
+		{{Name: "a/b"}},
+		{{Name: "this sheet name is far too long to use"}},
+		{{Cells: map[xlsx.Ref]xlsx.Cell{{Row: -1}: xlsx.NumberCell(1)}}},
+		{{Cells: map[xlsx.Ref]xlsx.Cell{{}: {Type: xlsx.Number, Value: "one"}}}},
+		{{ColumnWidths: map[int]float64{1: -2}}},
+		{{MergedRanges: []xlsx.Range{{Min: xlsx.Ref{Row: -1}}}}},
+	} {
+		var buffer bytes.Buffer
+		check.Error(t, xlsx.Write(&buffer, sheets), "index %d", i)
+	}
+}
@@ -5,6 +5,7 @@ go 1.24.0
 require (
 	github.com/jackpal/gateway v1.0.16
 	github.com/pkg/term v1.2.0-beta.2
+	golang.org/x/crypto v0.36.0
 	golang.org/x/exp v0.0.0-20250305212735-054e65f0b394
 	golang.org/x/image v0.25.0
 	gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,154 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git
+
+import (
+	"container/heap"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/i18n"
+)
+
+// BlameLine identifies the commit that last changed a line of a file.
+type BlameLine struct {
+	// Commit is the commit that introduced the line. Lines introduced by the same commit share the same Commit.
+	Commit *Commit
+	// Text is the content of the line, without its line ending.
+	Text string
+	// Line is the line number within the current version of the file, starting at 1.
+	Line int
+	// OriginalLine is the line number within the version of the file created by Commit, starting at 1.
+	OriginalLine int
+}
+
+// blameTarget tracks the lines of a single version of a file that have yet to be attributed to a commit.
+type blameTarget struct {
+	blobHash string
+	lines    []string
+	// pending maps line indexes within this version to line indexes within the final version.
+	pending map[int]int
+}
+
+// Blame returns the commit that last changed each line of the file at the slash-separated path, as of HEAD. Renames
+// are not followed, so lines that predate a rename are attributed to the commit that performed it.
+func (repo *Repo) Blame(path string) ([]BlameLine, error) {
+	l, err := openLocal(repo.local)
+	if err != nil {
+		return nil, errs.NewWithCause(i18n.Text("Unable to retrieve blame"), err)
+	}
+	defer l.close()
+	var result []BlameLine
+	if result, err = l.blame(path); err != nil {
+		return nil, errs.NewWithCause(i18n.Text("Unable to retrieve blame"), err)
+	}
+	return result, nil
+}
+
+func (l *local) blame(path string) ([]BlameLine, error) {
+	hash, err := l.resolveRef("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	var c *Commit
+	if c, err = l.commit(hash); err != nil {
+		return nil, err
+	}
+	var start *blameTarget
+	if start, err = l.blameTarget(c, path); err != nil {
+		return nil, err
+	}
+	if start == nil {
+		return nil, errs.Newf("%s does not exist", path)
+	}
+	result := make([]BlameLine, len(start.lines))
+	for i := range start.lines {
+		start.pending[i] = i
+	}
+	targets := map[string]*blameTarget{c.Hash: start}
+	queue := commitQueue{c}
+	for queue.Len() != 0 {
+		c = heap.Pop(&queue).(*Commit) //nolint:errcheck // The queue only holds commits
+		target := targets[c.Hash]
+		delete(targets, c.Hash)
+		for _, parentHash := range c.Parents {
+			if len(target.pending) == 0 {
+				break
+			}
+			var parent *Commit
+			if parent, err = l.commit(parentHash); err != nil {
+				return nil, err
+			}
+			var parentTarget *blameTarget
+			if parentTarget, err = l.blameTarget(parent, path); err != nil {
+				return nil, err
+			}
+			if parentTarget == nil {
+				continue
+			}
+			if parentTarget.blobHash == target.blobHash {
+				for line, final := range target.pending {
+					parentTarget.pending[line] = final
+				}
+				clear(target.pending)
+			} else {
+				for _, e := range diffLines(parentTarget.lines, target.lines) {
+					if e.kind != ContextLine {
+						continue
+					}
+					if final, ok := target.pending[e.newLine]; ok {
+						parentTarget.pending[e.oldLine] = final
+						delete(target.pending, e.newLine)
+					}
+				}
+			}
+			if len(parentTarget.pending) == 0 {
+				continue
+			}
+			if existing, ok := targets[parent.Hash]; ok {
+				for line, final := range parentTarget.pending {
+					existing.pending[line] = final
+				}
+			} else {
+				targets[parent.Hash] = parentTarget
+				heap.Push(&queue, parent)
+			}
+		}
+		for line, final := range target.pending {
+			result[final] = BlameLine{
+				Commit:       c,
+				Text:         strings.TrimSuffix(target.lines[line], "\n"),
+				Line:         final + 1,
+				OriginalLine: line + 1,
+			}
+		}
+	}
+	return result, nil
+}
+
+// blameTarget returns the version of the file at the path within the commit, or nil if the commit has no such file.
+func (l *local) blameTarget(c *Commit, path string) (*blameTarget, error) {
+	entry, exists, err := l.entryAt(c.Tree, path)
+	if err != nil || !exists {
+		return nil, err
+	}
+	if kind := entry.mode & typeMask; kind == treeMode || kind == submoduleMode {
+		return nil, nil
+	}
+	var data []byte
+	if data, err = l.blob(entry.hash); err != nil {
+		return nil, err
+	}
+	return &blameTarget{
+		blobHash: entry.hash,
+		lines:    splitLines(data),
+		pending:  make(map[int]int),
+	}, nil
+}
@@ -0,0 +1,487 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/i18n"
+)
+
+const (
+	diffContextLines = 3
+	binaryCheckSize  = 8000
+)
+
+// ChangeKind identifies the way in which a file was changed.
+type ChangeKind uint8
+
+// Possible ChangeKind values.
+const (
+	Unmodified ChangeKind = iota
+	Added
+	Deleted
+	Modified
+	Renamed
+	Copied
+	TypeChanged
+	Unmerged
+	Untracked
+	Ignored
+)
+
+// LineKind identifies the role of a line within a Hunk.
+type LineKind uint8
+
+// Possible LineKind values.
+const (
+	ContextLine LineKind = iota
+	AddedLine
+	DeletedLine
+)
+
+// FileDiff holds the differences found in a single file.
+type FileDiff struct {
+	// Path is the slash-separated path of the file, relative to the root of the repository.
+	Path string
+	// OldHash and NewHash are the ids of the file's content before and after the change. OldHash is empty for added
+	// files and NewHash is empty for deleted files.
+	OldHash string
+	NewHash string
+	// Hunks holds the changed lines, along with some surrounding context. It is empty for binary files and for files
+	// whose mode is all that changed.
+	Hunks []Hunk
+	// OldMode and NewMode are the git file modes, such as 0o100644, before and after the change.
+	OldMode uint32
+	NewMode uint32
+	// Kind is one of Added, Deleted, Modified or TypeChanged.
+	Kind ChangeKind
+	// Binary is true if either version of the file appears to hold binary data.
+	Binary bool
+}
+
+// Hunk holds a contiguous region of changes. Line numbers start at 1. As in the unified diff format, when a hunk has
+// no lines on one side, the start for that side is the number of the line the change follows, or 0 at the top.
+type Hunk struct {
+	Lines    []DiffLine
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+}
+
+// DiffLine is a single line within a Hunk.
+type DiffLine struct {
+	// Text is the content of the line, without its line ending.
+	Text string
+	Kind LineKind
+}
+
+// Diff returns the differences between two revisions, sorted by path. An empty revision means HEAD.
+func (repo *Repo) Diff(from, to string) ([]FileDiff, error) {
+	l, err := openLocal(repo.local)
+	if err != nil {
+		return nil, errs.NewWithCause(i18n.Text("Unable to compute differences"), err)
+	}
+	defer l.close()
+	var trees [2]string
+	for i, rev := range []string{from, to} {
+		if rev == "" {
+			rev = "HEAD"
+		}
+		var hash string
+		if hash, err = l.resolveCommit(rev); err != nil {
+			return nil, errs.NewWithCause(i18n.Text("Unable to compute differences"), err)
+		}
+		var c *Commit
+		if c, err = l.commit(hash); err != nil {
+			return nil, errs.NewWithCause(i18n.Text("Unable to compute differences"), err)
+		}
+		trees[i] = c.Tree
+	}
+	var diffs []FileDiff
+	if err = l.diffTrees(trees[0], trees[1], "", &diffs); err != nil {
+		return nil, errs.NewWithCause(i18n.Text("Unable to compute differences"), err)
+	}
+	slices.SortFunc(diffs, func(a, b FileDiff) int { return strings.Compare(a.Path, b.Path) })
+	return diffs, nil
+}
+
+// Header returns the hunk's header line, in unified diff format. As git does, a line count of 1 is omitted.
+func (h *Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return strconv.Itoa(start) + "," + strconv.Itoa(count)
+}
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Unmodified:
+		return "unmodified"
+	case Added:
+		return "added"
+	case Deleted:
+		return "deleted"
+	case Modified:
+		return "modified"
+	case Renamed:
+		return "renamed"
+	case Copied:
+		return "copied"
+	case TypeChanged:
+		return "type changed"
+	case Unmerged:
+		return "unmerged"
+	case Untracked:
+		return "untracked"
+	case Ignored:
+		return "ignored"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", k)
+	}
+}
+
+// diffTrees appends the differences between two trees to diffs. An empty hash stands for an empty tree.
+func (l *local) diffTrees(oldHash, newHash, prefix string, diffs *[]FileDiff) error {
+	entries := make(map[string]*[2]*treeEntry)
+	for i, hash := range []string{oldHash, newHash} {
+		if hash == "" {
+			continue
+		}
+		list, err := l.tree(hash)
+		if err != nil {
+			return err
+		}
+		for j := range list {
+			pair, exists := entries[list[j].name]
+			if !exists {
+				pair = &[2]*treeEntry{}
+				entries[list[j].name] = pair
+			}
+			pair[i] = &list[j]
+		}
+	}
+	for name, pair := range entries {
+		oldEntry, newEntry := pair[0], pair[1]
+		if oldEntry != nil && newEntry != nil && *oldEntry == *newEntry {
+			continue
+		}
+		path := prefix + name
+		oldIsTree := oldEntry != nil && oldEntry.mode&typeMask == treeMode
+		newIsTree := newEntry != nil && newEntry.mode&typeMask == treeMode
+		if oldIsTree || newIsTree {
+			var oldTree, newTree string
+			if oldIsTree {
+				oldTree = oldEntry.hash
+				oldEntry = nil
+			}
+			if newIsTree {
+				newTree = newEntry.hash
+				newEntry = nil
+			}
+			if err := l.diffTrees(oldTree, newTree, path+"/", diffs); err != nil {
+				return err
+			}
+			if oldEntry == nil && newEntry == nil {
+				continue
+			}
+		}
+		d, err := l.diffFiles(path, oldEntry, newEntry)
+		if err != nil {
+			return err
+		}
+		*diffs = append(*diffs, d)
+	}
+	return nil
+}
+
+// diffFiles compares two versions of a file, either of which may be nil.
+func (l *local) diffFiles(path string, oldEntry, newEntry *treeEntry) (FileDiff, error) {
+	d := FileDiff{
+		Path: path,
+		Kind: Modified,
+	}
+	var content [2][]byte
+	for i, entry := range []*treeEntry{oldEntry, newEntry} {
+		if entry == nil {
+			continue
+		}
+		if i == 0 {
+			d.OldHash = entry.hash
+			d.OldMode = entry.mode
+		} else {
+			d.NewHash = entry.hash
+			d.NewMode = entry.mode
+		}
+		if entry.mode&typeMask != submoduleMode {
+			var err error
+			if content[i], err = l.blob(entry.hash); err != nil {
+				return d, err
+			}
+			if bytes.IndexByte(content[i][:min(len(content[i]), binaryCheckSize)], 0) != -1 {
+				d.Binary = true
+			}
+		}
+	}
+	switch {
+	case oldEntry == nil:
+		d.Kind = Added
+	case newEntry == nil:
+		d.Kind = Deleted
+	case oldEntry.mode&typeMask != newEntry.mode&typeMask:
+		d.Kind = TypeChanged
+	}
+	if !d.Binary {
+		d.Hunks = hunks(diffLines(splitLines(content[0]), splitLines(content[1])), diffContextLines)
+	}
+	return d, nil
+}
+
+// splitLines splits the data into lines, each of which retains its line ending.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// edit is a single step in transforming one list of lines into another. oldLine and newLine are the indexes of the
+// line within each list or, for the side a line is not present in, the number of lines that precede it.
+type edit struct {
+	text    string
+	oldLine int
+	newLine int
+	kind    LineKind
+}
+
+// diffLines returns the shortest sequence of edits that transforms a into b, using Myers' algorithm.
+func diffLines(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	edits := make([]edit, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, edit{kind: ContextLine, oldLine: i, newLine: i, text: a[i]})
+	}
+	for _, e := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		e.oldLine += prefix
+		e.newLine += prefix
+		edits = append(edits, e)
+	}
+	for i := suffix; i > 0; i-- {
+		edits = append(edits, edit{kind: ContextLine, oldLine: len(a) - i, newLine: len(b) - i, text: a[len(a)-i]})
+	}
+	return edits
+}
+
+// myers returns the edits that turn a into b. It uses the linear space refinement of Myers' algorithm: rather than
+// keeping the furthest point reached on every diagonal after every step, which takes space proportional to the square of
+// the number of differences, it finds a point on a shortest path where a search forward from the start meets a search
+// backward from the end, and then diffs the parts on either side of that point in the same way.
+func myers(a, b []string) []edit {
+	d := &differ{
+		a:     a,
+		b:     b,
+		edits: make([]edit, 0, len(a)+len(b)),
+	}
+	d.diff(0, len(a), 0, len(b))
+	return d.edits
+}
+
+type differ struct {
+	a        []string
+	b        []string
+	edits    []edit
+	forward  []int
+	backward []int
+}
+
+func (d *differ) diff(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.edits = append(d.edits, edit{kind: ContextLine, oldLine: aLo, newLine: bLo, text: d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-1-suffix] == d.b[bHi-1-suffix] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+	x, y, ok := d.split(aLo, aHi, bLo, bHi)
+	if ok {
+		d.diff(aLo, x, bLo, y)
+		d.diff(x, aHi, y, bHi)
+	} else {
+		for i := aLo; i < aHi; i++ {
+			d.edits = append(d.edits, edit{kind: DeletedLine, oldLine: i, newLine: bLo, text: d.a[i]})
+		}
+		for i := bLo; i < bHi; i++ {
+			d.edits = append(d.edits, edit{kind: AddedLine, oldLine: aHi, newLine: i, text: d.b[i]})
+		}
+	}
+	for i := 0; i < suffix; i++ {
+		d.edits = append(d.edits, edit{kind: ContextLine, oldLine: aHi + i, newLine: bHi + i, text: d.a[aHi+i]})
+	}
+}
+
+// split returns a point on a shortest path through the edit graph of a[aLo:aHi] and b[bLo:bHi], other than its start
+// and end. The ranges must not share a common prefix or suffix. It returns false if there is no such point, which is the
+// case when one of the ranges is empty or they have nothing in common.
+func (d *differ) split(aLo, aHi, bLo, bHi int) (x, y int, ok bool) {
+	n := aHi - aLo
+	m := bHi - bLo
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	size := 2*maxD + 3
+	d.forward = resize(d.forward, size)
+	d.backward = resize(d.backward, size)
+	forward := d.forward
+	backward := d.backward
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+	delta := n - m
+	odd := delta%2 != 0
+	// Diagonals that have run off the edge of the edit graph are trimmed from the ends of the search.
+	var forwardStart, forwardEnd, backwardStart, backwardEnd int
+	for step := 0; step < maxD; step++ {
+		for k := -step + forwardStart; k <= step-forwardEnd; k += 2 {
+			i := offset + k
+			if k == -step || (k != step && forward[i-1] < forward[i+1]) {
+				x = forward[i+1]
+			} else {
+				x = forward[i-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[i] = x
+			switch {
+			case x > n:
+				forwardEnd += 2
+			case y > m:
+				forwardStart += 2
+			case odd:
+				if j := offset + delta - k; j >= 0 && j < size && backward[j] != -1 && x >= n-backward[j] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+		for k := -step + backwardStart; k <= step-backwardEnd; k += 2 {
+			i := offset + k
+			var bx int
+			if k == -step || (k != step && backward[i-1] < backward[i+1]) {
+				bx = backward[i+1]
+			} else {
+				bx = backward[i-1] + 1
+			}
+			by := bx - k
+			for bx < n && by < m && d.a[aHi-1-bx] == d.b[bHi-1-by] {
+				bx++
+				by++
+			}
+			backward[i] = bx
+			switch {
+			case bx > n:
+				backwardEnd += 2
+			case by > m:
+				backwardStart += 2
+			case !odd:
+				if j := offset + delta - k; j >= 0 && j < size && forward[j] != -1 && forward[j] >= n-bx {
+					x = forward[j]
+					return aLo + x, bLo + x - (j - offset), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// resize returns a slice of the given length, reusing the buffer's storage if it is large enough, with every element
+// set to -1.
+func resize(buffer []int, length int) []int {
+	if cap(buffer) < length {
+		buffer = make([]int, length)
+	}
+	buffer = buffer[:length]
+	for i := range buffer {
+		buffer[i] = -1
+	}
+	return buffer
+}
+
+// hunks groups the edits into hunks, each with up to the given number of unchanged lines around its changes.
+func hunks(edits []edit, context int) []Hunk {
+	var result []Hunk
+	i := 0
+	for i < len(edits) {
+		if edits[i].kind == ContextLine {
+			i++
+			continue
+		}
+		start := max(i-context, 0)
+		end := i + 1
+		for j := i + 1; j < len(edits); j++ {
+			if edits[j].kind != ContextLine {
+				end = j + 1
+			} else if j-end+1 > 2*context {
+				break
+			}
+		}
+		stop := min(end+context, len(edits))
+		h := Hunk{
+			OldStart: edits[start].oldLine,
+			NewStart: edits[start].newLine,
+			Lines:    make([]DiffLine, 0, stop-start),
+		}
+		for _, e := range edits[start:stop] {
+			if e.kind != AddedLine {
+				h.OldLines++
+			}
+			if e.kind != DeletedLine {
+				h.NewLines++
+			}
+			h.Lines = append(h.Lines, DiffLine{Kind: e.kind, Text: strings.TrimSuffix(e.text, "\n")})
+		}
+		if h.OldLines != 0 {
+			h.OldStart++
+		}
+		if h.NewLines != 0 {
+			h.NewStart++
+		}
+		result = append(result, h)
+		i = stop
+	}
+	return result
+}
@@ -0,0 +1,289 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git
+
+import (
+	"container/heap"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/i18n"
+)
+
+// Signature identifies who created a commit, and when.
+type Signature struct {
+	When  time.Time
+	Name  string
+	Email string
+}
+
+// Commit holds the details of a single commit.
+type Commit struct {
+	Author    Signature
+	Committer Signature
+	Hash      string
+	Tree      string
+	Message   string
+	Parents   []string
+}
+
+// Subject returns the first line of the commit message.
+func (c *Commit) Subject() string {
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	return strings.TrimSpace(subject)
+}
+
+// Log returns the commits within the range, newest first. The range may be:
+//
+//   - A single revision, such as "main", "v1.2.0", "HEAD~3" or an abbreviated commit id, for all commits reachable from
+//     it.
+//   - "A..B" for the commits reachable from B but not from A.
+//   - "A...B" for the commits reachable from either A or B, but not from both.
+//
+// An empty range, or an omitted revision within a range, means HEAD.
+func (repo *Repo) Log(rangeSpec string) ([]Commit, error) {
+	l, err := openLocal(repo.local)
+	if err != nil {
+		return nil, errs.NewWithCause(i18n.Text("Unable to retrieve log"), err)
+	}
+	defer l.close()
+	var commits []*Commit
+	if commits, err = l.log(rangeSpec); err != nil {
+		return nil, errs.NewWithCause(i18n.Text("Unable to retrieve log"), err)
+	}
+	result := make([]Commit, len(commits))
+	for i, c := range commits {
+		result[i] = *c
+	}
+	return result, nil
+}
+
+func (l *local) log(rangeSpec string) ([]*Commit, error) {
+	var include []string
+	var excluded map[string]bool
+	resolve := func(rev string) (string, error) {
+		if rev == "" {
+			rev = "HEAD"
+		}
+		return l.resolveCommit(rev)
+	}
+	if from, to, found := strings.Cut(rangeSpec, "..."); found {
+		a, err := resolve(from)
+		if err != nil {
+			return nil, err
+		}
+		var b string
+		if b, err = resolve(to); err != nil {
+			return nil, err
+		}
+		var fromA, fromB map[string]bool
+		if fromA, err = l.reachable(a); err != nil {
+			return nil, err
+		}
+		if fromB, err = l.reachable(b); err != nil {
+			return nil, err
+		}
+		excluded = make(map[string]bool)
+		for hash := range fromA {
+			if fromB[hash] {
+				excluded[hash] = true
+			}
+		}
+		include = []string{a, b}
+	} else if from, to, found = strings.Cut(rangeSpec, ".."); found {
+		a, err := resolve(from)
+		if err != nil {
+			return nil, err
+		}
+		var b string
+		if b, err = resolve(to); err != nil {
+			return nil, err
+		}
+		if excluded, err = l.reachable(a); err != nil {
+			return nil, err
+		}
+		include = []string{b}
+	} else {
+		hash, err := resolve(rangeSpec)
+		if err != nil {
+			return nil, err
+		}
+		include = []string{hash}
+	}
+	var commits []*Commit
+	seen := make(map[string]bool)
+	var queue commitQueue
+	push := func(hash string) error {
+		if seen[hash] || excluded[hash] {
+			return nil
+		}
+		seen[hash] = true
+		c, err := l.commit(hash)
+		if err != nil {
+			return err
+		}
+		heap.Push(&queue, c)
+		return nil
+	}
+	for _, hash := range include {
+		if err := push(hash); err != nil {
+			return nil, err
+		}
+	}
+	for queue.Len() != 0 {
+		c := heap.Pop(&queue).(*Commit) //nolint:errcheck // The queue only holds commits
+		commits = append(commits, c)
+		for _, parent := range c.Parents {
+			if err := push(parent); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return commits, nil
+}
+
+// reachable returns the set of commits reachable from the commit, including the commit itself.
+func (l *local) reachable(hash string) (map[string]bool, error) {
+	found := map[string]bool{hash: true}
+	pending := []string{hash}
+	for len(pending) != 0 {
+		c, err := l.commit(pending[len(pending)-1])
+		if err != nil {
+			return nil, err
+		}
+		pending = pending[:len(pending)-1]
+		for _, parent := range c.Parents {
+			if !found[parent] {
+				found[parent] = true
+				pending = append(pending, parent)
+			}
+		}
+	}
+	return found, nil
+}
+
+// resolveCommit resolves a revision to the id of the commit it refers to. The revision is a ref name, such as "HEAD",
+// "main", "v1.0.0" or "origin/main", or a full or abbreviated commit id, optionally followed by any number of "~n"
+// (n-th first-parent ancestor) and "^n" (n-th parent) suffixes.
+func (l *local) resolveCommit(rev string) (string, error) {
+	name := rev
+	suffixes := ""
+	if i := strings.IndexAny(rev, "~^"); i != -1 {
+		name = rev[:i]
+		suffixes = rev[i:]
+	}
+	hash, err := l.resolveName(name)
+	if err != nil {
+		return "", err
+	}
+	var c *Commit
+	if c, err = l.commit(hash); err != nil {
+		return "", err
+	}
+	for suffixes != "" {
+		op := suffixes[0]
+		suffixes = suffixes[1:]
+		n := 1
+		digits := 0
+		for digits < len(suffixes) && suffixes[digits] >= '0' && suffixes[digits] <= '9' {
+			digits++
+		}
+		if digits != 0 {
+			if n, err = strconv.Atoi(suffixes[:digits]); err != nil {
+				return "", errs.Newf("invalid revision: %s", rev)
+			}
+			suffixes = suffixes[digits:]
+		}
+		switch {
+		case op == '~':
+			for range n {
+				if len(c.Parents) == 0 {
+					return "", errs.Newf("revision %s does not exist", rev)
+				}
+				if c, err = l.commit(c.Parents[0]); err != nil {
+					return "", err
+				}
+			}
+		case n != 0:
+			if n > len(c.Parents) {
+				return "", errs.Newf("revision %s does not exist", rev)
+			}
+			if c, err = l.commit(c.Parents[n-1]); err != nil {
+				return "", err
+			}
+		}
+	}
+	return c.Hash, nil
+}
+
+// resolveName resolves a ref name or an object id, which may be abbreviated, to an object id.
+func (l *local) resolveName(name string) (string, error) {
+	if name == "" {
+		return "", errs.New("empty revision")
+	}
+	candidates := []string{
+		"refs/" + name,
+		"refs/tags/" + name,
+		"refs/heads/" + name,
+		"refs/remotes/" + name,
+		"refs/remotes/" + name + "/HEAD",
+	}
+	if name == "HEAD" || strings.HasPrefix(name, "refs/") {
+		candidates = []string{name}
+	}
+	for _, candidate := range candidates {
+		if hash, err := l.resolveRef(candidate); err == nil {
+			return hash, nil
+		}
+	}
+	if l.isHash(name) {
+		return name, nil
+	}
+	if len(name) >= 4 && len(name) < l.hashSize*2 && strings.Trim(name, "0123456789abcdef") == "" {
+		store, err := l.store()
+		if err != nil {
+			return "", err
+		}
+		return store.expand(name)
+	}
+	return "", errs.Newf("unknown revision: %s", name)
+}
+
+// commitQueue orders commits from newest to oldest by commit date.
+type commitQueue []*Commit
+
+func (q commitQueue) Len() int {
+	return len(q)
+}
+
+func (q commitQueue) Less(i, j int) bool {
+	if q[i].Committer.When.Equal(q[j].Committer.When) {
+		return q[i].Hash < q[j].Hash
+	}
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+
+func (q commitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *commitQueue) Push(x any) {
+	*q = append(*q, x.(*Commit)) //nolint:errcheck // The queue only holds commits
+}
+
+func (q *commitQueue) Pop() any {
+	old := *q
+	n := len(old) - 1
+	c := old[n]
+	*q = old[:n]
+	return c
+}
@@ -0,0 +1,331 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/vcs/git"
+)
+
+type historyRepo struct {
+	t    *testing.T
+	dir  string
+	date time.Time
+}
+
+func newHistoryRepo(t *testing.T) *historyRepo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	h := &historyRepo{
+		t:    t,
+		dir:  t.TempDir(),
+		date: time.Date(2023, time.June, 1, 9, 0, 0, 0, time.UTC),
+	}
+	h.git("init")
+	return h
+}
+
+func (h *historyRepo) git(args ...string) string {
+	h.t.Helper()
+	return runGit(h.t, h.dir, h.date, args...)
+}
+
+func (h *historyRepo) write(path, content string) {
+	h.t.Helper()
+	path = filepath.Join(h.dir, filepath.FromSlash(path))
+	check.NoError(h.t, os.MkdirAll(filepath.Dir(path), 0o755))
+	check.NoError(h.t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func (h *historyRepo) commit(message string) string {
+	h.t.Helper()
+	h.git("add", "-A")
+	h.git("commit", "-m", message)
+	h.date = h.date.Add(time.Hour)
+	return h.git("rev-parse", "HEAD")
+}
+
+func (h *historyRepo) repo() *git.Repo {
+	h.t.Helper()
+	repo, err := git.NewRepo("", h.dir)
+	check.NoError(h.t, err)
+	return repo
+}
+
+func numberedLines(count int, replace map[int]string) string {
+	var buffer strings.Builder
+	for i := 1; i <= count; i++ {
+		if text, ok := replace[i]; ok {
+			buffer.WriteString(text)
+		} else {
+			fmt.Fprintf(&buffer, "line %d", i)
+		}
+		buffer.WriteByte('\n')
+	}
+	return buffer.String()
+}
+
+func subjects(commits []git.Commit) []string {
+	list := make([]string, len(commits))
+	for i := range commits {
+		list[i] = commits[i].Subject()
+	}
+	return list
+}
+
+// unified renders the diff in the same form git uses for its hunks, so that the two can be compared.
+func unified(diffs []git.FileDiff) string {
+	var buffer strings.Builder
+	for _, d := range diffs {
+		for i := range d.Hunks {
+			buffer.WriteString(d.Hunks[i].Header())
+			buffer.WriteByte('\n')
+			for _, line := range d.Hunks[i].Lines {
+				switch line.Kind {
+				case git.AddedLine:
+					buffer.WriteByte('+')
+				case git.DeletedLine:
+					buffer.WriteByte('-')
+				default:
+					buffer.WriteByte(' ')
+				}
+				buffer.WriteString(line.Text)
+				buffer.WriteByte('\n')
+			}
+		}
+	}
+	return buffer.String()
+}
+
+// gitHunks extracts the hunks from git's own diff output, dropping the file headers and any function context that
+// follows the hunk ranges.
+func gitHunks(out string) string {
+	var buffer strings.Builder
+	inHunk := false
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			end := strings.Index(line[2:], "@@")
+			buffer.WriteString(line[:end+4])
+		case strings.HasPrefix(line, "diff "):
+			inHunk = false
+			continue
+		case inHunk && line != "" && strings.ContainsRune(" +-", rune(line[0])):
+			buffer.WriteString(line)
+		default:
+			continue
+		}
+		buffer.WriteByte('\n')
+	}
+	return buffer.String()
+}
+
+func TestLog(t *testing.T) {
+	clone, revs := createRepos(t)
+	t.Setenv("PATH", "")
+	repo, err := git.NewRepo("", clone)
+	check.NoError(t, err)
+
+	var commits []git.Commit
+	commits, err = repo.Log("")
+	check.NoError(t, err)
+	check.Equal(t, 12, len(commits))
+	check.Equal(t, revs["main"], commits[0].Hash)
+	check.Equal(t, "Revision 12", commits[0].Subject())
+	check.Equal(t, "Revision 1", commits[11].Subject())
+	check.Equal(t, 0, len(commits[11].Parents))
+	check.Equal(t, []string{commits[1].Hash}, commits[0].Parents)
+	check.Equal(t, "Tester", commits[0].Author.Name)
+	check.Equal(t, "tester@example.com", commits[0].Author.Email)
+	check.Equal(t, time.Date(2023, time.March, 15, 2, 9, 26, 0, time.FixedZone("", -5*3600)), commits[0].Author.When)
+
+	commits, err = repo.Log("v1.0.0..v1.1.0")
+	check.NoError(t, err)
+	check.Equal(t, []string{"Revision 6", "Revision 5", "Revision 4"}, subjects(commits))
+
+	commits, err = repo.Log("origin/feature...")
+	check.NoError(t, err)
+	check.Equal(t, 6, len(commits))
+	check.Equal(t, "Revision 7", commits[5].Subject())
+
+	commits, err = repo.Log("HEAD~9")
+	check.NoError(t, err)
+	check.Equal(t, []string{"Revision 3", "Revision 2", "Revision 1"}, subjects(commits))
+
+	commits, err = repo.Log(revs["v1.0.0"][:7] + "^..main~8")
+	check.NoError(t, err)
+	check.Equal(t, []string{"Revision 4", "Revision 3"}, subjects(commits))
+
+	_, err = repo.Log("HEAD~12")
+	check.Error(t, err)
+	_, err = repo.Log("no-such-branch..HEAD")
+	check.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	h := newHistoryRepo(t)
+	h.write("a.txt", numberedLines(20, nil))
+	h.write("dir/b.txt", "b\n")
+	h.write("image.bin", "\x00\x01\x02")
+	h.commit("Initial")
+	h.write("a.txt", numberedLines(21, map[int]string{2: "second", 8: "eighth", 18: "eighteenth"}))
+	check.NoError(t, os.Remove(filepath.Join(h.dir, "dir", "b.txt")))
+	h.write("dir/c.txt", "c\n")
+	h.write("image.bin", "\x00\x01\x03")
+	h.commit("Update")
+	h.write("a.txt", "zero\n"+numberedLines(21, map[int]string{2: "second", 8: "eighth", 18: "eighteenth"}))
+	h.commit("Prepend")
+
+	repo := h.repo()
+	diffs, err := repo.Diff("HEAD~2", "HEAD~1")
+	check.NoError(t, err)
+	check.Equal(t, 4, len(diffs))
+
+	check.Equal(t, "a.txt", diffs[0].Path)
+	check.Equal(t, git.Modified, diffs[0].Kind)
+	check.Equal(t, uint32(0o100644), diffs[0].NewMode)
+	check.Equal(t, 2, len(diffs[0].Hunks))
+	check.Equal(t, "@@ -1,11 +1,11 @@", diffs[0].Hunks[0].Header())
+	check.Equal(t, "@@ -15,6 +15,7 @@", diffs[0].Hunks[1].Header())
+
+	check.Equal(t, "dir/b.txt", diffs[1].Path)
+	check.Equal(t, git.Deleted, diffs[1].Kind)
+	check.Equal(t, "", diffs[1].NewHash)
+	check.Equal(t, []git.DiffLine{{Text: "b", Kind: git.DeletedLine}}, diffs[1].Hunks[0].Lines)
+	check.Equal(t, "@@ -1 +0,0 @@", diffs[1].Hunks[0].Header())
+
+	check.Equal(t, "dir/c.txt", diffs[2].Path)
+	check.Equal(t, git.Added, diffs[2].Kind)
+	check.Equal(t, "", diffs[2].OldHash)
+	check.Equal(t, "@@ -0,0 +1 @@", diffs[2].Hunks[0].Header())
+
+	check.Equal(t, "image.bin", diffs[3].Path)
+	check.True(t, diffs[3].Binary)
+	check.Equal(t, 0, len(diffs[3].Hunks))
+
+	check.Equal(t, gitHunks(h.git("diff", "--no-ext-diff", "--no-color", "--no-indent-heuristic", "HEAD~2", "HEAD~1")),
+		unified(diffs))
+
+	diffs, err = repo.Diff("HEAD~1", "")
+	check.NoError(t, err)
+	check.Equal(t, 1, len(diffs))
+	check.Equal(t, "@@ -1,3 +1,4 @@", diffs[0].Hunks[0].Header())
+	check.Equal(t, gitHunks(h.git("diff", "--no-ext-diff", "--no-color", "HEAD~1", "HEAD")), unified(diffs))
+
+	diffs, err = repo.Diff("HEAD", "HEAD")
+	check.NoError(t, err)
+	check.Equal(t, 0, len(diffs))
+}
+
+func TestDiffRewrite(t *testing.T) {
+	h := newHistoryRepo(t)
+	replace := make(map[int]string, 6000)
+	for i := 1; i <= 6000; i++ {
+		replace[i] = fmt.Sprintf("rewritten %d", i)
+	}
+	h.write("a.txt", numberedLines(6000, nil))
+	h.commit("Initial")
+	h.write("a.txt", numberedLines(6000, replace))
+	h.commit("Rewrite")
+
+	repo := h.repo()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	diffs, err := repo.Diff("HEAD~1", "HEAD")
+	runtime.ReadMemStats(&after)
+	check.NoError(t, err)
+	check.Equal(t, 1, len(diffs))
+	check.Equal(t, 1, len(diffs[0].Hunks))
+	check.Equal(t, "@@ -1,6000 +1,6000 @@", diffs[0].Hunks[0].Header())
+	check.Equal(t, 12000, len(diffs[0].Hunks[0].Lines))
+	// The edits themselves take a few megabytes; a diff that used space proportional to the square of the number of
+	// differences would need gigabytes.
+	check.True(t, after.TotalAlloc-before.TotalAlloc < 64<<20)
+}
+
+func TestBlame(t *testing.T) {
+	h := newHistoryRepo(t)
+	h.write("a.txt", "one\ntwo\nthree\n")
+	first := h.commit("First")
+	h.write("a.txt", "one\nTWO\nthree\nfour\n")
+	h.write("other.txt", "unrelated\n")
+	second := h.commit("Second")
+	h.git("checkout", "-b", "side")
+	h.write("a.txt", "one\nTWO\nthree\nFOUR\n")
+	side := h.commit("Side")
+	h.git("checkout", "main")
+	h.write("a.txt", "zero\none\nTWO\nthree\nfour\n")
+	main := h.commit("Main")
+	h.git("merge", "--no-ff", "-m", "Merge", "side")
+
+	lines, err := h.repo().Blame("a.txt")
+	check.NoError(t, err)
+	expected := []struct {
+		hash     string
+		text     string
+		original int
+	}{
+		{main, "zero", 1},
+		{first, "one", 1},
+		{second, "TWO", 2},
+		{first, "three", 3},
+		{side, "FOUR", 4},
+	}
+	check.Equal(t, len(expected), len(lines))
+	for i, one := range expected {
+		check.Equal(t, one.hash, lines[i].Commit.Hash, "line %d", i+1)
+		check.Equal(t, one.text, lines[i].Text, "line %d", i+1)
+		check.Equal(t, i+1, lines[i].Line, "line %d", i+1)
+		check.Equal(t, one.original, lines[i].OriginalLine, "line %d", i+1)
+	}
+	check.Equal(t, "Main", lines[0].Commit.Subject())
+
+	_, err = h.repo().Blame("missing.txt")
+	check.Error(t, err)
+}
+
+func TestStatus(t *testing.T) {
+	h := newHistoryRepo(t)
+	h.write("a.txt", "a\n")
+	h.write("dir/c.txt", "c\n")
+	h.write("gone.txt", "gone\n")
+	h.commit("Initial")
+	h.write("a.txt", "changed\n")
+	h.git("mv", "dir/c.txt", "dir/d.txt")
+	h.git("rm", "-q", "gone.txt")
+	h.write("new file.txt", "new\n")
+	h.git("add", "new file.txt")
+	h.write("new file.txt", "newer\n")
+	h.write("untracked/x.txt", "x\n")
+
+	repo := h.repo()
+	status, err := repo.Status()
+	check.NoError(t, err)
+	check.Equal(t, []git.FileStatus{
+		{Path: "a.txt", Staged: git.Unmodified, Unstaged: git.Modified},
+		{Path: "dir/d.txt", OrigPath: "dir/c.txt", Staged: git.Renamed, Unstaged: git.Unmodified},
+		{Path: "gone.txt", Staged: git.Deleted, Unstaged: git.Unmodified},
+		{Path: "new file.txt", Staged: git.Added, Unstaged: git.Modified},
+		{Path: "untracked/x.txt", Staged: git.Untracked, Unstaged: git.Untracked},
+	}, status)
+	check.True(t, repo.HasChanges())
+}
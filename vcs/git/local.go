@@ -0,0 +1,339 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// local provides direct, read-only access to the files of a local repository, so that it can be inspected without the
+// git binary.
+type local struct {
+	gitDir    string
+	commonDir string
+	config    map[string]string
+	objects   *objectStore
+	commits   map[string]*Commit
+	hashSize  int
+}
+
+// treeEntry is a single entry within a tree object.
+type treeEntry struct {
+	name string
+	hash string
+	mode uint32
+}
+
+// Modes used by tree entries.
+const (
+	treeMode      = 0o040000
+	symlinkMode   = 0o120000
+	submoduleMode = 0o160000
+	typeMask      = 0o170000
+)
+
+// openLocal opens the repository whose working tree is at dir. The .git entry may be a directory or, as is the case
+// for linked worktrees and submodules, a file pointing to the real git directory.
+func openLocal(dir string) (*local, error) {
+	gitDir := filepath.Join(dir, ".git")
+	fi, err := os.Stat(gitDir)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if !fi.IsDir() {
+		var data []byte
+		if data, err = os.ReadFile(gitDir); err != nil {
+			return nil, errs.Wrap(err)
+		}
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+		if !ok {
+			return nil, errs.Newf("%s does not refer to a git directory", gitDir)
+		}
+		gitDir = relativeTo(dir, strings.TrimSpace(target))
+	}
+	commonDir := gitDir
+	if data, readErr := os.ReadFile(filepath.Join(gitDir, "commondir")); readErr == nil {
+		commonDir = relativeTo(gitDir, strings.TrimSpace(string(data)))
+	}
+	l := &local{
+		gitDir:    gitDir,
+		commonDir: commonDir,
+		commits:   make(map[string]*Commit),
+		hashSize:  20,
+	}
+	if l.config, err = readConfig(filepath.Join(commonDir, "config")); err != nil {
+		return nil, err
+	}
+	switch format := strings.ToLower(l.config["extensions.objectformat"]); format {
+	case "", "sha1":
+	case "sha256":
+		l.hashSize = 32
+	default:
+		return nil, errs.Newf("unsupported object format: %s", format)
+	}
+	return l, nil
+}
+
+func (l *local) close() {
+	if l.objects != nil {
+		l.objects.close()
+		l.objects = nil
+	}
+}
+
+func (l *local) store() (*objectStore, error) {
+	if l.objects == nil {
+		var err error
+		if l.objects, err = openObjectStore(filepath.Join(l.commonDir, "objects"), l.hashSize); err != nil {
+			return nil, err
+		}
+	}
+	return l.objects, nil
+}
+
+// readObject returns the type and content of the object with the given hash.
+func (l *local) readObject(hash string) (objectType, []byte, error) {
+	store, err := l.store()
+	if err != nil {
+		return 0, nil, err
+	}
+	return store.read(hash)
+}
+
+// peel follows tag objects until it reaches an object that is not a tag, returning that object's hash and type.
+func (l *local) peel(hash string) (string, objectType, error) {
+	for range maxTagDepth {
+		kind, data, err := l.readObject(hash)
+		if err != nil {
+			return "", 0, err
+		}
+		if kind != tagObject {
+			return hash, kind, nil
+		}
+		var t *tag
+		if t, err = parseTag(data); err != nil {
+			return "", 0, errs.NewWithCausef(err, "unable to parse tag %s", hash)
+		}
+		hash = t.target
+	}
+	return "", 0, errs.Newf("too many levels of tags at %s", hash)
+}
+
+// commit returns the commit with the given hash. Tags are peeled to the commit they refer to.
+func (l *local) commit(hash string) (*Commit, error) {
+	if c, ok := l.commits[hash]; ok {
+		return c, nil
+	}
+	hash, kind, err := l.peel(hash)
+	if err != nil {
+		return nil, err
+	}
+	if kind != commitObject {
+		return nil, errs.Newf("%s is a %s, not a commit", hash, kind)
+	}
+	var data []byte
+	if _, data, err = l.readObject(hash); err != nil {
+		return nil, err
+	}
+	var c *Commit
+	if c, err = parseCommit(hash, data); err != nil {
+		return nil, errs.NewWithCausef(err, "unable to parse commit %s", hash)
+	}
+	l.commits[hash] = c
+	return c, nil
+}
+
+// tree returns the entries of the tree with the given hash.
+func (l *local) tree(hash string) ([]treeEntry, error) {
+	kind, data, err := l.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if kind != treeObject {
+		return nil, errs.Newf("%s is a %s, not a tree", hash, kind)
+	}
+	var entries []treeEntry
+	for len(data) != 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if space == -1 || nul < space || len(data) < nul+1+l.hashSize {
+			return nil, errs.Newf("tree %s is malformed", hash)
+		}
+		var mode uint64
+		if mode, err = strconv.ParseUint(string(data[:space]), 8, 32); err != nil {
+			return nil, errs.Newf("tree %s is malformed", hash)
+		}
+		entries = append(entries, treeEntry{
+			name: string(data[space+1 : nul]),
+			hash: hex.EncodeToString(data[nul+1 : nul+1+l.hashSize]),
+			mode: uint32(mode),
+		})
+		data = data[nul+1+l.hashSize:]
+	}
+	return entries, nil
+}
+
+// blob returns the content of the blob with the given hash.
+func (l *local) blob(hash string) ([]byte, error) {
+	kind, data, err := l.readObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if kind != blobObject {
+		return nil, errs.Newf("%s is a %s, not a blob", hash, kind)
+	}
+	return data, nil
+}
+
+// entryAt returns the tree entry at the slash-separated path within the tree. Returns false if no such entry exists.
+func (l *local) entryAt(treeHash, path string) (treeEntry, bool, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		entries, err := l.tree(treeHash)
+		if err != nil {
+			return treeEntry{}, false, err
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.name != part {
+				continue
+			}
+			if i == len(parts)-1 {
+				return entry, true, nil
+			}
+			if entry.mode&typeMask != treeMode {
+				return treeEntry{}, false, nil
+			}
+			treeHash = entry.hash
+			found = true
+			break
+		}
+		if !found {
+			break
+		}
+	}
+	return treeEntry{}, false, nil
+}
+
+func (l *local) isHash(s string) bool {
+	if len(s) != l.hashSize*2 {
+		return false
+	}
+	for _, ch := range s {
+		if (ch < '0' || ch > '9') && (ch < 'a' || ch > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func relativeTo(base, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
+
+// readConfig reads a git configuration file. Keys are of the form "section.key" or "section.subsection.key", with the
+// section and key names lowercased, since git treats them case-insensitively. A missing file produces an empty
+// configuration.
+func readConfig(path string) (map[string]string, error) {
+	cfg := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, errs.Wrap(err)
+	}
+	section := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end == -1 {
+				return nil, errs.Newf("%s:%d: invalid section header", path, i+1)
+			}
+			header := line[1:end]
+			if name, sub, hasSub := strings.Cut(header, `"`); hasSub {
+				sub = strings.TrimSuffix(sub, `"`)
+				sub = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(sub)
+				section = strings.ToLower(strings.TrimSpace(name)) + "." + sub
+			} else {
+				section = strings.ToLower(header)
+			}
+			if line = strings.TrimSpace(line[end+1:]); line == "" {
+				continue
+			}
+		}
+		key, value, hasValue := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if hasValue {
+			value = configValue(value)
+		} else {
+			value = "true"
+		}
+		cfg[section+"."+key] = value
+	}
+	return cfg, nil
+}
+
+// configValue removes the quoting, escapes and trailing comments from a configuration value.
+func configValue(raw string) string {
+	raw = strings.TrimLeft(raw, " \t")
+	var buffer strings.Builder
+	inQuotes := false
+	pending := ""
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+		switch {
+		case ch == '"':
+			inQuotes = !inQuotes
+			buffer.WriteString(pending)
+			pending = ""
+		case ch == '\\' && i+1 < len(raw):
+			i++
+			buffer.WriteString(pending)
+			pending = ""
+			switch raw[i] {
+			case 'n':
+				buffer.WriteByte('\n')
+			case 't':
+				buffer.WriteByte('\t')
+			case 'b':
+				buffer.WriteByte('\b')
+			default:
+				buffer.WriteByte(raw[i])
+			}
+		case !inQuotes && (ch == '#' || ch == ';'):
+			return buffer.String()
+		case !inQuotes && (ch == ' ' || ch == '\t'):
+			// Whitespace outside of quotes is kept only if something other than whitespace follows it.
+			pending += string(ch)
+		default:
+			buffer.WriteString(pending)
+			pending = ""
+			buffer.WriteByte(ch)
+		}
+	}
+	return buffer.String()
+}
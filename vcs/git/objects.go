@@ -0,0 +1,324 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio"
+)
+
+const (
+	maxTagDepth       = 16
+	maxSymrefDepth    = 10
+	maxAlternateDepth = 5
+)
+
+type objectType int8
+
+// The object types, using the values they have within pack files.
+const (
+	commitObject   objectType = 1
+	treeObject     objectType = 2
+	blobObject     objectType = 3
+	tagObject      objectType = 4
+	ofsDeltaObject objectType = 6
+	refDeltaObject objectType = 7
+)
+
+var objectTypeNames = map[objectType]string{
+	commitObject: "commit",
+	treeObject:   "tree",
+	blobObject:   "blob",
+	tagObject:    "tag",
+}
+
+func (t objectType) String() string {
+	if name, ok := objectTypeNames[t]; ok {
+		return name
+	}
+	return "object type " + strconv.Itoa(int(t))
+}
+
+type tag struct {
+	target     string
+	targetType string
+	name       string
+	tagger     Signature
+	message    string
+}
+
+// objectStore reads objects from a repository's object directory, its pack files, and any alternate object
+// directories.
+type objectStore struct {
+	dirs     []string
+	packs    []*pack
+	hashSize int
+}
+
+func openObjectStore(dir string, hashSize int) (*objectStore, error) {
+	s := &objectStore{hashSize: hashSize}
+	if err := s.addDir(dir, 0); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *objectStore) addDir(dir string, depth int) error {
+	s.dirs = append(s.dirs, dir)
+	entries, err := os.ReadDir(filepath.Join(dir, "pack"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errs.Wrap(err)
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); !entry.IsDir() && strings.HasSuffix(name, ".idx") {
+			var p *pack
+			if p, err = openPack(filepath.Join(dir, "pack", name), s.hashSize); err != nil {
+				return err
+			}
+			s.packs = append(s.packs, p)
+		}
+	}
+	if depth < maxAlternateDepth {
+		var data []byte
+		if data, err = os.ReadFile(filepath.Join(dir, "info", "alternates")); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if line = strings.TrimSpace(line); line != "" && line[0] != '#' {
+					if err = s.addDir(relativeTo(dir, line), depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *objectStore) close() {
+	for _, p := range s.packs {
+		xio.CloseIgnoringErrors(p.file)
+	}
+	s.packs = nil
+}
+
+// read returns the type and content of the object with the given hash.
+func (s *objectStore) read(hash string) (objectType, []byte, error) {
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != s.hashSize {
+		return 0, nil, errs.Newf("invalid object id: %s", hash)
+	}
+	for _, p := range s.packs {
+		if offset, ok := p.find(raw); ok {
+			return p.read(offset, s)
+		}
+	}
+	for _, dir := range s.dirs {
+		var data []byte
+		if data, err = os.ReadFile(filepath.Join(dir, hash[:2], hash[2:])); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return 0, nil, errs.Wrap(err)
+		}
+		return parseLooseObject(hash, data)
+	}
+	return 0, nil, errs.Newf("object %s does not exist", hash)
+}
+
+// expand returns the full hash of the object whose hash starts with the prefix, which must identify a single object.
+func (s *objectStore) expand(prefix string) (string, error) {
+	found := ""
+	add := func(hash string) error {
+		if found != "" && found != hash {
+			return errs.Newf("%s is ambiguous", prefix)
+		}
+		found = hash
+		return nil
+	}
+	lower := prefix
+	if len(lower)%2 != 0 {
+		lower += "0"
+	}
+	raw, err := hex.DecodeString(lower)
+	if err != nil {
+		return "", errs.Newf("invalid object id: %s", prefix)
+	}
+	for _, p := range s.packs {
+		for i := p.search(raw); i < len(p.offsets); i++ {
+			hash := hex.EncodeToString(p.hashes[i*p.hashSize : (i+1)*p.hashSize])
+			if !strings.HasPrefix(hash, prefix) {
+				break
+			}
+			if err = add(hash); err != nil {
+				return "", err
+			}
+		}
+	}
+	for _, dir := range s.dirs {
+		var entries []os.DirEntry
+		if entries, err = os.ReadDir(filepath.Join(dir, prefix[:2])); err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if hash := prefix[:2] + entry.Name(); len(hash) == s.hashSize*2 && strings.HasPrefix(hash, prefix) {
+				if err = add(hash); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	if found == "" {
+		return "", errs.Newf("object %s does not exist", prefix)
+	}
+	return found, nil
+}
+
+func parseLooseObject(hash string, data []byte) (objectType, []byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, errs.NewWithCausef(err, "unable to read object %s", hash)
+	}
+	defer xio.CloseIgnoringErrors(zr)
+	if data, err = io.ReadAll(bufio.NewReader(zr)); err != nil {
+		return 0, nil, errs.NewWithCausef(err, "unable to read object %s", hash)
+	}
+	header, content, found := bytes.Cut(data, []byte{0})
+	if !found {
+		return 0, nil, errs.Newf("object %s has an invalid header", hash)
+	}
+	name, sizeText, _ := strings.Cut(string(header), " ")
+	var kind objectType
+	for t, typeName := range objectTypeNames {
+		if typeName == name {
+			kind = t
+			break
+		}
+	}
+	if size, sizeErr := strconv.Atoi(sizeText); kind == 0 || sizeErr != nil || size != len(content) {
+		return 0, nil, errs.Newf("object %s has an invalid header", hash)
+	}
+	return kind, content, nil
+}
+
+// headers splits the header section of a commit or tag into its fields, returning them along with the message that
+// follows. Continuation lines, such as those of a multi-line signature, are joined to the field they belong to.
+func headers(data []byte) (fields [][2]string, message string) {
+	header, msg, _ := bytes.Cut(data, []byte("\n\n"))
+	for _, line := range strings.Split(string(header), "\n") {
+		if strings.HasPrefix(line, " ") && len(fields) != 0 {
+			fields[len(fields)-1][1] += "\n" + line[1:]
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		fields = append(fields, [2]string{key, value})
+	}
+	return fields, string(msg)
+}
+
+func parseCommit(hash string, data []byte) (*Commit, error) {
+	fields, message := headers(data)
+	c := &Commit{
+		Hash:    hash,
+		Message: message,
+	}
+	var err error
+	for _, field := range fields {
+		switch field[0] {
+		case "tree":
+			c.Tree = field[1]
+		case "parent":
+			c.Parents = append(c.Parents, field[1])
+		case "author":
+			c.Author, err = parseSignature(field[1])
+		case "committer":
+			c.Committer, err = parseSignature(field[1])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.Tree == "" {
+		return nil, errs.New("missing tree")
+	}
+	return c, nil
+}
+
+func parseTag(data []byte) (*tag, error) {
+	fields, message := headers(data)
+	t := &tag{message: message}
+	var err error
+	for _, field := range fields {
+		switch field[0] {
+		case "object":
+			t.target = field[1]
+		case "type":
+			t.targetType = field[1]
+		case "tag":
+			t.name = field[1]
+		case "tagger":
+			t.tagger, err = parseSignature(field[1])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.target == "" {
+		return nil, errs.New("missing object")
+	}
+	return t, nil
+}
+
+// parseSignature parses text of the form "Name <email> 1700000000 +0100".
+func parseSignature(text string) (Signature, error) {
+	start := strings.IndexByte(text, '<')
+	end := strings.LastIndexByte(text, '>')
+	if start == -1 || end < start {
+		return Signature{}, errs.Newf("invalid signature: %s", text)
+	}
+	sig := Signature{
+		Name:  strings.TrimSpace(text[:start]),
+		Email: text[start+1 : end],
+	}
+	parts := strings.Fields(text[end+1:])
+	if len(parts) != 2 || len(parts[1]) != 5 {
+		return Signature{}, errs.Newf("invalid signature: %s", text)
+	}
+	seconds, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Signature{}, errs.Newf("invalid signature: %s", text)
+	}
+	var hours, minutes int
+	hours, err = strconv.Atoi(parts[1][1:3])
+	if err == nil {
+		minutes, err = strconv.Atoi(parts[1][3:])
+	}
+	if err != nil || (parts[1][0] != '+' && parts[1][0] != '-') {
+		return Signature{}, errs.Newf("invalid signature: %s", text)
+	}
+	offset := hours*3600 + minutes*60
+	if parts[1][0] == '-' {
+		offset = -offset
+	}
+	sig.When = time.Unix(seconds, 0).In(time.FixedZone("", offset))
+	return sig, nil
+}
@@ -0,0 +1,299 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio"
+)
+
+const (
+	fanoutSize      = 256 * 4
+	maxDeltaDepth   = 1000
+	largeOffsetFlag = 0x80000000
+	// initialBufferSize limits the space reserved up front for an object, since its recorded size can't be trusted.
+	initialBufferSize = 1 << 20
+)
+
+var packIndexMagic = []byte{0xff, 't', 'O', 'c'}
+
+// pack provides access to the objects within a pack file, located by way of its index.
+type pack struct {
+	file     *os.File
+	hashes   []byte
+	offsets  []int64
+	hashSize int
+}
+
+// openPack loads the pack index at idxPath and opens the pack file that accompanies it. Both version 1 and version 2
+// indexes are supported.
+func openPack(idxPath string, hashSize int) (*pack, error) {
+	data, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	p := &pack{hashSize: hashSize}
+	if bytes.HasPrefix(data, packIndexMagic) {
+		err = p.loadIndexV2(data)
+	} else {
+		err = p.loadIndexV1(data)
+	}
+	if err != nil {
+		return nil, errs.NewWithCause(idxPath, err)
+	}
+	if p.file, err = os.Open(strings.TrimSuffix(idxPath, ".idx") + ".pack"); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	return p, nil
+}
+
+func (p *pack) loadIndexV1(data []byte) error {
+	if len(data) < fanoutSize {
+		return errs.New("pack index is truncated")
+	}
+	count := int(binary.BigEndian.Uint32(data[fanoutSize-4:]))
+	entrySize := 4 + p.hashSize
+	entries := data[fanoutSize:]
+	if len(entries) < count*entrySize {
+		return errs.New("pack index is truncated")
+	}
+	p.hashes = make([]byte, 0, count*p.hashSize)
+	p.offsets = make([]int64, count)
+	for i := range p.offsets {
+		entry := entries[i*entrySize : (i+1)*entrySize]
+		p.offsets[i] = int64(binary.BigEndian.Uint32(entry))
+		p.hashes = append(p.hashes, entry[4:]...)
+	}
+	return nil
+}
+
+func (p *pack) loadIndexV2(data []byte) error {
+	const headerSize = 8
+	if len(data) < headerSize+fanoutSize {
+		return errs.New("pack index is truncated")
+	}
+	if version := binary.BigEndian.Uint32(data[4:]); version != 2 {
+		return errs.Newf("unsupported pack index version %d", version)
+	}
+	pos := headerSize + fanoutSize
+	count := int(binary.BigEndian.Uint32(data[pos-4:]))
+	if len(data) < pos+count*(p.hashSize+8) {
+		return errs.New("pack index is truncated")
+	}
+	p.hashes = data[pos : pos+count*p.hashSize]
+	pos += count * p.hashSize
+	pos += count * 4 // Skip the CRC values
+	small := data[pos : pos+count*4]
+	large := data[pos+count*4:]
+	p.offsets = make([]int64, count)
+	for i := range p.offsets {
+		offset := binary.BigEndian.Uint32(small[i*4:])
+		if offset&largeOffsetFlag == 0 {
+			p.offsets[i] = int64(offset)
+			continue
+		}
+		j := int(offset &^ largeOffsetFlag)
+		if len(large) < (j+1)*8 {
+			return errs.New("pack index is truncated")
+		}
+		p.offsets[i] = int64(binary.BigEndian.Uint64(large[j*8:]))
+	}
+	return nil
+}
+
+// find returns the offset within the pack file of the object with the given hash.
+func (p *pack) find(hash []byte) (int64, bool) {
+	if i := p.search(hash); i < len(p.offsets) && bytes.Equal(p.hashes[i*p.hashSize:(i+1)*p.hashSize], hash) {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// search returns the index of the first object whose hash is not less than the given hash.
+func (p *pack) search(hash []byte) int {
+	return sort.Search(len(p.offsets), func(i int) bool {
+		return bytes.Compare(p.hashes[i*p.hashSize:(i+1)*p.hashSize], hash) >= 0
+	})
+}
+
+// read returns the type and content of the object at the offset within the pack file, applying deltas as needed.
+func (p *pack) read(offset int64, s *objectStore) (objectType, []byte, error) {
+	return p.readWithDepth(offset, s, 0)
+}
+
+func (p *pack) readWithDepth(offset int64, s *objectStore, depth int) (kind objectType, data []byte, err error) {
+	if depth > maxDeltaDepth {
+		return 0, nil, errs.New("delta chain is too long")
+	}
+	r := bufio.NewReader(io.NewSectionReader(p.file, offset, math.MaxInt64-offset))
+	var b byte
+	if b, err = r.ReadByte(); err != nil {
+		return 0, nil, errs.Wrap(err)
+	}
+	kind = objectType((b >> 4) & 7)
+	size := uint64(b & 0x0f)
+	for shift := 4; b&0x80 != 0; shift += 7 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, nil, errs.Wrap(err)
+		}
+		size |= uint64(b&0x7f) << shift
+	}
+	var baseKind objectType
+	var base []byte
+	switch kind {
+	case commitObject, treeObject, blobObject, tagObject:
+	case ofsDeltaObject:
+		if b, err = r.ReadByte(); err != nil {
+			return 0, nil, errs.Wrap(err)
+		}
+		distance := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = r.ReadByte(); err != nil {
+				return 0, nil, errs.Wrap(err)
+			}
+			distance = ((distance + 1) << 7) | int64(b&0x7f)
+		}
+		if distance <= 0 || distance > offset {
+			return 0, nil, errs.Newf("invalid delta base offset at %d", offset)
+		}
+		if baseKind, base, err = p.readWithDepth(offset-distance, s, depth+1); err != nil {
+			return 0, nil, err
+		}
+	case refDeltaObject:
+		hash := make([]byte, p.hashSize)
+		if _, err = io.ReadFull(r, hash); err != nil {
+			return 0, nil, errs.Wrap(err)
+		}
+		if baseOffset, ok := p.find(hash); ok {
+			baseKind, base, err = p.readWithDepth(baseOffset, s, depth+1)
+		} else {
+			baseKind, base, err = s.read(hex.EncodeToString(hash))
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	default:
+		return 0, nil, errs.Newf("invalid object type %d at %d", kind, offset)
+	}
+	if data, err = inflate(r, size); err != nil {
+		return 0, nil, err
+	}
+	if base != nil {
+		if data, err = applyDelta(base, data); err != nil {
+			return 0, nil, err
+		}
+		kind = baseKind
+	}
+	return kind, data, nil
+}
+
+// inflate decompresses an object of the given size. The size comes from the pack, so a corrupt pack may claim far more
+// than it holds; rather than being allocated up front, the buffer only grows as the data actually arrives.
+func inflate(r io.Reader, size uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer xio.CloseIgnoringErrors(zr)
+	var buffer bytes.Buffer
+	buffer.Grow(int(min(size, initialBufferSize)))
+	if _, err = io.Copy(&buffer, io.LimitReader(zr, int64(min(size, math.MaxInt64)))); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if uint64(buffer.Len()) != size {
+		return nil, errs.New("object is smaller than the size recorded for it")
+	}
+	return buffer.Bytes(), nil
+}
+
+// applyDelta reconstructs an object from its base and a delta.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, n := deltaHeaderSize(delta)
+	if n == 0 || baseSize != uint64(len(base)) {
+		return nil, errs.New("delta does not match its base")
+	}
+	delta = delta[n:]
+	var resultSize uint64
+	if resultSize, n = deltaHeaderSize(delta); n == 0 {
+		return nil, errs.New("invalid delta")
+	}
+	delta = delta[n:]
+	result := make([]byte, 0, min(resultSize, initialBufferSize))
+	for len(delta) != 0 {
+		if uint64(len(result)) > resultSize {
+			return nil, errs.New("delta produced the wrong size")
+		}
+		cmd := delta[0]
+		delta = delta[1:]
+		switch {
+		case cmd&0x80 != 0:
+			var offset, size uint64
+			for i := 0; i < 7; i++ {
+				if cmd&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errs.New("invalid delta")
+				}
+				if i < 4 {
+					offset |= uint64(delta[0]) << (8 * i)
+				} else {
+					size |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, errs.New("invalid delta")
+			}
+			result = append(result, base[offset:offset+size]...)
+		case cmd != 0:
+			if int(cmd) > len(delta) {
+				return nil, errs.New("invalid delta")
+			}
+			result = append(result, delta[:cmd]...)
+			delta = delta[cmd:]
+		default:
+			return nil, errs.New("invalid delta")
+		}
+	}
+	if uint64(len(result)) != resultSize {
+		return nil, errs.New("delta produced the wrong size")
+	}
+	return result, nil
+}
+
+// deltaHeaderSize decodes one of the sizes at the start of a delta, returning it and the number of bytes it occupied,
+// or zero bytes if it is invalid.
+func deltaHeaderSize(data []byte) (size uint64, n int) {
+	for i, b := range data {
+		if i > 9 {
+			break
+		}
+		size |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return size, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,178 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// ref is a named reference to an object.
+type ref struct {
+	name string
+	hash string
+	// peeled holds the hash of the object an annotated tag ultimately refers to, when the packed-refs file records it.
+	peeled string
+}
+
+// packedRefs returns the refs stored in the packed-refs file, keyed by name.
+func (l *local) packedRefs() (map[string]ref, error) {
+	refs := make(map[string]ref)
+	data, err := os.ReadFile(filepath.Join(l.commonDir, "packed-refs"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return refs, nil
+		}
+		return nil, errs.Wrap(err)
+	}
+	last := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line[0] == '#':
+		case line[0] == '^':
+			if r, ok := refs[last]; ok && l.isHash(line[1:]) {
+				r.peeled = line[1:]
+				refs[last] = r
+			}
+		default:
+			hash, name, found := strings.Cut(line, " ")
+			if !found || !l.isHash(hash) {
+				return nil, errs.Newf("invalid packed-refs line: %s", line)
+			}
+			refs[name] = ref{name: name, hash: hash}
+			last = name
+		}
+	}
+	return refs, nil
+}
+
+// readLooseRef reads a ref stored in its own file, returning either the hash it holds or, for a symbolic ref, the name
+// of the ref it points to.
+func (l *local) readLooseRef(name string) (hash, target string, err error) {
+	dir := l.commonDir
+	if !strings.HasPrefix(name, "refs/") {
+		// Pseudo-refs, such as HEAD, belong to the individual worktree.
+		dir = l.gitDir
+	}
+	var data []byte
+	if data, err = os.ReadFile(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+		return "", "", errs.Wrap(err)
+	}
+	content := strings.TrimSpace(string(data))
+	if t, ok := strings.CutPrefix(content, "ref:"); ok {
+		return "", strings.TrimSpace(t), nil
+	}
+	if !l.isHash(content) {
+		return "", "", errs.Newf("invalid ref %s: %s", name, content)
+	}
+	return content, "", nil
+}
+
+// resolveRef follows the named ref, and any symbolic refs it leads to, returning the hash it ultimately refers to.
+func (l *local) resolveRef(name string) (string, error) {
+	var packed map[string]ref
+	for range maxSymrefDepth {
+		hash, target, err := l.readLooseRef(name)
+		if err == nil {
+			if target == "" {
+				return hash, nil
+			}
+			name = target
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if packed == nil {
+			if packed, err = l.packedRefs(); err != nil {
+				return "", err
+			}
+		}
+		if r, ok := packed[name]; ok {
+			return r.hash, nil
+		}
+		return "", errs.Newf("ref %s does not exist", name)
+	}
+	return "", errs.Newf("too many levels of symbolic refs at %s", name)
+}
+
+// headTarget returns the name of the ref that HEAD points to, or an empty string if HEAD is detached.
+func (l *local) headTarget() (string, error) {
+	_, target, err := l.readLooseRef("HEAD")
+	return target, err
+}
+
+// refs returns the refs whose names start with the prefix, sorted by name. Symbolic refs are resolved to the hash they
+// ultimately refer to, while those that cannot be resolved are omitted.
+func (l *local) refs(prefix string) ([]ref, error) {
+	packed, err := l.packedRefs()
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]ref)
+	for name, r := range packed {
+		if strings.HasPrefix(name, prefix) {
+			found[name] = r
+		}
+	}
+	root := filepath.Join(l.commonDir, "refs")
+	if err = filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if path == root && errors.Is(walkErr, fs.ErrNotExist) {
+				return nil
+			}
+			return walkErr
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, relErr := filepath.Rel(l.commonDir, path)
+		if relErr != nil {
+			return relErr
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		hash, target, readErr := l.readLooseRef(name)
+		if readErr == nil && target != "" {
+			hash, readErr = l.resolveRef(target)
+		}
+		if readErr == nil {
+			// A loose ref takes precedence over a packed one of the same name.
+			found[name] = ref{name: name, hash: hash}
+		}
+		return nil
+	}); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	list := make([]ref, 0, len(found))
+	for _, r := range found {
+		list = append(list, r)
+	}
+	slices.SortFunc(list, func(a, b ref) int { return strings.Compare(a.name, b.name) })
+	return list, nil
+}
+
+// peeledHash returns the hash of the object the ref ultimately refers to, following annotated tags.
+func (l *local) peeledHash(r ref) (string, error) {
+	if r.peeled != "" {
+		return r.peeled, nil
+	}
+	hash, _, err := l.peel(r.hash)
+	return hash, err
+}
@@ -0,0 +1,279 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/i18n"
+	"github.com/ddkwork/toolbox/vcs/semver"
+)
+
+var conventionalSubjectRegex = regexp.MustCompile(`^([a-zA-Z]+)(?:\(([^()]*)\))?(!)?:\s+(.+)$`)
+
+// ReleaseTag is a tag whose name is a semantic version, such as "v1.2.3" or "1.2.3".
+type ReleaseTag struct {
+	// Name is the name of the tag.
+	Name string
+	// Commit is the id of the commit the tag refers to.
+	Commit  string
+	Version semver.Version
+}
+
+// ConventionalCommit holds the parts of a commit message that follows the Conventional Commits specification, as
+// described at https://www.conventionalcommits.org. For example, "feat(parser)!: drop support for tabs".
+type ConventionalCommit struct {
+	// Type is the lowercased type of the change, such as "feat" or "fix".
+	Type string
+	// Scope is the optional scope of the change, such as "parser".
+	Scope       string
+	Description string
+	// Breaking is true if the subject is marked with a '!' or the message has a "BREAKING CHANGE:" footer.
+	Breaking bool
+}
+
+// ParseConventionalCommit parses a commit message. Returns false if the message does not follow the Conventional
+// Commits specification.
+func ParseConventionalCommit(message string) (ConventionalCommit, bool) {
+	subject, body, _ := strings.Cut(message, "\n")
+	parts := conventionalSubjectRegex.FindStringSubmatch(strings.TrimSpace(subject))
+	if parts == nil {
+		return ConventionalCommit{}, false
+	}
+	cc := ConventionalCommit{
+		Type:        strings.ToLower(parts[1]),
+		Scope:       strings.TrimSpace(parts[2]),
+		Description: strings.TrimSpace(parts[4]),
+		Breaking:    parts[3] != "",
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "BREAKING CHANGE:") || strings.HasPrefix(line, "BREAKING-CHANGE:") {
+			cc.Breaking = true
+			break
+		}
+	}
+	return cc, true
+}
+
+// ReleaseTags returns the tags that are named for a semantic version and refer to a commit reachable from HEAD,
+// highest version first. Prereleases are included.
+func (repo *Repo) ReleaseTags() ([]ReleaseTag, error) {
+	l, err := openLocal(repo.local)
+	if err != nil {
+		return nil, errs.NewWithCause(i18n.Text("Unable to retrieve release tags"), err)
+	}
+	defer l.close()
+	var tags []ReleaseTag
+	if tags, err = l.releaseTags(true); err != nil {
+		return nil, errs.NewWithCause(i18n.Text("Unable to retrieve release tags"), err)
+	}
+	return tags, nil
+}
+
+// LatestRelease returns the release tag with the highest version that refers to a commit reachable from HEAD,
+// ignoring prereleases. Returns false if there is no such tag.
+func (repo *Repo) LatestRelease() (ReleaseTag, bool, error) {
+	l, err := openLocal(repo.local)
+	if err != nil {
+		return ReleaseTag{}, false, errs.NewWithCause(i18n.Text("Unable to retrieve release tags"), err)
+	}
+	defer l.close()
+	var tags []ReleaseTag
+	if tags, err = l.releaseTags(false); err != nil {
+		return ReleaseTag{}, false, errs.NewWithCause(i18n.Text("Unable to retrieve release tags"), err)
+	}
+	if len(tags) == 0 {
+		return ReleaseTag{}, false, nil
+	}
+	return tags[0], true, nil
+}
+
+// NextVersion returns the version the next release should have, based upon the conventional commit messages of the
+// commits made since the latest release. A breaking change bumps the major version, or the minor version while the
+// major version is 0. A "feat" commit bumps the minor version and any other commit bumps the patch version. If HEAD is
+// the latest release, its version is returned. If there has been no release, the commits are measured against 0.0.0.
+//
+// The result is suitable for setting cmdline.AppVersion at build time, for example with
+// -ldflags "-X github.com/ddkwork/toolbox/cmdline.AppVersion=1.2.3".
+func (repo *Repo) NextVersion() (semver.Version, error) {
+	l, err := openLocal(repo.local)
+	if err != nil {
+		return semver.Version{}, errs.NewWithCause(i18n.Text("Unable to determine the next version"), err)
+	}
+	defer l.close()
+	var tags []ReleaseTag
+	if tags, err = l.releaseTags(false); err != nil {
+		return semver.Version{}, errs.NewWithCause(i18n.Text("Unable to determine the next version"), err)
+	}
+	rangeSpec := "HEAD"
+	var current semver.Version
+	if len(tags) != 0 {
+		rangeSpec = tags[0].Commit + "..HEAD"
+		current = tags[0].Version
+	}
+	var commits []*Commit
+	if commits, err = l.log(rangeSpec); err != nil {
+		return semver.Version{}, errs.NewWithCause(i18n.Text("Unable to determine the next version"), err)
+	}
+	return nextVersion(current, commits), nil
+}
+
+func nextVersion(current semver.Version, commits []*Commit) semver.Version {
+	if len(commits) == 0 {
+		return current
+	}
+	var breaking, feature bool
+	for _, c := range commits {
+		if cc, ok := ParseConventionalCommit(c.Message); ok {
+			breaking = breaking || cc.Breaking
+			feature = feature || cc.Type == "feat"
+		}
+	}
+	switch {
+	case breaking && current.Major != 0:
+		return current.NextMajor()
+	case breaking || feature:
+		return current.NextMinor()
+	default:
+		return current.NextPatch()
+	}
+}
+
+// Changelog returns a Markdown changelog covering the history of HEAD. It has a section for each release, newest first,
+// preceded by an "Unreleased" section if commits have been made since the latest release. Within each section, the
+// changes are grouped by the kind of conventional commit that made them. Merge commits are omitted.
+func (repo *Repo) Changelog() (string, error) {
+	l, err := openLocal(repo.local)
+	if err != nil {
+		return "", errs.NewWithCause(i18n.Text("Unable to generate changelog"), err)
+	}
+	defer l.close()
+	var text string
+	if text, err = l.changelog(); err != nil {
+		return "", errs.NewWithCause(i18n.Text("Unable to generate changelog"), err)
+	}
+	return text, nil
+}
+
+func (l *local) changelog() (string, error) {
+	tags, err := l.releaseTags(false)
+	if err != nil {
+		return "", err
+	}
+	var buffer strings.Builder
+	buffer.WriteString("# ")
+	buffer.WriteString(i18n.Text("Changelog"))
+	buffer.WriteString("\n")
+	rangeSpec := "HEAD"
+	if len(tags) != 0 {
+		rangeSpec = tags[0].Commit + "..HEAD"
+	}
+	var commits []*Commit
+	if commits, err = l.log(rangeSpec); err != nil {
+		return "", err
+	}
+	if len(commits) != 0 {
+		writeChangelogSection(&buffer, i18n.Text("Unreleased"), commits)
+	}
+	for i, tag := range tags {
+		rangeSpec = tag.Commit
+		if i+1 < len(tags) {
+			rangeSpec = tags[i+1].Commit + ".." + tag.Commit
+		}
+		if commits, err = l.log(rangeSpec); err != nil {
+			return "", err
+		}
+		var c *Commit
+		if c, err = l.commit(tag.Commit); err != nil {
+			return "", err
+		}
+		writeChangelogSection(&buffer, fmt.Sprintf("%s - %s", tag.Version, c.Committer.When.Format("2006-01-02")),
+			commits)
+	}
+	return buffer.String(), nil
+}
+
+func writeChangelogSection(buffer *strings.Builder, title string, commits []*Commit) {
+	groups := []struct {
+		title   string
+		entries []string
+	}{
+		{title: i18n.Text("Breaking Changes")},
+		{title: i18n.Text("Features")},
+		{title: i18n.Text("Bug Fixes")},
+		{title: i18n.Text("Other Changes")},
+	}
+	for _, c := range commits {
+		if len(c.Parents) > 1 {
+			continue
+		}
+		group := len(groups) - 1
+		entry := c.Subject()
+		if cc, ok := ParseConventionalCommit(c.Message); ok {
+			switch {
+			case cc.Breaking:
+				group = 0
+			case cc.Type == "feat":
+				group = 1
+			case cc.Type == "fix":
+				group = 2
+			}
+			entry = cc.Description
+			if cc.Scope != "" {
+				entry = "**" + cc.Scope + ":** " + entry
+			}
+		}
+		groups[group].entries = append(groups[group].entries, fmt.Sprintf("- %s (%s)", entry, c.Hash[:7]))
+	}
+	fmt.Fprintf(buffer, "\n## %s\n", title)
+	for _, group := range groups {
+		if len(group.entries) != 0 {
+			fmt.Fprintf(buffer, "\n### %s\n\n%s\n", group.title, strings.Join(group.entries, "\n"))
+		}
+	}
+}
+
+// releaseTags returns the tags that are named for a semantic version and refer to a commit reachable from HEAD,
+// highest version first.
+func (l *local) releaseTags(includePrereleases bool) ([]ReleaseTag, error) {
+	head, err := l.resolveRef("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	var reachable map[string]bool
+	if reachable, err = l.reachable(head); err != nil {
+		return nil, err
+	}
+	var refs []ref
+	if refs, err = l.refs("refs/tags/"); err != nil {
+		return nil, err
+	}
+	var tags []ReleaseTag
+	for _, r := range refs {
+		name := strings.TrimPrefix(r.name, "refs/tags/")
+		v, parseErr := semver.Parse(name)
+		if parseErr != nil || (v.IsPrerelease() && !includePrereleases) {
+			continue
+		}
+		var hash string
+		if hash, err = l.peeledHash(r); err != nil {
+			return nil, err
+		}
+		if reachable[hash] {
+			tags = append(tags, ReleaseTag{Name: name, Commit: hash, Version: v})
+		}
+	}
+	slices.SortStableFunc(tags, func(a, b ReleaseTag) int { return b.Version.Compare(a.Version) })
+	return tags, nil
+}
@@ -0,0 +1,154 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/vcs/git"
+	"github.com/ddkwork/toolbox/vcs/semver"
+)
+
+func TestParseConventionalCommit(t *testing.T) {
+	cc, ok := git.ParseConventionalCommit("feat(parser)!: drop support for tabs\n\nDetails.")
+	check.True(t, ok)
+	check.Equal(t, git.ConventionalCommit{Type: "feat", Scope: "parser", Description: "drop support for tabs",
+		Breaking: true}, cc)
+
+	cc, ok = git.ParseConventionalCommit("Fix: handle empty input\n\nBREAKING CHANGE: empty input is now an error")
+	check.True(t, ok)
+	check.Equal(t, git.ConventionalCommit{Type: "fix", Description: "handle empty input", Breaking: true}, cc)
+
+	cc, ok = git.ParseConventionalCommit("docs: mention BREAKING CHANGE: in the guide")
+	check.True(t, ok)
+	check.False(t, cc.Breaking)
+
+	_, ok = git.ParseConventionalCommit("Update the readme")
+	check.False(t, ok)
+	_, ok = git.ParseConventionalCommit("feat:missing space")
+	check.False(t, ok)
+}
+
+func TestReleases(t *testing.T) {
+	h := newHistoryRepo(t)
+	step := 0
+	commit := func(message string) string {
+		step++
+		h.write("file.txt", fmt.Sprintf("step %d\n", step))
+		return h.commit(message)
+	}
+	repo := h.repo()
+
+	commit("Initial commit")
+	v, err := repo.NextVersion()
+	check.NoError(t, err)
+	check.Equal(t, "0.0.1", v.String())
+	_, found, err := repo.LatestRelease()
+	check.NoError(t, err)
+	check.False(t, found)
+
+	first := commit("feat: add the parser")
+	h.git("tag", "v0.1.0")
+	v, err = repo.NextVersion()
+	check.NoError(t, err)
+	check.Equal(t, "0.1.0", v.String())
+
+	commit("fix(parser): handle empty input")
+	v, err = repo.NextVersion()
+	check.NoError(t, err)
+	check.Equal(t, "0.1.1", v.String())
+	commit("feat!: require a configuration file")
+	v, err = repo.NextVersion()
+	check.NoError(t, err)
+	check.Equal(t, "0.2.0", v.String())
+	second := h.git("rev-parse", "HEAD")
+	h.git("tag", "-a", "-m", "Release 1.0.0", "v1.0.0")
+	h.git("tag", "v1.1.0-rc.1")
+	h.git("tag", "not-a-version")
+
+	third := commit("docs: explain the configuration file")
+	v, err = repo.NextVersion()
+	check.NoError(t, err)
+	check.Equal(t, "1.0.1", v.String())
+	commit("feat(cli): add --verbose")
+	v, err = repo.NextVersion()
+	check.NoError(t, err)
+	check.Equal(t, "1.1.0", v.String())
+	commit("refactor: restructure\n\nBREAKING CHANGE: the API has changed")
+	v, err = repo.NextVersion()
+	check.NoError(t, err)
+	check.Equal(t, "2.0.0", v.String())
+
+	// A release made on another branch is not reachable from HEAD, so is ignored.
+	h.git("checkout", "-q", "-b", "other", "v1.0.0")
+	commit("fix: backport")
+	h.git("tag", "v9.0.0")
+	h.git("checkout", "-q", "main")
+
+	var tags []git.ReleaseTag
+	tags, err = repo.ReleaseTags()
+	check.NoError(t, err)
+	check.Equal(t, []git.ReleaseTag{
+		{Name: "v1.1.0-rc.1", Commit: second, Version: semver.MustParse("1.1.0-rc.1")},
+		{Name: "v1.0.0", Commit: second, Version: semver.MustParse("1.0.0")},
+		{Name: "v0.1.0", Commit: first, Version: semver.MustParse("0.1.0")},
+	}, tags)
+
+	var latest git.ReleaseTag
+	latest, found, err = repo.LatestRelease()
+	check.NoError(t, err)
+	check.True(t, found)
+	check.Equal(t, "v1.0.0", latest.Name)
+
+	var changelog string
+	changelog, err = repo.Changelog()
+	check.NoError(t, err)
+	history, err := repo.Log("")
+	check.NoError(t, err)
+	check.Equal(t, fmt.Sprintf(`# Changelog
+
+## Unreleased
+
+### Breaking Changes
+
+- restructure (%s)
+
+### Features
+
+- **cli:** add --verbose (%s)
+
+### Other Changes
+
+- explain the configuration file (%s)
+
+## 1.0.0 - 2023-06-01
+
+### Breaking Changes
+
+- require a configuration file (%s)
+
+### Bug Fixes
+
+- **parser:** handle empty input (%s)
+
+## 0.1.0 - 2023-06-01
+
+### Features
+
+- add the parser (%s)
+
+### Other Changes
+
+- Initial commit (%s)
+`, history[0].Hash[:7], history[1].Hash[:7], third[:7], second[:7], history[4].Hash[:7], first[:7],
+		history[6].Hash[:7]), changelog)
+}
@@ -7,15 +7,14 @@
 // This Source Code Form is "Incompatible With Secondary Licenses", as
 // defined by the Mozilla Public License, version 2.0.
 
-// Package git provides simple git repository access.
+// Package git provides simple git repository access. Information is read directly from the repository's files, so the
+// git binary is only required for operations that modify the repository or examine its working tree.
 package git
 
 import (
-	"bytes"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -23,11 +22,6 @@ import (
 	"github.com/ddkwork/toolbox/i18n"
 )
 
-var (
-	tagsRefListRegex   = regexp.MustCompile(`(?m)tags/(\S+)$`)
-	originRefListRegex = regexp.MustCompile(`(?m)origin/(\S+)$`)
-)
-
 // Repo provides access to a git repository.
 type Repo struct {
 	remote string
@@ -36,21 +30,19 @@ type Repo struct {
 
 // NewRepo creates a new git repository access object.
 func NewRepo(remote, local string) (*Repo, error) {
-	if _, err := exec.LookPath("git"); err != nil {
-		return nil, errs.New(i18n.Text("git is not installed"))
-	}
 	repo := &Repo{
 		remote: remote,
 		local:  local,
 	}
 	if repo.CheckLocal() {
-		out, err := repo.runFromDir("git", "config", "--get", "remote.origin.url")
+		l, err := openLocal(local)
 		if err != nil {
 			return nil, errs.NewWithCause(i18n.Text("Unable to retrieve local repository information"), err)
 		}
-		localRemote := strings.TrimSpace(string(out))
+		localRemote := l.config["remote.origin.url"]
 		if remote != "" && localRemote != remote {
-			return nil, errs.Newf(i18n.Text("Existing remote (%) does not match requested remote (%s)"), localRemote, remote)
+			return nil, errs.Newf(i18n.Text("Existing remote (%s) does not match requested remote (%s)"), localRemote,
+				remote)
 		}
 		if remote == "" && localRemote != "" {
 			repo.remote = localRemote
@@ -67,7 +59,7 @@ func (repo *Repo) CheckLocal() bool {
 
 // Init initializes a git repository at the local location.
 func (repo *Repo) Init() error {
-	if _, err := exec.Command("git", "init", repo.local).CombinedOutput(); err != nil {
+	if _, err := run("", "git", "init", repo.local); err != nil {
 		return errs.NewWithCause(i18n.Text("Unable to initialize repository"), err)
 	}
 	return nil
@@ -75,7 +67,7 @@ func (repo *Repo) Init() error {
 
 // Clone a repository.
 func (repo *Repo) Clone() error {
-	if _, err := exec.Command("git", "clone", repo.remote, repo.local).CombinedOutput(); err != nil {
+	if _, err := run("", "git", "clone", repo.remote, repo.local); err != nil {
 		return errs.NewWithCause(i18n.Text("Unable to clone repository"), err)
 	}
 	return nil
@@ -107,39 +99,54 @@ func (repo *Repo) Pull() error {
 
 // HasDetachedHead returns true if the repo is currently in a "detached head" state.
 func (repo *Repo) HasDetachedHead() bool {
-	contents, err := os.ReadFile(filepath.Join(repo.local, ".git", "HEAD"))
-	return err != nil && !bytes.HasPrefix(bytes.TrimSpace(contents), []byte("ref: "))
+	l, err := openLocal(repo.local)
+	if err != nil {
+		return false
+	}
+	defer l.close()
+	target, err := l.headTarget()
+	return err == nil && target == ""
 }
 
 // Date retrieves the date on the latest commit.
 func (repo *Repo) Date() (time.Time, error) {
-	out, err := repo.runFromDir("git", "log", "-1", "--date=iso", "--pretty=format:%cd")
+	l, err := openLocal(repo.local)
 	if err != nil {
 		return time.Time{}, errs.NewWithCause(i18n.Text("Unable to retrieve revision date"), err)
 	}
-	t, err := time.Parse("2006-01-02 15:04:05 -0700", string(out))
-	if err != nil {
+	defer l.close()
+	var hash string
+	if hash, err = l.resolveRef("HEAD"); err != nil {
 		return time.Time{}, errs.NewWithCause(i18n.Text("Unable to retrieve revision date"), err)
 	}
-	return t, nil
+	var c *Commit
+	if c, err = l.commit(hash); err != nil {
+		return time.Time{}, errs.NewWithCause(i18n.Text("Unable to retrieve revision date"), err)
+	}
+	return c.Committer.When, nil
 }
 
-// Branches returns a list of available branches.
+// Branches returns a list of the branches available from the origin remote.
 func (repo *Repo) Branches() ([]string, error) {
-	out, err := repo.runFromDir("git", "show-ref")
+	list, err := repo.refNames("refs/remotes/origin/")
 	if err != nil {
 		return []string{}, errs.NewWithCause(i18n.Text("Unable to retrieve branches"), err)
 	}
-	return repo.referenceList(string(out), originRefListRegex), nil
+	return slices.DeleteFunc(list, func(name string) bool { return name == "HEAD" }), nil
 }
 
 // Revision retrieves the current revision.
 func (repo *Repo) Revision() (string, error) {
-	out, err := repo.runFromDir("git", "rev-parse", "HEAD")
+	l, err := openLocal(repo.local)
 	if err != nil {
 		return "", errs.NewWithCause(i18n.Text("Unable to retrieve checked out revision"), err)
 	}
-	return strings.TrimSpace(string(out)), nil
+	defer l.close()
+	var hash string
+	if hash, err = l.resolveRef("HEAD"); err != nil {
+		return "", errs.NewWithCause(i18n.Text("Unable to retrieve checked out revision"), err)
+	}
+	return hash, nil
 }
 
 // Current returns the current branch/tag/revision.
@@ -147,8 +154,13 @@ func (repo *Repo) Revision() (string, error) {
 // * Tag if on a tag
 // * Otherwise a revision id
 func (repo *Repo) Current() (string, error) {
-	if out, err := repo.runFromDir("git", "symbolic-ref", "HEAD"); err == nil {
-		return string(bytes.TrimSpace(bytes.TrimPrefix(out, []byte("refs/heads/")))), nil
+	if l, err := openLocal(repo.local); err == nil {
+		var target string
+		target, err = l.headTarget()
+		l.close()
+		if err == nil && target != "" {
+			return strings.TrimPrefix(target, "refs/heads/"), nil
+		}
 	}
 	rev, err := repo.Revision()
 	if err != nil {
@@ -166,42 +178,57 @@ func (repo *Repo) Current() (string, error) {
 
 // Tags returns a list of available tags.
 func (repo *Repo) Tags() ([]string, error) {
-	out, err := repo.runFromDir("git", "show-ref")
+	list, err := repo.refNames("refs/tags/")
 	if err != nil {
 		return []string{}, errs.NewWithCause(i18n.Text("Unable to retrieve tags"), err)
 	}
-	return repo.referenceList(string(out), tagsRefListRegex), nil
+	return list, nil
 }
 
-// TagsFromCommit retrieves the tags from a revision.
+// TagsFromCommit retrieves the tags from a revision. The revision may be abbreviated. A tag matches if either the tag
+// itself or, for annotated tags, the object it refers to has a matching id.
 func (repo *Repo) TagsFromCommit(rev string) ([]string, error) {
-	out, err := repo.runFromDir("git", "show-ref", "-d")
+	l, err := openLocal(repo.local)
 	if err != nil {
 		return nil, errs.NewWithCause(i18n.Text("Unable to retrieve tags"), err)
 	}
-	lines := strings.Split(string(out), "\n")
-	list := make([]string, 0, len(lines))
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, rev) {
-			list = append(list, line)
-		}
+	defer l.close()
+	var refs []ref
+	if refs, err = l.refs("refs/tags/"); err != nil {
+		return nil, errs.NewWithCause(i18n.Text("Unable to retrieve tags"), err)
 	}
-	tags := repo.referenceList(strings.Join(list, "\n"), tagsRefListRegex)
-	result := make([]string, 0, len(tags))
-	for _, t := range tags {
-		result = append(result, strings.TrimSuffix(t, "^{}"))
+	result := make([]string, 0, len(refs))
+	for _, r := range refs {
+		matched := strings.HasPrefix(r.hash, rev)
+		if !matched {
+			var hash string
+			if hash, err = l.peeledHash(r); err != nil {
+				return nil, errs.NewWithCause(i18n.Text("Unable to retrieve tags"), err)
+			}
+			matched = strings.HasPrefix(hash, rev)
+		}
+		if matched {
+			result = append(result, strings.TrimPrefix(r.name, "refs/tags/"))
+		}
 	}
 	return result, nil
 }
 
-func (repo *Repo) referenceList(content string, re *regexp.Regexp) []string {
-	submatches := re.FindAllStringSubmatch(content, -1)
-	out := make([]string, 0, len(submatches))
-	for _, m := range submatches {
-		out = append(out, m[1])
+func (repo *Repo) refNames(prefix string) ([]string, error) {
+	l, err := openLocal(repo.local)
+	if err != nil {
+		return nil, err
 	}
-	return out
+	defer l.close()
+	var refs []ref
+	if refs, err = l.refs(prefix); err != nil {
+		return nil, err
+	}
+	list := make([]string, 0, len(refs))
+	for _, r := range refs {
+		list = append(list, strings.TrimPrefix(r.name, prefix))
+	}
+	return list, nil
 }
 
 // HasChanges returns true if changes are present.
@@ -211,9 +238,18 @@ func (repo *Repo) HasChanges() bool {
 }
 
 func (repo *Repo) runFromDir(cmd string, args ...string) ([]byte, error) {
+	return run(repo.local, cmd, args...)
+}
+
+func run(dir, cmd string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(cmd); err != nil {
+		return nil, errs.New(i18n.Text("git is not installed"))
+	}
 	c := exec.Command(cmd, args...)
-	c.Dir = repo.local
-	c.Env = mergeEnvLists([]string{"PWD=" + c.Dir}, os.Environ())
+	if dir != "" {
+		c.Dir = dir
+		c.Env = mergeEnvLists([]string{"PWD=" + c.Dir}, os.Environ())
+	}
 	return c.CombinedOutput()
 }
 
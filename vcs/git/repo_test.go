@@ -0,0 +1,266 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/vcs/git"
+)
+
+func runGit(t *testing.T, dir string, date time.Time, args ...string) string {
+	t.Helper()
+	c := exec.Command("git", append([]string{"-c", "user.name=Tester", "-c", "user.email=tester@example.com",
+		"-c", "init.defaultBranch=main", "-c", "commit.gpgSign=false", "-c", "tag.gpgSign=false"}, args...)...)
+	c.Dir = dir
+	stamp := date.Format(time.RFC3339)
+	c.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_DATE="+stamp, "GIT_COMMITTER_DATE="+stamp)
+	out, err := c.CombinedOutput()
+	check.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+// createRepos creates an origin repository with a couple of branches and tags, then clones it, returning the clone's
+// directory along with the revision of each tag.
+func createRepos(t *testing.T) (clone string, revs map[string]string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	origin := filepath.Join(dir, "origin")
+	check.NoError(t, os.Mkdir(origin, 0o755))
+	date := time.Date(2023, time.March, 14, 15, 9, 26, 0, time.FixedZone("", -5*3600))
+	runGit(t, origin, date, "init")
+	revs = make(map[string]string)
+	var content strings.Builder
+	for i := 1; i <= 12; i++ {
+		// Many similar revisions of the same file produce deltas once the objects are packed.
+		for j := 0; j < 50; j++ {
+			fmt.Fprintf(&content, "line %d of revision %d\n", j, i)
+		}
+		check.NoError(t, os.WriteFile(filepath.Join(origin, "file.txt"), []byte(content.String()), 0o644))
+		runGit(t, origin, date, "add", "file.txt")
+		runGit(t, origin, date, "commit", "-m", fmt.Sprintf("Revision %d", i))
+		switch i {
+		case 3:
+			runGit(t, origin, date, "tag", "v1.0.0")
+			revs["v1.0.0"] = runGit(t, origin, date, "rev-parse", "HEAD")
+		case 6:
+			runGit(t, origin, date, "tag", "-a", "-m", "Release 1.1.0", "v1.1.0")
+			revs["v1.1.0"] = runGit(t, origin, date, "rev-parse", "HEAD")
+			runGit(t, origin, date, "branch", "feature")
+		}
+		date = date.Add(time.Hour)
+	}
+	revs["main"] = runGit(t, origin, date, "rev-parse", "HEAD")
+	clone = filepath.Join(dir, "clone")
+	runGit(t, dir, date, "clone", origin, clone)
+	return clone, revs
+}
+
+func checkRepo(t *testing.T, clone string, revs map[string]string) {
+	t.Helper()
+	repo, err := git.NewRepo("", clone)
+	check.NoError(t, err)
+
+	var branches []string
+	branches, err = repo.Branches()
+	check.NoError(t, err)
+	check.Equal(t, []string{"feature", "main"}, branches)
+
+	var tags []string
+	tags, err = repo.Tags()
+	check.NoError(t, err)
+	check.Equal(t, []string{"v1.0.0", "v1.1.0"}, tags)
+
+	for _, name := range []string{"v1.0.0", "v1.1.0"} {
+		tags, err = repo.TagsFromCommit(revs[name])
+		check.NoError(t, err)
+		check.Equal(t, []string{name}, tags)
+		tags, err = repo.TagsFromCommit(revs[name][:10])
+		check.NoError(t, err)
+		check.Equal(t, []string{name}, tags)
+	}
+	tags, err = repo.TagsFromCommit(revs["main"])
+	check.NoError(t, err)
+	check.Equal(t, 0, len(tags))
+
+	var rev string
+	rev, err = repo.Revision()
+	check.NoError(t, err)
+	check.Equal(t, revs["main"], rev)
+
+	var current string
+	current, err = repo.Current()
+	check.NoError(t, err)
+	check.Equal(t, "main", current)
+	check.False(t, repo.HasDetachedHead())
+
+	var date time.Time
+	date, err = repo.Date()
+	check.NoError(t, err)
+	check.Equal(t, time.Date(2023, time.March, 14, 15, 9, 26, 0, time.FixedZone("", -5*3600)).Add(11*time.Hour),
+		date)
+	_, offset := date.Zone()
+	check.Equal(t, -5*3600, offset)
+}
+
+func TestReadWithoutGitBinary(t *testing.T) {
+	clone, revs := createRepos(t)
+	t.Setenv("PATH", "")
+	checkRepo(t, clone, revs)
+	repo, err := git.NewRepo("", clone)
+	check.NoError(t, err)
+	check.Error(t, repo.Fetch())
+}
+
+func TestReadPacked(t *testing.T) {
+	clone, revs := createRepos(t)
+	runGit(t, clone, time.Now(), "gc", "--aggressive", "--prune=now")
+	_, err := os.Stat(filepath.Join(clone, ".git", "packed-refs"))
+	check.NoError(t, err)
+	t.Setenv("PATH", "")
+	checkRepo(t, clone, revs)
+}
+
+func TestDetachedHead(t *testing.T) {
+	clone, revs := createRepos(t)
+	repo, err := git.NewRepo("", clone)
+	check.NoError(t, err)
+	check.NoError(t, repo.Checkout("v1.1.0"))
+	check.True(t, repo.HasDetachedHead())
+	var current string
+	current, err = repo.Current()
+	check.NoError(t, err)
+	check.Equal(t, "v1.1.0", current)
+	var date time.Time
+	date, err = repo.Date()
+	check.NoError(t, err)
+	check.Equal(t, time.Date(2023, time.March, 14, 20, 9, 26, 0, time.FixedZone("", -5*3600)), date)
+
+	check.NoError(t, repo.Checkout(revs["v1.1.0"][:8]+"~1"))
+	current, err = repo.Current()
+	check.NoError(t, err)
+	check.Equal(t, 40, len(current))
+}
+
+func TestRemoteMismatch(t *testing.T) {
+	clone, _ := createRepos(t)
+	_, err := git.NewRepo("https://example.com/other.git", clone)
+	check.Error(t, err)
+}
+
+func TestCorruptPackSizes(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	date := time.Date(2023, time.March, 14, 15, 9, 26, 0, time.UTC)
+	runGit(t, dir, date, "init")
+	check.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), []byte("content\n"), 0o644))
+	runGit(t, dir, date, "add", "file.txt")
+	runGit(t, dir, date, "commit", "-m", "Initial")
+	runGit(t, dir, date, "gc", "--prune=now")
+	head := runGit(t, dir, date, "rev-parse", "HEAD")
+
+	// Sizes far larger than the data that follows them must be reported as errors, not allocated.
+	const huge = 1 << 40
+	base := []byte("base")
+	baseObject := append(packObjectHeader(3, uint64(len(base))), compress(t, base)...) // A blob
+	delta := append(append(deltaSize(uint64(len(base))), deltaSize(huge)...), 0x90, 4) // Copy the 4 bytes of base
+	for _, one := range []struct {
+		objects []byte
+		offset  int
+	}{
+		// A commit whose recorded size is too large.
+		{objects: append(packObjectHeader(1, huge), compress(t, []byte("tree"))...), offset: 12},
+		// An offset delta against the blob, whose recorded result size is too large.
+		{
+			objects: append(append(append(baseObject, packObjectHeader(6, uint64(len(delta)))...),
+				byte(len(baseObject))), compress(t, delta)...),
+			offset: 12 + len(baseObject),
+		},
+	} {
+		writePack(t, dir, head, one.offset, one.objects)
+		repo, err := git.NewRepo("", dir)
+		check.NoError(t, err)
+		_, err = repo.Date()
+		check.Error(t, err)
+	}
+}
+
+// writePack replaces the packs in the repository at dir with one holding the objects, with an index that locates the
+// object with the given hash at offset.
+func writePack(t *testing.T, dir, hash string, offset int, objects []byte) {
+	t.Helper()
+	packDir := filepath.Join(dir, ".git", "objects", "pack")
+	check.NoError(t, os.RemoveAll(packDir))
+	check.NoError(t, os.MkdirAll(packDir, 0o755))
+	data := binary.BigEndian.AppendUint32([]byte("PACK"), 2)
+	data = binary.BigEndian.AppendUint32(data, 1)
+	data = append(data, objects...)
+	data = append(data, make([]byte, 20)...) // Checksum, which isn't verified
+	check.NoError(t, os.WriteFile(filepath.Join(packDir, "pack-test.pack"), data, 0o644))
+	raw, err := hex.DecodeString(hash)
+	check.NoError(t, err)
+	index := []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}
+	for i := 0; i < 256; i++ {
+		var count uint32
+		if i >= int(raw[0]) {
+			count = 1
+		}
+		index = binary.BigEndian.AppendUint32(index, count)
+	}
+	index = append(index, raw...)
+	index = append(index, 0, 0, 0, 0) // CRC
+	index = binary.BigEndian.AppendUint32(index, uint32(offset))
+	index = append(index, make([]byte, 40)...) // Checksums, which aren't verified
+	check.NoError(t, os.WriteFile(filepath.Join(packDir, "pack-test.idx"), index, 0o644))
+}
+
+func packObjectHeader(kind byte, size uint64) []byte {
+	header := []byte{kind<<4 | byte(size&0x0f)}
+	for size >>= 4; size != 0; size >>= 7 {
+		header[len(header)-1] |= 0x80
+		header = append(header, byte(size&0x7f))
+	}
+	return header
+}
+
+func deltaSize(size uint64) []byte {
+	var data []byte
+	for ; size >= 0x80; size >>= 7 {
+		data = append(data, byte(size&0x7f)|0x80)
+	}
+	return append(data, byte(size))
+}
+
+func compress(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	w := zlib.NewWriter(&buffer)
+	_, err := w.Write(data)
+	check.NoError(t, err)
+	check.NoError(t, w.Close())
+	return buffer.Bytes()
+}
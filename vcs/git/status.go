@@ -0,0 +1,102 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package git
+
+import (
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/i18n"
+)
+
+// FileStatus holds the state of a single file within the working tree.
+type FileStatus struct {
+	// Path is the slash-separated path of the file, relative to the root of the repository.
+	Path string
+	// OrigPath is the path the file had before being renamed or copied. It is empty otherwise.
+	OrigPath string
+	// Staged is the change recorded in the index, relative to HEAD.
+	Staged ChangeKind
+	// Unstaged is the change in the working tree, relative to the index.
+	Unstaged ChangeKind
+}
+
+// Status returns the state of each file in the working tree that differs from HEAD, is untracked, or has unresolved
+// merge conflicts. Both the index and the working tree are examined, so the git binary is required. Untracked files
+// are reported with a Staged and Unstaged kind of Untracked, while unresolved conflicts use Unmerged for both.
+func (repo *Repo) Status() ([]FileStatus, error) {
+	out, err := repo.runFromDir("git", "status", "--porcelain=v1", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, errs.NewWithCause(i18n.Text("Unable to retrieve status"), err)
+	}
+	var result []FileStatus
+	entries := strings.Split(string(out), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if entry == "" {
+			continue
+		}
+		if len(entry) < 4 || entry[2] != ' ' {
+			return nil, errs.NewWithCause(i18n.Text("Unable to retrieve status"), errs.Newf("unexpected entry: %q", entry))
+		}
+		status := FileStatus{
+			Path:     entry[3:],
+			Staged:   statusChangeKind(entry[0]),
+			Unstaged: statusChangeKind(entry[1]),
+		}
+		switch {
+		case isUnmerged(entry[:2]):
+			status.Staged = Unmerged
+			status.Unstaged = Unmerged
+		case status.Staged == Renamed || status.Staged == Copied:
+			// The original path follows as a separate entry.
+			if i++; i < len(entries) {
+				status.OrigPath = entries[i]
+			}
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+func statusChangeKind(code byte) ChangeKind {
+	switch code {
+	case 'A':
+		return Added
+	case 'D':
+		return Deleted
+	case 'M':
+		return Modified
+	case 'R':
+		return Renamed
+	case 'C':
+		return Copied
+	case 'T':
+		return TypeChanged
+	case 'U':
+		return Unmerged
+	case '?':
+		return Untracked
+	case '!':
+		return Ignored
+	default:
+		return Unmodified
+	}
+}
+
+// isUnmerged returns true if the pair of status codes describes an unresolved merge conflict.
+func isUnmerged(codes string) bool {
+	switch codes {
+	case "DD", "AU", "UD", "UA", "DU", "AA", "UU":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+// Package hg provides simple Mercurial repository access. The hg binary is required.
+package hg
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/i18n"
+)
+
+// Repo provides access to a Mercurial repository.
+type Repo struct {
+	remote string
+	local  string
+}
+
+// NewRepo creates a new Mercurial repository access object.
+func NewRepo(remote, local string) (*Repo, error) {
+	repo := &Repo{
+		remote: remote,
+		local:  local,
+	}
+	if repo.CheckLocal() {
+		out, err := repo.runFromDir("paths", "default")
+		localRemote := ""
+		if err == nil {
+			localRemote = strings.TrimSpace(string(out))
+		}
+		if remote != "" && localRemote != remote {
+			return nil, errs.Newf(i18n.Text("Existing remote (%s) does not match requested remote (%s)"), localRemote,
+				remote)
+		}
+		if remote == "" && localRemote != "" {
+			repo.remote = localRemote
+		}
+	}
+	return repo, nil
+}
+
+// CheckLocal verifies the local location is a Mercurial repo.
+func (repo *Repo) CheckLocal() bool {
+	_, err := os.Stat(filepath.Join(repo.local, ".hg"))
+	return err == nil
+}
+
+// Init initializes a Mercurial repository at the local location.
+func (repo *Repo) Init() error {
+	if _, err := run("", "init", repo.local); err != nil {
+		return errs.NewWithCause(i18n.Text("Unable to initialize repository"), err)
+	}
+	return nil
+}
+
+// Clone a repository.
+func (repo *Repo) Clone() error {
+	if _, err := run("", "clone", repo.remote, repo.local); err != nil {
+		return errs.NewWithCause(i18n.Text("Unable to clone repository"), err)
+	}
+	return nil
+}
+
+// Checkout a revision, branch or tag.
+func (repo *Repo) Checkout(revisionBranchOrTag string) error {
+	if _, err := repo.runFromDir("update", "--rev", revisionBranchOrTag); err != nil {
+		return errs.NewWithCausef(err, i18n.Text("Unable to check out '%s'"), revisionBranchOrTag)
+	}
+	return nil
+}
+
+// Fetch retrieves new changesets from the remote without updating the working directory.
+func (repo *Repo) Fetch() error {
+	if _, err := repo.runFromDir("pull"); err != nil {
+		return errs.NewWithCause(i18n.Text("Unable to fetch"), err)
+	}
+	return nil
+}
+
+// Pull retrieves new changesets from the remote and updates the working directory.
+func (repo *Repo) Pull() error {
+	if _, err := repo.runFromDir("pull", "--update"); err != nil {
+		return errs.NewWithCause(i18n.Text("Unable to pull"), err)
+	}
+	return nil
+}
+
+// Revision retrieves the id of the working directory's parent changeset.
+func (repo *Repo) Revision() (string, error) {
+	out, err := repo.runFromDir("log", "--rev", ".", "--template", "{node}")
+	if err != nil {
+		return "", errs.NewWithCause(i18n.Text("Unable to retrieve checked out revision"), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Branches returns a list of the named branches.
+func (repo *Repo) Branches() ([]string, error) {
+	out, err := repo.runFromDir("branches", "--quiet")
+	if err != nil {
+		return []string{}, errs.NewWithCause(i18n.Text("Unable to retrieve branches"), err)
+	}
+	return lines(out), nil
+}
+
+// Tags returns a list of available tags. The automatic "tip" tag is omitted.
+func (repo *Repo) Tags() ([]string, error) {
+	out, err := repo.runFromDir("tags", "--quiet")
+	if err != nil {
+		return []string{}, errs.NewWithCause(i18n.Text("Unable to retrieve tags"), err)
+	}
+	return slices.DeleteFunc(lines(out), func(name string) bool { return name == "tip" }), nil
+}
+
+// HasChanges returns true if changes are present.
+func (repo *Repo) HasChanges() bool {
+	out, err := repo.runFromDir("status")
+	return err != nil || len(out) != 0
+}
+
+func lines(out []byte) []string {
+	var list []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			list = append(list, line)
+		}
+	}
+	slices.Sort(list)
+	return list
+}
+
+func (repo *Repo) runFromDir(args ...string) ([]byte, error) {
+	return run(repo.local, args...)
+}
+
+func run(dir string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("hg"); err != nil {
+		return nil, errs.New(i18n.Text("hg is not installed"))
+	}
+	c := exec.Command("hg", args...)
+	// HGPLAIN disables any user configuration that would alter the output.
+	c.Env = append(os.Environ(), "HGPLAIN=1")
+	if dir != "" {
+		c.Dir = dir
+		c.Env = append(c.Env, "PWD="+dir)
+	}
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return out, errs.NewWithCause(strings.TrimSpace(string(out)), err)
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package hg_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/vcs/hg"
+)
+
+func runHg(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	c := exec.Command("hg", args...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), "HGPLAIN=1", "HGUSER=Tester <tester@example.com>", "HGRCPATH=")
+	out, err := c.CombinedOutput()
+	check.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func TestRepo(t *testing.T) {
+	if _, err := exec.LookPath("hg"); err != nil {
+		t.Skip("hg is not installed")
+	}
+	dir := t.TempDir()
+	origin := filepath.Join(dir, "origin")
+	repo, err := hg.NewRepo("", origin)
+	check.NoError(t, err)
+	check.False(t, repo.CheckLocal())
+	check.NoError(t, repo.Init())
+	check.True(t, repo.CheckLocal())
+	check.NoError(t, os.WriteFile(filepath.Join(origin, "file.txt"), []byte("one\n"), 0o644))
+	runHg(t, origin, "add", "file.txt")
+	runHg(t, origin, "commit", "-m", "First")
+	first := runHg(t, origin, "log", "--rev", ".", "--template", "{node}")
+	runHg(t, origin, "tag", "v1.0.0")
+
+	clone := filepath.Join(dir, "clone")
+	if repo, err = hg.NewRepo(origin, clone); err != nil {
+		t.Fatal(err)
+	}
+	check.NoError(t, repo.Clone())
+	var tags []string
+	tags, err = repo.Tags()
+	check.NoError(t, err)
+	check.Equal(t, []string{"v1.0.0"}, tags)
+	var rev string
+	rev, err = repo.Revision()
+	check.NoError(t, err)
+	check.Equal(t, runHg(t, origin, "log", "--rev", "tip", "--template", "{node}"), rev)
+
+	check.False(t, repo.HasChanges())
+	check.NoError(t, os.WriteFile(filepath.Join(clone, "file.txt"), []byte("two\n"), 0o644))
+	check.True(t, repo.HasChanges())
+	runHg(t, clone, "revert", "--all", "--no-backup")
+
+	check.NoError(t, repo.Checkout("v1.0.0"))
+	rev, err = repo.Revision()
+	check.NoError(t, err)
+	check.Equal(t, first, rev)
+
+	check.NoError(t, os.WriteFile(filepath.Join(origin, "file.txt"), []byte("three\n"), 0o644))
+	runHg(t, origin, "commit", "-m", "Third")
+	check.NoError(t, repo.Fetch())
+	rev, err = repo.Revision()
+	check.NoError(t, err)
+	check.Equal(t, first, rev)
+
+	if repo, err = hg.NewRepo("", clone); err != nil {
+		t.Fatal(err)
+	}
+	check.NoError(t, repo.Checkout("default"))
+	rev, err = repo.Revision()
+	check.NoError(t, err)
+	check.Equal(t, runHg(t, origin, "log", "--rev", "tip", "--template", "{node}"), rev)
+
+	_, err = hg.NewRepo("https://example.com/other", clone)
+	check.Error(t, err)
+}
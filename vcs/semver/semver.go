@@ -0,0 +1,218 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+// Package semver provides parsing and comparison of semantic versions, as described at https://semver.org.
+package semver
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// Version holds a semantic version.
+type Version struct {
+	// Prerelease holds the dot-separated prerelease identifiers, such as "rc.1", without the leading '-'.
+	Prerelease string
+	// Build holds the dot-separated build metadata, such as "20230314.abc123", without the leading '+'. It has no
+	// effect on the version's precedence.
+	Build string
+	Major uint64
+	Minor uint64
+	Patch uint64
+}
+
+// MustParse parses a version, panicking if it is invalid.
+func MustParse(text string) Version {
+	v, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Parse a version. A leading 'v', as is commonly used for tags, is permitted and ignored.
+func Parse(text string) (Version, error) {
+	var v Version
+	s := strings.TrimPrefix(text, "v")
+	var found bool
+	if s, v.Build, found = strings.Cut(s, "+"); found && !validIdentifiers(v.Build, false) {
+		return Version{}, errs.Newf("invalid build metadata in version %q", text)
+	}
+	if s, v.Prerelease, found = strings.Cut(s, "-"); found && !validIdentifiers(v.Prerelease, true) {
+		return Version{}, errs.Newf("invalid prerelease in version %q", text)
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return Version{}, errs.Newf("version %q must have major, minor and patch components", text)
+	}
+	for i, target := range []*uint64{&v.Major, &v.Minor, &v.Patch} {
+		if !isNumeric(parts[i]) || (len(parts[i]) > 1 && parts[i][0] == '0') {
+			return Version{}, errs.Newf("invalid numeric component %q in version %q", parts[i], text)
+		}
+		var err error
+		if *target, err = strconv.ParseUint(parts[i], 10, 64); err != nil {
+			return Version{}, errs.NewWithCausef(err, "invalid numeric component %q in version %q", parts[i], text)
+		}
+	}
+	return v, nil
+}
+
+// validIdentifiers returns true if s holds one or more dot-separated identifiers made up of ASCII alphanumerics and
+// hyphens. If numeric is true, purely numeric identifiers must not have leading zeros.
+func validIdentifiers(s string, numeric bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, ch := range id {
+			if (ch < '0' || ch > '9') && (ch < 'a' || ch > 'z') && (ch < 'A' || ch > 'Z') && ch != '-' {
+				return false
+			}
+		}
+		if numeric && len(id) > 1 && id[0] == '0' && isNumeric(id) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the version in its canonical form, without a leading 'v'.
+func (v Version) String() string {
+	var buffer strings.Builder
+	buffer.WriteString(strconv.FormatUint(v.Major, 10))
+	buffer.WriteByte('.')
+	buffer.WriteString(strconv.FormatUint(v.Minor, 10))
+	buffer.WriteByte('.')
+	buffer.WriteString(strconv.FormatUint(v.Patch, 10))
+	if v.Prerelease != "" {
+		buffer.WriteByte('-')
+		buffer.WriteString(v.Prerelease)
+	}
+	if v.Build != "" {
+		buffer.WriteByte('+')
+		buffer.WriteString(v.Build)
+	}
+	return buffer.String()
+}
+
+// IsPrerelease returns true if the version has prerelease identifiers.
+func (v Version) IsPrerelease() bool {
+	return v.Prerelease != ""
+}
+
+// Compare returns -1 if v has lower precedence than other, 1 if it has higher precedence, and 0 if they have the same
+// precedence. Build metadata is ignored.
+func (v Version) Compare(other Version) int {
+	if result := cmp.Compare(v.Major, other.Major); result != 0 {
+		return result
+	}
+	if result := cmp.Compare(v.Minor, other.Minor); result != 0 {
+		return result
+	}
+	if result := cmp.Compare(v.Patch, other.Patch); result != 0 {
+		return result
+	}
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+	ids := strings.Split(v.Prerelease, ".")
+	otherIDs := strings.Split(other.Prerelease, ".")
+	for i := 0; i < len(ids) && i < len(otherIDs); i++ {
+		if result := compareIdentifiers(ids[i], otherIDs[i]); result != 0 {
+			return result
+		}
+	}
+	return cmp.Compare(len(ids), len(otherIDs))
+}
+
+// compareIdentifiers compares two prerelease identifiers. Numeric identifiers are compared numerically and have lower
+// precedence than alphanumeric identifiers, which are compared lexically.
+func compareIdentifiers(a, b string) int {
+	aNumeric := isNumeric(a)
+	bNumeric := isNumeric(b)
+	switch {
+	case aNumeric && bNumeric:
+		if result := cmp.Compare(len(a), len(b)); result != 0 {
+			return result
+		}
+		return strings.Compare(a, b)
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// Less returns true if v has lower precedence than other.
+func (v Version) Less(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+// NextMajor returns the next major version. For a prerelease of a major version, such as 2.0.0-rc.1, this is the
+// release it precedes.
+func (v Version) NextMajor() Version {
+	if v.Prerelease != "" && v.Minor == 0 && v.Patch == 0 {
+		return Version{Major: v.Major}
+	}
+	return Version{Major: v.Major + 1}
+}
+
+// NextMinor returns the next minor version. For a prerelease of a minor version, such as 1.3.0-rc.1, this is the
+// release it precedes.
+func (v Version) NextMinor() Version {
+	if v.Prerelease != "" && v.Patch == 0 {
+		return Version{Major: v.Major, Minor: v.Minor}
+	}
+	return Version{Major: v.Major, Minor: v.Minor + 1}
+}
+
+// NextPatch returns the next patch version. For a prerelease, this is the release it precedes.
+func (v Version) NextPatch() Version {
+	if v.Prerelease != "" {
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	}
+	return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (v Version) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *Version) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package semver_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/vcs/semver"
+)
+
+func TestParse(t *testing.T) {
+	v, err := semver.Parse("v1.2.3-rc.1+build.42")
+	check.NoError(t, err)
+	check.Equal(t, semver.Version{Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1", Build: "build.42"}, v)
+	check.Equal(t, "1.2.3-rc.1+build.42", v.String())
+	check.True(t, v.IsPrerelease())
+
+	v, err = semver.Parse("0.10.0-alpha-beta")
+	check.NoError(t, err)
+	check.Equal(t, "alpha-beta", v.Prerelease)
+	check.False(t, semver.MustParse("2.0.0+exp.sha.5114f85").IsPrerelease())
+
+	for _, bad := range []string{
+		"", "1", "1.2", "1.2.3.4", "01.2.3", "1.02.3", "1.2.-3", "1.2.3-", "1.2.3-01", "1.2.3-a..b", "1.2.3+",
+		"1.2.3+a_b", "1.2.x", "99999999999999999999.0.0",
+	} {
+		_, err = semver.Parse(bad)
+		check.Error(t, err, bad)
+	}
+	check.Panics(t, func() { semver.MustParse("bad") })
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11",
+		"1.0.0-rc.1", "1.0.0", "1.0.1", "1.2.0", "1.10.0", "2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a := semver.MustParse(ordered[i])
+			b := semver.MustParse(ordered[j])
+			switch {
+			case i < j:
+				check.Equal(t, -1, a.Compare(b), "%s vs %s", a, b)
+				check.True(t, a.Less(b), "%s vs %s", a, b)
+			case i > j:
+				check.Equal(t, 1, a.Compare(b), "%s vs %s", a, b)
+			default:
+				check.Equal(t, 0, a.Compare(b), "%s vs %s", a, b)
+			}
+		}
+	}
+	check.Equal(t, 0, semver.MustParse("1.0.0+a").Compare(semver.MustParse("1.0.0+b")))
+}
+
+func TestNext(t *testing.T) {
+	v := semver.MustParse("1.2.3+build")
+	check.Equal(t, "2.0.0", v.NextMajor().String())
+	check.Equal(t, "1.3.0", v.NextMinor().String())
+	check.Equal(t, "1.2.4", v.NextPatch().String())
+
+	check.Equal(t, "2.0.0", semver.MustParse("2.0.0-rc.1").NextMajor().String())
+	check.Equal(t, "3.0.0", semver.MustParse("2.1.0-rc.1").NextMajor().String())
+	check.Equal(t, "1.3.0", semver.MustParse("1.3.0-rc.1").NextMinor().String())
+	check.Equal(t, "1.4.0", semver.MustParse("1.3.1-rc.1").NextMinor().String())
+	check.Equal(t, "1.3.1", semver.MustParse("1.3.1-rc.1").NextPatch().String())
+}
+
+func TestMarshalText(t *testing.T) {
+	type record struct {
+		Version semver.Version
+	}
+	data, err := json.Marshal(record{Version: semver.MustParse("v1.2.3-beta")})
+	check.NoError(t, err)
+	check.Equal(t, `{"Version":"1.2.3-beta"}`, string(data))
+	var r record
+	check.NoError(t, json.Unmarshal(data, &r))
+	check.Equal(t, semver.MustParse("1.2.3-beta"), r.Version)
+	check.Error(t, json.Unmarshal([]byte(`{"Version":"1.2"}`), &r))
+}
@@ -0,0 +1,189 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+// Package svn provides simple Subversion working copy access. The svn binary is required. Branches and tags are
+// expected to follow the standard layout of "trunk", "branches" and "tags" directories at the repository root.
+package svn
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/i18n"
+)
+
+// Repo provides access to a Subversion working copy.
+type Repo struct {
+	remote string
+	local  string
+}
+
+// NewRepo creates a new Subversion working copy access object. The remote is the URL to check out.
+func NewRepo(remote, local string) (*Repo, error) {
+	repo := &Repo{
+		remote: remote,
+		local:  local,
+	}
+	if repo.CheckLocal() {
+		localRemote, err := repo.info("url")
+		if err != nil {
+			return nil, errs.NewWithCause(i18n.Text("Unable to retrieve local repository information"), err)
+		}
+		if remote != "" && strings.TrimSuffix(localRemote, "/") != strings.TrimSuffix(remote, "/") {
+			return nil, errs.Newf(i18n.Text("Existing remote (%s) does not match requested remote (%s)"), localRemote,
+				remote)
+		}
+		if remote == "" {
+			repo.remote = localRemote
+		}
+	}
+	return repo, nil
+}
+
+// CheckLocal verifies the local location is a Subversion working copy.
+func (repo *Repo) CheckLocal() bool {
+	_, err := os.Stat(filepath.Join(repo.local, ".svn"))
+	return err == nil
+}
+
+// Clone checks out a working copy of the remote.
+func (repo *Repo) Clone() error {
+	if _, err := run("", "checkout", repo.remote, repo.local); err != nil {
+		return errs.NewWithCause(i18n.Text("Unable to clone repository"), err)
+	}
+	return nil
+}
+
+// Checkout switches the working copy to "trunk", a tag, or a branch, checking for them in that order. Anything else is
+// treated as a revision number of the current branch.
+func (repo *Repo) Checkout(revisionBranchOrTag string) error {
+	var err error
+	target := ""
+	if revisionBranchOrTag == "trunk" {
+		target = "^/trunk"
+	} else {
+		for _, dir := range []string{"tags", "branches"} {
+			var names []string
+			if names, err = repo.list(dir); err != nil {
+				return errs.NewWithCausef(err, i18n.Text("Unable to check out '%s'"), revisionBranchOrTag)
+			}
+			if slices.Contains(names, revisionBranchOrTag) {
+				target = "^/" + dir + "/" + revisionBranchOrTag
+				break
+			}
+		}
+	}
+	if target != "" {
+		_, err = repo.runFromDir("switch", target)
+	} else {
+		_, err = repo.runFromDir("update", "--revision", revisionBranchOrTag)
+	}
+	if err != nil {
+		return errs.NewWithCausef(err, i18n.Text("Unable to check out '%s'"), revisionBranchOrTag)
+	}
+	return nil
+}
+
+// Fetch does nothing, since a Subversion working copy has no local history to bring up to date. It exists to satisfy
+// the same interface as other repository types.
+func (repo *Repo) Fetch() error {
+	return nil
+}
+
+// Pull updates the working copy to the latest revision.
+func (repo *Repo) Pull() error {
+	if _, err := repo.runFromDir("update"); err != nil {
+		return errs.NewWithCause(i18n.Text("Unable to pull"), err)
+	}
+	return nil
+}
+
+// Revision retrieves the revision the working copy is at.
+func (repo *Repo) Revision() (string, error) {
+	rev, err := repo.info("revision")
+	if err != nil {
+		return "", errs.NewWithCause(i18n.Text("Unable to retrieve checked out revision"), err)
+	}
+	return rev, nil
+}
+
+// Branches returns a list of the branches.
+func (repo *Repo) Branches() ([]string, error) {
+	list, err := repo.list("branches")
+	if err != nil {
+		return []string{}, errs.NewWithCause(i18n.Text("Unable to retrieve branches"), err)
+	}
+	return list, nil
+}
+
+// Tags returns a list of available tags.
+func (repo *Repo) Tags() ([]string, error) {
+	list, err := repo.list("tags")
+	if err != nil {
+		return []string{}, errs.NewWithCause(i18n.Text("Unable to retrieve tags"), err)
+	}
+	return list, nil
+}
+
+// HasChanges returns true if changes are present.
+func (repo *Repo) HasChanges() bool {
+	out, err := repo.runFromDir("status")
+	return err != nil || len(out) != 0
+}
+
+// info returns a single item of information about the working copy.
+func (repo *Repo) info(item string) (string, error) {
+	out, err := repo.runFromDir("info", "--show-item", item)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// list returns the names of the directories within the directory at the root of the repository, sorted.
+func (repo *Repo) list(dir string) ([]string, error) {
+	out, err := repo.runFromDir("list", "^/"+dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); strings.HasSuffix(line, "/") {
+			names = append(names, strings.TrimSuffix(line, "/"))
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (repo *Repo) runFromDir(args ...string) ([]byte, error) {
+	return run(repo.local, args...)
+}
+
+func run(dir string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("svn"); err != nil {
+		return nil, errs.New(i18n.Text("svn is not installed"))
+	}
+	c := exec.Command("svn", append([]string{"--non-interactive"}, args...)...)
+	// Force untranslated output, which is parsed in places.
+	c.Env = append(os.Environ(), "LC_ALL=C")
+	if dir != "" {
+		c.Dir = dir
+		c.Env = append(c.Env, "PWD="+dir)
+	}
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return out, errs.NewWithCause(strings.TrimSpace(string(out)), err)
+	}
+	return out, nil
+}
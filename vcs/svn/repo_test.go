@@ -0,0 +1,88 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package svn_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/vcs/svn"
+)
+
+func runTool(t *testing.T, dir, tool string, args ...string) string {
+	t.Helper()
+	c := exec.Command(tool, args...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := c.CombinedOutput()
+	check.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func TestRepo(t *testing.T) {
+	for _, tool := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip(tool + " is not installed")
+		}
+	}
+	dir := t.TempDir()
+	server := filepath.Join(dir, "server")
+	runTool(t, dir, "svnadmin", "create", server)
+	url := filepath.ToSlash(server)
+	if !strings.HasPrefix(url, "/") {
+		url = "/" + url
+	}
+	url = "file://" + url
+	runTool(t, dir, "svn", "mkdir", "--non-interactive", "-m", "Layout", url+"/trunk", url+"/tags", url+"/branches")
+
+	wc := filepath.Join(dir, "wc")
+	repo, err := svn.NewRepo(url+"/trunk", wc)
+	check.NoError(t, err)
+	check.False(t, repo.CheckLocal())
+	check.NoError(t, repo.Clone())
+	check.True(t, repo.CheckLocal())
+	check.NoError(t, os.WriteFile(filepath.Join(wc, "file.txt"), []byte("one\n"), 0o644))
+	check.True(t, repo.HasChanges())
+	runTool(t, wc, "svn", "add", "--non-interactive", "file.txt")
+	runTool(t, wc, "svn", "commit", "--non-interactive", "-m", "First")
+	runTool(t, wc, "svn", "copy", "--non-interactive", "-m", "Tag", url+"/trunk", url+"/tags/v1.0.0")
+	check.False(t, repo.HasChanges())
+
+	check.NoError(t, repo.Fetch())
+	check.NoError(t, repo.Pull())
+	var rev string
+	rev, err = repo.Revision()
+	check.NoError(t, err)
+	check.Equal(t, "3", rev)
+	var tags []string
+	tags, err = repo.Tags()
+	check.NoError(t, err)
+	check.Equal(t, []string{"v1.0.0"}, tags)
+
+	if repo, err = svn.NewRepo("", wc); err != nil {
+		t.Fatal(err)
+	}
+	_, err = svn.NewRepo(url+"/branches", wc)
+	check.Error(t, err)
+
+	check.NoError(t, repo.Checkout("v1.0.0"))
+	check.Equal(t, url+"/tags/v1.0.0", runTool(t, wc, "svn", "info", "--show-item", "url"))
+	check.NoError(t, repo.Checkout("trunk"))
+	check.NoError(t, repo.Checkout("1"))
+	rev, err = repo.Revision()
+	check.NoError(t, err)
+	check.Equal(t, "1", rev)
+	_, err = os.Stat(filepath.Join(wc, "file.txt"))
+	check.NotNil(t, err)
+}
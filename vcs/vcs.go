@@ -0,0 +1,134 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+// Package vcs provides access to version control repositories without regard to the system that manages them.
+package vcs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/i18n"
+	"github.com/ddkwork/toolbox/vcs/git"
+	"github.com/ddkwork/toolbox/vcs/hg"
+	"github.com/ddkwork/toolbox/vcs/svn"
+)
+
+// Kind identifies a version control system.
+type Kind uint8
+
+// Possible Kind values.
+const (
+	Git Kind = iota
+	Mercurial
+	Subversion
+)
+
+var (
+	_ Repo = &git.Repo{}
+	_ Repo = &hg.Repo{}
+	_ Repo = &svn.Repo{}
+)
+
+// markers holds the name of the directory entry that identifies the root of a repository of each kind.
+var markers = []struct {
+	name string
+	kind Kind
+}{
+	{name: ".git", kind: Git},
+	{name: ".hg", kind: Mercurial},
+	{name: ".svn", kind: Subversion},
+}
+
+// Repo provides access to a repository.
+type Repo interface {
+	// Clone the remote repository into the local location.
+	Clone() error
+	// Checkout a revision, branch or tag.
+	Checkout(revisionBranchOrTag string) error
+	// Fetch changes from the remote repository without altering the working files.
+	Fetch() error
+	// Pull changes from the remote repository and update the working files.
+	Pull() error
+	// Revision retrieves the current revision.
+	Revision() (string, error)
+	// Tags returns a list of available tags.
+	Tags() ([]string, error)
+	// HasChanges returns true if the working files have been modified.
+	HasChanges() bool
+}
+
+// NewRepo creates a new repository access object of the given kind.
+func NewRepo(kind Kind, remote, local string) (Repo, error) {
+	switch kind {
+	case Git:
+		return asRepo(git.NewRepo(remote, local))
+	case Mercurial:
+		return asRepo(hg.NewRepo(remote, local))
+	case Subversion:
+		return asRepo(svn.NewRepo(remote, local))
+	default:
+		return nil, errs.Newf("unknown repository kind: %s", kind)
+	}
+}
+
+// asRepo converts the result of a backend's constructor, ensuring a failure produces a nil interface rather than one
+// holding a nil pointer.
+func asRepo[T Repo](repo T, err error) (Repo, error) {
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Detect determines the kind of repository that manages the local directory, returning it along with the root
+// directory of the repository. Parent directories are searched if the directory itself is not the root.
+func Detect(local string) (kind Kind, root string, err error) {
+	var dir string
+	if dir, err = filepath.Abs(local); err != nil {
+		return 0, "", errs.Wrap(err)
+	}
+	for {
+		for _, marker := range markers {
+			if _, err = os.Stat(filepath.Join(dir, marker.name)); err == nil {
+				return marker.kind, dir, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return 0, "", errs.Newf(i18n.Text("%s is not within a known type of repository"), local)
+		}
+		dir = parent
+	}
+}
+
+// Open creates a new repository access object for the repository that manages the local directory, detecting its
+// kind automatically. The remote is taken from the repository's configuration.
+func Open(local string) (Repo, error) {
+	kind, root, err := Detect(local)
+	if err != nil {
+		return nil, err
+	}
+	return NewRepo(kind, "", root)
+}
+
+func (k Kind) String() string {
+	switch k {
+	case Git:
+		return "git"
+	case Mercurial:
+		return "hg"
+	case Subversion:
+		return "svn"
+	default:
+		return fmt.Sprintf("Kind(%d)", k)
+	}
+}
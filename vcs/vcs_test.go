@@ -0,0 +1,95 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package vcs_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/vcs"
+)
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/.git", "a/b/.hg", "c/.svn", "d"} {
+		check.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.FromSlash(name)), 0o755))
+	}
+	// A worktree or submodule has a .git file, rather than a directory.
+	check.NoError(t, os.MkdirAll(filepath.Join(dir, "a", "b", "e", "deep"), 0o755))
+	check.NoError(t, os.WriteFile(filepath.Join(dir, "a", "b", "e", ".git"), []byte("gitdir: ../../.git\n"), 0o644))
+
+	for _, one := range []struct {
+		path string
+		root string
+		kind vcs.Kind
+	}{
+		{path: "a", root: "a", kind: vcs.Git},
+		{path: "a/b", root: "a/b", kind: vcs.Mercurial},
+		{path: "a/b/e/deep", root: "a/b/e", kind: vcs.Git},
+		{path: "c", root: "c", kind: vcs.Subversion},
+	} {
+		kind, root, err := vcs.Detect(filepath.Join(dir, filepath.FromSlash(one.path)))
+		check.NoError(t, err, one.path)
+		check.Equal(t, one.kind, kind, one.path)
+		check.Equal(t, filepath.Join(dir, filepath.FromSlash(one.root)), root, one.path)
+	}
+
+	if _, _, err := vcs.Detect(filepath.Join(dir, "d")); err == nil {
+		// The temporary directory may itself be inside a repository, in which case detection is expected to succeed.
+		_, err = os.Stat(filepath.Join(dir, ".git"))
+		check.NotNil(t, err)
+	}
+	check.Equal(t, "hg", vcs.Mercurial.String())
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"commit", "--quiet", "--allow-empty", "-m", "First"},
+		{"tag", "v1.0.0"},
+	} {
+		c := exec.Command("git", append([]string{"-c", "user.name=Tester", "-c", "user.email=tester@example.com",
+			"-c", "commit.gpgSign=false", "-c", "tag.gpgSign=false"}, args...)...)
+		c.Dir = dir
+		c.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1")
+		out, err := c.CombinedOutput()
+		check.NoError(t, err, string(out))
+	}
+	sub := filepath.Join(dir, "sub")
+	check.NoError(t, os.Mkdir(sub, 0o755))
+
+	repo, err := vcs.Open(sub)
+	check.NoError(t, err)
+	var rev string
+	rev, err = repo.Revision()
+	check.NoError(t, err)
+	check.Equal(t, 40, len(rev))
+	check.Equal(t, "", strings.Trim(rev, "0123456789abcdef"))
+	var tags []string
+	tags, err = repo.Tags()
+	check.NoError(t, err)
+	check.Equal(t, []string{"v1.0.0"}, tags)
+	check.False(t, repo.HasChanges())
+	check.NoError(t, os.WriteFile(filepath.Join(sub, "new.txt"), []byte("new\n"), 0o644))
+	check.True(t, repo.HasChanges())
+
+	_, err = vcs.NewRepo(vcs.Git, "https://example.com/other.git", dir)
+	check.Error(t, err)
+	_, err = vcs.NewRepo(vcs.Kind(99), "", dir)
+	check.Error(t, err)
+}
@@ -0,0 +1,112 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+// Package argon2 produces and verifies Argon2 password hashes in the PHC string format, e.g.
+// "$argon2id$v=19$m=65536,t=3,p=4$salt$hash". The key derivation itself is done by golang.org/x/crypto/argon2.
+package argon2
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	kdf "golang.org/x/crypto/argon2"
+)
+
+// ErrMismatchedHashAndPassword is returned by CompareHashAndPassword when the password does not match the hash.
+var ErrMismatchedHashAndPassword = errors.New("hashed password does not match password")
+
+// Params holds the parameters used when generating a password hash.
+type Params struct {
+	Memory     uint32 // in KiB
+	Time       uint32
+	SaltLength uint32
+	KeyLength  uint32
+	Threads    uint8
+}
+
+// DefaultParams are the second recommended set of parameters from RFC 9106, for use when memory is constrained.
+var DefaultParams = Params{
+	Memory:     64 * 1024,
+	Time:       3,
+	Threads:    4,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+// variants maps the name used in a PHC string to the function that derives keys for that variant of Argon2. Argon2d
+// is not supported, as it is not recommended for password hashing.
+var variants = map[string]func(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte{
+	"argon2i":  kdf.Key,
+	"argon2id": kdf.IDKey,
+}
+
+// GenerateFromPassword returns the Argon2id hash of the password, using a random salt, in the PHC string format.
+func GenerateFromPassword(password []byte, params Params) ([]byte, error) {
+	if params.SaltLength < 8 {
+		return nil, errs.New("salt length must be at least 8 bytes")
+	}
+	if params.KeyLength < 4 {
+		return nil, errs.New("key length must be at least 4 bytes")
+	}
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	key := kdf.IDKey(password, salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	return fmt.Appendf(nil, "$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", kdf.Version, params.Memory, params.Time,
+		params.Threads, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CompareHashAndPassword returns nil if the password matches the hash, ErrMismatchedHashAndPassword if it doesn't, or
+// another error if the hash cannot be parsed. Hashes for either Argon2id or Argon2i are accepted.
+func CompareHashAndPassword(hashedPassword, password []byte) error {
+	parts := strings.Split(string(hashedPassword), "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return errs.New("not an argon2 hash")
+	}
+	deriveKey, ok := variants[parts[1]]
+	if !ok {
+		return errs.Newf("unsupported argon2 variant %q", parts[1])
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return errs.NewWithCause("invalid argon2 version", err)
+	}
+	if version != kdf.Version {
+		return errs.Newf("unsupported argon2 version %d", version)
+	}
+	var params Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return errs.NewWithCause("invalid argon2 parameters", err)
+	}
+	if params.Time < 1 || params.Threads < 1 {
+		return errs.New("invalid argon2 parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return errs.NewWithCause("invalid argon2 salt", err)
+	}
+	var expected []byte
+	if expected, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return errs.NewWithCause("invalid argon2 hash", err)
+	}
+	if len(expected) < 4 {
+		return errs.New("invalid argon2 hash")
+	}
+	key := deriveKey(password, salt, params.Time, params.Memory, params.Threads, uint32(len(expected)))
+	if subtle.ConstantTimeCompare(key, expected) != 1 {
+		return ErrMismatchedHashAndPassword
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package argon2_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/xcrypto/argon2"
+)
+
+func TestKnownHash(t *testing.T) {
+	// From the documentation of the reference implementation.
+	hash := []byte("$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG")
+	check.NoError(t, argon2.CompareHashAndPassword(hash, []byte("password")))
+	check.True(t, errors.Is(argon2.CompareHashAndPassword(hash, []byte("Password")),
+		argon2.ErrMismatchedHashAndPassword))
+}
+
+func TestGenerateFromPassword(t *testing.T) {
+	params := argon2.Params{Memory: 64, Time: 1, Threads: 2, SaltLength: 16, KeyLength: 32}
+	hash, err := argon2.GenerateFromPassword([]byte("secret"), params)
+	check.NoError(t, err)
+	check.True(t, strings.HasPrefix(string(hash), "$argon2id$v=19$m=64,t=1,p=2$"))
+	check.NoError(t, argon2.CompareHashAndPassword(hash, []byte("secret")))
+	check.True(t, errors.Is(argon2.CompareHashAndPassword(hash, []byte("secret!")),
+		argon2.ErrMismatchedHashAndPassword))
+
+	var other []byte
+	other, err = argon2.GenerateFromPassword([]byte("secret"), params)
+	check.NoError(t, err)
+	check.True(t, string(hash) != string(other), "salt should be random")
+
+	params.SaltLength = 4
+	_, err = argon2.GenerateFromPassword([]byte("secret"), params)
+	check.Error(t, err)
+}
+
+func TestMalformedHashes(t *testing.T) {
+	for _, one := range []string{
+		"",
+		"$2b$04$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm",
+		"$argon2x$v=19$m=64,t=1,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2d$v=19$m=64,t=1,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=16$m=64,t=1,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=64,t=0,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$t=1,m=64,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ!$RdescudvJCsgt3ub+b+dWRWJTmaaJObG",
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$Rdes",
+	} {
+		err := argon2.CompareHashAndPassword([]byte(one), []byte("password"))
+		check.Error(t, err, one)
+		check.False(t, errors.Is(err, argon2.ErrMismatchedHashAndPassword), one)
+	}
+}
@@ -21,27 +21,58 @@ import (
 	"github.com/ddkwork/toolbox/xio/fs/safe"
 )
 
+// JSONOption defines an option for loading JSON data.
+type JSONOption func(*jsonOptions)
+
+type jsonOptions struct {
+	validate func(data []byte) error
+}
+
+// JSONValidator causes the raw JSON data to be passed to validate before it is decoded. If validate returns an error,
+// the data is not decoded and the error is returned as the cause of the one from the load. A compiled JSON Schema's
+// ValidateJSON method from the formats/json package may be used to check the data against the schema.
+func JSONValidator(validate func(data []byte) error) JSONOption {
+	return func(opts *jsonOptions) { opts.validate = validate }
+}
+
 // LoadJSON data from the specified path.
-func LoadJSON(path string, data any) error {
+func LoadJSON(path string, data any, options ...JSONOption) error {
 	f, err := os.Open(path)
 	if err != nil {
 		return errs.NewWithCause(path, err)
 	}
-	return loadJSON(f, path, data)
+	return loadJSON(f, path, data, options)
 }
 
 // LoadJSONFromFS data from the specified filesystem path.
-func LoadJSONFromFS(fsys fs.FS, path string, data any) error {
+func LoadJSONFromFS(fsys fs.FS, path string, data any, options ...JSONOption) error {
 	f, err := fsys.Open(path)
 	if err != nil {
 		return errs.NewWithCause(path, err)
 	}
-	return loadJSON(f, path, data)
+	return loadJSON(f, path, data, options)
 }
 
-func loadJSON(r io.ReadCloser, path string, data any) error {
+func loadJSON(r io.ReadCloser, path string, data any, options []JSONOption) error {
 	defer xio.CloseIgnoringErrors(r)
-	if err := json.NewDecoder(bufio.NewReader(r)).Decode(data); err != nil {
+	var opts jsonOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.validate == nil {
+		if err := json.NewDecoder(bufio.NewReader(r)).Decode(data); err != nil {
+			return errs.NewWithCause(path, err)
+		}
+		return nil
+	}
+	buffer, err := io.ReadAll(r)
+	if err != nil {
+		return errs.NewWithCause(path, err)
+	}
+	if err = opts.validate(buffer); err != nil {
+		return errs.NewWithCause(path, err)
+	}
+	if err = json.Unmarshal(buffer, data); err != nil {
 		return errs.NewWithCause(path, err)
 	}
 	return nil
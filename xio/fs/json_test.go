@@ -10,10 +10,13 @@
 package fs_test
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/formats/json"
 	"github.com/ddkwork/toolbox/xio/fs"
 )
 
@@ -35,3 +38,33 @@ func TestLoadSaveJSON(t *testing.T) {
 	check.NoError(t, os.Remove(f.Name()))
 	check.Equal(t, value, &value2)
 }
+
+func TestLoadJSONWithSchema(t *testing.T) {
+	type data struct {
+		Name  string
+		Count int
+	}
+	schema, err := json.NewSchema(json.MustParse([]byte(`{
+		"type": "object",
+		"required": ["Name"],
+		"properties": {"Name": {"type": "string"}, "Count": {"type": "integer", "minimum": 1}}
+	}`)))
+	check.NoError(t, err)
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	check.NoError(t, os.WriteFile(good, []byte(`{"Name":"Rich","Count":22}`), 0o600))
+	var value data
+	check.NoError(t, fs.LoadJSON(good, &value, fs.JSONValidator(schema.ValidateJSON)))
+	check.Equal(t, data{Name: "Rich", Count: 22}, value)
+
+	bad := filepath.Join(dir, "bad.json")
+	check.NoError(t, os.WriteFile(bad, []byte(`{"Count":0.5}`), 0o600))
+	value = data{}
+	err = fs.LoadJSON(bad, &value, fs.JSONValidator(schema.ValidateJSON))
+	check.Error(t, err)
+	var validationErr *json.ValidationError
+	check.True(t, errors.As(err, &validationErr))
+	check.Equal(t, 3, len(validationErr.Violations))
+	check.Contains(t, err.Error(), `"/Count": value must be >= 1`)
+	check.Equal(t, data{}, value)
+}
@@ -0,0 +1,434 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+// Package acme provides a client for obtaining certificates from an ACME certificate authority, such as Let's Encrypt,
+// using the http-01 challenge.
+//
+// See https://tools.ietf.org/html/rfc8555 for the protocol.
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio"
+)
+
+// Directory URLs for the Let's Encrypt certificate authority.
+const (
+	LetsEncryptURL        = "https://acme-v02.api.letsencrypt.org/directory"
+	LetsEncryptStagingURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// Status values for ACME objects.
+const (
+	StatusPending    = "pending"
+	StatusReady      = "ready"
+	StatusProcessing = "processing"
+	StatusValid      = "valid"
+	StatusInvalid    = "invalid"
+)
+
+const (
+	problemBadNonce     = "urn:ietf:params:acme:error:badNonce"
+	maxResponseSize     = 1 << 20
+	defaultPollInterval = time.Second
+)
+
+// Problem is an error reported by the certificate authority.
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return fmt.Sprintf("%s (status %d)", p.Type, p.Status)
+	}
+	return fmt.Sprintf("%s: %s (status %d)", p.Type, p.Detail, p.Status)
+}
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type order struct {
+	Error          *Problem `json:"error"`
+	Status         string   `json:"status"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+	Authorizations []string `json:"authorizations"`
+}
+
+type authorization struct {
+	Error      *Problem    `json:"error"`
+	Identifier identifier  `json:"identifier"`
+	Status     string      `json:"status"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type challenge struct {
+	Error  *Problem `json:"error"`
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+}
+
+// Client communicates with an ACME certificate authority on behalf of a single account.
+type Client struct {
+	// HTTPClient is used for all requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	key        *ecdsa.PrivateKey
+	dir        *directory
+	// PollInterval is how long to wait between checks on pending authorizations and orders. If zero or less, one
+	// second is used.
+	PollInterval time.Duration
+	directoryURL string
+	kid          string
+	nonces       []string
+	lock         sync.Mutex
+}
+
+// NewClient creates a new Client for the certificate authority with the given directory URL. The account key must be
+// an ECDSA P-256 key and should be retained, since it identifies the account.
+func NewClient(directoryURL string, accountKey *ecdsa.PrivateKey) (*Client, error) {
+	if err := checkKey(accountKey); err != nil {
+		return nil, err
+	}
+	return &Client{
+		key:          accountKey,
+		directoryURL: directoryURL,
+	}, nil
+}
+
+// Register creates the account with the certificate authority, agreeing to its terms of service, or locates the
+// existing account for the key. The contact list may contain "mailto:" URLs the authority can use to reach the account
+// holder.
+func (c *Client) Register(ctx context.Context, contact ...string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.register(ctx, contact)
+}
+
+func (c *Client) register(ctx context.Context, contact []string) error {
+	if err := c.loadDirectory(ctx); err != nil {
+		return err
+	}
+	payload := struct {
+		Contact              []string `json:"contact,omitempty"`
+		TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed"`
+	}{
+		Contact:              contact,
+		TermsOfServiceAgreed: true,
+	}
+	rsp, err := c.post(ctx, c.dir.NewAccount, payload, nil)
+	if err != nil {
+		return err
+	}
+	if c.kid = rsp.Header.Get("Location"); c.kid == "" {
+		return errs.New("account response lacks a location")
+	}
+	return nil
+}
+
+// ObtainCertificate requests a certificate for the domains, answering the http-01 challenges through the responder,
+// which must be reachable by the certificate authority on port 80 of each domain. The certificate's public key is
+// taken from certKey. Returns the certificate chain in DER form, leaf first. If Register() has not been called, it
+// will be called with no contacts.
+func (c *Client) ObtainCertificate(ctx context.Context, certKey crypto.Signer, responder *HTTP01Responder,
+	domains ...string,
+) ([][]byte, error) {
+	if len(domains) == 0 {
+		return nil, errs.New("at least one domain is required")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.kid == "" {
+		if err := c.register(ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+	ids := make([]identifier, len(domains))
+	for i, domain := range domains {
+		ids[i] = identifier{Type: "dns", Value: domain}
+	}
+	var o order
+	rsp, err := c.post(ctx, c.dir.NewOrder, struct {
+		Identifiers []identifier `json:"identifiers"`
+	}{Identifiers: ids}, &o)
+	if err != nil {
+		return nil, err
+	}
+	orderURL := rsp.Header.Get("Location")
+	for _, authzURL := range o.Authorizations {
+		if err = c.authorize(ctx, authzURL, responder); err != nil {
+			return nil, err
+		}
+	}
+	var csr []byte
+	if csr, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, certKey); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if _, err = c.post(ctx, o.Finalize, struct {
+		CSR string `json:"csr"`
+	}{CSR: encode(csr)}, &o); err != nil {
+		return nil, err
+	}
+	for o.Status != StatusValid {
+		switch o.Status {
+		case StatusInvalid:
+			return nil, problemOr(o.Error, "order for %s is invalid", strings.Join(domains, ", "))
+		case StatusPending, StatusReady, StatusProcessing:
+		default:
+			return nil, errs.Newf("unexpected order status %q", o.Status)
+		}
+		if err = c.wait(ctx); err != nil {
+			return nil, err
+		}
+		if _, err = c.post(ctx, orderURL, nil, &o); err != nil {
+			return nil, err
+		}
+	}
+	return c.downloadCertificate(ctx, o.Certificate)
+}
+
+func (c *Client) authorize(ctx context.Context, authzURL string, responder *HTTP01Responder) error {
+	var authz authorization
+	if _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+		return err
+	}
+	if authz.Status == StatusValid {
+		return nil
+	}
+	var chal *challenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == "http-01" {
+			chal = &authz.Challenges[i]
+			break
+		}
+	}
+	if chal == nil {
+		return errs.Newf("no http-01 challenge offered for %s", authz.Identifier.Value)
+	}
+	responder.add(chal.Token, chal.Token+"."+thumbprint(&c.key.PublicKey))
+	defer responder.remove(chal.Token)
+	if _, err := c.post(ctx, chal.URL, struct{}{}, nil); err != nil {
+		return err
+	}
+	for {
+		switch authz.Status {
+		case StatusValid:
+			return nil
+		case StatusInvalid:
+			var problem *Problem
+			for _, one := range authz.Challenges {
+				if one.Error != nil {
+					problem = one.Error
+					break
+				}
+			}
+			if problem == nil {
+				problem = authz.Error
+			}
+			return problemOr(problem, "authorization for %s is invalid", authz.Identifier.Value)
+		case StatusPending:
+		default:
+			return errs.Newf("unexpected authorization status %q for %s", authz.Status, authz.Identifier.Value)
+		}
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+		if _, err := c.post(ctx, authzURL, nil, &authz); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) downloadCertificate(ctx context.Context, certURL string) ([][]byte, error) {
+	rsp, err := c.post(ctx, certURL, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var chain [][]byte
+	rest := rsp.Body
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, errs.New("no certificates in response")
+	}
+	return chain, nil
+}
+
+func (c *Client) wait(ctx context.Context) error {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return errs.Wrap(ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+func problemOr(problem *Problem, format string, v ...any) error {
+	if problem != nil {
+		return errs.Wrap(problem)
+	}
+	return errs.Newf(format, v...)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) loadDirectory(ctx context.Context) error {
+	if c.dir != nil {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.directoryURL, http.NoBody)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	var dir directory
+	if _, err = c.do(req, &dir); err != nil {
+		return err
+	}
+	if dir.NewNonce == "" || dir.NewAccount == "" || dir.NewOrder == "" {
+		return errs.New("directory is incomplete")
+	}
+	c.dir = &dir
+	return nil
+}
+
+func (c *Client) nonce(ctx context.Context) (string, error) {
+	if n := len(c.nonces); n != 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		return nonce, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.dir.NewNonce, http.NoBody)
+	if err != nil {
+		return "", errs.Wrap(err)
+	}
+	var rsp *http.Response
+	if rsp, err = c.httpClient().Do(req); err != nil {
+		return "", errs.Wrap(err)
+	}
+	xio.DiscardAndCloseIgnoringErrors(rsp.Body)
+	nonce := rsp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errs.New("no nonce provided")
+	}
+	return nonce, nil
+}
+
+type response struct {
+	Header http.Header
+	Body   []byte
+}
+
+// post sends a signed request to the URL. A nil payload makes it a POST-as-GET request. If result is not nil, the
+// response body is decoded into it.
+func (c *Client) post(ctx context.Context, url string, payload, result any) (*response, error) {
+	for attempt := 0; ; attempt++ {
+		nonce, err := c.nonce(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var body []byte
+		if body, err = signJWS(c.key, c.kid, nonce, url, payload); err != nil {
+			return nil, err
+		}
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body)); err != nil {
+			return nil, errs.Wrap(err)
+		}
+		req.Header.Set("Content-Type", "application/jose+json")
+		var rsp *response
+		if rsp, err = c.do(req, result); err != nil {
+			var problem *Problem
+			if attempt == 0 && errors.As(err, &problem) && problem.Type == problemBadNonce {
+				continue
+			}
+			return nil, err
+		}
+		return rsp, nil
+	}
+}
+
+func (c *Client) do(req *http.Request, result any) (*response, error) {
+	rsp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer xio.CloseIgnoringErrors(rsp.Body)
+	if nonce := rsp.Header.Get("Replay-Nonce"); nonce != "" {
+		c.nonces = append(c.nonces, nonce)
+	}
+	var body []byte
+	if body, err = io.ReadAll(io.LimitReader(rsp.Body, maxResponseSize)); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	if rsp.StatusCode >= http.StatusBadRequest {
+		problem := &Problem{Status: rsp.StatusCode}
+		if json.Unmarshal(body, problem) != nil || problem.Type == "" {
+			problem.Type = "about:blank"
+			problem.Detail = strings.TrimSpace(string(body))
+		}
+		problem.Status = rsp.StatusCode
+		return nil, errs.Wrap(problem)
+	}
+	if result != nil {
+		if err = json.Unmarshal(body, result); err != nil {
+			return nil, errs.NewWithCause("unable to decode response from "+req.URL.String(), err)
+		}
+	}
+	return &response{Header: rsp.Header, Body: body}, nil
+}
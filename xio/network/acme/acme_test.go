@@ -0,0 +1,100 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package acme_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/xio/network/acme"
+	"github.com/ddkwork/toolbox/xio/network/acme/acmetest"
+)
+
+func newClient(t *testing.T, ca *acmetest.Server) *acme.Client {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	check.NoError(t, err)
+	var client *acme.Client
+	client, err = acme.NewClient(ca.DirectoryURL(), key)
+	check.NoError(t, err)
+	client.PollInterval = 10 * time.Millisecond
+	return client
+}
+
+func TestObtainCertificate(t *testing.T) {
+	responder := acme.NewHTTP01Responder()
+	challenges := httptest.NewServer(responder.Wrap(nil))
+	defer challenges.Close()
+	ca, err := acmetest.NewServer(strings.TrimPrefix(challenges.URL, "http://"))
+	check.NoError(t, err)
+	defer ca.Close()
+
+	client := newClient(t, ca)
+	check.NoError(t, client.Register(context.Background(), "mailto:admin@example.test"))
+	var certKey *ecdsa.PrivateKey
+	certKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	check.NoError(t, err)
+	var chain [][]byte
+	chain, err = client.ObtainCertificate(context.Background(), certKey, responder, "example.test", "www.example.test")
+	check.NoError(t, err)
+	check.Equal(t, 2, len(chain))
+	check.Equal(t, 1, ca.Issued())
+
+	var leaf *x509.Certificate
+	leaf, err = x509.ParseCertificate(chain[0])
+	check.NoError(t, err)
+	check.Equal(t, []string{"example.test", "www.example.test"}, leaf.DNSNames)
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "www.example.test", Roots: ca.Roots()})
+	check.NoError(t, err)
+
+	// The challenge tokens are removed once validation completes.
+	rsp, err := http.Get(challenges.URL + acme.ChallengePathPrefix + "anything") //nolint:noctx // Test only
+	check.NoError(t, err)
+	check.NoError(t, rsp.Body.Close())
+	check.Equal(t, http.StatusNotFound, rsp.StatusCode)
+}
+
+func TestFailedChallenge(t *testing.T) {
+	// The certificate authority fetches challenges from a server that doesn't know the tokens.
+	challenges := httptest.NewServer(acme.NewHTTP01Responder().Wrap(nil))
+	defer challenges.Close()
+	ca, err := acmetest.NewServer(strings.TrimPrefix(challenges.URL, "http://"))
+	check.NoError(t, err)
+	defer ca.Close()
+
+	var certKey *ecdsa.PrivateKey
+	certKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	check.NoError(t, err)
+	_, err = newClient(t, ca).ObtainCertificate(context.Background(), certKey, acme.NewHTTP01Responder(),
+		"example.test")
+	var problem *acme.Problem
+	check.True(t, errors.As(err, &problem))
+	check.Equal(t, "urn:ietf:params:acme:error:unauthorized", problem.Type)
+	check.Equal(t, 0, ca.Issued())
+}
+
+func TestAccountKeyType(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	check.NoError(t, err)
+	_, err = acme.NewClient(acme.LetsEncryptStagingURL, key)
+	check.Error(t, err)
+	_, err = acme.NewClient(acme.LetsEncryptStagingURL, nil)
+	check.Error(t, err)
+}
@@ -0,0 +1,524 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+// Package acmetest provides a minimal ACME certificate authority for use in tests, in the spirit of Pebble. It
+// verifies request signatures and nonces, validates http-01 challenges by fetching them over HTTP, and issues
+// certificates signed by an in-memory root.
+package acmetest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio"
+)
+
+// Server is a test ACME certificate authority.
+type Server struct {
+	server   *httptest.Server
+	caKey    *ecdsa.PrivateKey
+	caCert   *x509.Certificate
+	roots    *x509.CertPool
+	accounts map[string]*ecdsa.PublicKey
+	nonces   map[string]bool
+	orders   map[string]*order
+	authzs   map[string]*authorization
+	certs    map[string][]byte
+	// ChallengeAddress is the host:port that http-01 challenges are fetched from, in place of port 80 of the domain
+	// being validated. The domain is still sent as the Host header.
+	ChallengeAddress string
+	// Validity is how long issued certificates are valid for.
+	Validity time.Duration
+	lock     sync.Mutex
+	next     int
+	issued   int
+}
+
+type order struct {
+	Error          *problem     `json:"error,omitempty"`
+	Status         string       `json:"status"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+	Identifiers    []identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	account        string
+}
+
+type authorization struct {
+	Identifier identifier `json:"identifier"`
+	Status     string     `json:"status"`
+	account    string
+	Challenges []*challenge `json:"challenges"`
+}
+
+type challenge struct {
+	Error  *problem `json:"error,omitempty"`
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+type jsonWebKey struct {
+	Crv string `json:"crv"`
+	Kty string `json:"kty"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewServer creates and starts a new Server that fetches http-01 challenges from the challenge address.
+func NewServer(challengeAddress string) (*Server, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acmetest root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour * 365),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	var der []byte
+	if der, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	s := &Server{
+		caKey:            key,
+		roots:            x509.NewCertPool(),
+		accounts:         make(map[string]*ecdsa.PublicKey),
+		nonces:           make(map[string]bool),
+		orders:           make(map[string]*order),
+		authzs:           make(map[string]*authorization),
+		certs:            make(map[string][]byte),
+		ChallengeAddress: challengeAddress,
+		Validity:         90 * 24 * time.Hour,
+	}
+	if s.caCert, err = x509.ParseCertificate(der); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	s.roots.AddCert(s.caCert)
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s, nil
+}
+
+// DirectoryURL returns the URL of the directory, for use with acme.NewClient().
+func (s *Server) DirectoryURL() string {
+	return s.server.URL + "/directory"
+}
+
+// Roots returns a pool containing the root certificate that issued certificates chain to.
+func (s *Server) Roots() *x509.CertPool {
+	return s.roots
+}
+
+// Issued returns the number of certificates that have been issued.
+func (s *Server) Issued() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.issued
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	if req.URL.Path == "/directory" {
+		s.reply(w, http.StatusOK, map[string]string{
+			"newNonce":   s.server.URL + "/new-nonce",
+			"newAccount": s.server.URL + "/new-account",
+			"newOrder":   s.server.URL + "/new-order",
+		})
+		return
+	}
+	if req.URL.Path == "/new-nonce" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if req.Method != http.MethodPost {
+		s.fail(w, http.StatusMethodNotAllowed, "malformed", "POST required")
+		return
+	}
+	account, payload, ok := s.verify(w, req)
+	if !ok {
+		return
+	}
+	kind, id, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	switch kind {
+	case "new-account":
+		w.Header().Set("Location", account)
+		s.reply(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case "new-order":
+		s.newOrder(w, account, payload)
+	case "order":
+		if o, exists := s.orders[id]; exists && o.account == account {
+			s.reply(w, http.StatusOK, o)
+			return
+		}
+		s.fail(w, http.StatusNotFound, "malformed", "no such order")
+	case "authz":
+		if authz, exists := s.authzs[id]; exists && authz.account == account {
+			s.reply(w, http.StatusOK, authz)
+			return
+		}
+		s.fail(w, http.StatusNotFound, "malformed", "no such authorization")
+	case "chal":
+		s.respondToChallenge(w, account, id)
+	case "finalize":
+		s.finalize(w, account, id, payload)
+	case "cert":
+		if chain, exists := s.certs[id]; exists {
+			w.Header().Set("Content-Type", "application/pem-certificate-chain")
+			_, _ = w.Write(chain) //nolint:errcheck // The client will report the failure
+			return
+		}
+		s.fail(w, http.StatusNotFound, "malformed", "no such certificate")
+	default:
+		s.fail(w, http.StatusNotFound, "malformed", "unknown resource")
+	}
+}
+
+// verify checks the signature, nonce and URL of a request, returning the account URL and the decoded payload.
+func (s *Server) verify(w http.ResponseWriter, req *http.Request) (account string, payload []byte, ok bool) {
+	var msg struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+		Signature string `json:"signature"`
+	}
+	var header struct {
+		JWK   *jsonWebKey `json:"jwk"`
+		Alg   string      `json:"alg"`
+		KID   string      `json:"kid"`
+		Nonce string      `json:"nonce"`
+		URL   string      `json:"url"`
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil || json.Unmarshal(body, &msg) != nil {
+		s.fail(w, http.StatusBadRequest, "malformed", "invalid JWS")
+		return "", nil, false
+	}
+	var data []byte
+	if data, err = base64.RawURLEncoding.DecodeString(msg.Protected); err != nil || json.Unmarshal(data, &header) != nil {
+		s.fail(w, http.StatusBadRequest, "malformed", "invalid protected header")
+		return "", nil, false
+	}
+	if !s.nonces[header.Nonce] {
+		s.fail(w, http.StatusBadRequest, "badNonce", "unknown nonce")
+		return "", nil, false
+	}
+	delete(s.nonces, header.Nonce)
+	if header.Alg != "ES256" || header.URL != s.server.URL+req.URL.Path {
+		s.fail(w, http.StatusBadRequest, "malformed", "unexpected algorithm or URL")
+		return "", nil, false
+	}
+	var key *ecdsa.PublicKey
+	switch {
+	case header.JWK != nil && req.URL.Path == "/new-account":
+		if key, err = header.JWK.publicKey(); err != nil {
+			s.fail(w, http.StatusBadRequest, "malformed", err.Error())
+			return "", nil, false
+		}
+		account = s.server.URL + "/account/" + thumbprint(header.JWK)
+		s.accounts[account] = key
+	case header.KID != "":
+		account = header.KID
+		if key = s.accounts[account]; key == nil {
+			s.fail(w, http.StatusBadRequest, "accountDoesNotExist", "unknown account")
+			return "", nil, false
+		}
+	default:
+		s.fail(w, http.StatusBadRequest, "malformed", "jwk or kid required")
+		return "", nil, false
+	}
+	var signature []byte
+	if signature, err = base64.RawURLEncoding.DecodeString(msg.Signature); err != nil || len(signature) != 64 {
+		s.fail(w, http.StatusBadRequest, "malformed", "invalid signature")
+		return "", nil, false
+	}
+	digest := sha256.Sum256([]byte(msg.Protected + "." + msg.Payload))
+	if !ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+		s.fail(w, http.StatusUnauthorized, "unauthorized", "signature does not verify")
+		return "", nil, false
+	}
+	if payload, err = base64.RawURLEncoding.DecodeString(msg.Payload); err != nil {
+		s.fail(w, http.StatusBadRequest, "malformed", "invalid payload")
+		return "", nil, false
+	}
+	return account, payload, true
+}
+
+func (s *Server) newOrder(w http.ResponseWriter, account string, payload []byte) {
+	var req struct {
+		Identifiers []identifier `json:"identifiers"`
+	}
+	if json.Unmarshal(payload, &req) != nil || len(req.Identifiers) == 0 {
+		s.fail(w, http.StatusBadRequest, "malformed", "identifiers required")
+		return
+	}
+	id := s.nextID()
+	o := &order{
+		Status:      "pending",
+		Finalize:    s.server.URL + "/finalize/" + id,
+		account:     account,
+		Identifiers: req.Identifiers,
+	}
+	for _, ident := range req.Identifiers {
+		if ident.Type != "dns" {
+			s.fail(w, http.StatusBadRequest, "unsupportedIdentifier", "only dns identifiers are supported")
+			return
+		}
+		authzID := s.nextID()
+		s.authzs[authzID] = &authorization{
+			Identifier: ident,
+			Status:     "pending",
+			account:    account,
+			Challenges: []*challenge{{
+				Type:   "http-01",
+				URL:    s.server.URL + "/chal/" + authzID,
+				Token:  s.newNonce(),
+				Status: "pending",
+			}},
+		}
+		o.Authorizations = append(o.Authorizations, s.server.URL+"/authz/"+authzID)
+	}
+	s.orders[id] = o
+	w.Header().Set("Location", s.server.URL+"/order/"+id)
+	s.reply(w, http.StatusCreated, o)
+}
+
+func (s *Server) respondToChallenge(w http.ResponseWriter, account, id string) {
+	authz, exists := s.authzs[id]
+	if !exists || authz.account != account {
+		s.fail(w, http.StatusNotFound, "malformed", "no such challenge")
+		return
+	}
+	chal := authz.Challenges[0]
+	if chal.Status == "pending" {
+		chal.Status = "processing"
+		go s.validate(authz, chal, thumbprint(jwkFor(s.accounts[account])))
+	}
+	s.reply(w, http.StatusOK, chal)
+}
+
+// validate fetches the challenge response and updates the authorization and any orders depending on it.
+func (s *Server) validate(authz *authorization, chal *challenge, accountThumbprint string) {
+	var failure *problem
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+s.ChallengeAddress+"/.well-known/acme-challenge/"+chal.Token, http.NoBody)
+	if err == nil {
+		req.Host = authz.Identifier.Value
+		var rsp *http.Response
+		if rsp, err = http.DefaultClient.Do(req); err == nil {
+			var body []byte
+			body, err = io.ReadAll(rsp.Body)
+			xio.CloseIgnoringErrors(rsp.Body)
+			if err == nil && (rsp.StatusCode != http.StatusOK ||
+				strings.TrimSpace(string(body)) != chal.Token+"."+accountThumbprint) {
+				err = errs.Newf("unexpected challenge response (status %d)", rsp.StatusCode)
+			}
+		}
+	}
+	if err != nil {
+		failure = &problem{
+			Type:   "urn:ietf:params:acme:error:unauthorized",
+			Detail: err.Error(),
+			Status: http.StatusForbidden,
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if failure != nil {
+		chal.Status = "invalid"
+		chal.Error = failure
+		authz.Status = "invalid"
+	} else {
+		chal.Status = "valid"
+		authz.Status = "valid"
+	}
+	for _, o := range s.orders {
+		if o.Status != "pending" {
+			continue
+		}
+		ready := true
+		for _, authzURL := range o.Authorizations {
+			authzID := strings.TrimPrefix(authzURL, s.server.URL+"/authz/")
+			if status := s.authzs[authzID].Status; status == "invalid" {
+				o.Status = "invalid"
+				o.Error = failure
+				ready = false
+				break
+			} else if status != "valid" {
+				ready = false
+			}
+		}
+		if ready {
+			o.Status = "ready"
+		}
+	}
+}
+
+func (s *Server) finalize(w http.ResponseWriter, account, id string, payload []byte) {
+	o, exists := s.orders[id]
+	if !exists || o.account != account {
+		s.fail(w, http.StatusNotFound, "malformed", "no such order")
+		return
+	}
+	if o.Status != "ready" {
+		s.fail(w, http.StatusForbidden, "orderNotReady", "order is "+o.Status)
+		return
+	}
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	var csr *x509.CertificateRequest
+	var der []byte
+	err := json.Unmarshal(payload, &req)
+	if err == nil {
+		if der, err = base64.RawURLEncoding.DecodeString(req.CSR); err == nil {
+			if csr, err = x509.ParseCertificateRequest(der); err == nil {
+				err = csr.CheckSignature()
+			}
+		}
+	}
+	if err != nil || csr == nil {
+		s.fail(w, http.StatusBadRequest, "badCSR", "invalid CSR")
+		return
+	}
+	names := make([]string, len(o.Identifiers))
+	for i, ident := range o.Identifiers {
+		names[i] = ident.Value
+	}
+	requested := slices.Clone(csr.DNSNames)
+	slices.Sort(names)
+	slices.Sort(requested)
+	if !slices.Equal(names, requested) {
+		s.fail(w, http.StatusBadRequest, "badCSR", "CSR names do not match the order")
+		return
+	}
+	s.next++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(s.next) + 1),
+		Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(s.Validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if der, err = x509.CreateCertificate(rand.Reader, template, s.caCert, csr.PublicKey, s.caKey); err != nil {
+		s.fail(w, http.StatusInternalServerError, "serverInternal", err.Error())
+		return
+	}
+	certID := s.nextID()
+	s.certs[certID] = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.caCert.Raw})...)
+	s.issued++
+	o.Status = "valid"
+	o.Certificate = s.server.URL + "/cert/" + certID
+	s.reply(w, http.StatusOK, o)
+}
+
+func (s *Server) nextID() string {
+	s.next++
+	return fmt.Sprint(s.next)
+}
+
+func (s *Server) newNonce() string {
+	var buffer [16]byte
+	if _, err := rand.Read(buffer[:]); err != nil {
+		panic(err)
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(buffer[:])
+	s.nonces[nonce] = true
+	return nonce
+}
+
+func (s *Server) reply(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value) //nolint:errcheck // The client will report the failure
+}
+
+func (s *Server) fail(w http.ResponseWriter, status int, kind, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	//nolint:errcheck // The client will report the failure
+	_ = json.NewEncoder(w).Encode(&problem{
+		Type:   "urn:ietf:params:acme:error:" + kind,
+		Detail: detail,
+		Status: status,
+	})
+}
+
+func (k *jsonWebKey) publicKey() (*ecdsa.PublicKey, error) {
+	if k.Kty != "EC" || k.Crv != "P-256" {
+		return nil, errs.New("only P-256 keys are supported")
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	var y []byte
+	if y, err = base64.RawURLEncoding.DecodeString(k.Y); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+func jwkFor(key *ecdsa.PublicKey) *jsonWebKey {
+	return &jsonWebKey{
+		Crv: "P-256",
+		Kty: "EC",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func thumbprint(k *jsonWebKey) string {
+	sum := sha256.Sum256(fmt.Appendf(nil, `{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k.Crv, k.Kty, k.X, k.Y))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,67 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package acme
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ddkwork/toolbox/xio/network/xhttp"
+)
+
+// ChallengePathPrefix is the path prefix the certificate authority requests http-01 challenge responses from.
+const ChallengePathPrefix = "/.well-known/acme-challenge/"
+
+// HTTP01Responder answers http-01 challenges for a Client. It must be installed in the server handling port 80 for
+// the domains being validated.
+type HTTP01Responder struct {
+	tokens map[string]string
+	lock   sync.RWMutex
+}
+
+// NewHTTP01Responder creates a new HTTP01Responder.
+func NewHTTP01Responder() *HTTP01Responder {
+	return &HTTP01Responder{tokens: make(map[string]string)}
+}
+
+// Wrap an http.Handler, answering challenge requests and passing everything else through to the handler. The handler
+// may be nil, in which case other requests receive a 404 response.
+func (r *HTTP01Responder) Wrap(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if token, ok := strings.CutPrefix(req.URL.Path, ChallengePathPrefix); ok {
+			r.lock.RLock()
+			keyAuth, exists := r.tokens[token]
+			r.lock.RUnlock()
+			if exists {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = w.Write([]byte(keyAuth)) //nolint:errcheck // Nothing useful can be done with the error
+				return
+			}
+		}
+		if handler == nil {
+			xhttp.WriteHTTPStatus(w, http.StatusNotFound)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+func (r *HTTP01Responder) add(token, keyAuth string) {
+	r.lock.Lock()
+	r.tokens[token] = keyAuth
+	r.lock.Unlock()
+}
+
+func (r *HTTP01Responder) remove(token string) {
+	r.lock.Lock()
+	delete(r.tokens, token)
+	r.lock.Unlock()
+}
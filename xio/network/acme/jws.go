@@ -0,0 +1,117 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// jsonWebKey is the public portion of an ECDSA P-256 key, in JSON Web Key form.
+type jsonWebKey struct {
+	Crv string `json:"crv"`
+	Kty string `json:"kty"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwsProtected struct {
+	JWK   *jsonWebKey `json:"jwk,omitempty"`
+	Alg   string      `json:"alg"`
+	KID   string      `json:"kid,omitempty"`
+	Nonce string      `json:"nonce"`
+	URL   string      `json:"url"`
+}
+
+type jwsMessage struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+func checkKey(key *ecdsa.PrivateKey) error {
+	if key == nil || key.Curve != elliptic.P256() {
+		return errs.New("account key must be an ECDSA P-256 key")
+	}
+	return nil
+}
+
+func newJSONWebKey(key *ecdsa.PublicKey) *jsonWebKey {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return &jsonWebKey{
+		Crv: key.Curve.Params().Name,
+		Kty: "EC",
+		X:   encode(key.X.FillBytes(make([]byte, size))),
+		Y:   encode(key.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the key.
+func thumbprint(key *ecdsa.PublicKey) string {
+	jwk := newJSONWebKey(key)
+	// The members must be in lexicographic order with no whitespace, which is exactly what this produces.
+	sum := sha256.Sum256(fmt.Appendf(nil, `{"crv":%q,"kty":%q,"x":%q,"y":%q}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y))
+	return encode(sum[:])
+}
+
+// signJWS produces a flattened JWS for the payload. If kid is empty, the public key is embedded instead. A nil payload
+// produces the empty payload used for POST-as-GET requests.
+func signJWS(key *ecdsa.PrivateKey, kid, nonce, url string, payload any) ([]byte, error) {
+	protected := jwsProtected{
+		Alg:   "ES256",
+		KID:   kid,
+		Nonce: nonce,
+		URL:   url,
+	}
+	if kid == "" {
+		protected.JWK = newJSONWebKey(&key.PublicKey)
+	}
+	header, err := json.Marshal(&protected)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	var body string
+	if payload != nil {
+		var data []byte
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, errs.Wrap(err)
+		}
+		body = encode(data)
+	}
+	msg := jwsMessage{
+		Protected: encode(header),
+		Payload:   body,
+	}
+	digest := sha256.Sum256([]byte(msg.Protected + "." + msg.Payload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	msg.Signature = encode(signature)
+	var data []byte
+	if data, err = json.Marshal(&msg); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	return data, nil
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,293 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package natpmp
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ddkwork/toolbox/atexit"
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// DefaultGatewayPort is the port PCP and NAT-PMP gateways listen on.
+const DefaultGatewayPort = 5351
+
+// renewalInterval is how often a Client checks whether any of its mappings need renewing.
+const renewalInterval = time.Minute
+
+// Clock provides the time to a Client.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel that receives the current time once the duration has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is a Clock that uses the system time.
+type SystemClock struct{}
+
+// Now implements Clock.
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After implements Clock.
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type mapping struct {
+	external   int
+	renew      time.Time
+	notifyChan chan any
+}
+
+// Client maps ports through a single gateway and keeps those mappings renewed until they are unmapped, the Client is
+// closed, or the program exits via atexit.Exit().
+type Client struct {
+	gateway        *net.UDPAddr
+	ssdp           *net.UDPAddr
+	clock          Clock
+	mappings       map[int]mapping
+	active         mapper
+	done           chan struct{}
+	probeTimeout   time.Duration
+	requestTimeout time.Duration
+	atexitID       int
+	lock           sync.RWMutex
+	mapperLock     sync.Mutex
+	closeOnce      sync.Once
+}
+
+// NewClient creates a new Client for the gateway at the given address. If the address has no port,
+// DefaultGatewayPort will be used. If the address is nil, only UPnP IGD discovery will be attempted. If clock is nil,
+// SystemClock will be used.
+func NewClient(gateway *net.UDPAddr, clock Clock) *Client {
+	if gateway != nil && gateway.Port == 0 {
+		addr := *gateway
+		addr.Port = DefaultGatewayPort
+		gateway = &addr
+	}
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	c := &Client{
+		gateway:        gateway,
+		ssdp:           ssdpAddress,
+		clock:          clock,
+		mappings:       make(map[int]mapping),
+		done:           make(chan struct{}),
+		probeTimeout:   probeTimeout,
+		requestTimeout: requestTimeout,
+	}
+	c.atexitID = atexit.Register(func() {
+		_ = c.unmapAll() //nolint:errcheck // Nothing useful can be done with the error at exit
+	})
+	go c.renewLoop()
+	return c
+}
+
+// Close unmaps all of the ports mapped by this Client and stops renewing them. Returns the first error encountered
+// while unmapping, if any.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		atexit.Unregister(c.atexitID)
+		err = c.unmapAll()
+	})
+	return err
+}
+
+func (c *Client) unmapAll() error {
+	c.lock.RLock()
+	keys := make([]int, 0, len(c.mappings))
+	for key := range c.mappings {
+		keys = append(keys, key)
+	}
+	c.lock.RUnlock()
+	var firstErr error
+	for _, key := range keys {
+		if err := c.unmapPort(key&tcpFlag != 0, key&^tcpFlag); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (c *Client) renewLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.clock.After(renewalInterval):
+			c.renewMappings()
+		}
+	}
+}
+
+func (c *Client) renewMappings() {
+	now := c.clock.Now()
+	c.lock.RLock()
+	renew := make(map[int]mapping, len(c.mappings))
+	for k, v := range c.mappings {
+		if !now.Before(v.renew) {
+			renew[k] = v
+		}
+	}
+	c.lock.RUnlock()
+	for key, v := range renew {
+		tcp := key&tcpFlag != 0
+		port := key &^ tcpFlag
+		external, err := c.mapPort(tcp, port, v.notifyChan)
+		if v.notifyChan == nil {
+			continue
+		}
+		var msg any
+		switch {
+		case err != nil:
+			msg = errs.NewWithCausef(err, "Mapping renewal for %s port %d failed", protocolName(tcp), port)
+		case v.external != external:
+			msg = external
+		default:
+			continue
+		}
+		select {
+		case v.notifyChan <- msg:
+		default:
+		}
+	}
+}
+
+// Protocol returns the name of the port mapping protocol being used with the gateway: "PCP", "NAT-PMP" or "UPnP IGD".
+func (c *Client) Protocol() (string, error) {
+	m, err := c.currentMapper()
+	if err != nil {
+		return "", err
+	}
+	return m.String(), nil
+}
+
+// ExternalAddress returns the external address the internet sees you as having.
+func (c *Client) ExternalAddress() (net.IP, error) {
+	m, err := c.currentMapper()
+	if err != nil {
+		return nil, err
+	}
+	return m.externalAddress()
+}
+
+// MapTCP maps the specified TCP port for external access. It returns the port on the external address that can be used
+// to connect to the internal port. If you wish to be notified of changes to the external port mapping, provide a notify
+// channel. It will be sent an int containing the updated external port mapping when it changes or an error if a renewal
+// fails. The channel will only be sent to if it is ready.
+func (c *Client) MapTCP(port int, notifyChan chan any) (int, error) {
+	return c.mapPort(true, port, notifyChan)
+}
+
+// MapUDP maps the specified UDP port for external access. It returns the port on the external address that can be used
+// to connect to the internal port. If you wish to be notified of changes to the external port mapping, provide a notify
+// channel. It will be sent an int containing the updated external port mapping when it changes or an error if a renewal
+// fails. The channel will only be sent to if it is ready.
+func (c *Client) MapUDP(port int, notifyChan chan any) (int, error) {
+	return c.mapPort(false, port, notifyChan)
+}
+
+// UnmapTCP unmaps a previously mapped internal TCP port.
+func (c *Client) UnmapTCP(port int) error {
+	return c.unmapPort(true, port)
+}
+
+// UnmapUDP unmaps a previously mapped internal UDP port.
+func (c *Client) UnmapUDP(port int) error {
+	return c.unmapPort(false, port)
+}
+
+func (c *Client) mapPort(tcp bool, port int, notifyChan chan any) (int, error) {
+	if err := checkPort(port); err != nil {
+		return 0, err
+	}
+	m, err := c.currentMapper()
+	if err != nil {
+		return 0, err
+	}
+	key := mappingKey(tcp, port)
+	c.lock.RLock()
+	previous := c.mappings[key].external
+	c.lock.RUnlock()
+	external, lifetime, err := m.addMapping(tcp, port, previous, requestedLifetime)
+	if err != nil {
+		return 0, err
+	}
+	if lifetime <= 0 || lifetime > requestedLifetime {
+		lifetime = requestedLifetime
+	}
+	c.lock.Lock()
+	c.mappings[key] = mapping{
+		external: external,
+		// Renew once five sixths of the lifetime has elapsed, which is 50 minutes for the requested hour.
+		renew:      c.clock.Now().Add(lifetime * 5 / 6),
+		notifyChan: notifyChan,
+	}
+	c.lock.Unlock()
+	return external, nil
+}
+
+func (c *Client) unmapPort(tcp bool, port int) error {
+	if err := checkPort(port); err != nil {
+		return err
+	}
+	m, err := c.currentMapper()
+	if err != nil {
+		return err
+	}
+	key := mappingKey(tcp, port)
+	c.lock.RLock()
+	external := c.mappings[key].external
+	c.lock.RUnlock()
+	if err = m.deleteMapping(tcp, port, external); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	delete(c.mappings, key)
+	c.lock.Unlock()
+	return nil
+}
+
+// currentMapper returns the mapper for the protocol the gateway supports, determining it first if necessary.
+func (c *Client) currentMapper() (mapper, error) {
+	c.mapperLock.Lock()
+	defer c.mapperLock.Unlock()
+	if c.active != nil {
+		return c.active, nil
+	}
+	if c.gateway != nil {
+		p := newPCP(c.gateway, c.probeTimeout)
+		if err := p.announce(); err == nil {
+			p.timeout = c.requestTimeout
+			c.active = p
+			return c.active, nil
+		}
+		n := &pmp{gateway: c.gateway, timeout: c.probeTimeout}
+		if _, err := n.externalAddress(); err == nil {
+			n.timeout = c.requestTimeout
+			c.active = n
+			return c.active, nil
+		}
+	}
+	u, err := discoverUPnP(c.ssdp, c.probeTimeout, c.requestTimeout)
+	if err != nil {
+		return nil, errs.NewWithCause("No gateway supporting PCP, NAT-PMP or UPnP IGD found", err)
+	}
+	c.active = u
+	return c.active, nil
+}
@@ -7,178 +7,103 @@
 // This Source Code Form is "Incompatible With Secondary Licenses", as
 // defined by the Mozilla Public License, version 2.0.
 
-// Package natpmp provides an implementation of NAT-PMP.
-// See https://tools.ietf.org/html/rfc6886
+// Package natpmp provides port mapping through the gateway, using whichever of PCP, NAT-PMP or UPnP IGD it supports,
+// in that order of preference.
+//
+// The package-level functions use the gateway of the default route. Use NewClient() to map ports through a different
+// gateway, or through several of them.
+//
+// See https://tools.ietf.org/html/rfc6887 for PCP, https://tools.ietf.org/html/rfc6886 for NAT-PMP, and
+// http://upnp.org/specs/gw/UPnP-gw-WANIPConnection-v2-Service.pdf for UPnP IGD.
 package natpmp
 
 import (
-	"encoding/binary"
 	"errors"
 	"net"
 	"sync"
 	"time"
 
-	"github.com/ddkwork/toolbox/atexit"
 	"github.com/ddkwork/toolbox/errs"
 	"github.com/jackpal/gateway"
 )
 
 const (
-	protocolVersion = 0
-	expiration      = uint32(time.Hour / time.Second)
-	tcpFlag         = 0x10000
-)
-
-const (
-	opExternalAddress = iota
-	opMapUDP
-	opMapTCP
+	requestedLifetime = time.Hour
+	tcpFlag           = 0x10000
+	// initialRetransmit is the delay before the first retransmission of a UDP request. Each subsequent retransmission
+	// waits twice as long as the previous one.
+	initialRetransmit = 250 * time.Millisecond
+	// probeTimeout is how long to wait for a gateway to respond when determining which protocols it supports.
+	probeTimeout = 2 * time.Second
+	// requestTimeout is how long to wait for a gateway to respond once its protocol is known.
+	requestTimeout = 30 * time.Second
 )
 
-type mapping struct {
-	external   int
-	renew      time.Time
-	notifyChan chan any
+// mapper is implemented by each of the supported port mapping protocols.
+type mapper interface {
+	// String returns the name of the protocol.
+	String() string
+	externalAddress() (net.IP, error)
+	// addMapping maps the internal port, requesting the external port if it is not zero. Returns the external port
+	// and the lifetime of the mapping.
+	addMapping(tcp bool, internal, external int, lifetime time.Duration) (int, time.Duration, error)
+	deleteMapping(tcp bool, internal, external int) error
 }
 
 var (
-	gw       net.IP
-	lock     sync.RWMutex
-	mappings = make(map[int]mapping)
+	defaultOnce   sync.Once
+	defaultClient *Client
+	ssdpAddress   = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
 )
 
-func init() {
-	var err error
-	if gw, err = gateway.DiscoverGateway(); err == nil {
-		go func() {
-			atexit.Register(func() {
-				lock.RLock()
-				ports := make([]int, len(mappings))
-				for port := range mappings {
-					ports = append(ports, port)
-				}
-				lock.RUnlock()
-				for _, port := range ports {
-					if port&tcpFlag != 0 {
-						err = UnmapTCP(port &^ tcpFlag)
-					} else {
-						err = UnmapUDP(port)
-					}
-				}
-			})
-			for {
-				time.Sleep(time.Minute)
-				renew := make(map[int]mapping, len(mappings))
-				now := time.Now()
-				lock.RLock()
-				for k, v := range mappings {
-					if !now.Before(v.renew) {
-						renew[k] = v
-					}
-				}
-				lock.RUnlock()
-				for port, v := range renew {
-					var external int
-					if port&tcpFlag != 0 {
-						external, err = MapTCP(port&^tcpFlag, v.notifyChan)
-					} else {
-						external, err = MapUDP(port, v.notifyChan)
-					}
-					if v.notifyChan != nil {
-						if err != nil {
-							var portType string
-							if port&tcpFlag != 0 {
-								portType = "TCP"
-							} else {
-								portType = "UDP"
-							}
-							select {
-							case v.notifyChan <- errs.NewWithCausef(err, "Mapping renewal for %s port %d failed", portType, port):
-							default:
-							}
-						} else if v.external != external {
-							select {
-							case v.notifyChan <- external:
-							default:
-							}
-						}
-					}
-				}
-			}
-		}()
-	}
+// Default returns the Client for the gateway of the default route, creating it on first use.
+func Default() *Client {
+	defaultOnce.Do(func() {
+		var addr *net.UDPAddr
+		if ip, err := gateway.DiscoverGateway(); err == nil {
+			addr = &net.UDPAddr{IP: ip, Port: DefaultGatewayPort}
+		}
+		defaultClient = NewClient(addr, nil)
+	})
+	return defaultClient
+}
+
+// Protocol returns the name of the port mapping protocol being used with the default gateway: "PCP", "NAT-PMP" or
+// "UPnP IGD".
+func Protocol() (string, error) {
+	return Default().Protocol()
 }
 
 // ExternalAddress returns the external address the internet sees you as having.
 func ExternalAddress() (net.IP, error) {
-	buffer := make([]byte, 2)
-	buffer[0] = protocolVersion
-	buffer[1] = opExternalAddress
-	response, err := call(buffer, 12)
-	if err != nil {
-		return nil, err
-	}
-	return response[8:12], nil
+	return Default().ExternalAddress()
 }
 
-// MapTCP maps the specified TCP port for external access. It returns the port on the external address that can be used
-// to connect to the internal port. If you wish to be notified of changes to the external port mapping, provide a notify
-// channel. It will be sent an int containing the updated external port mapping when it changes or an error if a renewal
-// fails. The channel will only be sent to if it is ready.
+// MapTCP maps the specified TCP port for external access through the default gateway. See Client.MapTCP().
 func MapTCP(port int, notifyChan chan any) (int, error) {
-	if err := checkPort(port); err != nil {
-		return 0, err
-	}
-	response, err := call(makeMapBuffer(opMapTCP, uint16(port)), 16)
-	if err != nil {
-		return 0, err
-	}
-	external := int(binary.BigEndian.Uint16(response[10:12]))
-	addMapping(port|tcpFlag, external, notifyChan)
-	return external, nil
+	return Default().MapTCP(port, notifyChan)
 }
 
-// MapUDP maps the specified UDP port for external access. It returns the port on the external address that can be used
-// to connect to the internal port. If you wish to be notified of changes to the external port mapping, provide a notify
-// channel. It will be sent an int containing the updated external port mapping when it changes or an error if a renewal
-// fails. The channel will only be sent to if it is ready.
+// MapUDP maps the specified UDP port for external access through the default gateway. See Client.MapUDP().
 func MapUDP(port int, notifyChan chan any) (int, error) {
-	if err := checkPort(port); err != nil {
-		return 0, err
-	}
-	response, err := call(makeMapBuffer(opMapUDP, uint16(port)), 16)
-	if err != nil {
-		return 0, err
-	}
-	external := int(binary.BigEndian.Uint16(response[10:12]))
-	addMapping(port, external, notifyChan)
-	return external, nil
+	return Default().MapUDP(port, notifyChan)
 }
 
-// UnmapTCP unmaps a previously mapped internal TCP port.
+// UnmapTCP unmaps a previously mapped internal TCP port on the default gateway.
 func UnmapTCP(port int) error {
-	if err := checkPort(port); err != nil {
-		return err
-	}
-	_, err := call(makeUnmapBuffer(opMapTCP, uint16(port)), 16)
-	if err != nil {
-		return err
-	}
-	removeMapping(port | tcpFlag)
-	return err
+	return Default().UnmapTCP(port)
 }
 
-// UnmapUDP unmaps a previously mapped internal UDP port.
+// UnmapUDP unmaps a previously mapped internal UDP port on the default gateway.
 func UnmapUDP(port int) error {
-	if err := checkPort(port); err != nil {
-		return err
-	}
-	_, err := call(makeUnmapBuffer(opMapUDP, uint16(port)), 16)
-	if err != nil {
-		return err
+	return Default().UnmapUDP(port)
+}
+
+func mappingKey(tcp bool, port int) int {
+	if tcp {
+		return port | tcpFlag
 	}
-	removeMapping(port)
-	return err
+	return port
 }
 
 func checkPort(port int) error {
@@ -188,98 +113,54 @@ func checkPort(port int) error {
 	return errs.Newf("Port (%d) must be in the range 1-65535", port)
 }
 
-func makeMapBuffer(op byte, port uint16) []byte {
-	buffer := makeUnmapBuffer(op, port)
-	binary.BigEndian.PutUint16(buffer[6:8], port)
-	binary.BigEndian.PutUint32(buffer[8:12], expiration)
-	return buffer
-}
-
-func makeUnmapBuffer(op byte, port uint16) []byte {
-	buffer := make([]byte, 12)
-	buffer[0] = protocolVersion
-	buffer[1] = op
-	binary.BigEndian.PutUint16(buffer[4:6], port)
-	return buffer
-}
-
-func addMapping(internal, external int, notifyChan chan any) {
-	lock.Lock()
-	mappings[internal] = mapping{
-		external:   external,
-		renew:      time.Now().Add(50 * time.Minute),
-		notifyChan: notifyChan,
-	}
-	lock.Unlock()
-}
-
-func removeMapping(internal int) {
-	lock.Lock()
-	delete(mappings, internal)
-	lock.Unlock()
-}
-
-func call(msg []byte, resultSize int) ([]byte, error) {
-	if gw == nil {
-		return nil, errs.New("No gateway found")
-	}
-	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{
-		IP:   gw,
-		Port: 5351,
-	})
+// exchange sends the request to the address over UDP, retransmitting it with exponential backoff until a response
+// that satisfies match arrives or the timeout elapses.
+func exchange(addr *net.UDPAddr, request []byte, timeout time.Duration, match func([]byte) bool) ([]byte, error) {
+	conn, err := net.DialUDP("udp", nil, addr)
 	if err != nil {
 		return nil, errs.Wrap(err)
 	}
-	defer func() { err = conn.Close() }()
-	timeout := time.Now().Add(30 * time.Second)
-	err = conn.SetDeadline(timeout)
-	if err != nil {
-		return nil, errs.Wrap(err)
-	}
-	result := make([]byte, resultSize)
-	for time.Now().Before(timeout) {
-		if _, err = conn.Write(msg); err != nil {
+	defer func() { _ = conn.Close() }() //nolint:errcheck // The exchange has already concluded
+	deadline := time.Now().Add(timeout)
+	buffer := make([]byte, 1100)
+	for wait := initialRetransmit; time.Now().Before(deadline); wait *= 2 {
+		if _, err = conn.Write(request); err != nil {
 			return nil, errs.Wrap(err)
 		}
-		var n int
-		var remote *net.UDPAddr
-		if n, remote, err = conn.ReadFromUDP(result); err != nil {
-			var nerr net.Error
-			if errors.As(err, &nerr) && nerr.Timeout() {
-				continue
-			}
-			return nil, errs.Wrap(err)
-		}
-		if !remote.IP.Equal(gw) {
-			continue
-		}
-		if n != resultSize {
-			return nil, errs.Newf("Unexpected result size (received %d, expected %d)", n, resultSize)
-		}
-		if result[0] != 0 {
-			return nil, errs.Newf("Unknown protocol version (%d)", result[0])
+		readDeadline := time.Now().Add(wait)
+		if readDeadline.After(deadline) {
+			readDeadline = deadline
 		}
-		expectedOp := msg[1] | 0x80
-		if result[1] != expectedOp {
-			return nil, errs.Newf("Unexpected opcode (received %d, expected %d)", result[1], expectedOp)
+		if err = conn.SetReadDeadline(readDeadline); err != nil {
+			return nil, errs.Wrap(err)
 		}
-		code := binary.BigEndian.Uint16(result[2:4])
-		switch code {
-		case 0:
-			return result, nil
-		case 1:
-			return nil, errs.New("Unsupported version")
-		case 2:
-			return nil, errs.New("Not authorized")
-		case 3:
-			return nil, errs.New("Network failure")
-		case 4:
-			return nil, errs.New("Out of resources")
-		case 5:
-			return nil, errs.New("Unsupported opcode")
-		default:
-			return nil, errs.Newf("Unknown result code %d", code)
+		for {
+			var n int
+			if n, err = conn.Read(buffer); err != nil {
+				var nerr net.Error
+				if errors.As(err, &nerr) && nerr.Timeout() {
+					break
+				}
+				return nil, errs.Wrap(err)
+			}
+			if match(buffer[:n]) {
+				return append([]byte(nil), buffer[:n]...), nil
+			}
 		}
 	}
-	return nil, errs.Newf("Timed out trying to contact gateway")
+	return nil, errs.New("Timed out trying to contact gateway")
+}
+
+// localAddressFor returns the local address used to reach the address.
+func localAddressFor(addr *net.UDPAddr) (*net.UDPAddr, error) {
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer func() { _ = conn.Close() }() //nolint:errcheck // Only the local address was needed
+	local, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, errs.New("Unable to determine local address")
+	}
+	return local, nil
 }
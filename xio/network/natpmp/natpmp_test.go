@@ -0,0 +1,524 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package natpmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+)
+
+var fakeExternalIP = net.IPv4(203, 0, 113, 7).To4()
+
+// fakeGateway answers PCP and NAT-PMP requests on a local UDP port, as a gateway would.
+type fakeGateway struct {
+	conn     *net.UDPConn
+	mappings map[int]int
+	nonces   map[int][]byte
+	lock     sync.Mutex
+	offset   int
+	pcp      bool
+	pmp      bool
+	fail     bool
+}
+
+func newFakeGateway(t *testing.T, pcp, pmp bool) *fakeGateway {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	check.NoError(t, err)
+	g := &fakeGateway{
+		conn:     conn,
+		mappings: make(map[int]int),
+		nonces:   make(map[int][]byte),
+		offset:   10000,
+		pcp:      pcp,
+		pmp:      pmp,
+	}
+	t.Cleanup(func() { _ = conn.Close() }) //nolint:errcheck // Closing is only done to stop the server
+	go g.serve()
+	return g
+}
+
+func (g *fakeGateway) port() int {
+	return g.conn.LocalAddr().(*net.UDPAddr).Port //nolint:errcheck // Always a UDP address
+}
+
+func (g *fakeGateway) serve() {
+	buffer := make([]byte, 1100)
+	for {
+		n, remote, err := g.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		var response []byte
+		switch {
+		case n >= 2 && buffer[0] == pcpVersion && g.pcp:
+			response = g.handlePCP(buffer[:n])
+		case n >= 2 && g.pmp:
+			response = g.handlePMP(buffer[:n])
+		}
+		if response != nil {
+			_, _ = g.conn.WriteToUDP(response, remote) //nolint:errcheck // The client will retransmit if needed
+		}
+	}
+}
+
+func (g *fakeGateway) handlePMP(request []byte) []byte {
+	response := make([]byte, 16)
+	response[1] = request[1] | 0x80
+	if request[0] != protocolVersion {
+		response[1] = 0x80
+		response[3] = 1
+		return response[:8]
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.fail {
+		response[3] = 3
+		return response[:8]
+	}
+	switch request[1] {
+	case opExternalAddress:
+		copy(response[8:12], fakeExternalIP)
+		return response[:12]
+	case opMapUDP, opMapTCP:
+		internal := int(binary.BigEndian.Uint16(request[4:6]))
+		key := mappingKey(request[1] == opMapTCP, internal)
+		lifetime := binary.BigEndian.Uint32(request[8:12])
+		external := 0
+		if lifetime == 0 {
+			delete(g.mappings, key)
+		} else {
+			external = internal + g.offset
+			g.mappings[key] = external
+		}
+		copy(response[8:10], request[4:6])
+		binary.BigEndian.PutUint16(response[10:12], uint16(external))
+		binary.BigEndian.PutUint32(response[12:16], lifetime)
+		return response
+	default:
+		response[3] = 5
+		return response[:8]
+	}
+}
+
+func (g *fakeGateway) handlePCP(request []byte) []byte {
+	response := make([]byte, len(request))
+	copy(response, request)
+	response[1] |= pcpResponseFlag
+	clear(response[2:4])
+	clear(response[8:pcpHeaderSize])
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	switch {
+	case g.fail:
+		response[3] = 7
+	case request[1] == pcpOpAnnounce:
+		clear(response[4:8])
+	case request[1] == pcpOpMap && len(request) == pcpHeaderSize+pcpMapPayloadSize:
+		payload := response[pcpHeaderSize:]
+		internal := int(binary.BigEndian.Uint16(payload[16:18]))
+		key := mappingKey(payload[12] == pcpProtocolTCP, internal)
+		if nonce, exists := g.nonces[key]; exists && !bytes.Equal(nonce, payload[:pcpNonceSize]) {
+			response[3] = 2
+			break
+		}
+		if binary.BigEndian.Uint32(request[4:8]) == 0 {
+			delete(g.mappings, key)
+			delete(g.nonces, key)
+			break
+		}
+		external := internal + g.offset
+		g.mappings[key] = external
+		g.nonces[key] = append([]byte(nil), payload[:pcpNonceSize]...)
+		binary.BigEndian.PutUint16(payload[18:20], uint16(external))
+		copy(payload[20:36], fakeExternalIP.To16())
+	default:
+		response[3] = 4
+	}
+	return response
+}
+
+func (g *fakeGateway) mapped() map[int]int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	result := make(map[int]int, len(g.mappings))
+	for k, v := range g.mappings {
+		result[k] = v
+	}
+	return result
+}
+
+// fakeIGD answers SSDP searches on a local UDP port and serves a UPnP Internet Gateway Device over HTTP.
+type fakeIGD struct {
+	ssdp     *net.UDPConn
+	server   *httptest.Server
+	mappings map[string]string
+	lock     sync.Mutex
+}
+
+func newFakeIGD(t *testing.T) *fakeIGD {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	check.NoError(t, err)
+	d := &fakeIGD{
+		ssdp:     conn,
+		mappings: make(map[string]string),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/description.xml", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/control</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`)
+	})
+	mux.HandleFunc("/control", d.control)
+	d.server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		_ = conn.Close() //nolint:errcheck // Closing is only done to stop the server
+		d.server.Close()
+	})
+	go d.serveSSDP()
+	return d
+}
+
+func (d *fakeIGD) serveSSDP() {
+	buffer := make([]byte, 2048)
+	for {
+		n, remote, err := d.ssdp.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(string(buffer[:n]), "M-SEARCH") {
+			response := "HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=120\r\nLOCATION: " + d.server.URL +
+				"/description.xml\r\nST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+			_, _ = d.ssdp.WriteToUDP([]byte(response), remote) //nolint:errcheck // The client will time out
+		}
+	}
+}
+
+func (d *fakeIGD) control(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	body := string(data)
+	arg := func(name string) string {
+		_, after, _ := strings.Cut(body, "<"+name+">")
+		value, _, _ := strings.Cut(after, "</"+name+">")
+		return value
+	}
+	fault := func(code int, description string) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>
+<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>%d</errorCode>
+<errorDescription>%s</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`, code, description)
+	}
+	reply := func(action, content string) {
+		fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:%[1]sResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">%[2]s</u:%[1]sResponse></s:Body>
+</s:Envelope>`, action, content)
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	switch r.Header.Get("SOAPAction") {
+	case `"urn:schemas-upnp-org:service:WANIPConnection:1#GetExternalIPAddress"`:
+		reply("GetExternalIPAddress", "<NewExternalIPAddress>"+fakeExternalIP.String()+"</NewExternalIPAddress>")
+	case `"urn:schemas-upnp-org:service:WANIPConnection:1#AddPortMapping"`:
+		if arg("NewLeaseDuration") != "0" {
+			fault(upnpErrorOnlyPermanentLease, "OnlyPermanentLeasesSupported")
+			return
+		}
+		d.mappings[arg("NewProtocol")+"/"+arg("NewExternalPort")] = arg("NewInternalClient") + ":" +
+			arg("NewInternalPort")
+		reply("AddPortMapping", "")
+	case `"urn:schemas-upnp-org:service:WANIPConnection:1#DeletePortMapping"`:
+		key := arg("NewProtocol") + "/" + arg("NewExternalPort")
+		if _, exists := d.mappings[key]; !exists {
+			fault(714, "NoSuchEntryInArray")
+			return
+		}
+		delete(d.mappings, key)
+		reply("DeletePortMapping", "")
+	default:
+		fault(401, "Invalid Action")
+	}
+}
+
+func (d *fakeIGD) mapped() map[string]string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	result := make(map[string]string, len(d.mappings))
+	for k, v := range d.mappings {
+		result[k] = v
+	}
+	return result
+}
+
+// fakeClock is a Clock whose time only moves when advanced.
+type fakeClock struct {
+	now     time.Time
+	waiters []fakeWaiter
+	lock    sync.Mutex
+}
+
+type fakeWaiter struct {
+	when time.Time
+	ch   chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{when: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// advance moves the time forward, once something is waiting on the clock, and wakes any waiters that are now due.
+func (c *fakeClock) advance(t *testing.T, d time.Duration) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		c.lock.Lock()
+		if len(c.waiters) != 0 {
+			break
+		}
+		c.lock.Unlock()
+		if time.Now().After(deadline) {
+			t.Fatal("nothing is waiting on the clock")
+		}
+	}
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if c.now.Before(w.when) {
+			remaining = append(remaining, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = remaining
+}
+
+// newTestClient returns a Client that directs its requests to the given gateway port and SSDP address.
+func newTestClient(t *testing.T, port int, ssdp *net.UDPAddr, clock Clock) *Client {
+	t.Helper()
+	c := NewClient(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}, clock)
+	c.ssdp = ssdp
+	c.probeTimeout = 500 * time.Millisecond
+	c.requestTimeout = 2 * time.Second
+	t.Cleanup(func() { _ = c.Close() }) //nolint:errcheck // The fakes may already be gone
+	return c
+}
+
+// unusedAddress returns a local UDP address that nothing is listening on.
+func unusedAddress(t *testing.T) *net.UDPAddr {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	check.NoError(t, err)
+	addr := conn.LocalAddr().(*net.UDPAddr) //nolint:errcheck // Always a UDP address
+	check.NoError(t, conn.Close())
+	return addr
+}
+
+func TestPCP(t *testing.T) {
+	g := newFakeGateway(t, true, true)
+	c := newTestClient(t, g.port(), unusedAddress(t), nil)
+
+	protocol, err := c.Protocol()
+	check.NoError(t, err)
+	check.Equal(t, "PCP", protocol)
+
+	var ip net.IP
+	ip, err = c.ExternalAddress()
+	check.NoError(t, err)
+	check.Equal(t, fakeExternalIP.String(), ip.String())
+	check.Equal(t, 0, len(g.mapped()), "the temporary mapping should have been removed")
+
+	var external int
+	external, err = c.MapTCP(8080, nil)
+	check.NoError(t, err)
+	check.Equal(t, 18080, external)
+	external, err = c.MapUDP(8080, nil)
+	check.NoError(t, err)
+	check.Equal(t, 18080, external)
+	check.Equal(t, map[int]int{8080: 18080, 8080 | tcpFlag: 18080}, g.mapped())
+
+	check.NoError(t, c.UnmapTCP(8080))
+	check.Equal(t, map[int]int{8080: 18080}, g.mapped())
+	check.NoError(t, c.UnmapUDP(8080))
+	check.Equal(t, 0, len(g.mapped()))
+
+	_, err = c.MapTCP(0, nil)
+	check.Error(t, err)
+}
+
+func TestNATPMP(t *testing.T) {
+	g := newFakeGateway(t, false, true)
+	c := newTestClient(t, g.port(), unusedAddress(t), nil)
+
+	protocol, err := c.Protocol()
+	check.NoError(t, err)
+	check.Equal(t, "NAT-PMP", protocol)
+
+	var ip net.IP
+	ip, err = c.ExternalAddress()
+	check.NoError(t, err)
+	check.Equal(t, fakeExternalIP.String(), ip.String())
+
+	var external int
+	external, err = c.MapUDP(5000, nil)
+	check.NoError(t, err)
+	check.Equal(t, 15000, external)
+	check.Equal(t, map[int]int{5000: 15000}, g.mapped())
+	check.NoError(t, c.UnmapUDP(5000))
+	check.Equal(t, 0, len(g.mapped()))
+}
+
+func TestUPnP(t *testing.T) {
+	d := newFakeIGD(t)
+	c := newTestClient(t, unusedAddress(t).Port, d.ssdp.LocalAddr().(*net.UDPAddr), nil) //nolint:errcheck // UDP
+
+	protocol, err := c.Protocol()
+	check.NoError(t, err)
+	check.Equal(t, "UPnP IGD", protocol)
+
+	var ip net.IP
+	ip, err = c.ExternalAddress()
+	check.NoError(t, err)
+	check.Equal(t, fakeExternalIP.String(), ip.String())
+
+	var external int
+	external, err = c.MapTCP(8080, nil)
+	check.NoError(t, err)
+	check.Equal(t, 8080, external)
+	check.Equal(t, map[string]string{"TCP/8080": "127.0.0.1:8080"}, d.mapped())
+	check.NoError(t, c.UnmapTCP(8080))
+	check.Equal(t, 0, len(d.mapped()))
+	check.Error(t, c.UnmapTCP(8080))
+}
+
+func TestNoGateway(t *testing.T) {
+	c := newTestClient(t, unusedAddress(t).Port, unusedAddress(t), nil)
+	_, err := c.Protocol()
+	check.Error(t, err)
+	_, err = c.MapTCP(8080, nil)
+	check.Error(t, err)
+}
+
+func TestMultipleClients(t *testing.T) {
+	g1 := newFakeGateway(t, true, false)
+	g2 := newFakeGateway(t, false, true)
+	c1 := newTestClient(t, g1.port(), unusedAddress(t), nil)
+	c2 := newTestClient(t, g2.port(), unusedAddress(t), nil)
+
+	_, err := c1.MapTCP(8080, nil)
+	check.NoError(t, err)
+	_, err = c2.MapTCP(9090, nil)
+	check.NoError(t, err)
+	check.Equal(t, map[int]int{8080 | tcpFlag: 18080}, g1.mapped())
+	check.Equal(t, map[int]int{9090 | tcpFlag: 19090}, g2.mapped())
+
+	// Closing a client removes only its own mappings.
+	check.NoError(t, c1.Close())
+	check.Equal(t, 0, len(g1.mapped()))
+	check.Equal(t, map[int]int{9090 | tcpFlag: 19090}, g2.mapped())
+	check.NoError(t, c1.Close())
+}
+
+func TestRenewal(t *testing.T) {
+	g := newFakeGateway(t, true, false)
+	clock := newFakeClock()
+	c := newTestClient(t, g.port(), unusedAddress(t), clock)
+
+	notify := make(chan any, 1)
+	external, err := c.MapTCP(8080, notify)
+	check.NoError(t, err)
+	check.Equal(t, 18080, external)
+
+	// Nothing is due for renewal until 50 minutes of the hour lifetime have passed.
+	g.lock.Lock()
+	g.offset = 20000
+	g.lock.Unlock()
+	clock.advance(t, 49*time.Minute)
+	c.renewMappings()
+	select {
+	case msg := <-notify:
+		t.Fatalf("unexpected notification: %v", msg)
+	default:
+	}
+
+	// A changed external port is reported by the renewal loop.
+	g.lock.Lock()
+	delete(g.mappings, 8080|tcpFlag)
+	g.lock.Unlock()
+	clock.advance(t, time.Minute)
+	check.Equal(t, 28080, <-notify)
+
+	// An unchanged mapping produces no notification.
+	clock.advance(t, 50*time.Minute)
+	c.renewMappings()
+	select {
+	case msg := <-notify:
+		t.Fatalf("unexpected notification: %v", msg)
+	default:
+	}
+
+	// A failure to renew is reported.
+	g.lock.Lock()
+	g.fail = true
+	g.lock.Unlock()
+	clock.advance(t, 50*time.Minute)
+	msg := <-notify
+	renewErr, ok := msg.(error)
+	check.True(t, ok)
+	check.Contains(t, renewErr.Error(), "Mapping renewal for TCP port 8080 failed")
+}
@@ -0,0 +1,196 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package natpmp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+const (
+	pcpVersion        = 2
+	pcpOpAnnounce     = 0
+	pcpOpMap          = 1
+	pcpResponseFlag   = 0x80
+	pcpHeaderSize     = 24
+	pcpMapPayloadSize = 36
+	pcpNonceSize      = 12
+	pcpProtocolTCP    = 6
+	pcpProtocolUDP    = 17
+	// pcpProbeLifetime is the lifetime of the temporary mapping used to learn the external address.
+	pcpProbeLifetime = 2 * time.Minute
+)
+
+var pcpResultCodes = []string{
+	"Success",
+	"Unsupported version",
+	"Not authorized",
+	"Malformed request",
+	"Unsupported opcode",
+	"Unsupported option",
+	"Malformed option",
+	"Network failure",
+	"Out of resources",
+	"Unsupported protocol",
+	"User exceeded quota",
+	"Cannot provide external port",
+	"Address mismatch",
+	"Excessive remote peers",
+}
+
+// pcp implements the Port Control Protocol.
+type pcp struct {
+	gateway *net.UDPAddr
+	lock    sync.Mutex
+	// nonces holds the nonce used for each mapping, which must be presented again to renew or delete it.
+	nonces   map[int][]byte
+	external net.IP
+	timeout  time.Duration
+}
+
+func newPCP(gateway *net.UDPAddr, timeout time.Duration) *pcp {
+	return &pcp{
+		gateway: gateway,
+		nonces:  make(map[int][]byte),
+		timeout: timeout,
+	}
+}
+
+func (p *pcp) String() string {
+	return "PCP"
+}
+
+// announce verifies the gateway supports PCP.
+func (p *pcp) announce() error {
+	_, err := p.call(pcpOpAnnounce, 0, nil)
+	return err
+}
+
+// externalAddress returns the external address reported by the most recent mapping. PCP has no request for the
+// external address alone, so if no mapping has been made yet, a short-lived one is created and then deleted.
+func (p *pcp) externalAddress() (net.IP, error) {
+	p.lock.Lock()
+	ip := p.external
+	p.lock.Unlock()
+	if ip != nil {
+		return ip, nil
+	}
+	local, err := localAddressFor(p.gateway)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err = p.addMapping(false, local.Port, 0, pcpProbeLifetime); err != nil {
+		return nil, err
+	}
+	p.lock.Lock()
+	ip = p.external
+	p.lock.Unlock()
+	if err = p.deleteMapping(false, local.Port, 0); err != nil {
+		return nil, err
+	}
+	return ip, nil
+}
+
+func (p *pcp) addMapping(tcp bool, internal, external int, lifetime time.Duration) (int, time.Duration, error) {
+	response, err := p.callMap(tcp, internal, external, lifetime)
+	if err != nil {
+		return 0, 0, err
+	}
+	ip := net.IP(response[pcpHeaderSize+20 : pcpHeaderSize+36])
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	p.lock.Lock()
+	p.external = ip
+	p.lock.Unlock()
+	return int(binary.BigEndian.Uint16(response[pcpHeaderSize+18 : pcpHeaderSize+20])),
+		time.Duration(binary.BigEndian.Uint32(response[4:8])) * time.Second, nil
+}
+
+func (p *pcp) deleteMapping(tcp bool, internal, _ int) error {
+	if _, err := p.callMap(tcp, internal, 0, 0); err != nil {
+		return err
+	}
+	p.lock.Lock()
+	delete(p.nonces, mappingKey(tcp, internal))
+	p.lock.Unlock()
+	return nil
+}
+
+func (p *pcp) callMap(tcp bool, internal, external int, lifetime time.Duration) ([]byte, error) {
+	key := mappingKey(tcp, internal)
+	p.lock.Lock()
+	nonce, exists := p.nonces[key]
+	if !exists {
+		nonce = make([]byte, pcpNonceSize)
+		if _, err := rand.Read(nonce); err != nil {
+			p.lock.Unlock()
+			return nil, errs.Wrap(err)
+		}
+		p.nonces[key] = nonce
+	}
+	p.lock.Unlock()
+	payload := make([]byte, pcpMapPayloadSize)
+	copy(payload, nonce)
+	payload[12] = pcpProtocolUDP
+	if tcp {
+		payload[12] = pcpProtocolTCP
+	}
+	binary.BigEndian.PutUint16(payload[16:18], uint16(internal))
+	binary.BigEndian.PutUint16(payload[18:20], uint16(external))
+	// Request any external IPv4 address, which is expressed as the IPv4-mapped IPv6 address ::ffff:0.0.0.0.
+	copy(payload[20:36], net.IPv4zero.To16())
+	return p.call(pcpOpMap, uint32(lifetime/time.Second), payload)
+}
+
+// call sends a request to the gateway and returns its response, which is guaranteed to be at least as long as the
+// request.
+func (p *pcp) call(op byte, lifetime uint32, payload []byte) ([]byte, error) {
+	local, err := localAddressFor(p.gateway)
+	if err != nil {
+		return nil, err
+	}
+	request := make([]byte, pcpHeaderSize, pcpHeaderSize+len(payload))
+	request[0] = pcpVersion
+	request[1] = op
+	binary.BigEndian.PutUint32(request[4:8], lifetime)
+	copy(request[8:24], local.IP.To16())
+	request = append(request, payload...)
+	var response []byte
+	if response, err = exchange(p.gateway, request, p.timeout, func(response []byte) bool {
+		if len(response) < 4 || response[1] != op|pcpResponseFlag {
+			return false
+		}
+		// A NAT-PMP gateway responds to any version it does not support with a short error response.
+		if response[0] != pcpVersion {
+			return true
+		}
+		return len(response) >= len(request) && (len(payload) < pcpNonceSize ||
+			bytes.Equal(response[pcpHeaderSize:pcpHeaderSize+pcpNonceSize], payload[:pcpNonceSize]))
+	}); err != nil {
+		return nil, err
+	}
+	if response[0] != pcpVersion {
+		return nil, errs.Newf("Gateway does not support PCP (responded with version %d)", response[0])
+	}
+	if code := int(response[3]); code != 0 {
+		if code < len(pcpResultCodes) {
+			return nil, errs.New(pcpResultCodes[code])
+		}
+		return nil, errs.Newf("Unknown result code %d", code)
+	}
+	return response, nil
+}
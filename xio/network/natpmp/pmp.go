@@ -0,0 +1,108 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package natpmp
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+const protocolVersion = 0
+
+const (
+	opExternalAddress = iota
+	opMapUDP
+	opMapTCP
+)
+
+// pmp implements NAT-PMP.
+type pmp struct {
+	gateway *net.UDPAddr
+	timeout time.Duration
+}
+
+func (p *pmp) String() string {
+	return "NAT-PMP"
+}
+
+func (p *pmp) externalAddress() (net.IP, error) {
+	response, err := p.call([]byte{protocolVersion, opExternalAddress}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IP(response[8:12]), nil
+}
+
+func (p *pmp) addMapping(tcp bool, internal, external int, lifetime time.Duration) (int, time.Duration, error) {
+	if external == 0 {
+		external = internal
+	}
+	buffer := makeUnmapBuffer(tcp, uint16(internal))
+	binary.BigEndian.PutUint16(buffer[6:8], uint16(external))
+	binary.BigEndian.PutUint32(buffer[8:12], uint32(lifetime/time.Second))
+	response, err := p.call(buffer, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(binary.BigEndian.Uint16(response[10:12])),
+		time.Duration(binary.BigEndian.Uint32(response[12:16])) * time.Second, nil
+}
+
+func (p *pmp) deleteMapping(tcp bool, internal, _ int) error {
+	_, err := p.call(makeUnmapBuffer(tcp, uint16(internal)), 16)
+	return err
+}
+
+func makeUnmapBuffer(tcp bool, port uint16) []byte {
+	buffer := make([]byte, 12)
+	buffer[0] = protocolVersion
+	buffer[1] = opMapUDP
+	if tcp {
+		buffer[1] = opMapTCP
+	}
+	binary.BigEndian.PutUint16(buffer[4:6], port)
+	return buffer
+}
+
+func (p *pmp) call(msg []byte, resultSize int) ([]byte, error) {
+	expectedOp := msg[1] | 0x80
+	result, err := exchange(p.gateway, msg, p.timeout, func(response []byte) bool {
+		return len(response) >= 4 && response[1] == expectedOp
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result[0] != protocolVersion {
+		return nil, errs.Newf("Unknown protocol version (%d)", result[0])
+	}
+	code := binary.BigEndian.Uint16(result[2:4])
+	switch code {
+	case 0:
+	case 1:
+		return nil, errs.New("Unsupported version")
+	case 2:
+		return nil, errs.New("Not authorized")
+	case 3:
+		return nil, errs.New("Network failure")
+	case 4:
+		return nil, errs.New("Out of resources")
+	case 5:
+		return nil, errs.New("Unsupported opcode")
+	default:
+		return nil, errs.Newf("Unknown result code %d", code)
+	}
+	if len(result) != resultSize {
+		return nil, errs.Newf("Unexpected result size (received %d, expected %d)", len(result), resultSize)
+	}
+	return result, nil
+}
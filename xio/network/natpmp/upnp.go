@@ -0,0 +1,357 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package natpmp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio"
+)
+
+const (
+	upnpErrorOnlyPermanentLease = 725
+	maxUPnPResponseSize         = 1 << 20
+)
+
+// upnpServiceTypes holds the service types that provide port mapping, in order of preference.
+var upnpServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// upnp implements port mapping through a UPnP Internet Gateway Device.
+type upnp struct {
+	client      *http.Client
+	controlURL  string
+	serviceType string
+	localIP     net.IP
+	description string
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+// upnpError is the error reported by a device when a SOAP action fails.
+type upnpError struct {
+	description string
+	code        int
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.code, e.description)
+}
+
+// discoverUPnP searches for an Internet Gateway Device using SSDP, waiting up to searchTimeout for one to respond.
+// Subsequent requests to the device may take up to requestTimeout.
+func discoverUPnP(ssdp *net.UDPAddr, searchTimeout, requestTimeout time.Duration) (*upnp, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer func() { _ = conn.Close() }() //nolint:errcheck // The search has already concluded
+	for _, target := range []string{
+		"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+		"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+	} {
+		msg := "M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 2\r\nST: " +
+			target + "\r\n\r\n"
+		if _, err = conn.WriteToUDP([]byte(msg), ssdp); err != nil {
+			return nil, errs.Wrap(err)
+		}
+	}
+	deadline := time.Now().Add(searchTimeout)
+	if err = conn.SetReadDeadline(deadline); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	client := &http.Client{Timeout: requestTimeout}
+	tried := make(map[string]bool)
+	var lastErr error = errs.New("No UPnP Internet Gateway Device responded")
+	buffer := make([]byte, 2048)
+	for {
+		var n int
+		if n, _, err = conn.ReadFromUDP(buffer); err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				return nil, lastErr
+			}
+			return nil, errs.Wrap(err)
+		}
+		var resp *http.Response
+		if resp, err = http.ReadResponse(bufio.NewReader(bytes.NewReader(buffer[:n])), nil); err != nil {
+			continue
+		}
+		xio.CloseIgnoringErrors(resp.Body)
+		location := resp.Header.Get("Location")
+		if location == "" || tried[location] {
+			continue
+		}
+		tried[location] = true
+		var u *upnp
+		if u, err = newUPnP(client, location, deadline); err != nil {
+			lastErr = err
+			continue
+		}
+		return u, nil
+	}
+}
+
+// newUPnP retrieves the device description at the location and prepares to use its port mapping service.
+func newUPnP(client *http.Client, location string, deadline time.Time) (*upnp, error) {
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, location, http.NoBody); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	var resp *http.Response
+	if resp, err = client.Do(req); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer xio.CloseIgnoringErrors(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, errs.Newf("Unable to retrieve device description from %s (status %d)", location, resp.StatusCode)
+	}
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err = xml.NewDecoder(io.LimitReader(resp.Body, maxUPnPResponseSize)).Decode(&root); err != nil {
+		return nil, errs.NewWithCausef(err, "Invalid device description at %s", location)
+	}
+	if root.URLBase != "" {
+		if base, err = url.Parse(root.URLBase); err != nil {
+			return nil, errs.Wrap(err)
+		}
+	}
+	for _, serviceType := range upnpServiceTypes {
+		service := root.Device.find(serviceType)
+		if service == nil {
+			continue
+		}
+		var control *url.URL
+		if control, err = base.Parse(strings.TrimSpace(service.ControlURL)); err != nil {
+			return nil, errs.Wrap(err)
+		}
+		u := &upnp{
+			client:      client,
+			controlURL:  control.String(),
+			serviceType: serviceType,
+			description: filepath.Base(os.Args[0]),
+		}
+		var device, local *net.UDPAddr
+		if device, err = net.ResolveUDPAddr("udp4", net.JoinHostPort(control.Hostname(), "1")); err != nil {
+			return nil, errs.Wrap(err)
+		}
+		if local, err = localAddressFor(device); err != nil {
+			return nil, err
+		}
+		u.localIP = local.IP
+		return u, nil
+	}
+	return nil, errs.Newf("Device at %s does not provide port mapping", location)
+}
+
+func (d *upnpDevice) find(serviceType string) *upnpService {
+	for i := range d.Services {
+		if strings.TrimSpace(d.Services[i].ServiceType) == serviceType {
+			return &d.Services[i]
+		}
+	}
+	for i := range d.Devices {
+		if service := d.Devices[i].find(serviceType); service != nil {
+			return service
+		}
+	}
+	return nil
+}
+
+func (u *upnp) String() string {
+	return "UPnP IGD"
+}
+
+func (u *upnp) externalAddress() (net.IP, error) {
+	results, err := u.call("GetExternalIPAddress", nil, "NewExternalIPAddress")
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(results["NewExternalIPAddress"])
+	if ip == nil {
+		return nil, errs.Newf("Invalid external address: %q", results["NewExternalIPAddress"])
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return ip, nil
+}
+
+func (u *upnp) addMapping(tcp bool, internal, external int, lifetime time.Duration) (int, time.Duration, error) {
+	if external == 0 {
+		external = internal
+	}
+	args := [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(external)},
+		{"NewProtocol", protocolName(tcp)},
+		{"NewInternalPort", strconv.Itoa(internal)},
+		{"NewInternalClient", u.localIP.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", u.description},
+		{"NewLeaseDuration", strconv.Itoa(int(lifetime / time.Second))},
+	}
+	if strings.HasSuffix(u.serviceType, ":2") {
+		// Version 2 of the service can pick an alternate external port if the requested one is in use.
+		results, err := u.call("AddAnyPortMapping", args, "NewReservedPort")
+		if err != nil {
+			return 0, 0, err
+		}
+		var port int
+		if port, err = strconv.Atoi(results["NewReservedPort"]); err != nil {
+			return 0, 0, errs.Newf("Invalid reserved port: %q", results["NewReservedPort"])
+		}
+		return port, lifetime, nil
+	}
+	_, err := u.call("AddPortMapping", args)
+	var upnpErr *upnpError
+	if errors.As(err, &upnpErr) && upnpErr.code == upnpErrorOnlyPermanentLease {
+		// Many version 1 devices only support permanent mappings. They are still renewed periodically, so that they
+		// are recreated should the device restart.
+		args[len(args)-1][1] = "0"
+		_, err = u.call("AddPortMapping", args)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return external, lifetime, nil
+}
+
+func (u *upnp) deleteMapping(tcp bool, internal, external int) error {
+	if external == 0 {
+		external = internal
+	}
+	_, err := u.call("DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(external)},
+		{"NewProtocol", protocolName(tcp)},
+	})
+	return err
+}
+
+func protocolName(tcp bool) string {
+	if tcp {
+		return "TCP"
+	}
+	return "UDP"
+}
+
+// call invokes a SOAP action on the device's port mapping service, returning the requested results.
+func (u *upnp) call(action string, args [][2]string, results ...string) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" `)
+	body.WriteString(`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><u:`)
+	body.WriteString(action)
+	body.WriteString(` xmlns:u="`)
+	body.WriteString(u.serviceType)
+	body.WriteString(`">`)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg[0])
+		if err := xml.EscapeText(&body, []byte(arg[1])); err != nil {
+			return nil, errs.Wrap(err)
+		}
+		fmt.Fprintf(&body, "</%s>", arg[0])
+	}
+	fmt.Fprintf(&body, "</u:%s></s:Body></s:Envelope>", action)
+	ctx, cancel := context.WithTimeout(context.Background(), u.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.controlURL, &body)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", `"`+u.serviceType+"#"+action+`"`)
+	var resp *http.Response
+	if resp, err = u.client.Do(req); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer xio.CloseIgnoringErrors(resp.Body)
+	wanted := append([]string{"errorCode", "errorDescription"}, results...)
+	var values map[string]string
+	if values, err = elementValues(io.LimitReader(resp.Body, maxUPnPResponseSize), wanted); err != nil {
+		return nil, errs.NewWithCausef(err, "Invalid response to %s", action)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if code, convErr := strconv.Atoi(values["errorCode"]); convErr == nil {
+			return nil, errs.NewWithCausef(&upnpError{code: code, description: values["errorDescription"]},
+				"%s failed", action)
+		}
+		return nil, errs.Newf("%s failed (status %d)", action, resp.StatusCode)
+	}
+	return values, nil
+}
+
+// elementValues returns the text content of the first element with each of the given local names.
+func elementValues(r io.Reader, names []string) (map[string]string, error) {
+	values := make(map[string]string)
+	decoder := xml.NewDecoder(r)
+	current := ""
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return values, nil
+			}
+			return nil, errs.Wrap(err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			current = ""
+			for _, name := range names {
+				if t.Name.Local == name {
+					if _, exists := values[name]; !exists {
+						current = name
+					}
+					break
+				}
+			}
+		case xml.CharData:
+			if current != "" {
+				values[current] += strings.TrimSpace(string(t))
+			}
+		case xml.EndElement:
+			current = ""
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xhttp
+
+import "net/http"
+
+// DefaultAPIKeyHeader is the header used by APIKeyAuth when none is specified.
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// APIKeyAuth provides authentication via an API key sent in a request header.
+type APIKeyAuth struct {
+	lookup TokenLookup
+	header string
+}
+
+// NewAPIKeyAuth creates a new APIKeyAuth that looks for the key in header. If header is empty, DefaultAPIKeyHeader
+// will be used.
+func NewAPIKeyAuth(header string, lookup TokenLookup) *APIKeyAuth {
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+	return &APIKeyAuth{header: header, lookup: lookup}
+}
+
+// Authenticate implements Authenticator.
+func (auth *APIKeyAuth) Authenticate(req *http.Request) (*Principal, error) {
+	key := req.Header.Get(auth.header)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	return lookupToken(auth.lookup, key, "APIKey")
+}
+
+// Challenge implements Authenticator. API keys have no standard challenge, so nothing is added.
+func (auth *APIKeyAuth) Challenge(_ http.ResponseWriter, _ error) {
+}
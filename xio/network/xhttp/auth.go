@@ -0,0 +1,102 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xcrypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries no credentials for its scheme.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal identifies the authenticated entity making a request.
+type Principal struct {
+	// Claims holds the claims of the token used to authenticate, if it was a JSON Web Token.
+	Claims map[string]any
+	Name   string
+	// Scheme is the authentication scheme that was used, e.g. "Basic" or "Bearer".
+	Scheme string
+}
+
+// Authenticator determines who is making a request.
+type Authenticator interface {
+	// Authenticate returns the Principal making the request. ErrNoCredentials is returned if the request has no
+	// credentials for this authenticator's scheme, while any other error means the credentials were rejected.
+	Authenticate(req *http.Request) (*Principal, error)
+	// Challenge adds any headers to the response that describe how to authenticate with this scheme, such as
+	// WWW-Authenticate. err is the error returned by Authenticate().
+	Challenge(w http.ResponseWriter, err error)
+}
+
+type principalCtxKey int
+
+var principalKey principalCtxKey = 1
+
+// Authenticate wraps an http.Handler, only passing requests through to it that one of the authenticators accepts. The
+// authenticators are consulted in order until one finds credentials in the request. If those are accepted, the
+// resulting Principal is made available to the handler via PrincipalFrom(). Otherwise, a 401 response is sent along
+// with the challenges of all the authenticators.
+func Authenticate(handler http.Handler, authenticators ...Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		failed := -1
+		var failure error
+		for i, auth := range authenticators {
+			principal, err := auth.Authenticate(req)
+			if err == nil {
+				handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), principalKey, principal)))
+				return
+			}
+			if !errors.Is(err, ErrNoCredentials) {
+				failed = i
+				failure = err
+				break
+			}
+		}
+		for i, auth := range authenticators {
+			if i == failed {
+				auth.Challenge(w, failure)
+			} else {
+				auth.Challenge(w, ErrNoCredentials)
+			}
+		}
+		WriteHTTPStatus(w, http.StatusUnauthorized)
+	})
+}
+
+// PrincipalFrom returns the Principal established by Authenticate() for the request, or nil if it has none.
+func PrincipalFrom(req *http.Request) *Principal {
+	p, _ := req.Context().Value(principalKey).(*Principal) //nolint:errcheck // nil is fine if not present
+	return p
+}
+
+// CheckPasswordHash returns nil if the password matches the hash, which may be in bcrypt ($2a$, $2b$ or $2y$) or
+// Argon2 PHC ($argon2id$ or $argon2i$) format.
+func CheckPasswordHash(hash, password string) error {
+	var err error
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	case strings.HasPrefix(hash, "$argon2"):
+		err = argon2.CompareHashAndPassword([]byte(hash), []byte(password))
+	default:
+		return errs.New("unsupported password hash format")
+	}
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) || errors.Is(err, argon2.ErrMismatchedHashAndPassword) {
+		return errs.New("password does not match")
+	}
+	return err
+}
@@ -0,0 +1,261 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xhttp_test
+
+import (
+	"crypto/md5" //nolint:gosec // Required by the MD5 digest algorithm
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/xcrypto/argon2"
+	"github.com/ddkwork/toolbox/xio/network/xhttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var whoAmI = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	p := xhttp.PrincipalFrom(req)
+	fmt.Fprintf(w, "%s:%s", p.Scheme, p.Name)
+})
+
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func basicRequest(user, password string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.SetBasicAuth(user, password)
+	return req
+}
+
+func TestBasicAuth(t *testing.T) {
+	handler := xhttp.NewBasicAuth("test", func(user, realm string) string {
+		if user == "bob" && realm == "test" {
+			return "secret"
+		}
+		return "none"
+	}).Wrap(whoAmI)
+	rec := serve(handler, basicRequest("bob", "secret"))
+	check.Equal(t, http.StatusOK, rec.Code)
+	check.Equal(t, "Basic:bob", rec.Body.String())
+
+	rec = serve(handler, basicRequest("bob", "Secret"))
+	check.Equal(t, http.StatusUnauthorized, rec.Code)
+	check.Equal(t, `Basic realm="test"`, rec.Header().Get("WWW-Authenticate"))
+	check.Equal(t, http.StatusUnauthorized, serve(handler, httptest.NewRequest(http.MethodGet, "/", http.NoBody)).Code)
+}
+
+func TestHashedBasicAuth(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-pw"), bcrypt.MinCost)
+	check.NoError(t, err)
+	var argon2Hash []byte
+	argon2Hash, err = argon2.GenerateFromPassword([]byte("argon2-pw"),
+		argon2.Params{Memory: 64, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32})
+	check.NoError(t, err)
+	hashes := map[string]string{
+		"alice": string(bcryptHash),
+		"bob":   string(argon2Hash),
+		"carol": "plaintext",
+	}
+	handler := xhttp.NewHashedBasicAuth("test", func(user, _ string) string { return hashes[user] }).Wrap(whoAmI)
+	for _, one := range []struct {
+		user     string
+		password string
+		status   int
+	}{
+		{"alice", "bcrypt-pw", http.StatusOK},
+		{"alice", "argon2-pw", http.StatusUnauthorized},
+		{"bob", "argon2-pw", http.StatusOK},
+		{"bob", "bcrypt-pw", http.StatusUnauthorized},
+		{"carol", "plaintext", http.StatusUnauthorized},
+		{"dave", "", http.StatusUnauthorized},
+	} {
+		rec := serve(handler, basicRequest(one.user, one.password))
+		check.Equal(t, one.status, rec.Code, one.user, one.password)
+		if one.status == http.StatusOK {
+			check.Equal(t, "Basic:"+one.user, rec.Body.String())
+		}
+	}
+
+	// An unknown user's password is still checked against a hash, so that the user isn't rejected any faster.
+	start := time.Now()
+	rec := serve(handler, basicRequest("eve", "password"))
+	check.Equal(t, http.StatusUnauthorized, rec.Code)
+	check.True(t, time.Since(start) >= 5*time.Millisecond)
+}
+
+func TestBearerJWT(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Unix(1700000000, 0)
+	handler := xhttp.Authenticate(whoAmI, xhttp.NewBearerAuth("api", xhttp.JWTLookup(xhttp.JWTOptions{
+		Key:      key,
+		Issuer:   "issuer",
+		Audience: "service",
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return now },
+	})))
+	request := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return serve(handler, req)
+	}
+	sign := func(signingKey []byte, claims map[string]any) string {
+		token, err := xhttp.SignJWT(signingKey, claims)
+		check.NoError(t, err)
+		return token
+	}
+	valid := map[string]any{"sub": "bob", "iss": "issuer", "aud": []string{"other", "service"}, "exp": now.Unix() + 60}
+
+	rec := request(sign(key, valid))
+	check.Equal(t, http.StatusOK, rec.Code)
+	check.Equal(t, "Bearer:bob", rec.Body.String())
+
+	// The claims are available to the handler and the scheme name is case-insensitive.
+	var claims map[string]any
+	claimsHandler := xhttp.Authenticate(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		claims = xhttp.PrincipalFrom(req).Claims
+	}), xhttp.NewBearerAuth("api", xhttp.JWTLookup(xhttp.JWTOptions{Key: key})))
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.Header.Set("Authorization", "bearer "+sign(key, map[string]any{"sub": "bob", "role": "admin"}))
+	check.Equal(t, http.StatusOK, serve(claimsHandler, req).Code)
+	check.Equal(t, "admin", claims["role"])
+
+	for i, one := range []map[string]any{
+		{"sub": "bob", "iss": "issuer", "aud": "service", "exp": now.Unix() - 61},
+		{"sub": "bob", "iss": "issuer", "aud": "service", "nbf": now.Unix() + 61},
+		{"sub": "bob", "iss": "other", "aud": "service"},
+		{"sub": "bob", "iss": "issuer", "aud": "other"},
+		{"sub": "bob", "iss": "issuer"},
+	} {
+		rec = request(sign(key, one))
+		check.Equal(t, http.StatusUnauthorized, rec.Code, i)
+		check.Equal(t, `Bearer realm="api", error="invalid_token"`, rec.Header().Get("WWW-Authenticate"), i)
+	}
+	check.Equal(t, http.StatusOK, request(sign(key, map[string]any{
+		"sub": "bob", "iss": "issuer", "aud": "service", "exp": now.Unix() - 30,
+	})).Code)
+	check.Equal(t, http.StatusUnauthorized, request(sign([]byte("wrong key"), valid)).Code)
+	// Unsigned tokens are rejected.
+	check.Equal(t, http.StatusUnauthorized,
+		request("eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJzdWIiOiJib2IifQ.").Code)
+	check.Equal(t, http.StatusUnauthorized, request("not a token").Code)
+}
+
+func TestMultipleAuthenticators(t *testing.T) {
+	tokens := map[string]*xhttp.Principal{"key-1": {Name: "service"}}
+	lookup := func(token string) (*xhttp.Principal, error) {
+		if p, ok := tokens[token]; ok {
+			return p, nil
+		}
+		return nil, errors.New("unknown token")
+	}
+	handler := xhttp.Authenticate(whoAmI,
+		xhttp.NewBasicAuth("test", func(_, _ string) string { return "secret" }),
+		xhttp.NewBearerAuth("test", lookup),
+		xhttp.NewAPIKeyAuth("", lookup))
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	check.Equal(t, http.StatusUnauthorized, rec.Code)
+	check.Equal(t, []string{`Basic realm="test"`, `Bearer realm="test"`}, rec.Header().Values("WWW-Authenticate"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.Header.Set(xhttp.DefaultAPIKeyHeader, "key-1")
+	rec = serve(handler, req)
+	check.Equal(t, http.StatusOK, rec.Code)
+	check.Equal(t, "APIKey:service", rec.Body.String())
+	check.Equal(t, "", tokens["key-1"].Scheme)
+
+	req = httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.Header.Set("Authorization", "Bearer key-1")
+	rec = serve(handler, req)
+	check.Equal(t, "Bearer:service", rec.Body.String())
+
+	// Authenticators are consulted in order and rejected credentials for one scheme aren't overridden by valid
+	// credentials for another.
+	req = basicRequest("bob", "secret")
+	req.Header.Set(xhttp.DefaultAPIKeyHeader, "key-2")
+	rec = serve(handler, req)
+	check.Equal(t, "Basic:bob", rec.Body.String())
+	req = httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	req.Header.Set("Authorization", "Bearer key-2")
+	req.Header.Set(xhttp.DefaultAPIKeyHeader, "key-1")
+	rec = serve(handler, req)
+	check.Equal(t, http.StatusUnauthorized, rec.Code)
+	check.Equal(t, []string{`Basic realm="test"`, `Bearer realm="test", error="invalid_token"`},
+		rec.Header().Values("WWW-Authenticate"))
+}
+
+func TestDigestAuth(t *testing.T) {
+	const realm = "http-auth@example.org"
+	auth := xhttp.NewDigestAuth(realm, func(user, userRealm, algorithm string) string {
+		if user != "Mufasa" {
+			return ""
+		}
+		return xhttp.DigestHA1(algorithm, user, userRealm, "Circle of Life")
+	})
+	handler := xhttp.Authenticate(whoAmI, auth)
+
+	rec := serve(handler, httptest.NewRequest(http.MethodGet, "/dir/index.html", http.NoBody))
+	check.Equal(t, http.StatusUnauthorized, rec.Code)
+	challenges := rec.Header().Values("WWW-Authenticate")
+	check.Equal(t, 2, len(challenges))
+	check.Contains(t, challenges[0], "algorithm=SHA-256")
+	check.Contains(t, challenges[1], "algorithm=MD5")
+	match := regexp.MustCompile(`nonce="([^"]+)"`).FindStringSubmatch(challenges[0])
+	check.Equal(t, 2, len(match))
+	nonce := match[1]
+
+	hexHash := func(hasher func() hash.Hash, s string) string {
+		h := hasher()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+	request := func(algorithm, user, password, nc string) *httptest.ResponseRecorder {
+		hasher := sha256.New
+		if algorithm == xhttp.DigestMD5 {
+			hasher = md5.New
+		}
+		const uri = "/dir/index.html?x=1"
+		ha1 := hexHash(hasher, user+":"+realm+":"+password)
+		ha2 := hexHash(hasher, "GET:"+uri)
+		response := hexHash(hasher, ha1+":"+nonce+":"+nc+":0a4f113b:auth:"+ha2)
+		req := httptest.NewRequest(http.MethodGet, uri, http.NoBody)
+		req.Header.Set("Authorization", fmt.Sprintf(`Digest username=%q, realm=%q, uri=%q, algorithm=%s, `+
+			`nonce=%q, nc=%s, cnonce="0a4f113b", qop=auth, response=%q`, user, realm, uri, algorithm, nonce, nc,
+			response))
+		return serve(handler, req)
+	}
+	rec = request(xhttp.DigestSHA256, "Mufasa", "Circle of Life", "00000001")
+	check.Equal(t, http.StatusOK, rec.Code)
+	check.Equal(t, "Digest:Mufasa", rec.Body.String())
+	// Replayed nonce counts are rejected.
+	check.Equal(t, http.StatusUnauthorized, request(xhttp.DigestSHA256, "Mufasa", "Circle of Life", "00000001").Code)
+	check.Equal(t, http.StatusOK, request(xhttp.DigestMD5, "Mufasa", "Circle of Life", "00000002").Code)
+	check.Equal(t, http.StatusUnauthorized, request(xhttp.DigestSHA256, "Mufasa", "Circle of life", "00000003").Code)
+	check.Equal(t, http.StatusUnauthorized, request(xhttp.DigestSHA256, "Simba", "Circle of Life", "00000004").Code)
+	nonce = "forged"
+	check.Equal(t, http.StatusUnauthorized, request(xhttp.DigestSHA256, "Mufasa", "Circle of Life", "00000005").Code)
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+	check.NoError(t, xhttp.CheckPasswordHash("$2b$04$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm", "password"))
+	check.Error(t, xhttp.CheckPasswordHash("$2b$04$abcdefghijklmnopqrstuughE8Ev8uGFaUgY2cNEySvxngrb/Jzdm", "Password"))
+	check.Error(t, xhttp.CheckPasswordHash("{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", "password"))
+}
@@ -11,41 +11,69 @@
 package xhttp
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
+
+	"github.com/ddkwork/toolbox/errs"
 )
 
+// unknownUserHash is checked against the password given for an unknown user, so that rejecting the user takes about as
+// long as rejecting a known user's wrong password and which users exist cannot be discovered by timing requests.
+const unknownUserHash = "$2a$10$8tgJjqNtwrEh.2BLuo4LOO4OHZviPHyG512nZZ.Qec/W0rQv2zpWG"
+
 // PasswordLookup provides a way to map a user in a realm to a password
 type PasswordLookup func(user, realm string) string
 
+// PasswordHashLookup provides a way to map a user in a realm to a password hash in one of the formats accepted by
+// CheckPasswordHash(). An empty string should be returned if the user is unknown.
+type PasswordHashLookup func(user, realm string) string
+
 // BasicAuth provides basic HTTP authentication.
 type BasicAuth struct {
-	realm  string
-	lookup PasswordLookup
+	realm      string
+	lookup     PasswordLookup
+	hashLookup PasswordHashLookup
 }
 
-// NewBasicAuth creates a new BasicAuth.
+// NewBasicAuth creates a new BasicAuth that compares passwords against the plaintext passwords provided by lookup.
+// Prefer NewHashedBasicAuth().
 func NewBasicAuth(realm string, lookup PasswordLookup) *BasicAuth {
 	return &BasicAuth{realm: realm, lookup: lookup}
 }
 
-// Wrap an http.Handler.
-func (auth *BasicAuth) Wrap(handler http.Handler) http.Handler {
-	return &wrapper{auth: auth, handler: handler}
+// NewHashedBasicAuth creates a new BasicAuth that verifies passwords against the password hashes provided by lookup.
+func NewHashedBasicAuth(realm string, lookup PasswordHashLookup) *BasicAuth {
+	return &BasicAuth{realm: realm, hashLookup: lookup}
 }
 
-type wrapper struct {
-	auth    *BasicAuth
-	handler http.Handler
+// Wrap an http.Handler.
+func (auth *BasicAuth) Wrap(handler http.Handler) http.Handler {
+	return Authenticate(handler, auth)
 }
 
-func (hw *wrapper) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if user, pw, ok := req.BasicAuth(); ok {
-		if pw == hw.auth.lookup(user, hw.auth.realm) {
-			hw.handler.ServeHTTP(w, req)
-			return
+// Authenticate implements Authenticator.
+func (auth *BasicAuth) Authenticate(req *http.Request) (*Principal, error) {
+	user, pw, ok := req.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	if auth.hashLookup != nil {
+		hash := auth.hashLookup(user, auth.realm)
+		if hash == "" {
+			_ = CheckPasswordHash(unknownUserHash, pw) //nolint:errcheck // Only called for the time it takes
+			return nil, errs.Newf("unknown user %q", user)
+		}
+		if err := CheckPasswordHash(hash, pw); err != nil {
+			return nil, err
 		}
+	} else if subtle.ConstantTimeCompare([]byte(pw), []byte(auth.lookup(user, auth.realm))) != 1 {
+		return nil, errs.New("password does not match")
 	}
-	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q`, hw.auth.realm))
-	WriteHTTPStatus(w, http.StatusUnauthorized)
+	return &Principal{Name: user, Scheme: "Basic"}, nil
+}
+
+// Challenge implements Authenticator.
+func (auth *BasicAuth) Challenge(w http.ResponseWriter, _ error) {
+	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q`, auth.realm))
 }
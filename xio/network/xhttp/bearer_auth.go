@@ -0,0 +1,69 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xhttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// TokenLookup returns the Principal a token was issued to, or an error if the token is not valid. The Scheme of the
+// returned Principal is filled in by the caller.
+type TokenLookup func(token string) (*Principal, error)
+
+// BearerAuth provides bearer token authentication (RFC 6750), with the tokens sent in the Authorization header. See
+// JWTLookup() for validating JSON Web Tokens.
+type BearerAuth struct {
+	lookup TokenLookup
+	realm  string
+}
+
+// NewBearerAuth creates a new BearerAuth.
+func NewBearerAuth(realm string, lookup TokenLookup) *BearerAuth {
+	return &BearerAuth{realm: realm, lookup: lookup}
+}
+
+// Authenticate implements Authenticator.
+func (auth *BearerAuth) Authenticate(req *http.Request) (*Principal, error) {
+	scheme, token, found := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+	return lookupToken(auth.lookup, strings.TrimSpace(token), "Bearer")
+}
+
+// Challenge implements Authenticator.
+func (auth *BearerAuth) Challenge(w http.ResponseWriter, err error) {
+	challenge := fmt.Sprintf(`Bearer realm=%q`, auth.realm)
+	if !errors.Is(err, ErrNoCredentials) {
+		challenge += `, error="invalid_token"`
+	}
+	w.Header().Add("WWW-Authenticate", challenge)
+}
+
+func lookupToken(lookup TokenLookup, token, scheme string) (*Principal, error) {
+	if token == "" {
+		return nil, errs.New("empty token")
+	}
+	p, err := lookup(token)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, errs.New("invalid token")
+	}
+	principal := *p
+	principal.Scheme = scheme
+	return &principal, nil
+}
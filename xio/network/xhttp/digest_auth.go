@@ -0,0 +1,252 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xhttp
+
+import (
+	"crypto/hmac"
+	"crypto/md5" //nolint:gosec // Required by the MD5 digest algorithm
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+// Digest algorithms supported by DigestAuth.
+const (
+	DigestSHA256 = "SHA-256"
+	DigestMD5    = "MD5"
+)
+
+const (
+	digestNonceLifetime = 5 * time.Minute
+	digestNonceSize     = 32 // 8 byte timestamp, 8 random bytes and a 16 byte MAC
+)
+
+var (
+	digestAlgorithms = map[string]func() hash.Hash{
+		DigestSHA256: sha256.New,
+		DigestMD5:    md5.New,
+	}
+	errStaleNonce = errors.New("stale nonce")
+)
+
+// DigestLookup provides a way to map a user in a realm to the hash of "user:realm:password" using the algorithm, in
+// lowercase hex, as produced by DigestHA1(). This permits the passwords themselves to not be stored. An empty string
+// should be returned if the user is unknown.
+type DigestLookup func(user, realm, algorithm string) string
+
+// DigestAuth provides HTTP digest authentication (RFC 7616), offering the SHA-256 and MD5 algorithms with a quality of
+// protection of "auth". Nonces expire after a few minutes and nonce counts may not be reused.
+type DigestAuth struct {
+	lookup    DigestLookup
+	counts    map[string]uint64
+	lastPurge time.Time
+	realm     string
+	secret    []byte
+	lock      sync.Mutex
+}
+
+// NewDigestAuth creates a new DigestAuth.
+func NewDigestAuth(realm string, lookup DigestLookup) *DigestAuth {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err) // rand.Read is documented to never return an error
+	}
+	return &DigestAuth{
+		realm:     realm,
+		lookup:    lookup,
+		secret:    secret,
+		counts:    make(map[string]uint64),
+		lastPurge: time.Now(),
+	}
+}
+
+// DigestHA1 returns the lowercase hex hash of "user:realm:password" using the algorithm, which must be DigestSHA256
+// or DigestMD5.
+func DigestHA1(algorithm, user, realm, password string) string {
+	return digestHash(digestAlgorithms[algorithm], user+":"+realm+":"+password)
+}
+
+// Authenticate implements Authenticator.
+func (auth *DigestAuth) Authenticate(req *http.Request) (*Principal, error) {
+	scheme, rest, found := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Digest") {
+		return nil, ErrNoCredentials
+	}
+	params, err := parseAuthParams(rest)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"username", "realm", "nonce", "uri", "response", "qop", "nc", "cnonce"} {
+		if params[name] == "" {
+			return nil, errs.Newf("missing digest parameter %q", name)
+		}
+	}
+	if params["realm"] != auth.realm {
+		return nil, errs.New("digest realm does not match")
+	}
+	if params["qop"] != "auth" {
+		return nil, errs.Newf("unsupported digest qop %q", params["qop"])
+	}
+	if params["uri"] != req.RequestURI {
+		return nil, errs.New("digest uri does not match request")
+	}
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = DigestMD5
+	}
+	hasher, ok := digestAlgorithms[algorithm]
+	if !ok {
+		return nil, errs.Newf("unsupported digest algorithm %q", algorithm)
+	}
+	var count uint64
+	if count, err = strconv.ParseUint(params["nc"], 16, 64); err != nil {
+		return nil, errs.NewWithCause("invalid digest nonce count", err)
+	}
+	nonce := params["nonce"]
+	var issued time.Time
+	if issued, err = auth.checkNonce(nonce); err != nil {
+		return nil, err
+	}
+	user := params["username"]
+	ha1 := auth.lookup(user, auth.realm, algorithm)
+	if ha1 == "" {
+		return nil, errs.Newf("unknown user %q", user)
+	}
+	expected := digestHash(hasher, strings.Join([]string{
+		ha1, nonce, params["nc"], params["cnonce"], params["qop"],
+		digestHash(hasher, req.Method+":"+params["uri"]),
+	}, ":"))
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(params["response"]))) != 1 {
+		return nil, errs.New("digest response does not match")
+	}
+	// Only now that the credentials are known to be good is the client told the nonce is stale, per the RFC.
+	if time.Since(issued) > digestNonceLifetime {
+		return nil, errStaleNonce
+	}
+	if err = auth.useCount(nonce, count); err != nil {
+		return nil, err
+	}
+	return &Principal{Name: user, Scheme: "Digest"}, nil
+}
+
+// Challenge implements Authenticator.
+func (auth *DigestAuth) Challenge(w http.ResponseWriter, err error) {
+	nonce := auth.newNonce()
+	var stale string
+	if errors.Is(err, errStaleNonce) {
+		stale = ", stale=true"
+	}
+	for _, algorithm := range []string{DigestSHA256, DigestMD5} {
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm=%q, qop="auth", algorithm=%s, nonce=%q%s`,
+			auth.realm, algorithm, nonce, stale))
+	}
+}
+
+func (auth *DigestAuth) newNonce() string {
+	var buffer [digestNonceSize]byte
+	binary.BigEndian.PutUint64(buffer[:8], uint64(time.Now().UnixNano()))
+	_, _ = rand.Read(buffer[8:16]) //nolint:errcheck // rand.Read is documented to never return an error
+	copy(buffer[16:], auth.nonceMAC(buffer[:16]))
+	return base64.RawURLEncoding.EncodeToString(buffer[:])
+}
+
+// checkNonce verifies that the nonce was issued by us and returns the time at which it was issued.
+func (auth *DigestAuth) checkNonce(nonce string) (time.Time, error) {
+	data, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(data) != digestNonceSize || !hmac.Equal(data[16:], auth.nonceMAC(data[:16])) {
+		return time.Time{}, errs.New("invalid digest nonce")
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(data[:8]))), nil
+}
+
+func (auth *DigestAuth) nonceMAC(data []byte) []byte {
+	mac := hmac.New(sha256.New, auth.secret)
+	mac.Write(data)
+	return mac.Sum(nil)[:digestNonceSize-16]
+}
+
+// useCount records the nonce count for the nonce, returning an error if it was not greater than any previously used,
+// which indicates a replayed request.
+func (auth *DigestAuth) useCount(nonce string, count uint64) error {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+	if time.Since(auth.lastPurge) > digestNonceLifetime {
+		auth.lastPurge = time.Now()
+		for one := range auth.counts {
+			if issued, err := auth.checkNonce(one); err != nil || time.Since(issued) > digestNonceLifetime {
+				delete(auth.counts, one)
+			}
+		}
+	}
+	if count <= auth.counts[nonce] {
+		return errs.New("digest nonce count was reused")
+	}
+	auth.counts[nonce] = count
+	return nil
+}
+
+func digestHash(hasher func() hash.Hash, data string) string {
+	h := hasher()
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseAuthParams parses the comma-separated name=value pairs that follow the scheme in an Authorization header.
+// Values may be tokens or quoted strings.
+func parseAuthParams(s string) (map[string]string, error) {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params, nil
+		}
+		name, rest, found := strings.Cut(s, "=")
+		if !found {
+			return nil, errs.New("malformed authorization parameters")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		rest = strings.TrimLeft(rest, " \t")
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			if i >= len(rest) {
+				return nil, errs.New("unterminated quoted string in authorization parameters")
+			}
+			s = rest[i+1:]
+		} else {
+			end := strings.IndexAny(rest, ", \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			value.WriteString(rest[:end])
+			s = rest[end:]
+		}
+		params[name] = value.String()
+	}
+}
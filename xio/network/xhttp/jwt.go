@@ -0,0 +1,142 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package xhttp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"hash"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+)
+
+var jwtAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// JWTOptions holds the options for validating JSON Web Tokens.
+type JWTOptions struct {
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+	// Key is the HMAC key the tokens are signed with.
+	Key []byte
+	// Issuer, if not empty, must match the token's "iss" claim.
+	Issuer string
+	// Audience, if not empty, must be present in the token's "aud" claim.
+	Audience string
+	// Leeway is the allowance made for clock skew when checking the "exp" and "nbf" claims.
+	Leeway time.Duration
+}
+
+// JWTLookup returns a TokenLookup for use with BearerAuth that accepts JSON Web Tokens (RFC 7519) signed with HMAC
+// (HS256, HS384 or HS512). The resulting Principal's Name is taken from the "sub" claim and its Claims hold all of the
+// token's claims.
+func JWTLookup(options JWTOptions) TokenLookup {
+	return func(token string) (*Principal, error) {
+		claims, err := verifyJWT(token, options.Key)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now
+		if options.Now != nil {
+			now = options.Now
+		}
+		current := now()
+		if exp, ok := claims["exp"].(float64); ok && !current.Before(time.Unix(int64(exp), 0).Add(options.Leeway)) {
+			return nil, errs.New("token has expired")
+		}
+		if nbf, ok := claims["nbf"].(float64); ok && current.Add(options.Leeway).Before(time.Unix(int64(nbf), 0)) {
+			return nil, errs.New("token is not yet valid")
+		}
+		if options.Issuer != "" {
+			if iss, _ := claims["iss"].(string); iss != options.Issuer { //nolint:errcheck // Mismatch is the failure
+				return nil, errs.New("token issuer does not match")
+			}
+		}
+		if options.Audience != "" && !jwtHasAudience(claims["aud"], options.Audience) {
+			return nil, errs.New("token audience does not match")
+		}
+		sub, _ := claims["sub"].(string) //nolint:errcheck // An empty name is fine if not present
+		return &Principal{Name: sub, Claims: claims}, nil
+	}
+}
+
+// SignJWT returns a JSON Web Token holding the claims, signed with HS256 using key.
+func SignJWT(key []byte, claims map[string]any) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", errs.Wrap(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(jwtSignature(sha256.New, key, signingInput)),
+		nil
+}
+
+func verifyJWT(token string, key []byte) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errs.New("malformed token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errs.NewWithCause("malformed token header", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err = json.Unmarshal(data, &header); err != nil {
+		return nil, errs.NewWithCause("malformed token header", err)
+	}
+	hasher, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return nil, errs.Newf("unsupported token algorithm %q", header.Alg)
+	}
+	var signature []byte
+	if signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, errs.NewWithCause("malformed token signature", err)
+	}
+	if !hmac.Equal(signature, jwtSignature(hasher, key, parts[0]+"."+parts[1])) {
+		return nil, errs.New("invalid token signature")
+	}
+	if data, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, errs.NewWithCause("malformed token payload", err)
+	}
+	var claims map[string]any
+	if err = json.Unmarshal(data, &claims); err != nil {
+		return nil, errs.NewWithCause("malformed token payload", err)
+	}
+	return claims, nil
+}
+
+func jwtSignature(hasher func() hash.Hash, key []byte, signingInput string) []byte {
+	mac := hmac.New(hasher, key)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+func jwtHasAudience(aud any, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []any:
+		return slices.Contains(v, any(audience))
+	default:
+		return false
+	}
+}
@@ -61,3 +61,8 @@ func (w *StatusResponseWriter) Flush() {
 		f.Flush()
 	}
 }
+
+// Unwrap returns the original http.ResponseWriter, for use by http.ResponseController.
+func (w *StatusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.Original
+}
@@ -0,0 +1,364 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio/fs"
+	"github.com/ddkwork/toolbox/xio/fs/safe"
+	"github.com/ddkwork/toolbox/xio/network/acme"
+)
+
+const (
+	// DefaultRenewBefore is how long before expiration ACME certificates are renewed, if not otherwise specified.
+	DefaultRenewBefore = 30 * 24 * time.Hour
+	selfSignedValidity = 365 * 24 * time.Hour
+)
+
+// ACMEConfig holds the configuration for a certificate obtained through ACME.
+type ACMEConfig struct {
+	// Client is used to obtain the certificate.
+	Client *acme.Client
+	// Responder answers the certificate authority's challenges. Its Wrap() method must be used to install it in the
+	// server handling port 80 for the domains.
+	Responder *acme.HTTP01Responder
+	// CertFile and KeyFile are where the certificate chain and its private key are stored between runs.
+	CertFile string
+	KeyFile  string
+	// Domains holds the names the certificate is for.
+	Domains []string
+	// RenewBefore is how long before expiration the certificate is renewed. If zero or less, DefaultRenewBefore is
+	// used.
+	RenewBefore time.Duration
+}
+
+// CertificateManager supplies certificates to TLS connections, choosing among them by the server name the client
+// requests (SNI). Certificates loaded from files are reloaded when the files change and certificates obtained through
+// ACME are renewed before they expire, whenever Reload() is called. If no certificate matches the requested name, the
+// first one added is used.
+type CertificateManager struct {
+	sources []*certificateSource
+	byName  map[string]*tls.Certificate
+	lock    sync.RWMutex
+	// reloadLock serializes changes to the sources, which are otherwise only modified with lock also held.
+	reloadLock sync.Mutex
+}
+
+type certificateSource struct {
+	cert     *tls.Certificate
+	acme     *ACMEConfig
+	certFile string
+	keyFile  string
+	modTime  time.Time
+}
+
+// NewCertificateManager creates a new, empty CertificateManager.
+func NewCertificateManager() *CertificateManager {
+	return &CertificateManager{byName: make(map[string]*tls.Certificate)}
+}
+
+// AddFiles adds the certificate chain and private key stored in the PEM files.
+func (m *CertificateManager) AddFiles(certFile, keyFile string) error {
+	src := &certificateSource{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	cert, modTime, err := src.read()
+	if err != nil {
+		return err
+	}
+	src.cert = cert
+	src.modTime = modTime
+	m.add(src)
+	return nil
+}
+
+// AddSelfSigned adds the certificate chain and private key stored in the PEM files, first creating a self-signed
+// certificate for the hosts in them if they don't exist. This is intended for development use.
+func (m *CertificateManager) AddSelfSigned(certFile, keyFile string, hosts ...string) error {
+	if !fs.FileExists(certFile) || !fs.FileExists(keyFile) {
+		if err := CreateSelfSignedCertificate(certFile, keyFile, hosts...); err != nil {
+			return err
+		}
+	}
+	return m.AddFiles(certFile, keyFile)
+}
+
+// AddACME adds a certificate obtained through ACME. If the files named by the configuration hold a certificate that
+// is not yet due for renewal, it is used rather than requesting a new one.
+func (m *CertificateManager) AddACME(ctx context.Context, cfg ACMEConfig) error {
+	if cfg.Client == nil || cfg.Responder == nil || len(cfg.Domains) == 0 {
+		return errs.New("ACME configuration requires a client, a responder and at least one domain")
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return errs.New("ACME configuration requires files to store the certificate and key in")
+	}
+	if cfg.RenewBefore <= 0 {
+		cfg.RenewBefore = DefaultRenewBefore
+	}
+	src := &certificateSource{
+		acme:     &cfg,
+		certFile: cfg.CertFile,
+		keyFile:  cfg.KeyFile,
+	}
+	if fs.FileExists(cfg.CertFile) && fs.FileExists(cfg.KeyFile) {
+		// A certificate that can't be loaded is simply replaced.
+		src.cert, src.modTime, _ = src.read() //nolint:errcheck // See above
+	}
+	if src.needsRenewal() {
+		if err := src.renew(ctx); err != nil {
+			return err
+		}
+		var err error
+		if src.cert, src.modTime, err = src.read(); err != nil {
+			return err
+		}
+	}
+	m.add(src)
+	return nil
+}
+
+func (m *CertificateManager) add(src *certificateSource) {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.sources = append(m.sources, src)
+	m.rebuild()
+}
+
+// Reload renews any ACME certificates that are due, then reloads any certificate files that have changed. A
+// certificate that fails to load remains in use until it can be replaced.
+func (m *CertificateManager) Reload(ctx context.Context) error {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+	var result error
+	for _, src := range m.sources {
+		if src.needsRenewal() {
+			if err := src.renew(ctx); err != nil {
+				result = errs.Append(result, err)
+			}
+		}
+		cert, modTime, err := src.read()
+		if err != nil {
+			result = errs.Append(result, err)
+			continue
+		}
+		if cert != src.cert {
+			m.lock.Lock()
+			src.cert = cert
+			src.modTime = modTime
+			m.rebuild()
+			m.lock.Unlock()
+		}
+	}
+	return result
+}
+
+// Watch calls Reload() at the interval until the context is done, logging any errors.
+func (m *CertificateManager) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Reload(ctx); err != nil && ctx.Err() == nil {
+				errs.Log(errs.NewWithCause("unable to reload certificates", err))
+			}
+		}
+	}
+}
+
+// GetCertificate returns the certificate for the server name requested by the client. It is suitable for use as
+// tls.Config.GetCertificate.
+func (m *CertificateManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if len(m.sources) == 0 {
+		return nil, errs.New("no certificates available")
+	}
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if cert, exists := m.byName[name]; exists {
+		return cert, nil
+	}
+	if _, domain, found := strings.Cut(name, "."); found {
+		if cert, exists := m.byName["*."+domain]; exists {
+			return cert, nil
+		}
+	}
+	return m.sources[0].cert, nil
+}
+
+// TLSConfig returns a TLS configuration that obtains its certificates from this CertificateManager.
+func (m *CertificateManager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+// rebuild the name index. Must be called with the write lock held.
+func (m *CertificateManager) rebuild() {
+	byName := make(map[string]*tls.Certificate)
+	for _, src := range m.sources {
+		leaf := src.cert.Leaf
+		names := slices.Clone(leaf.DNSNames)
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, ip := range leaf.IPAddresses {
+			names = append(names, ip.String())
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, exists := byName[name]; !exists {
+				byName[name] = src.cert
+			}
+		}
+	}
+	m.byName = byName
+}
+
+// read the files if they have changed since they were last loaded. If they haven't, the current certificate and
+// modification time are returned.
+func (src *certificateSource) read() (*tls.Certificate, time.Time, error) {
+	modTime, err := latestModTime(src.certFile, src.keyFile)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if src.cert != nil && modTime.Equal(src.modTime) {
+		return src.cert, src.modTime, nil
+	}
+	var cert tls.Certificate
+	if cert, err = tls.LoadX509KeyPair(src.certFile, src.keyFile); err != nil {
+		return nil, time.Time{}, errs.NewWithCausef(err, "unable to load certificate from %s and %s", src.certFile,
+			src.keyFile)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, time.Time{}, errs.Wrap(err)
+		}
+	}
+	return &cert, modTime, nil
+}
+
+func (src *certificateSource) needsRenewal() bool {
+	if src.acme == nil {
+		return false
+	}
+	return src.cert == nil || time.Now().Add(src.acme.RenewBefore).After(src.cert.Leaf.NotAfter)
+}
+
+// renew obtains a new certificate through ACME and stores it in the files.
+func (src *certificateSource) renew(ctx context.Context) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	var chain [][]byte
+	if chain, err = src.acme.Client.ObtainCertificate(ctx, key, src.acme.Responder, src.acme.Domains...); err != nil {
+		return errs.NewWithCausef(err, "unable to obtain certificate for %s", strings.Join(src.acme.Domains, ", "))
+	}
+	return writeCertificate(src.certFile, src.keyFile, chain, key)
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return time.Time{}, errs.Wrap(err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// CreateSelfSignedCertificate creates a self-signed certificate for the hosts, which may be names or IP addresses,
+// storing it and its private key in the PEM files. If no hosts are specified, "localhost" and the loopback addresses
+// are used.
+func CreateSelfSignedCertificate(certFile, keyFile string, hosts ...string) error {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	var serial *big.Int
+	if serial, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)); err != nil {
+		return errs.Wrap(err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	var der []byte
+	if der, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key); err != nil {
+		return errs.Wrap(err)
+	}
+	return writeCertificate(certFile, keyFile, [][]byte{der}, key)
+}
+
+func writeCertificate(certFile, keyFile string, chain [][]byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	if err = safe.WriteFileWithMode(keyFile, func(w io.Writer) error {
+		return errs.Wrap(pem.Encode(w, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	}, 0o600); err != nil {
+		return err
+	}
+	return safe.WriteFileWithMode(certFile, func(w io.Writer) error {
+		for _, der := range chain {
+			if err := pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+				return errs.Wrap(err)
+			}
+		}
+		return nil
+	}, 0o644)
+}
@@ -0,0 +1,236 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package web_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/xio/network/acme"
+	"github.com/ddkwork/toolbox/xio/network/acme/acmetest"
+	"github.com/ddkwork/toolbox/xio/network/xhttp/web"
+)
+
+func createCert(t *testing.T, dir, name string, hosts ...string) (certFile, keyFile string) {
+	t.Helper()
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	check.NoError(t, web.CreateSelfSignedCertificate(certFile, keyFile, hosts...))
+	// Ensure the modification time differs from any previous version of the files.
+	later := time.Now().Add(time.Duration(len(hosts)) * time.Second)
+	check.NoError(t, os.Chtimes(certFile, later, later))
+	check.NoError(t, os.Chtimes(keyFile, later, later))
+	return certFile, keyFile
+}
+
+func certNames(t *testing.T, m *web.CertificateManager, serverName string) []string {
+	t.Helper()
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	check.NoError(t, err)
+	return cert.Leaf.DNSNames
+}
+
+func TestCertificateManagerSNI(t *testing.T) {
+	dir := t.TempDir()
+	m := web.NewCertificateManager()
+	_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.test"})
+	check.Error(t, err)
+
+	check.NoError(t, m.AddFiles(createCert(t, dir, "a", "a.test")))
+	check.NoError(t, m.AddFiles(createCert(t, dir, "b", "*.b.test", "b.test")))
+	check.Error(t, m.AddFiles(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key")))
+
+	check.Equal(t, []string{"a.test"}, certNames(t, m, "a.test"))
+	check.Equal(t, []string{"*.b.test", "b.test"}, certNames(t, m, "B.Test"))
+	check.Equal(t, []string{"*.b.test", "b.test"}, certNames(t, m, "www.b.test"))
+	check.Equal(t, []string{"a.test"}, certNames(t, m, "x.y.b.test"))
+	check.Equal(t, []string{"a.test"}, certNames(t, m, ""))
+}
+
+func TestCertificateManagerReload(t *testing.T) {
+	dir := t.TempDir()
+	m := web.NewCertificateManager()
+	check.NoError(t, m.AddSelfSigned(filepath.Join(dir, "dev.crt"), filepath.Join(dir, "dev.key")))
+	check.Equal(t, []string{"localhost"}, certNames(t, m, "localhost"))
+
+	// Unchanged files are left alone.
+	check.NoError(t, m.Reload(context.Background()))
+	check.Equal(t, []string{"localhost"}, certNames(t, m, "localhost"))
+
+	createCert(t, dir, "dev", "localhost", "dev.test")
+	check.NoError(t, m.Reload(context.Background()))
+	check.Equal(t, []string{"localhost", "dev.test"}, certNames(t, m, "dev.test"))
+
+	// A broken file leaves the previous certificate in use.
+	broken := filepath.Join(dir, "dev.crt")
+	check.NoError(t, os.WriteFile(broken, []byte("garbage"), 0o600))
+	later := time.Now().Add(time.Minute)
+	check.NoError(t, os.Chtimes(broken, later, later))
+	check.Error(t, m.Reload(context.Background()))
+	check.Equal(t, []string{"localhost", "dev.test"}, certNames(t, m, "dev.test"))
+}
+
+func TestServerTLSHotReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	s := &web.Server{
+		CertFile:                 certFile,
+		KeyFile:                  keyFile,
+		SelfSigned:               true,
+		CertificateCheckInterval: 10 * time.Millisecond,
+		WebServer: &http.Server{
+			Addr: "127.0.0.1",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("secure")) //nolint:errcheck // Test only
+			}),
+		},
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		StartedChan: make(chan any),
+	}
+	check.Equal(t, web.ProtocolHTTPS, s.Protocol())
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	<-s.StartedChan
+	defer func() {
+		s.Shutdown()
+		check.NoError(t, <-done)
+	}()
+
+	serial := func() string {
+		conn, err := tls.Dial("tcp", strings.TrimPrefix(s.LocalBaseURL(), "https://"),
+			&tls.Config{InsecureSkipVerify: true}) //nolint:gosec // Test only
+		check.NoError(t, err)
+		defer func() { check.NoError(t, conn.Close()) }()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.String()
+	}
+
+	data, err := os.ReadFile(certFile)
+	check.NoError(t, err)
+	roots := x509.NewCertPool()
+	check.True(t, roots.AppendCertsFromPEM(data))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	var rsp *http.Response
+	rsp, err = client.Get(s.LocalBaseURL()) //nolint:noctx // Test only
+	check.NoError(t, err)
+	data, err = io.ReadAll(rsp.Body)
+	check.NoError(t, err)
+	check.NoError(t, rsp.Body.Close())
+	check.Equal(t, "secure", string(data))
+
+	original := serial()
+	createCert(t, dir, "server", "localhost", "127.0.0.1")
+	deadline := time.Now().Add(5 * time.Second)
+	for serial() == original {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerRetryAfterFailedStart(t *testing.T) {
+	dir := t.TempDir()
+	wraps := 0
+	s := &web.Server{
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+		WebServer: &http.Server{
+			Addr: "127.0.0.1",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("secure")) //nolint:errcheck // Test only
+			}),
+		},
+		Middleware: []web.Middleware{func(next http.Handler) http.Handler {
+			wraps++
+			return next
+		}},
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		StartedChan: make(chan any),
+	}
+	// The certificate files don't exist yet, so the server can't start.
+	check.Error(t, s.Run())
+	check.Equal(t, 0, wraps)
+
+	s.SelfSigned = true
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	<-s.StartedChan
+	s.Shutdown()
+	check.NoError(t, <-done)
+	check.Equal(t, 1, wraps)
+}
+
+func TestCertificateManagerACME(t *testing.T) {
+	responder := acme.NewHTTP01Responder()
+	challenges := httptest.NewServer(responder.Wrap(nil))
+	defer challenges.Close()
+	ca, err := acmetest.NewServer(strings.TrimPrefix(challenges.URL, "http://"))
+	check.NoError(t, err)
+	defer ca.Close()
+	var accountKey *ecdsa.PrivateKey
+	accountKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	check.NoError(t, err)
+	var client *acme.Client
+	client, err = acme.NewClient(ca.DirectoryURL(), accountKey)
+	check.NoError(t, err)
+	client.PollInterval = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	cfg := web.ACMEConfig{
+		Client:    client,
+		Responder: responder,
+		CertFile:  filepath.Join(dir, "acme.crt"),
+		KeyFile:   filepath.Join(dir, "acme.key"),
+		Domains:   []string{"example.test"},
+	}
+	m := web.NewCertificateManager()
+	check.NoError(t, m.AddACME(context.Background(), cfg))
+	check.Equal(t, 1, ca.Issued())
+	check.Equal(t, []string{"example.test"}, certNames(t, m, "example.test"))
+	var cert *tls.Certificate
+	cert, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.test"})
+	check.NoError(t, err)
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: "example.test", Roots: ca.Roots()})
+	check.NoError(t, err)
+
+	// A stored certificate that isn't due for renewal is reused.
+	check.NoError(t, web.NewCertificateManager().AddACME(context.Background(), cfg))
+	check.NoError(t, m.Reload(context.Background()))
+	check.Equal(t, 1, ca.Issued())
+
+	// One that is due is renewed.
+	cfg.RenewBefore = 100 * 24 * time.Hour
+	m = web.NewCertificateManager()
+	check.NoError(t, m.AddACME(context.Background(), cfg))
+	check.Equal(t, 2, ca.Issued())
+	check.NoError(t, m.Reload(context.Background()))
+	check.Equal(t, 3, ca.Issued())
+
+	check.Error(t, m.AddACME(context.Background(), web.ACMEConfig{Client: client}))
+	noFiles := cfg
+	noFiles.KeyFile = ""
+	check.Error(t, m.AddACME(context.Background(), noFiles))
+	check.Equal(t, 3, ca.Issued())
+}
@@ -0,0 +1,442 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package web
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio/network/xhttp"
+)
+
+// DefaultRequestIDHeader is the header used by RequestID() when none is specified.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+type requestIDCtxKey int
+
+var requestIDKey requestIDCtxKey = 1
+
+// Middleware wraps an http.Handler to provide additional behavior.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps the handler with the middleware, with the first being the outermost.
+func Chain(handler http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// CleanPath cleans the request's URL path and prepares it for use with PathHeadThenShift() and the related functions.
+func CleanPath() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req.URL.Path = path.Clean(req.URL.Path)
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), routeKey, &route{path: req.URL.Path})))
+		})
+	}
+}
+
+// Recover recovers from panics in the handler, logging them to the logger and responding with a 500 status. If logger
+// is nil, slog.Default() will be used.
+func Recover(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					if recovered == http.ErrAbortHandler { //nolint:errorlint // The panic value must be compared directly
+						panic(recovered)
+					}
+					err, ok := recovered.(error)
+					if !ok {
+						err = errs.Newf("%+v", recovered)
+					}
+					errs.LogTo(loggerOrDefault(logger), errs.NewWithCause("recovered from panic in handler", err))
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// AccessLogEntry holds the information about a completed request that is provided to an access logger.
+type AccessLogEntry struct {
+	Request   *http.Request
+	Started   time.Time
+	Elapsed   time.Duration
+	RequestID string
+	Status    int
+	Bytes     int
+}
+
+// AccessLog logs each request to the logger once it completes. If logger is nil, slog.Default() will be used.
+func AccessLog(logger *slog.Logger) Middleware {
+	return AccessLogFunc(func(entry *AccessLogEntry) {
+		millis := int64(entry.Elapsed / time.Millisecond)
+		micros := int64(entry.Elapsed/time.Microsecond) - millis*1000
+		args := []any{
+			"status", entry.Status, "elapsed", fmt.Sprintf("%d.%03dms", millis, micros), "bytes", entry.Bytes,
+			"method", entry.Request.Method, "url", entry.Request.URL,
+		}
+		if entry.RequestID != "" {
+			args = append(args, "request_id", entry.RequestID)
+		}
+		loggerOrDefault(logger).Info("web", args...)
+	})
+}
+
+// AccessLogFunc calls the log function with the details of each request once it completes.
+func AccessLogFunc(log func(entry *AccessLogEntry)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			started := time.Now()
+			sw := &xhttp.StatusResponseWriter{
+				Original: w,
+				Head:     req.Method == http.MethodHead,
+			}
+			defer func() {
+				log(&AccessLogEntry{
+					Request:   req,
+					Started:   started,
+					Elapsed:   time.Since(started),
+					RequestID: RequestIDFrom(req),
+					Status:    sw.Status(),
+					Bytes:     sw.BytesWritten(),
+				})
+			}()
+			next.ServeHTTP(sw, req)
+		})
+	}
+}
+
+// CommonLogFormat returns a function for use with AccessLogFunc() that writes entries to w in the Common Log Format.
+func CommonLogFormat(w io.Writer) func(entry *AccessLogEntry) {
+	return func(entry *AccessLogEntry) {
+		host, _, err := net.SplitHostPort(entry.Request.RemoteAddr)
+		if err != nil {
+			host = entry.Request.RemoteAddr
+		}
+		user := "-"
+		if u := entry.Request.URL.User; u != nil && u.Username() != "" {
+			user = u.Username()
+		} else if name, _, ok := entry.Request.BasicAuth(); ok && name != "" {
+			user = name
+		}
+		fmt.Fprintf(w, "%s - %s [%s] %q %d %d\n", host, user, entry.Started.Format("02/Jan/2006:15:04:05 -0700"),
+			entry.Request.Method+" "+entry.Request.RequestURI+" "+entry.Request.Proto, entry.Status, entry.Bytes)
+	}
+}
+
+// RequestID assigns an identifier to each request, which can be retrieved with RequestIDFrom() and is returned to the
+// client in the header. If the request already carries a reasonable identifier in the header, it is used rather than
+// generating a new one. If header is empty, DefaultRequestIDHeader will be used.
+func RequestID(header string) Middleware {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			id := req.Header.Get(header)
+			if !validRequestID(id) {
+				id = rand.Text()
+			}
+			w.Header().Set(header, id)
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), requestIDKey, id)))
+		})
+	}
+}
+
+// RequestIDFrom returns the identifier assigned to the request by RequestID(), or an empty string if it has none.
+func RequestIDFrom(req *http.Request) string {
+	id, _ := req.Context().Value(requestIDKey).(string) //nolint:errcheck // An empty string is fine if not present
+	return id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, ch := range id {
+		if ch <= ' ' || ch > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Encoder provides a content encoding for use with Compress().
+type Encoder struct {
+	// Name is the content coding, as used in the Accept-Encoding and Content-Encoding headers, e.g. "gzip" or "br".
+	Name string
+	// NewWriter returns a writer that encodes the data written to it and writes the result to w.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// GzipEncoder returns an Encoder for gzip at the given compression level.
+func GzipEncoder(level int) Encoder {
+	return Encoder{
+		Name: "gzip",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+	}
+}
+
+// DeflateEncoder returns an Encoder for deflate at the given compression level.
+func DeflateEncoder(level int) Encoder {
+	return Encoder{
+		Name: "deflate",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, level)
+		},
+	}
+}
+
+// Compress encodes responses with the first of the encoders the client accepts. If no encoders are provided, gzip and
+// deflate are offered, in that order, at their default compression levels. Other encodings, such as brotli, can be
+// supported by supplying an Encoder for them. Responses that already have a Content-Encoding are left alone.
+func Compress(encoders ...Encoder) Middleware {
+	if len(encoders) == 0 {
+		encoders = []Encoder{GzipEncoder(gzip.DefaultCompression), DeflateEncoder(flate.DefaultCompression)}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoder := negotiateEncoding(req.Header.Get("Accept-Encoding"), encoders)
+			if encoder == nil || req.Method == http.MethodHead {
+				next.ServeHTTP(w, req)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, encoder: encoder}
+			defer func() {
+				if err := cw.close(); err != nil {
+					errs.Log(errs.NewWithCause("unable to finish compressed response", err))
+				}
+			}()
+			next.ServeHTTP(cw, req)
+		})
+	}
+}
+
+// negotiateEncoding returns the first of the encoders that the Accept-Encoding header value allows, or nil.
+func negotiateEncoding(accept string, encoders []Encoder) *Encoder {
+	if accept == "" {
+		return nil
+	}
+	q := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value := 1.0
+		if k, v, found := strings.Cut(strings.TrimSpace(params), "="); found && strings.TrimSpace(k) == "q" {
+			var err error
+			if value, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				value = 0
+			}
+		}
+		q[name] = value
+	}
+	for i := range encoders {
+		value, exists := q[encoders[i].Name]
+		if !exists {
+			value, exists = q["*"]
+		}
+		if exists && value > 0 {
+			return &encoders[i]
+		}
+	}
+	return nil
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoder     *Encoder
+	writer      io.WriteCloser
+	wroteHeader bool
+	passThrough bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || status < http.StatusOK || status == http.StatusNoContent ||
+		status == http.StatusNotModified {
+		w.passThrough = true
+	} else {
+		h.Set("Content-Encoding", w.encoder.Name)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passThrough {
+		return w.ResponseWriter.Write(data)
+	}
+	if w.writer == nil {
+		var err error
+		if w.writer, err = w.encoder.NewWriter(w.ResponseWriter); err != nil {
+			return 0, errs.Wrap(err)
+		}
+	}
+	return w.writer.Write(data)
+}
+
+// Flush implements http.Flusher.
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.writer.(interface{ Flush() error }); ok {
+		_ = f.Flush() //nolint:errcheck // http.Flusher has no way to report the error
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original http.ResponseWriter, for use by http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) close() error {
+	if w.writer == nil {
+		return nil
+	}
+	return errs.Wrap(w.writer.Close())
+}
+
+// CORSOptions holds the configuration for CORS().
+type CORSOptions struct {
+	// AllowedOrigins holds the origins that may make cross-origin requests. An entry of "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedMethods holds the methods allowed in cross-origin requests. If empty, GET, HEAD and POST are allowed.
+	AllowedMethods []string
+	// AllowedHeaders holds the request headers allowed in cross-origin requests. If empty, the headers requested by
+	// the client during preflight are allowed.
+	AllowedHeaders []string
+	// ExposedHeaders holds the response headers that clients are permitted to read.
+	ExposedHeaders []string
+	// MaxAge is how long the results of a preflight request may be cached. Zero omits the header.
+	MaxAge time.Duration
+	// AllowCredentials permits requests that include credentials.
+	AllowCredentials bool
+}
+
+// CORS adds Cross-Origin Resource Sharing headers to responses for the allowed origins and answers preflight requests
+// without calling the handler.
+func CORS(options CORSOptions) Middleware {
+	methods := options.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	anyOrigin := slices.Contains(options.AllowedOrigins, "*")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			origin := req.Header.Get("Origin")
+			if origin == "" || (!anyOrigin && !slices.Contains(options.AllowedOrigins, origin)) {
+				next.ServeHTTP(w, req)
+				return
+			}
+			if anyOrigin && !options.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if options.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			requestedMethod := req.Header.Get("Access-Control-Request-Method")
+			if req.Method != http.MethodOptions || requestedMethod == "" {
+				if len(options.ExposedHeaders) != 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(options.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, req)
+				return
+			}
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			if !slices.Contains(methods, requestedMethod) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if len(options.AllowedHeaders) != 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(options.AllowedHeaders, ", "))
+			} else if requested := req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+			if options.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(options.MaxAge/time.Second)))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// Timeout responds with a 503 status if the handler takes longer than the duration to complete. The request's context
+// is canceled when the time expires, so handlers should watch it to stop their work. As with http.TimeoutHandler,
+// which this uses, the response is buffered, so the handler cannot flush partial results to the client.
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.TimeoutHandler(next, d, http.StatusText(http.StatusServiceUnavailable))
+	}
+}
+
+// MaxBodySize limits request bodies to the given number of bytes. Requests that declare a larger Content-Length are
+// rejected with a 413 status, and reads beyond the limit by the handler fail.
+func MaxBodySize(limit int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > limit {
+				xhttp.WriteHTTPStatus(w, http.StatusRequestEntityTooLarge)
+				return
+			}
+			if req.Body != nil {
+				req.Body = http.MaxBytesReader(w, req.Body, limit)
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
@@ -0,0 +1,210 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package web_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/xio/network/xhttp/web"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	mark := func(name string) web.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+	h := web.Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls = append(calls, "handler") }),
+		mark("a"), mark("b"))
+	serve(h, http.MethodGet, "/")
+	check.Equal(t, []string{"a", "b", "handler"}, calls)
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := web.Chain(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) { seen = web.RequestIDFrom(req) }),
+		web.RequestID(""))
+
+	w := serve(h, http.MethodGet, "/")
+	check.True(t, seen != "")
+	check.Equal(t, seen, w.Header().Get(web.DefaultRequestIDHeader))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(web.DefaultRequestIDHeader, "abc-123")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	check.Equal(t, "abc-123", seen)
+	check.Equal(t, "abc-123", w.Header().Get(web.DefaultRequestIDHeader))
+
+	req.Header.Set(web.DefaultRequestIDHeader, "bad id")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	check.True(t, seen != "bad id")
+
+	check.Equal(t, "", web.RequestIDFrom(req))
+}
+
+func TestCompress(t *testing.T) {
+	content := strings.Repeat("compressible content ", 100)
+	h := web.Chain(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		fmt.Fprint(w, content)
+	}), web.Compress())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "br;q=1.0, gzip;q=0.8, deflate;q=0")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	check.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	check.Equal(t, "", w.Header().Get("Content-Length"))
+	check.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	check.True(t, w.Body.Len() < len(content))
+	r, err := gzip.NewReader(w.Body)
+	check.NoError(t, err)
+	var data []byte
+	data, err = io.ReadAll(r)
+	check.NoError(t, err)
+	check.Equal(t, content, string(data))
+
+	req.Header.Set("Accept-Encoding", "deflate;q=0, gzip;q=0")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	check.Equal(t, "", w.Header().Get("Content-Encoding"))
+	check.Equal(t, content, w.Body.String())
+
+	custom := web.Encoder{
+		Name: "upper",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return &upperWriter{w: w}, nil
+		},
+	}
+	h = web.Chain(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { fmt.Fprint(w, "abc") }),
+		web.Compress(custom))
+	req.Header.Set("Accept-Encoding", "*")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	check.Equal(t, "upper", w.Header().Get("Content-Encoding"))
+	check.Equal(t, "ABC", w.Body.String())
+}
+
+type upperWriter struct {
+	w io.Writer
+}
+
+func (u *upperWriter) Write(data []byte) (int, error) {
+	return u.w.Write(bytes.ToUpper(data))
+}
+
+func (u *upperWriter) Close() error {
+	return nil
+}
+
+func TestCORS(t *testing.T) {
+	called := false
+	h := web.Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }),
+		web.CORS(web.CORSOptions{
+			AllowedOrigins: []string{"https://example.com"},
+			AllowedMethods: []string{http.MethodGet, http.MethodPut},
+			ExposedHeaders: []string{"X-Total"},
+			MaxAge:         time.Hour,
+		}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	check.False(t, called)
+	check.Equal(t, http.StatusNoContent, w.Code)
+	check.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	check.Equal(t, "GET, PUT", w.Header().Get("Access-Control-Allow-Methods"))
+	check.Equal(t, "Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+	check.Equal(t, "3600", w.Header().Get("Access-Control-Max-Age"))
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	check.True(t, called)
+	check.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	check.Equal(t, "X-Total", w.Header().Get("Access-Control-Expose-Headers"))
+
+	req.Header.Set("Origin", "https://other.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	check.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestTimeout(t *testing.T) {
+	h := web.Chain(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) { <-req.Context().Done() }),
+		web.Timeout(10*time.Millisecond))
+	check.Equal(t, http.StatusServiceUnavailable, serve(h, http.MethodGet, "/").Code)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	var readErr error
+	h := web.Chain(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		_, readErr = io.ReadAll(req.Body)
+	}), web.MaxBodySize(4))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345")))
+	check.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345"))
+	req.ContentLength = -1
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	check.Error(t, readErr)
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader("1234")))
+	check.NoError(t, readErr)
+}
+
+func TestAccessLogAndRecover(t *testing.T) {
+	var entries []*web.AccessLogEntry
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buffer, nil))
+	h := web.Chain(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/panic" {
+			panic("boom")
+		}
+		fmt.Fprint(w, "hello")
+	}), web.RequestID(""), web.AccessLogFunc(func(entry *web.AccessLogEntry) { entries = append(entries, entry) }),
+		web.AccessLog(logger), web.Recover(logger))
+
+	serve(h, http.MethodGet, "/hello")
+	serve(h, http.MethodGet, "/panic")
+	check.Equal(t, 2, len(entries))
+	check.Equal(t, http.StatusOK, entries[0].Status)
+	check.Equal(t, 5, entries[0].Bytes)
+	check.True(t, entries[0].RequestID != "")
+	check.Equal(t, http.StatusInternalServerError, entries[1].Status)
+	check.Contains(t, buffer.String(), "recovered from panic in handler")
+	check.Contains(t, buffer.String(), "status=500")
+
+	buffer.Reset()
+	entries[0].Started = time.Date(2023, time.March, 4, 5, 6, 7, 0, time.UTC)
+	web.CommonLogFormat(&buffer)(entries[0])
+	check.Equal(t, `192.0.2.1 - - [04/Mar/2023:05:06:07 +0000] "GET /hello HTTP/1.1" 200 5`+"\n", buffer.String())
+}
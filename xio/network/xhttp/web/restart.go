@@ -0,0 +1,217 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ddkwork/toolbox/atexit"
+	"github.com/ddkwork/toolbox/errs"
+)
+
+const (
+	listenersEnvVar = "TOOLBOX_WEB_LISTENERS"
+	readyFDEnvVar   = "TOOLBOX_WEB_READY_FD"
+	restartTimeout  = time.Minute
+)
+
+var (
+	restartLock   sync.Mutex
+	running       = make(map[*Server]*net.TCPListener)
+	inherited     map[string][]*os.File
+	readyFile     *os.File
+	unclaimed     int
+	inheritedOnce sync.Once
+	signalOnce    sync.Once
+)
+
+// Restart starts a new copy of the running executable with the same arguments and environment, handing it the
+// listeners of all running servers, then waits until the new process is serving on all of them. Until this process
+// shuts its servers down, both processes accept connections; the caller is responsible for doing so once this returns
+// without error, typically by calling atexit.Exit(), which drains in-flight requests via Server.Shutdown(). If the new
+// process exits or the context is done before it becomes ready, the new process is killed and an error is returned.
+// Not supported on Windows.
+func Restart(ctx context.Context) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	restartLock.Lock()
+	keys := make([]string, 0, len(running))
+	listeners := make([]*net.TCPListener, 0, len(running))
+	for s, ln := range running {
+		keys = append(keys, s.listenKey())
+		listeners = append(listeners, ln)
+	}
+	restartLock.Unlock()
+	if len(listeners) == 0 {
+		return errs.New("no running servers to hand off")
+	}
+	var data []byte
+	if data, err = json.Marshal(keys); err != nil {
+		return errs.Wrap(err)
+	}
+	files := make([]*os.File, 0, len(listeners)+1)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close() //nolint:errcheck // The new process has its own copy
+		}
+	}()
+	for _, ln := range listeners {
+		var f *os.File
+		if f, err = ln.File(); err != nil {
+			return errs.Wrap(err)
+		}
+		files = append(files, f)
+	}
+	var r, w *os.File
+	if r, w, err = os.Pipe(); err != nil {
+		return errs.Wrap(err)
+	}
+	defer func() { _ = r.Close() }() //nolint:errcheck // Nothing useful can be done with the error
+	files = append(files, w)
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// ExtraFiles start at descriptor 3 in the new process.
+	cmd.Env = append(os.Environ(), listenersEnvVar+"="+string(data),
+		fmt.Sprintf("%s=%d", readyFDEnvVar, 2+len(files)))
+	cmd.ExtraFiles = files
+	if err = cmd.Start(); err != nil {
+		return errs.Wrap(err)
+	}
+	_ = w.Close() //nolint:errcheck // Must be closed here so that the read below sees the new process exit
+	files = files[:len(files)-1]
+	ready := make(chan bool, 1)
+	go func() {
+		var buffer [1]byte
+		n, _ := r.Read(buffer[:]) //nolint:errcheck // Only the byte count matters
+		ready <- n == 1
+	}()
+	select {
+	case ok := <-ready:
+		if ok {
+			return errs.Wrap(cmd.Process.Release())
+		}
+		err = errs.New("new process exited before becoming ready")
+	case <-ctx.Done():
+		err = errs.NewWithCause("new process did not become ready", ctx.Err())
+	}
+	_ = cmd.Process.Kill() //nolint:errcheck // The process may have already exited
+	_ = cmd.Wait()         //nolint:errcheck // The failure has already been determined
+	return err
+}
+
+func installRestartHandler() {
+	signalOnce.Do(func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGHUP)
+		go func() {
+			for range sigChan {
+				slog.Info("restarting")
+				ctx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+				err := Restart(ctx)
+				cancel()
+				if err != nil {
+					errs.Log(errs.NewWithCause("unable to restart", err))
+					continue
+				}
+				atexit.Exit(0)
+			}
+		}()
+	})
+}
+
+func loadInherited() {
+	inheritedOnce.Do(func() {
+		names := os.Getenv(listenersEnvVar)
+		readyFD := os.Getenv(readyFDEnvVar)
+		// Don't pass these on to any processes we start.
+		_ = os.Unsetenv(listenersEnvVar) //nolint:errcheck // Nothing useful can be done with the error
+		_ = os.Unsetenv(readyFDEnvVar)   //nolint:errcheck // Nothing useful can be done with the error
+		if names == "" {
+			return
+		}
+		var keys []string
+		if err := json.Unmarshal([]byte(names), &keys); err != nil {
+			errs.Log(errs.NewWithCause("unable to decode inherited listeners", err))
+			return
+		}
+		inherited = make(map[string][]*os.File)
+		for i, key := range keys {
+			inherited[key] = append(inherited[key], os.NewFile(uintptr(3+i), key))
+		}
+		unclaimed = len(keys)
+		if fd, err := strconv.Atoi(readyFD); err == nil {
+			readyFile = os.NewFile(uintptr(fd), "ready")
+		}
+	})
+}
+
+// inheritedListener returns the listener handed to this process by its parent for the key, or nil if there isn't one.
+func inheritedListener(key string) (net.Listener, error) {
+	loadInherited()
+	restartLock.Lock()
+	defer restartLock.Unlock()
+	files := inherited[key]
+	if len(files) == 0 {
+		return nil, nil
+	}
+	f := files[0]
+	inherited[key] = files[1:]
+	defer func() { _ = f.Close() }() //nolint:errcheck // The listener has its own copy
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, errs.NewWithCause("unable to use inherited listener for "+key, err)
+	}
+	return ln, nil
+}
+
+func (s *Server) started(ln *net.TCPListener, wasInherited bool) {
+	restartLock.Lock()
+	defer restartLock.Unlock()
+	running[s] = ln
+	if wasInherited {
+		unclaimed--
+		if unclaimed == 0 && readyFile != nil {
+			if _, err := readyFile.Write([]byte{1}); err != nil {
+				errs.Log(errs.NewWithCause("unable to notify parent of readiness", err))
+			}
+			_ = readyFile.Close() //nolint:errcheck // Nothing useful can be done with the error
+			readyFile = nil
+		}
+	}
+}
+
+func (s *Server) stopped() {
+	restartLock.Lock()
+	delete(running, s)
+	restartLock.Unlock()
+}
+
+// listenKey returns the key used to match up the server's listener with the one inherited from a parent process.
+func (s *Server) listenKey() string {
+	if _, _, err := net.SplitHostPort(s.WebServer.Addr); err == nil {
+		return s.WebServer.Addr
+	}
+	return fmt.Sprintf("%s%v", s.WebServer.Addr, s.Ports)
+}
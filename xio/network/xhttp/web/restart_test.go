@@ -0,0 +1,106 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package web_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/xio/network/xhttp/web"
+)
+
+const restartChildEnvVar = "WEB_RESTART_TEST_CHILD"
+
+func TestGracefulRestart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("listener handoff is not supported on Windows")
+	}
+	// The restarted process is this test binary running only this test, which takes the child's role.
+	name := "parent"
+	if os.Getenv(restartChildEnvVar) != "" {
+		name = "child"
+	}
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var s *web.Server
+	s = &web.Server{
+		ShutdownGracePeriod: 10 * time.Second,
+		WebServer: &http.Server{
+			Addr: "127.0.0.1",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/slow":
+					close(entered)
+					<-release
+				case "/quit":
+					go s.Shutdown()
+				}
+				_, _ = w.Write([]byte(name)) //nolint:errcheck // Test only
+			}),
+		},
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		StartedChan: make(chan any),
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	<-s.StartedChan
+	if name == "child" {
+		check.NoError(t, <-done)
+		return
+	}
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	get := func(path string) string {
+		rsp, err := client.Get(s.LocalBaseURL() + path) //nolint:noctx // Test only
+		check.NoError(t, err)
+		var data []byte
+		data, err = io.ReadAll(rsp.Body)
+		check.NoError(t, err)
+		check.NoError(t, rsp.Body.Close())
+		return string(data)
+	}
+	check.Equal(t, "parent", get("/"))
+	slow := make(chan string, 1)
+	go func() { slow <- get("/slow") }()
+	<-entered
+
+	t.Setenv(restartChildEnvVar, "1")
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestGracefulRestart$"}
+	defer func() { os.Args = args }()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	check.NoError(t, web.Restart(ctx))
+
+	// Shutting down stops new connections from reaching this process, while the in-flight request completes.
+	go s.Shutdown()
+	deadline := time.Now().Add(10 * time.Second)
+	for get("/") != "child" {
+		if time.Now().After(deadline) {
+			t.Fatal("new process never received a request")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	check.Equal(t, "parent", <-slow)
+	check.NoError(t, <-done)
+	check.Equal(t, "child", get("/quit"))
+}
+
+func TestRestartWithoutServers(t *testing.T) {
+	check.Error(t, web.Restart(context.Background()))
+}
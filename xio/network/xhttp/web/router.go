@@ -0,0 +1,358 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package web
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio/network/xhttp"
+)
+
+// Router dispatches requests to handlers registered with patterns of the form "[METHOD ]/path". Each segment of the
+// path may be a literal, a "{name}" wildcard that matches exactly one segment, or, as the final segment only, a
+// "{name...}" wildcard that matches all remaining segments, including none. Literal segments take precedence over
+// wildcards. A pattern without a method matches any method. HEAD requests are served by the GET handler when no HEAD
+// handler was registered, OPTIONS requests are answered with the allowed methods when no OPTIONS handler was
+// registered, and requests for a path that has handlers, but not for the method requested, receive a 405 response.
+//
+// The values matched by wildcards can be retrieved with Param(). When used with a Server, matching is performed
+// against the path remaining after any calls to PathHeadThenShift() made before the Router was reached. Once a route
+// has matched, the remaining path is set to the value of its "{name...}" wildcard, if any, so PathHeadThenShift() can
+// continue to be used to walk it.
+//
+// The zero value is not usable; create one with NewRouter().
+type Router struct {
+	root       *Router
+	parent     *Router
+	shared     *routerState
+	prefix     string
+	middleware []Middleware
+}
+
+type routerState struct {
+	tree     *routeNode
+	notFound http.Handler
+	lock     sync.RWMutex
+}
+
+type routeNode struct {
+	literals map[string]*routeNode
+	wildcard *routeNode
+	name     string
+	rest     *routeEndpoint
+	endpoint *routeEndpoint
+	restName string
+}
+
+type routeEndpoint struct {
+	handlers map[string]*routeHandler
+}
+
+type routeHandler struct {
+	handler http.Handler
+	group   *Router
+}
+
+type routeMatch struct {
+	endpoint *routeEndpoint
+	names    []string
+	values   []string
+	rest     string
+}
+
+// NewRouter creates a new, empty Router.
+func NewRouter() *Router {
+	r := &Router{shared: &routerState{tree: &routeNode{}}}
+	r.root = r
+	return r
+}
+
+// Group returns a Router that registers its routes with this Router, prefixing their paths with the prefix and
+// wrapping their handlers with the middleware, after any middleware of this Router.
+func (r *Router) Group(prefix string, middleware ...Middleware) *Router {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		panic(errs.Newf("group prefix must start with a '/': %q", prefix))
+	}
+	return &Router{
+		root:       r.root,
+		parent:     r,
+		shared:     r.shared,
+		prefix:     r.prefix + prefix,
+		middleware: slices.Clone(middleware),
+	}
+}
+
+// Use adds middleware to this Router. Middleware added to a group applies to the routes registered with that group
+// and its subgroups. Middleware added to the Router returned by NewRouter() applies to every request it serves,
+// including those that result in a 404, 405 or automatic OPTIONS response. Middleware is applied in the order it was
+// added, with the first being the outermost.
+func (r *Router) Use(middleware ...Middleware) {
+	r.shared.lock.Lock()
+	r.middleware = append(r.middleware, middleware...)
+	r.shared.lock.Unlock()
+}
+
+// NotFound sets the handler to use when no route matches a request. By default, a 404 status is returned.
+func (r *Router) NotFound(handler http.Handler) {
+	r.shared.lock.Lock()
+	r.shared.notFound = handler
+	r.shared.lock.Unlock()
+}
+
+// Handle registers the handler for the pattern. Panics if the pattern is malformed or conflicts with one that was
+// already registered.
+func (r *Router) Handle(pattern string, handler http.Handler) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+	path = strings.TrimLeft(path, " ")
+	if method != strings.ToUpper(method) {
+		panic(errs.Newf("method in pattern must be upper case: %q", pattern))
+	}
+	if !strings.HasPrefix(path, "/") {
+		panic(errs.Newf("path in pattern must start with a '/': %q", pattern))
+	}
+	if handler == nil {
+		panic(errs.Newf("nil handler for pattern %q", pattern))
+	}
+	r.shared.lock.Lock()
+	defer r.shared.lock.Unlock()
+	e := r.shared.tree.insert(pattern, splitPath(r.prefix+path))
+	if e.handlers == nil {
+		e.handlers = make(map[string]*routeHandler)
+	}
+	if _, exists := e.handlers[method]; exists {
+		panic(errs.Newf("pattern %q conflicts with one already registered", pattern))
+	}
+	e.handlers[method] = &routeHandler{handler: handler, group: r}
+}
+
+// HandleFunc registers the handler function for the pattern. Panics if the pattern is malformed or conflicts with one
+// that was already registered.
+func (r *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	r.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	root := r.root
+	root.shared.lock.RLock()
+	handler := Chain(root.dispatch(req), root.middleware...)
+	root.shared.lock.RUnlock()
+	handler.ServeHTTP(w, req)
+}
+
+func (r *Router) dispatch(req *http.Request) http.Handler {
+	rt, hasRoute := req.Context().Value(routeKey).(*route)
+	p := req.URL.Path
+	if hasRoute {
+		p = rt.path
+	}
+	m := r.shared.tree.match(req.Method, splitPath(p))
+	if m == nil {
+		if r.shared.notFound != nil {
+			return r.shared.notFound
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			xhttp.WriteHTTPStatus(w, http.StatusNotFound)
+		})
+	}
+	for i, name := range m.names {
+		req.SetPathValue(name, m.values[i])
+	}
+	if hasRoute {
+		rt.path = "/" + m.rest
+	}
+	rh := m.endpoint.lookup(req.Method)
+	if rh == nil {
+		allowed := m.endpoint.allowed()
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Allow", allowed)
+			if req.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			xhttp.WriteHTTPStatus(w, http.StatusMethodNotAllowed)
+		})
+	}
+	handler := rh.handler
+	for g := rh.group; g != r; g = g.parent {
+		handler = Chain(handler, g.middleware...)
+	}
+	return handler
+}
+
+// Param returns the value matched by the named wildcard of the Router pattern that matched the request, or an empty
+// string if there is no such wildcard.
+func Param(req *http.Request, name string) string {
+	return req.PathValue(name)
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+func (n *routeNode) insert(pattern string, segments []string) *routeEndpoint {
+	for i, seg := range segments {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			if strings.ContainsAny(seg, "{}") {
+				panic(errs.Newf("wildcard must be an entire path segment in pattern %q", pattern))
+			}
+			if n.literals == nil {
+				n.literals = make(map[string]*routeNode)
+			}
+			child, exists := n.literals[seg]
+			if !exists {
+				child = &routeNode{}
+				n.literals[seg] = child
+			}
+			n = child
+			continue
+		}
+		name := seg[1 : len(seg)-1]
+		if rest, isRest := strings.CutSuffix(name, "..."); isRest {
+			if i != len(segments)-1 {
+				panic(errs.Newf("'{%s}' must be the final segment in pattern %q", name, pattern))
+			}
+			checkWildcardName(pattern, rest)
+			if n.rest == nil {
+				n.rest = &routeEndpoint{}
+				n.restName = rest
+			} else if n.restName != rest {
+				panic(errs.Newf("wildcard '{%s...}' in pattern %q conflicts with '{%s...}'", rest, pattern,
+					n.restName))
+			}
+			return n.rest
+		}
+		checkWildcardName(pattern, name)
+		if n.wildcard == nil {
+			n.wildcard = &routeNode{name: name}
+		} else if n.wildcard.name != name {
+			panic(errs.Newf("wildcard '{%s}' in pattern %q conflicts with '{%s}'", name, pattern, n.wildcard.name))
+		}
+		n = n.wildcard
+	}
+	if n.endpoint == nil {
+		n.endpoint = &routeEndpoint{}
+	}
+	return n.endpoint
+}
+
+func checkWildcardName(pattern, name string) {
+	if name == "" || strings.ContainsAny(name, "{}.") {
+		panic(errs.Newf("invalid wildcard name %q in pattern %q", name, pattern))
+	}
+}
+
+// match returns the best match for the segments, preferring literal segments over wildcards and a route that accepts
+// the method over one that doesn't. Returns nil if no route matches the path at all.
+func (n *routeNode) match(method string, segments []string) *routeMatch {
+	var fallback *routeMatch
+	var names, values []string
+	var walk func(n *routeNode, segments []string) *routeMatch
+	walk = func(n *routeNode, segments []string) *routeMatch {
+		if len(segments) == 0 && n.endpoint != nil {
+			if m := candidate(method, n.endpoint, names, values, "", &fallback); m != nil {
+				return m
+			}
+		}
+		if len(segments) != 0 {
+			if child, exists := n.literals[segments[0]]; exists {
+				if m := walk(child, segments[1:]); m != nil {
+					return m
+				}
+			}
+			if n.wildcard != nil {
+				names = append(names, n.wildcard.name)
+				values = append(values, segments[0])
+				if m := walk(n.wildcard, segments[1:]); m != nil {
+					return m
+				}
+				names = names[:len(names)-1]
+				values = values[:len(values)-1]
+			}
+		}
+		if n.rest != nil {
+			rest := strings.Join(segments, "/")
+			if m := candidate(method, n.rest, append(names, n.restName), append(values, rest), rest,
+				&fallback); m != nil {
+				return m
+			}
+		}
+		return nil
+	}
+	if m := walk(n, segments); m != nil {
+		return m
+	}
+	return fallback
+}
+
+// candidate returns a match for the endpoint if it accepts the method. If it does not, but it is the first endpoint
+// found, it is recorded as the fallback.
+func candidate(method string, e *routeEndpoint, names, values []string, rest string,
+	fallback **routeMatch,
+) *routeMatch {
+	if len(e.handlers) == 0 {
+		return nil
+	}
+	m := &routeMatch{
+		endpoint: e,
+		names:    slices.Clone(names),
+		values:   slices.Clone(values),
+		rest:     rest,
+	}
+	if e.lookup(method) != nil {
+		return m
+	}
+	if *fallback == nil {
+		*fallback = m
+	}
+	return nil
+}
+
+func (e *routeEndpoint) lookup(method string) *routeHandler {
+	if h, exists := e.handlers[method]; exists {
+		return h
+	}
+	if method == http.MethodHead {
+		if h, exists := e.handlers[http.MethodGet]; exists {
+			return h
+		}
+	}
+	return e.handlers[""]
+}
+
+// allowed returns the value for the Allow header.
+func (e *routeEndpoint) allowed() string {
+	methods := make([]string, 0, len(e.handlers)+2)
+	for method := range e.handlers {
+		methods = append(methods, method)
+	}
+	if _, exists := e.handlers[http.MethodGet]; exists {
+		if _, exists = e.handlers[http.MethodHead]; !exists {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	if _, exists := e.handlers[http.MethodOptions]; !exists {
+		methods = append(methods, http.MethodOptions)
+	}
+	slices.Sort(methods)
+	return strings.Join(methods, ", ")
+}
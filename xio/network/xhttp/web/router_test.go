@@ -0,0 +1,176 @@
+// Copyright ©2016-2023 by Richard A. Wilkes. All rights reserved.
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with
+// this file, You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// This Source Code Form is "Incompatible With Secondary Licenses", as
+// defined by the Mozilla Public License, version 2.0.
+
+package web_test
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ddkwork/toolbox/check"
+	"github.com/ddkwork/toolbox/xio/network/xhttp/web"
+)
+
+func serve(r http.Handler, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func reply(text string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "%s id=%s path=%s", text, web.Param(req, "id"), web.Param(req, "path"))
+	}
+}
+
+func TestRouterMatching(t *testing.T) {
+	r := web.NewRouter()
+	r.Handle("GET /users/{id}/files/{path...}", reply("files"))
+	r.Handle("GET /users/{id}", reply("user"))
+	r.Handle("GET /users/me", reply("me"))
+	r.Handle("DELETE /users/{id}", reply("delete"))
+	r.Handle("/any", reply("any"))
+	r.HandleFunc("GET /", func(w http.ResponseWriter, _ *http.Request) { fmt.Fprint(w, "root") })
+
+	for _, one := range []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodGet, "/users/42/files/a/b/c.txt", "files id=42 path=a/b/c.txt"},
+		{http.MethodGet, "/users/42/files", "files id=42 path="},
+		{http.MethodGet, "/users/42", "user id=42 path="},
+		{http.MethodGet, "/users/me", "me id= path="},
+		{http.MethodDelete, "/users/me", "delete id=me path="},
+		{http.MethodPatch, "/any", "any id= path="},
+		{http.MethodGet, "/", "root"},
+	} {
+		w := serve(r, one.method, one.target)
+		check.Equal(t, http.StatusOK, w.Code, one.method+" "+one.target)
+		check.Equal(t, one.body, w.Body.String(), one.method+" "+one.target)
+	}
+
+	check.Equal(t, http.StatusNotFound, serve(r, http.MethodGet, "/users/42/other").Code)
+	r.NotFound(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) }))
+	check.Equal(t, http.StatusTeapot, serve(r, http.MethodGet, "/nothing").Code)
+}
+
+func TestRouterMethods(t *testing.T) {
+	r := web.NewRouter()
+	r.Handle("GET /items/{id}", reply("get"))
+	r.Handle("PUT /items/{id}", reply("put"))
+
+	w := serve(r, http.MethodPost, "/items/1")
+	check.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	check.Equal(t, "GET, HEAD, OPTIONS, PUT", w.Header().Get("Allow"))
+
+	w = serve(r, http.MethodOptions, "/items/1")
+	check.Equal(t, http.StatusNoContent, w.Code)
+	check.Equal(t, "GET, HEAD, OPTIONS, PUT", w.Header().Get("Allow"))
+
+	w = serve(r, http.MethodHead, "/items/1")
+	check.Equal(t, http.StatusOK, w.Code)
+
+	r.Handle("OPTIONS /items/{id}", reply("options"))
+	w = serve(r, http.MethodOptions, "/items/1")
+	check.Equal(t, http.StatusOK, w.Code)
+	check.Equal(t, "options id=1 path=", w.Body.String())
+}
+
+func TestRouterGroups(t *testing.T) {
+	var calls []string
+	mark := func(name string) web.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, req)
+			})
+		}
+	}
+	r := web.NewRouter()
+	r.Use(mark("root"))
+	api := r.Group("/api", mark("api"))
+	v1 := api.Group("/v1/", mark("v1"))
+	v1.Use(mark("v1b"))
+	v1.Handle("GET /users/{id}", reply("v1"))
+	r.Handle("GET /plain", reply("plain"))
+
+	w := serve(r, http.MethodGet, "/api/v1/users/7")
+	check.Equal(t, "v1 id=7 path=", w.Body.String())
+	check.Equal(t, []string{"root", "api", "v1", "v1b"}, calls)
+
+	calls = nil
+	serve(r, http.MethodGet, "/plain")
+	check.Equal(t, []string{"root"}, calls)
+
+	calls = nil
+	check.Equal(t, http.StatusNotFound, serve(r, http.MethodGet, "/api/v2").Code)
+	check.Equal(t, []string{"root"}, calls)
+
+	// A group serves requests through the full router.
+	check.Equal(t, "plain id= path=", serve(v1, http.MethodGet, "/plain").Body.String())
+}
+
+func TestRouterBadPatterns(t *testing.T) {
+	r := web.NewRouter()
+	r.Handle("GET /a/{id}", reply(""))
+	check.Panics(t, func() { r.Handle("GET /a/{id}", reply("")) })
+	check.Panics(t, func() { r.Handle("GET /a/{name}/b", reply("")) })
+	check.Panics(t, func() { r.Handle("GET /a/{path...}/b", reply("")) })
+	check.Panics(t, func() { r.Handle("GET /a/x{id}", reply("")) })
+	check.Panics(t, func() { r.Handle("get /b", reply("")) })
+	check.Panics(t, func() { r.Handle("GET b", reply("")) })
+	check.Panics(t, func() { r.Group("b") })
+	check.NotPanics(t, func() { r.Handle("POST /a/{id}", reply("")) })
+}
+
+func TestRouterWithShift(t *testing.T) {
+	r := web.NewRouter()
+	r.HandleFunc("GET /repos/{id}/{path...}", func(w http.ResponseWriter, req *http.Request) {
+		var segments []string
+		for web.HasMorePathSegments(req) {
+			segments = append(segments, web.PathHeadThenShift(req))
+		}
+		fmt.Fprintf(w, "%s:%s", web.Param(req, "id"), strings.Join(segments, ","))
+	})
+	s := &web.Server{
+		WebServer: &http.Server{
+			Addr: "127.0.0.1",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if web.PathHeadThenShift(req) != "v1" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				r.ServeHTTP(w, req)
+			}),
+		},
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		StartedChan: make(chan any),
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	<-s.StartedChan
+	defer func() {
+		s.Shutdown()
+		check.NoError(t, <-done)
+	}()
+
+	rsp, err := http.Get(s.LocalBaseURL() + "/v1/repos/12/a/b/c") //nolint:noctx // Test only
+	check.NoError(t, err)
+	var body []byte
+	body, err = io.ReadAll(rsp.Body)
+	check.NoError(t, err)
+	check.NoError(t, rsp.Body.Close())
+	check.Equal(t, "12:a,b,c", string(body))
+}
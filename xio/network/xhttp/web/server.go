@@ -13,20 +13,20 @@ package web
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
-	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ddkwork/toolbox/atexit"
 	"github.com/ddkwork/toolbox/errs"
+	"github.com/ddkwork/toolbox/xio"
 	"github.com/ddkwork/toolbox/xio/network"
-	"github.com/ddkwork/toolbox/xio/network/xhttp"
 )
 
 // Constants for protocols the server can provide.
@@ -37,21 +37,37 @@ const (
 
 // Server holds the data necessary for the server.
 type Server struct {
-	CertFile            string
-	KeyFile             string
-	ShutdownGracePeriod time.Duration
-	Logger              *slog.Logger
-	WebServer           *http.Server
-	Ports               []int
-	ShutdownCallback    func()
-	StartedChan         chan any // If not nil, will be closed once the server is ready to accept connections
-	addresses           []string
-	port                int
+	CertFile string
+	KeyFile  string
+	// Certificates, if not nil, supplies the certificates for HTTPS and takes precedence over CertFile and KeyFile.
+	// When it is nil and CertFile and KeyFile are set, a CertificateManager for them is created, so changes to the
+	// files are picked up without a restart.
+	Certificates *CertificateManager
+	// CertificateCheckInterval is how often certificates are checked for changes and renewal. If zero or less, one
+	// minute is used.
+	CertificateCheckInterval time.Duration
+	ShutdownGracePeriod      time.Duration
+	Logger                   *slog.Logger
+	WebServer                *http.Server
+	Ports                    []int
+	// Middleware wraps WebServer.Handler, with the first being the outermost. If nil, DefaultMiddleware() is used.
+	Middleware       []Middleware
+	ShutdownCallback func()
+	StartedChan      chan any // If not nil, will be closed once the server is ready to accept connections
+	// SelfSigned causes a self-signed certificate to be created in CertFile and KeyFile if they don't exist. This is
+	// intended for development use.
+	SelfSigned bool
+	// GracefulRestart causes a SIGHUP to restart the process without dropping connections: the executable is started
+	// again and handed the listeners of all running servers, then, once it is serving, this process exits via
+	// atexit.Exit(), which drains in-flight requests. See Restart().
+	GracefulRestart bool
+	addresses       []string
+	port            int
 }
 
 // Protocol returns the protocol this server is handling.
 func (s *Server) Protocol() string {
-	if s.CertFile != "" && s.KeyFile != "" {
+	if s.Certificates != nil || (s.CertFile != "" && s.KeyFile != "") {
 		return ProtocolHTTPS
 	}
 	return ProtocolHTTP
@@ -85,44 +101,32 @@ func (s *Server) String() string {
 	return buffer.String()
 }
 
+// DefaultMiddleware returns the middleware used when Middleware is nil: CleanPath(), then AccessLog() and Recover()
+// using the server's logger. It may be used as the starting point for a customized set of middleware.
+func (s *Server) DefaultMiddleware() []Middleware {
+	return []Middleware{CleanPath(), AccessLog(s.Logger), Recover(s.Logger)}
+}
+
 // Run the server. Does not return until the server is shutdown.
 func (s *Server) Run() error {
-	atexit.Register(s.Shutdown)
 	if s.Logger == nil {
 		s.Logger = slog.Default()
 	}
-	handler := s.WebServer.Handler
-	s.WebServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		started := time.Now()
-		req.URL.Path = path.Clean(req.URL.Path)
-		req = req.WithContext(context.WithValue(req.Context(), routeKey, &route{path: req.URL.Path}))
-		sw := &xhttp.StatusResponseWriter{
-			Original: w,
-			Head:     req.Method == http.MethodHead,
-		}
-		defer func() {
-			if recovered := recover(); recovered != nil {
-				err, ok := recovered.(error)
-				if !ok {
-					err = errs.Newf("%+v", recovered)
-				}
-				errs.LogTo(s.Logger, errs.NewWithCause("recovered from panic in handler", err))
-				sw.WriteHeader(http.StatusInternalServerError)
-			}
-			since := time.Since(started)
-			millis := int64(since / time.Millisecond)
-			micros := int64(since/time.Microsecond) - millis*1000
-			written := sw.BytesWritten()
-			s.Logger.Info("web", "status", sw.Status(), "elapsed", fmt.Sprintf("%d.%03dms", millis, micros),
-				"bytes", written, "method", req.Method, "url", req.URL)
-		}()
-		handler.ServeHTTP(sw, req)
-	})
+	certs, err := s.certificates()
+	if err != nil {
+		return err
+	}
+	host, _, splitErr := net.SplitHostPort(s.WebServer.Addr)
 	var ln net.Listener
-	host, _, err := net.SplitHostPort(s.WebServer.Addr)
-	if err == nil {
+	if ln, err = inheritedListener(s.listenKey()); err != nil {
+		return err
+	}
+	wasInherited := ln != nil
+	switch {
+	case wasInherited:
+	case splitErr == nil:
 		ln, err = net.Listen("tcp", s.WebServer.Addr)
-	} else {
+	default:
 		ports := s.Ports
 		if len(ports) == 0 {
 			ports = []int{0}
@@ -139,20 +143,42 @@ func (s *Server) Run() error {
 	listener := network.TCPKeepAliveListener{TCPListener: ln.(*net.TCPListener)}
 	var portStr string
 	if _, portStr, err = net.SplitHostPort(ln.Addr().String()); err != nil {
+		xio.CloseIgnoringErrors(ln)
 		return errs.Wrap(err)
 	}
 	if s.port, err = strconv.Atoi(portStr); err != nil {
+		xio.CloseIgnoringErrors(ln)
 		return errs.Wrap(err)
 	}
+	// Nothing is changed until the server is certain to start, so that a failed attempt may be retried.
+	atexit.Register(s.Shutdown)
+	middleware := s.Middleware
+	if middleware == nil {
+		middleware = s.DefaultMiddleware()
+	}
+	s.WebServer.Handler = Chain(s.WebServer.Handler, middleware...)
 	s.addresses = network.AddressesForHost(host)
-	s.Logger.Info("listening", "protocol", s.Protocol(), "addresses", s.addresses, "port", s.port)
+	s.Logger.Info("listening", "protocol", s.Protocol(), "addresses", s.addresses, "port", s.port, "inherited",
+		wasInherited)
+	if s.GracefulRestart {
+		installRestartHandler()
+	}
+	s.started(listener.TCPListener, wasInherited)
+	defer s.stopped()
 	go func() {
 		if s.StartedChan != nil {
 			close(s.StartedChan)
 		}
 	}()
-	if s.Protocol() == ProtocolHTTPS {
-		err = s.WebServer.ServeTLS(listener, s.CertFile, s.KeyFile)
+	if certs != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		interval := s.CertificateCheckInterval
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		go certs.Watch(ctx, interval)
+		err = s.WebServer.ServeTLS(listener, "", "")
 	} else {
 		err = s.WebServer.Serve(listener)
 	}
@@ -162,6 +188,37 @@ func (s *Server) Run() error {
 	return nil
 }
 
+// certificates returns the CertificateManager to use, or nil if the server is not using HTTPS. The WebServer's TLS
+// configuration is updated to obtain its certificates from it.
+func (s *Server) certificates() (*CertificateManager, error) {
+	if s.Protocol() != ProtocolHTTPS {
+		return nil, nil
+	}
+	certs := s.Certificates
+	if certs == nil {
+		certs = NewCertificateManager()
+		var err error
+		if s.SelfSigned {
+			err = certs.AddSelfSigned(s.CertFile, s.KeyFile)
+		} else {
+			err = certs.AddFiles(s.CertFile, s.KeyFile)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	var cfg *tls.Config
+	if s.WebServer.TLSConfig != nil {
+		cfg = s.WebServer.TLSConfig.Clone()
+		cfg.Certificates = nil
+		cfg.GetCertificate = certs.GetCertificate
+	} else {
+		cfg = certs.TLSConfig()
+	}
+	s.WebServer.TLSConfig = cfg
+	return certs, nil
+}
+
 // Shutdown the server gracefully.
 func (s *Server) Shutdown() {
 	startedAt := time.Now()
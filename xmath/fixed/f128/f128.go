@@ -255,6 +255,49 @@ func (f Int[T]) Dec() Int[T] {
 	return f.Sub(Multiplier[T]())
 }
 
+// CheckedAdd is the same as Add(), except that it returns num.ErrOverflow if the result cannot be represented.
+func (f Int[T]) CheckedAdd(value Int[T]) (Int[T], error) {
+	data, err := f.data.CheckedAdd(value.data)
+	return Int[T]{data: data}, err
+}
+
+// CheckedSub is the same as Sub(), except that it returns num.ErrOverflow if the result cannot be represented.
+func (f Int[T]) CheckedSub(value Int[T]) (Int[T], error) {
+	data, err := f.data.CheckedSub(value.data)
+	return Int[T]{data: data}, err
+}
+
+// CheckedMul is the same as Mul(), except that it returns num.ErrOverflow if the result cannot be represented.
+func (f Int[T]) CheckedMul(value Int[T]) (Int[T], error) {
+	if data, err := f.data.CheckedMul(value.data); err == nil {
+		return Int[T]{data: data.Div(multiplier[T]())}, nil
+	}
+	// The intermediate product is too large, but the final result may still fit.
+	product := new(big.Int).Mul(f.data.AsBigInt(), value.data.AsBigInt())
+	data, err := num.CheckedInt128FromBigInt(product.Quo(product, multiplier[T]().AsBigInt()))
+	return Int[T]{data: data}, err
+}
+
+// CheckedDiv is the same as Div(), except that it returns num.ErrOverflow if the result cannot be represented.
+func (f Int[T]) CheckedDiv(value Int[T]) (Int[T], error) {
+	if data, err := f.data.CheckedMul(multiplier[T]()); err == nil {
+		if data, err = data.CheckedDiv(value.data); err != nil {
+			return Int[T]{}, err
+		}
+		return Int[T]{data: data}, nil
+	}
+	// The intermediate product is too large, but the final result may still fit.
+	scaled := new(big.Int).Mul(f.data.AsBigInt(), multiplier[T]().AsBigInt())
+	data, err := num.CheckedInt128FromBigInt(scaled.Quo(scaled, value.data.AsBigInt()))
+	return Int[T]{data: data}, err
+}
+
+// CheckedNeg is the same as Neg(), except that it returns num.ErrOverflow if the result cannot be represented.
+func (f Int[T]) CheckedNeg() (Int[T], error) {
+	data, err := f.data.CheckedNeg()
+	return Int[T]{data: data}, err
+}
+
 // As returns the equivalent value in the destination type.
 func As[T fixed.Dx, TO xmath.Numeric](f Int[T]) TO {
 	var n TO
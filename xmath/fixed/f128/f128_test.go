@@ -17,6 +17,7 @@ import (
 	"github.com/ddkwork/toolbox/check"
 	"github.com/ddkwork/toolbox/xmath/fixed"
 	"github.com/ddkwork/toolbox/xmath/fixed/f128"
+	"github.com/ddkwork/toolbox/xmath/num"
 	"gopkg.in/yaml.v3"
 )
 
@@ -118,6 +119,44 @@ func testMulDiv[T fixed.Dx](t *testing.T) {
 	check.Equal(t, "-0.9", negativePointThree.Mul(f128.From[T, int](3)).String())
 }
 
+func TestChecked(t *testing.T) {
+	testChecked[fixed.D1](t)
+	testChecked[fixed.D2](t)
+	testChecked[fixed.D3](t)
+	testChecked[fixed.D4](t)
+	testChecked[fixed.D5](t)
+	testChecked[fixed.D6](t)
+}
+
+func testChecked[T fixed.Dx](t *testing.T) {
+	one := f128.From[T, int](1)
+	v, err := f128.FromStringForced[T]("0.3").CheckedMul(f128.From[T, int](3))
+	check.NoError(t, err)
+	check.Equal(t, "0.9", v.String())
+	v, err = one.CheckedDiv(f128.From[T, int](-3))
+	check.NoError(t, err)
+	check.Equal(t, "-0."+strings.Repeat("3", f128.MaxDecimalDigits[T]()), v.String())
+	_, err = f128.Maximum[T]().CheckedAdd(one)
+	check.Equal(t, num.ErrOverflow, err)
+	_, err = f128.Minimum[T]().CheckedSub(one)
+	check.Equal(t, num.ErrOverflow, err)
+	_, err = f128.Minimum[T]().CheckedNeg()
+	check.Equal(t, num.ErrOverflow, err)
+	_, err = f128.Maximum[T]().CheckedMul(f128.From[T, int](2))
+	check.Equal(t, num.ErrOverflow, err)
+	_, err = f128.Maximum[T]().CheckedDiv(f128.FromStringForced[T]("0.5"))
+	check.Equal(t, num.ErrOverflow, err)
+
+	// Results that fit are still produced when the intermediate values do not.
+	large := f128.FromStringForced[T]("1" + strings.Repeat("0", 28))
+	v, err = large.CheckedMul(f128.From[T, int](2))
+	check.NoError(t, err)
+	check.Equal(t, "2"+strings.Repeat("0", 28), v.String())
+	v, err = v.CheckedDiv(f128.From[T, int](2))
+	check.NoError(t, err)
+	check.Equal(t, large, v)
+}
+
 func TestMod(t *testing.T) {
 	testMod[fixed.D1](t)
 	testMod[fixed.D2](t)
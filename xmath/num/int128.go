@@ -638,6 +638,71 @@ func (i Int128) Mod64(n int64) (r Int128) {
 	return r
 }
 
+// CheckedInt128FromBigInt creates an Int128 from a big.Int, returning ErrOverflow if the value is out of range rather
+// than clamping it.
+func CheckedInt128FromBigInt(v *big.Int) (Int128, error) {
+	if !fitsInt128(v) {
+		return Int128{}, ErrOverflow
+	}
+	return Int128FromBigInt(v), nil
+}
+
+// CheckedAdd returns i + n, or ErrOverflow if the result does not fit.
+func (i Int128) CheckedAdd(n Int128) (Int128, error) {
+	r := i.Add(n)
+	if (i.hi^r.hi)&(n.hi^r.hi)&signBit != 0 {
+		return Int128{}, ErrOverflow
+	}
+	return r, nil
+}
+
+// CheckedSub returns i - n, or ErrOverflow if the result does not fit.
+func (i Int128) CheckedSub(n Int128) (Int128, error) {
+	r := i.Sub(n)
+	if (i.hi^n.hi)&(i.hi^r.hi)&signBit != 0 {
+		return Int128{}, ErrOverflow
+	}
+	return r, nil
+}
+
+// CheckedMul returns i * n, or ErrOverflow if the result does not fit.
+func (i Int128) CheckedMul(n Int128) (Int128, error) {
+	if i.IsInt64() && n.IsInt64() {
+		// The product of two 64-bit values always fits within 128 bits.
+		return i.Mul(n), nil
+	}
+	return CheckedInt128FromBigInt(new(big.Int).Mul(i.AsBigInt(), n.AsBigInt()))
+}
+
+// CheckedDiv returns i / n, or ErrOverflow if the result does not fit, which only happens when dividing MinInt128 by
+// -1. If n == 0, a divide by zero panic will occur.
+func (i Int128) CheckedDiv(n Int128) (Int128, error) {
+	if i == MinInt128 && n.Equal64(-1) {
+		return Int128{}, ErrOverflow
+	}
+	return i.Div(n), nil
+}
+
+// CheckedNeg returns -i, or ErrOverflow if the result does not fit, which only happens for MinInt128.
+func (i Int128) CheckedNeg() (Int128, error) {
+	if i == MinInt128 {
+		return Int128{}, ErrOverflow
+	}
+	return i.Neg(), nil
+}
+
+func fitsInt128(v *big.Int) bool {
+	switch bitLen := v.BitLen(); {
+	case bitLen < 128:
+		return true
+	case bitLen > 128 || v.Sign() > 0:
+		return false
+	default:
+		// Only -2^127 remains representable.
+		return v.TrailingZeroBits() == 127
+	}
+}
+
 // String implements fmt.Stringer.
 func (i Int128) String() string {
 	if i.hi == 0 {
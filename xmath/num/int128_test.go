@@ -395,6 +395,53 @@ func TestInt128Div(t *testing.T) {
 	check.Equal(t, num.Int128FromBigInt(result), num.Int128FromBigInt(left).Div(num.Int128From64(10000)))
 }
 
+func TestInt128Checked(t *testing.T) {
+	one := num.Int128From64(1)
+	minusOne := num.Int128From64(-1)
+	v, err := num.MaxInt128.Sub(one).CheckedAdd(one)
+	check.NoError(t, err)
+	check.Equal(t, num.MaxInt128, v)
+	_, err = num.MaxInt128.CheckedAdd(one)
+	check.Equal(t, num.ErrOverflow, err)
+	_, err = num.MinInt128.CheckedAdd(minusOne)
+	check.Equal(t, num.ErrOverflow, err)
+	_, err = num.MinInt128.CheckedSub(one)
+	check.Equal(t, num.ErrOverflow, err)
+	_, err = num.MaxInt128.CheckedSub(minusOne)
+	check.Equal(t, num.ErrOverflow, err)
+	v, err = num.Int128From64(-5).CheckedSub(num.Int128From64(7))
+	check.NoError(t, err)
+	check.Equal(t, num.Int128From64(-12), v)
+
+	v, err = num.Int128From64(math.MaxInt64).CheckedMul(num.Int128From64(math.MinInt64))
+	check.NoError(t, err)
+	check.Equal(t, num.Int128From64(math.MaxInt64).Mul(num.Int128From64(math.MinInt64)), v)
+	_, err = num.MaxInt128.CheckedMul(num.Int128From64(2))
+	check.Equal(t, num.ErrOverflow, err)
+	v, err = num.MinInt128.Div(num.Int128From64(2)).CheckedMul(num.Int128From64(2))
+	check.NoError(t, err)
+	check.Equal(t, num.MinInt128, v)
+
+	_, err = num.MinInt128.CheckedDiv(minusOne)
+	check.Equal(t, num.ErrOverflow, err)
+	_, err = num.MinInt128.CheckedNeg()
+	check.Equal(t, num.ErrOverflow, err)
+	v, err = num.MaxInt128.CheckedNeg()
+	check.NoError(t, err)
+	check.Equal(t, num.MinInt128.Inc(), v)
+
+	b, _ := new(big.Int).SetString(maxInt128PlusOneAsStr, 10)
+	_, err = num.CheckedInt128FromBigInt(b)
+	check.Equal(t, num.ErrOverflow, err)
+	b, _ = new(big.Int).SetString(minInt128AsStr, 10)
+	v, err = num.CheckedInt128FromBigInt(b)
+	check.NoError(t, err)
+	check.Equal(t, num.MinInt128, v)
+	b, _ = new(big.Int).SetString(minInt128MinusOneAsStr, 10)
+	_, err = num.CheckedInt128FromBigInt(b)
+	check.Equal(t, num.ErrOverflow, err)
+}
+
 func TestInt128Json(t *testing.T) {
 	for i, one := range table {
 		if !one.IsInt128 {